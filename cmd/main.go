@@ -2,18 +2,24 @@ package main
 
 import (
 	"context"
+	"expvar"
+	appconfig "large_fss/internals/config"
 	"large_fss/internals/constants"
 	v1_handler "large_fss/internals/handlers/v1"
 	middlewares "large_fss/internals/middleware"
+	"large_fss/internals/notification"
 	"large_fss/internals/repository"
+	"large_fss/internals/scanner"
 	"large_fss/internals/services"
 	"large_fss/internals/storage"
+	"large_fss/internals/urlimport"
 	// "path/filepath"
 
 	"fmt"
 	"log"
+	"os"
+	"time"
 
-	// "time"
 	"github.com/aws/aws-sdk-go-v2/config"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -48,6 +54,62 @@ func ConnectAWSClient() *s3.Client {
 	fmt.Println("✅ Connected to AWS!")
 	return s3Client
 }
+// ConnectScanner uses clamd when CLAMD_ADDRESS is set (tcp://host:port or unix:///path),
+// otherwise every upload is treated as clean.
+func ConnectScanner() scanner.Scanner {
+	address := os.Getenv("CLAMD_ADDRESS")
+	if address == "" {
+		log.Println("⚠️ CLAMD_ADDRESS not set, uploads will not be scanned for malware")
+		return scanner.NewNoopScanner()
+	}
+	clamd, err := scanner.NewClamdScanner(address)
+	if err != nil {
+		log.Fatalf("unable to configure clamd scanner, %v", err)
+	}
+	fmt.Println("✅ Using clamd at", address)
+	return clamd
+}
+
+// ConnectNotifier emails notifications through SMTP_HOST when it is set, otherwise they
+// are only logged. A local stand-in such as MailHog works without credentials.
+func ConnectNotifier() notification.Notifier {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("⚠️ SMTP_HOST not set, email notifications will only be logged")
+		return notification.NewLogNotifier()
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "25"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		log.Fatalf("SMTP_FROM is required with SMTP_HOST")
+	}
+	fmt.Println("✅ Sending email through", host+":"+port)
+	return notification.NewSMTPNotifier(notification.SMTPConfig{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	})
+}
+
+// ConnectFetcher builds the client used for url imports from the operator's allowlist.
+func ConnectFetcher(cfg *appconfig.Config) *urlimport.Fetcher {
+	fetcher, err := urlimport.NewFetcher(urlimport.Options{
+		AllowedHosts: cfg.URLImport.AllowedHosts,
+		AllowedCIDRs: cfg.URLImport.AllowedCIDRs,
+		Timeout:      time.Duration(cfg.URLImport.TimeoutSeconds) * time.Second,
+		MaxRedirects: cfg.URLImport.MaxRedirects,
+	})
+	if err != nil {
+		log.Fatalf("unable to configure url import, %v", err)
+	}
+	return fetcher
+}
+
 func main() {
 
 	r := gin.Default()
@@ -78,12 +140,22 @@ func main() {
 
 	filestorage := storage.NewLocalStorage("./Local_storage")
 
+	cfg, err := appconfig.LoadConfig()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	// Forwarded client addresses are spoofable unless they come through a known proxy
+	err = r.SetTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("failed to set trusted proxies: %v", err)
+	}
+
 	jwtservice, err := services.NewJWTService()
 	if err != nil {
 		log.Fatalf("failed to create JWT service: %v", err)
 	}
 	
-	mainservice := services.NewService(jwtservice, postgres, filestorage)
+	mainservice := services.NewService(jwtservice, postgres, filestorage, ConnectScanner(), ConnectNotifier(), ConnectFetcher(cfg), cfg)
 	go mainservice.CleanupService()
 
 	r.GET("/", func(c *gin.Context) {
@@ -92,13 +164,19 @@ func main() {
 	r.GET("/login", func(c *gin.Context) {
 		c.HTML(200, "login_page.html", gin.H{})
 	})
-	r.GET("/share/:transferid", func(c *gin.Context) {
-		transferID := c.Param("transferid")
+	r.GET("/share/:token", func(c *gin.Context) {
 		c.HTML(200, "share.html", gin.H{
-			"TransferID": transferID,
+			"LinkToken": c.Param("token"),
 		})
 	})
 
+	// Download counters and bandwidth, published through expvar for the operator only
+	if metricsToken := os.Getenv("METRICS_TOKEN"); metricsToken != "" {
+		r.GET("/metrics", middlewares.MetricsTokenMiddleware(metricsToken), gin.WrapH(expvar.Handler()))
+	} else {
+		log.Println("⚠️ METRICS_TOKEN not set, /metrics is disabled")
+	}
+
 	r.GET("/view/transfers/", middlewares.AuthorizationMiddleware(jwtservice), func(c *gin.Context) {
 
 		c.HTML(200, "viewtransfers.html", gin.H{})
@@ -108,9 +186,15 @@ func main() {
 	backend.POST("/login", handler.LoginHandler)   //checked
 	backend.POST("/signup", handler.SignupHandler) //checked
 	publicTransferGroup := backend.Group("/transfer")
-	publicTransferGroup.GET("/share/:transferid", handler.GetTransferInfoHandler)
-	publicTransferGroup.GET("/download/file/:fileid", handler.FileDownloaderHandler)
-	publicTransferGroup.GET("/download/transfer/:transferid", handler.TransferDownloaderHandler)
+	publicTransferGroup.GET("/share/:token", handler.GetTransferInfoHandler)
+	publicTransferGroup.POST("/share/:token/unlock", handler.UnlockTransferHandler)
+	publicTransferGroup.POST("/share/:token/code", handler.RequestRecipientCodeHandler)
+	publicTransferGroup.POST("/share/:token/verify", handler.VerifyRecipientCodeHandler)
+	publicTransferGroup.GET("/download/file/:token/:fileid", handler.FileDownloaderHandler)
+	publicTransferGroup.GET("/download/transfer/:token", handler.TransferDownloaderHandler)
+	publicTransferGroup.GET("/download/selection/:token", handler.SelectionDownloaderHandler)
+	publicTransferGroup.GET("/preview/file/:token/:fileid", handler.FilePreviewHandler)
+	publicTransferGroup.GET("/thumbnail/:token/:fileid", handler.ThumbnailHandler)
 
 	protected := backend.Group("/auth") //checked
 	protected.Use(middlewares.AuthorizationMiddleware(mainservice.JwtService))
@@ -118,15 +202,41 @@ func main() {
 	{
 		protectedTransferRoutes := protected.Group("/transfer")
 		protectedTransferRoutes.POST("/new", handler.CreateTransferHandler)
+		protectedTransferRoutes.POST("/append", handler.AppendTransferHandler)
+		protectedTransferRoutes.POST("/import", handler.ImportTransferHandler)
+		protectedTransferRoutes.GET("/import/:transferid", handler.ImportStatusHandler)
 		protectedTransferRoutes.POST("/upload", handler.UploadChunkHandler)
 		protectedTransferRoutes.POST("/cancel", handler.CancelTransferHandler)
 
 		protectedTransferRoutes.POST("/assemble", handler.AssembleFileHandler)
 		protectedTransferRoutes.GET("/successchunk/:transferid", handler.GetAllUploadedChunksIndexHandler)
+		protectedTransferRoutes.GET("/uploads", handler.UploadSessionsHandler)
+		protectedTransferRoutes.GET("/expiry-policy", handler.ExpiryPolicyHandler)
 
 		protectedTransferRoutes.DELETE("/delete/:transferid", handler.DeleteTransferHandler)
+		protectedTransferRoutes.POST("/restore/:transferid", handler.RestoreTransferHandler)
+		protectedTransferRoutes.DELETE("/trash/:transferid", handler.PurgeTransferHandler)
+		protectedTransferRoutes.DELETE("/file/:fileid", handler.DeleteFileHandler)
+		protectedTransferRoutes.PUT("/file/:fileid", handler.RenameFileHandler)
 		protectedTransferRoutes.GET("/all", handler.GetAllTransfersHandler)
 		protectedTransferRoutes.PUT("/update", handler.UpdateTransferHandler)
+		protectedTransferRoutes.GET("/analytics/:transferid", handler.DownloadStatsHandler)
+		protectedTransferRoutes.GET("/analytics/:transferid/events", handler.DownloadEventsHandler)
+		protectedTransferRoutes.GET("/analytics/:transferid/export", handler.ExportDownloadEventsHandler)
+		protectedTransferRoutes.POST("/links/:transferid", handler.CreateLinkHandler)
+		protectedTransferRoutes.GET("/links/:transferid", handler.GetAllLinksHandler)
+		protectedTransferRoutes.PUT("/link/:linkid", handler.UpdateLinkHandler)
+		protectedTransferRoutes.DELETE("/link/:linkid", handler.RevokeLinkHandler)
+		protectedTransferRoutes.POST("/recipients/:transferid", handler.AddRecipientsHandler)
+		protectedTransferRoutes.GET("/recipients/:transferid", handler.GetRecipientsHandler)
+		protectedTransferRoutes.DELETE("/recipient/:recipientid", handler.RemoveRecipientHandler)
+
+		protectedNotificationRoutes := protected.Group("/notifications")
+		protectedNotificationRoutes.GET("", handler.GetNotificationsHandler)
+		protectedNotificationRoutes.POST("/read", handler.MarkAllNotificationsReadHandler)
+		protectedNotificationRoutes.POST("/:notificationid/read", handler.MarkNotificationReadHandler)
+		protectedNotificationRoutes.GET("/preferences", handler.GetNotificationPreferencesHandler)
+		protectedNotificationRoutes.PUT("/preferences", handler.UpdateNotificationPreferencesHandler)
 
 	}
 
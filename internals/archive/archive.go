@@ -0,0 +1,135 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/storage"
+	"path"
+	"strings"
+)
+
+// Format is an archive container recognised from its magic bytes.
+type Format string
+
+const (
+	FormatZip     Format = "zip"
+	FormatTar     Format = "tar"
+	FormatTarGzip Format = "tar.gz"
+	FormatTarZstd Format = "tar.zst"
+	FormatUnknown Format = ""
+)
+
+// Enough leading bytes to see the tar "ustar" magic at offset 257.
+const detectHeaderSize = 262
+
+// Limits bounds what an archive may expand to. Zero disables a limit.
+type Limits struct {
+	MaxTotalSize        int64
+	MaxEntries          int
+	MaxPathDepth        int
+	MaxCompressionRatio float64
+}
+
+// Entries smaller than this are not held to the compression ratio, tiny text
+// files legitimately compress far beyond any sane bomb threshold.
+const ratioCheckMinSize = 1024 * 1024
+
+// Extractor unpacks one archive format from an upload's chunks into storage.
+// Entry headers are validated before each entry is written and byte counts are
+// enforced while copying because headers can lie. On error the caller is
+// expected to remove destPath.
+type Extractor interface {
+	Extract(ctx context.Context, src *ChunkSource, fs storage.Storage, destPath string, limits Limits) error
+}
+
+// DetectFormat recognises an archive from its leading bytes.
+func DetectFormat(header []byte) Format {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return FormatZip
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return FormatTarGzip
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return FormatTarZstd
+	case len(header) >= detectHeaderSize && bytes.Equal(header[257:262], []byte("ustar")):
+		return FormatTar
+	default:
+		return FormatUnknown
+	}
+}
+
+// ExtractorFor returns the extractor of a format.
+func ExtractorFor(format Format) (Extractor, error) {
+	switch format {
+	case FormatZip:
+		return &ZipExtractor{}, nil
+	case FormatTar:
+		return &TarExtractor{}, nil
+	case FormatTarGzip:
+		return &TarExtractor{Decompress: gzipDecompressor}, nil
+	case FormatTarZstd:
+		return &TarExtractor{Decompress: zstdDecompressor}, nil
+	default:
+		return nil, customerrors.ErrUnsupportedArchive
+	}
+}
+
+// DetectExtractor sniffs the upload's format and returns the matching extractor.
+func DetectExtractor(src *ChunkSource) (Extractor, error) {
+	header, err := src.Peek(detectHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	return ExtractorFor(DetectFormat(header))
+}
+
+// Store copies the upload unmodified into a single file at destFile.
+func Store(ctx context.Context, src *ChunkSource, fs storage.Storage, destFile string, maxSize int64) error {
+	if maxSize > 0 && src.Size() > maxSize {
+		return fmt.Errorf("store archive: upload is %d bytes, max %d: %w", src.Size(), maxSize, customerrors.ErrArchiveLimitExceeded)
+	}
+	r := src.Open()
+	defer r.Close()
+	_, err := writeEntry(ctx, fs, destFile, r, src.Size())
+	return err
+}
+
+// checkEntryName rejects entries escaping the destination or nested too deep.
+func checkEntryName(name string, limits Limits) error {
+	trimmed := strings.TrimSuffix(name, "/")
+	cleaned := path.Clean(trimmed)
+	if path.IsAbs(trimmed) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("extract archive: entry %q escapes the destination: %w", name, customerrors.ErrArchiveLimitExceeded)
+	}
+	if depth := strings.Count(cleaned, "/") + 1; limits.MaxPathDepth > 0 && depth > limits.MaxPathDepth {
+		return fmt.Errorf("extract archive: entry %q is %d levels deep, max %d: %w", name, depth, limits.MaxPathDepth, customerrors.ErrArchiveLimitExceeded)
+	}
+	return nil
+}
+
+// writeEntry copies at most maxBytes from r into a new file at fPath and fails if r holds more.
+func writeEntry(ctx context.Context, fs storage.Storage, fPath string, r io.Reader, maxBytes int64) (int64, error) {
+	err := fs.CreateFolder(ctx, path.Dir(fPath))
+	if err != nil {
+		return 0, fmt.Errorf("extract archive:failed to create folder for %s: %w", fPath, err)
+	}
+	writer, err := fs.WriteFile(ctx, fPath)
+	if err != nil {
+		return 0, fmt.Errorf("extract archive:failed to create file %s in storage: %w", fPath, err)
+	}
+	written, err := io.Copy(writer, io.LimitReader(r, maxBytes+1))
+	closeErr := writer.Close()
+	if err != nil {
+		return written, fmt.Errorf("extract archive:failed to copy contents to %s: %w", fPath, err)
+	}
+	if closeErr != nil {
+		return written, fmt.Errorf("extract archive:failed to close %s: %w", fPath, closeErr)
+	}
+	if written > maxBytes {
+		return written, fmt.Errorf("extract archive: %s expanded past %d bytes: %w", fPath, maxBytes, customerrors.ErrArchiveLimitExceeded)
+	}
+	return written, nil
+}
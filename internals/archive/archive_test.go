@@ -0,0 +1,58 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/storage"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// uploadChunk stores data as the only chunk of an upload.
+func uploadChunk(t *testing.T, data []byte) (storage.Storage, *ChunkSource) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "chunks"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "chunks", "0"), data, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fs := storage.NewLocalStorage(dir)
+	src, err := NewChunkSource(context.Background(), fs, "chunks")
+	if err != nil {
+		t.Fatalf("chunk source: %v", err)
+	}
+	return fs, src
+}
+
+func TestCheckEntryName(t *testing.T) {
+	limits := Limits{MaxPathDepth: 3}
+	for _, test := range []struct {
+		name  string
+		valid bool
+	}{
+		{"file.txt", true},
+		{"folder/", true},
+		{"a/b/c.txt", true},
+		{"a/../b.txt", true},
+		{"./file.txt", true},
+		{"../file.txt", false},
+		{"..", false},
+		{"../", false},
+		{"a/../../file.txt", false},
+		{"/etc/passwd", false},
+		{"a/b/c/d.txt", false},
+		{"a/b/c/d/", false},
+	} {
+		err := checkEntryName(test.name, limits)
+		if test.valid && err != nil {
+			t.Errorf("%q: expected to be allowed, got %v", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, customerrors.ErrArchiveLimitExceeded) {
+			t.Errorf("%q: expected ErrArchiveLimitExceeded, got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"large_fss/internals/storage"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ChunkSource reads the chunk files of an upload, ordered by index, as one
+// continuous archive without first merging them into a single file.
+type ChunkSource struct {
+	ctx     context.Context
+	storage storage.Storage
+	paths   []string
+	offsets []int64 // Start offset of each chunk within the upload
+	size    int64
+}
+
+// NewChunkSource lists the chunk files stored under chunkPath.
+func NewChunkSource(ctx context.Context, fs storage.Storage, chunkPath string) (*ChunkSource, error) {
+	files, err := fs.ReadFolder(ctx, chunkPath)
+	if err != nil {
+		return nil, fmt.Errorf("chunk source:failed to read chunk directory: %w", err)
+	}
+
+	chunkFiles := files[:0]
+	for _, file := range files {
+		if !file.IsDir {
+			chunkFiles = append(chunkFiles, file)
+		}
+	}
+	// Sort chunk files numerically by filename
+	sort.Slice(chunkFiles, func(i, j int) bool {
+		iInt, _ := strconv.Atoi(chunkFiles[i].Name)
+		jInt, _ := strconv.Atoi(chunkFiles[j].Name)
+		return iInt < jInt
+	})
+
+	src := &ChunkSource{ctx: ctx, storage: fs}
+	for _, chunk := range chunkFiles {
+		src.paths = append(src.paths, filepath.Join(chunkPath, chunk.Name))
+		src.offsets = append(src.offsets, src.size)
+		src.size += chunk.Size
+	}
+	return src, nil
+}
+
+// Size is the total upload size in bytes.
+func (s *ChunkSource) Size() int64 {
+	return s.size
+}
+
+// Open returns a sequential reader over all chunks, opening one chunk at a time.
+func (s *ChunkSource) Open() io.ReadCloser {
+	return &chunkReader{src: s}
+}
+
+// Peek returns up to n leading bytes of the upload.
+func (s *ChunkSource) Peek(n int) ([]byte, error) {
+	r := s.Open()
+	defer r.Close()
+
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("chunk source:failed to read header: %w", err)
+	}
+	return buf[:read], nil
+}
+
+// ReaderAt gives random access to the upload. Chunks read straight from storage
+// when it supports ReadAt (local disk), otherwise the upload is spooled to a
+// local temp file. The returned closer releases whichever was used.
+func (s *ChunkSource) ReaderAt() (io.ReaderAt, io.Closer, error) {
+	if len(s.paths) > 0 {
+		first, err := s.storage.ReadFile(s.ctx, s.paths[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("chunk source:failed to open chunk: %w", err)
+		}
+		if _, ok := first.(io.ReaderAt); ok {
+			ra := &chunkReaderAt{src: s, index: 0, cur: first}
+			return ra, ra, nil
+		}
+		first.Close()
+	}
+
+	spool, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("chunk source:failed to create spool file: %w", err)
+	}
+	closer := spoolCloser{spool}
+	r := s.Open()
+	defer r.Close()
+	if _, err := io.Copy(spool, r); err != nil {
+		closer.Close()
+		return nil, nil, fmt.Errorf("chunk source:failed to spool upload: %w", err)
+	}
+	return spool, closer, nil
+}
+
+type chunkReader struct {
+	src  *ChunkSource
+	next int
+	cur  io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if r.next >= len(r.src.paths) {
+				return 0, io.EOF
+			}
+			cur, err := r.src.storage.ReadFile(r.src.ctx, r.src.paths[r.next])
+			if err != nil {
+				return 0, fmt.Errorf("chunk source:failed to open chunk %s: %w", r.src.paths[r.next], err)
+			}
+			r.cur = cur
+			r.next++
+		}
+		n, err := r.cur.Read(p)
+		if errors.Is(err, io.EOF) {
+			r.cur.Close()
+			r.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+// chunkReaderAt keeps only the most recently used chunk open, archive readers
+// mostly move forward so this avoids holding one descriptor per chunk.
+type chunkReaderAt struct {
+	mu    sync.Mutex
+	src   *ChunkSource
+	index int
+	cur   io.ReadCloser
+}
+
+func (r *chunkReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	total := 0
+	for len(p) > 0 {
+		if off >= r.src.size {
+			return total, io.EOF
+		}
+		// Last chunk starting at or before off
+		index := sort.Search(len(r.src.offsets), func(i int) bool { return r.src.offsets[i] > off }) - 1
+		if err := r.use(index); err != nil {
+			return total, err
+		}
+		chunkEnd := r.src.size
+		if index+1 < len(r.src.offsets) {
+			chunkEnd = r.src.offsets[index+1]
+		}
+		want := p
+		if int64(len(want)) > chunkEnd-off {
+			want = want[:chunkEnd-off]
+		}
+		n, err := r.cur.(io.ReaderAt).ReadAt(want, off-r.src.offsets[index])
+		total += n
+		off += int64(n)
+		p = p[n:]
+		if err != nil && !(errors.Is(err, io.EOF) && n == len(want)) {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (r *chunkReaderAt) use(index int) error {
+	if r.cur != nil && r.index == index {
+		return nil
+	}
+	if r.cur != nil {
+		r.cur.Close()
+		r.cur = nil
+	}
+	cur, err := r.src.storage.ReadFile(r.src.ctx, r.src.paths[index])
+	if err != nil {
+		return fmt.Errorf("chunk source:failed to open chunk %s: %w", r.src.paths[index], err)
+	}
+	if _, ok := cur.(io.ReaderAt); !ok {
+		cur.Close()
+		return fmt.Errorf("chunk source: chunk %s does not support random access", r.src.paths[index])
+	}
+	r.cur = cur
+	r.index = index
+	return nil
+}
+
+func (r *chunkReaderAt) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+type spoolCloser struct {
+	file *os.File
+}
+
+func (s spoolCloser) Close() error {
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
@@ -0,0 +1,130 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/storage"
+	"path"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TarExtractor streams a tar archive, optionally compressed, straight from the chunks.
+type TarExtractor struct {
+	Decompress func(r io.Reader) (io.ReadCloser, error) // nil for a plain tar
+}
+
+func gzipDecompressor(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func zstdDecompressor(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+func (t *TarExtractor) Extract(ctx context.Context, src *ChunkSource, fs storage.Storage, destPath string, limits Limits) error {
+	stream := src.Open()
+	defer stream.Close()
+
+	compressed := &countingReader{r: stream}
+	var r io.Reader = compressed
+	if t.Decompress != nil {
+		decompressed, err := t.Decompress(compressed)
+		if err != nil {
+			return fmt.Errorf("untar:failed to open compressed stream: %w", err)
+		}
+		defer decompressed.Close()
+		r = decompressed
+		// Per entry compressed sizes are unknown in a compressed tar, so the ratio is held over
+		// the whole stream, while it is read so a single entry can't expand far past it
+		if limits.MaxCompressionRatio > 0 {
+			r = &ratioReader{r: decompressed, compressed: compressed, maxRatio: limits.MaxCompressionRatio}
+		}
+	}
+	tarReader := tar.NewReader(r)
+
+	var extracted int64
+	entries := 0
+	for {
+		hdr, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		// A compressed upload that doesn't start with a tar header is some other file, not a broken archive
+		if entries == 0 && (errors.Is(err, tar.ErrHeader) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			return fmt.Errorf("untar: compressed stream is not a tar: %w", customerrors.ErrUnsupportedArchive)
+		}
+		if err != nil {
+			return fmt.Errorf("untar:failed to read entry header: %w", err)
+		}
+
+		// A stream has no central directory, so each header is checked before its entry
+		entries++
+		if limits.MaxEntries > 0 && entries > limits.MaxEntries {
+			return fmt.Errorf("untar: more than %d entries: %w", limits.MaxEntries, customerrors.ErrArchiveLimitExceeded)
+		}
+		if err := checkEntryName(hdr.Name, limits); err != nil {
+			return err
+		}
+		fPath := path.Join(destPath, hdr.Name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err := fs.CreateFolder(ctx, fPath)
+			if err != nil {
+				return fmt.Errorf("untar:failed to create folder %s: %w", fPath, err)
+			}
+		case tar.TypeReg:
+			budget := hdr.Size
+			if limits.MaxTotalSize > 0 && extracted+hdr.Size > limits.MaxTotalSize {
+				return fmt.Errorf("untar: uncompressed size exceeds %d bytes: %w", limits.MaxTotalSize, customerrors.ErrArchiveLimitExceeded)
+			}
+			written, err := writeEntry(ctx, fs, fPath, tarReader, budget)
+			if err != nil {
+				return err
+			}
+			extracted += written
+		default:
+			// Links, devices and other special entries are never extracted
+		}
+	}
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ratioReader fails once more than maxRatio times the compressed bytes read so far
+// came out of the decompressor.
+type ratioReader struct {
+	r          io.Reader
+	compressed *countingReader
+	maxRatio   float64
+	n          int64
+}
+
+func (r *ratioReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.n >= ratioCheckMinSize && float64(r.n) > float64(r.compressed.n)*r.maxRatio {
+		return n, fmt.Errorf("untar: compression ratio exceeds %.0f: %w", r.maxRatio, customerrors.ErrArchiveLimitExceeded)
+	}
+	return n, err
+}
@@ -0,0 +1,89 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/storage"
+	"strings"
+	"testing"
+)
+
+// gzipChunk stores content, gzipped, as the only chunk of an upload.
+func gzipChunk(t *testing.T, content []byte) (storage.Storage, *ChunkSource) {
+	t.Helper()
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(content)
+	gz.Close()
+	return uploadChunk(t, compressed.Bytes())
+}
+
+func TestTarExtractorRejectsGzipOfOtherFiles(t *testing.T) {
+	for name, content := range map[string]string{
+		"short": "just a log line\n",
+		"long":  strings.Repeat("just a log line\n", 100),
+	} {
+		fs, src := gzipChunk(t, []byte(content))
+		extractor, err := ExtractorFor(FormatTarGzip)
+		if err != nil {
+			t.Fatalf("extractor: %v", err)
+		}
+		err = extractor.Extract(context.Background(), src, fs, "out", Limits{})
+		if !errors.Is(err, customerrors.ErrUnsupportedArchive) {
+			t.Errorf("%s: expected ErrUnsupportedArchive, got %v", name, err)
+		}
+	}
+}
+
+func TestTarExtractorUnpacksTarGzip(t *testing.T) {
+	var archived bytes.Buffer
+	tw := tar.NewWriter(&archived)
+	tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0o644, Size: 5, Typeflag: tar.TypeReg})
+	tw.Write([]byte("hello"))
+	tw.Close()
+
+	fs, src := gzipChunk(t, archived.Bytes())
+	extractor, _ := ExtractorFor(FormatTarGzip)
+	if err := extractor.Extract(context.Background(), src, fs, "out", Limits{}); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	rc, err := fs.ReadFile(context.Background(), "out/a.txt")
+	if err != nil {
+		t.Fatalf("open extracted file: %v", err)
+	}
+	defer rc.Close()
+	var content bytes.Buffer
+	content.ReadFrom(rc)
+	if content.String() != "hello" {
+		t.Fatalf("extracted %q", content.String())
+	}
+}
+
+func TestTarExtractorStopsSingleEntryBombsWhileWriting(t *testing.T) {
+	const entrySize = 32 * 1024 * 1024
+	var archived bytes.Buffer
+	tw := tar.NewWriter(&archived)
+	tw.WriteHeader(&tar.Header{Name: "bomb", Mode: 0o644, Size: entrySize, Typeflag: tar.TypeReg})
+	tw.Write(make([]byte, entrySize))
+	tw.Close()
+
+	fs, src := gzipChunk(t, archived.Bytes())
+	extractor, _ := ExtractorFor(FormatTarGzip)
+	limits := Limits{MaxCompressionRatio: 100}
+	err := extractor.Extract(context.Background(), src, fs, "out", limits)
+	if !errors.Is(err, customerrors.ErrArchiveLimitExceeded) {
+		t.Fatalf("expected ErrArchiveLimitExceeded, got %v", err)
+	}
+	// Stopped about where the ratio was crossed, not after the whole entry was written
+	info, err := fs.Stat(context.Background(), "out/bomb")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Size > 2*ratioCheckMinSize {
+		t.Fatalf("wrote %d bytes of the bomb before stopping", info.Size)
+	}
+}
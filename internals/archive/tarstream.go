@@ -0,0 +1,105 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"large_fss/internals/storage"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const tarBlockSize = 512
+
+// TarStream writes a tar, optionally compressed, straight to a writer. Files get
+// mode 0644 and folders 0755 so unpacking on Unix gives sensible permissions.
+type TarStream struct {
+	entries  []Entry
+	compress func(w io.Writer) (io.WriteCloser, error) // nil for a plain tar
+}
+
+func gzipCompressor(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func zstdCompressor(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func NewTarStream(entries []Entry, compress func(w io.Writer) (io.WriteCloser, error)) *TarStream {
+	return &TarStream{entries: entries, compress: compress}
+}
+
+func (e Entry) tarHeader() *tar.Header {
+	hdr := &tar.Header{
+		Name: e.Name,
+		// Whole seconds keep the header in plain ustar for most entries
+		ModTime: e.Modified.UTC().Truncate(time.Second),
+	}
+	if e.isDir() {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Mode = 0755
+		return hdr
+	}
+	hdr.Typeflag = tar.TypeReg
+	hdr.Mode = 0644
+	hdr.Size = e.Size
+	return hdr
+}
+
+// Size returns the exact length of a plain tar, compressed tars are unknown up front.
+func (t *TarStream) Size() (int64, bool) {
+	if t.compress != nil {
+		return 0, false
+	}
+	var size int64
+	for _, entry := range t.entries {
+		// Long names add extension headers, so the header is measured by writing it
+		cw := &countingWriter{w: io.Discard}
+		if err := tar.NewWriter(cw).WriteHeader(entry.tarHeader()); err != nil {
+			return 0, false
+		}
+		size += cw.n
+		if !entry.isDir() {
+			size += (entry.Size + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+		}
+	}
+	// End of archive marker
+	return size + 2*tarBlockSize, true
+}
+
+func (t *TarStream) WriteTo(ctx context.Context, fs storage.Storage, w io.Writer) error {
+	dest := w
+	var compressor io.WriteCloser
+	if t.compress != nil {
+		var err error
+		compressor, err = t.compress(w)
+		if err != nil {
+			return fmt.Errorf("tar stream: failed to start compression: %w", err)
+		}
+		dest = compressor
+	}
+
+	tarWriter := tar.NewWriter(dest)
+	for _, entry := range t.entries {
+		if err := tarWriter.WriteHeader(entry.tarHeader()); err != nil {
+			return fmt.Errorf("tar stream: failed to write header of %s: %w", entry.Name, err)
+		}
+		if entry.isDir() {
+			continue
+		}
+		if _, err := copyEntry(ctx, fs, tarWriter, entry); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if compressor != nil {
+		return compressor.Close()
+	}
+	return nil
+}
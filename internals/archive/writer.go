@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/storage"
+	"strings"
+)
+
+// Writer streams stored entries as one download archive.
+type Writer interface {
+	// Size returns the exact archive length, or false when it is only known once written.
+	Size() (int64, bool)
+	// WriteTo streams the archive. Content that no longer matches its recorded size
+	// or checksum aborts the stream rather than producing a corrupt archive.
+	WriteTo(ctx context.Context, fs storage.Storage, w io.Writer) error
+}
+
+// ParseFormat reads a download format as given by a client, an empty string means zip.
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(name))) {
+	case "", FormatZip:
+		return FormatZip, nil
+	case FormatTar:
+		return FormatTar, nil
+	case FormatTarGzip, "tgz":
+		return FormatTarGzip, nil
+	case FormatTarZstd, "tzst":
+		return FormatTarZstd, nil
+	default:
+		return FormatUnknown, customerrors.ErrUnsupportedFormat
+	}
+}
+
+// NewWriter returns the writer producing the format from the entries.
+func NewWriter(format Format, entries []Entry) (Writer, error) {
+	switch format {
+	case FormatZip:
+		return NewZipStream(entries), nil
+	case FormatTar:
+		return NewTarStream(entries, nil), nil
+	case FormatTarGzip:
+		return NewTarStream(entries, gzipCompressor), nil
+	case FormatTarZstd:
+		return NewTarStream(entries, zstdCompressor), nil
+	default:
+		return nil, customerrors.ErrUnsupportedFormat
+	}
+}
+
+// ContentType is the media type a download of the format is served with.
+func ContentType(format Format) string {
+	switch format {
+	case FormatZip:
+		return "application/zip"
+	case FormatTar:
+		return "application/x-tar"
+	case FormatTarGzip:
+		return "application/gzip"
+	case FormatTarZstd:
+		return "application/zstd"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Extension is the file name suffix of the format, including the leading dot.
+func Extension(format Format) string {
+	if format == FormatUnknown {
+		return ""
+	}
+	return "." + string(format)
+}
+
+// copyEntry writes exactly the entry's size from storage and returns its checksum,
+// after checking it against the recorded one when there is one.
+func copyEntry(ctx context.Context, fs storage.Storage, w io.Writer, entry Entry) (uint32, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	reader, err := fs.ReadFile(ctx, entry.Path)
+	if err != nil {
+		return 0, fmt.Errorf("archive stream: failed to open %s: %w", entry.Path, err)
+	}
+	defer reader.Close()
+
+	hasher := crc32.NewIEEE()
+	n, err := io.CopyN(io.MultiWriter(w, hasher), reader, entry.Size)
+	if err != nil {
+		return 0, fmt.Errorf("archive stream: failed to copy %s after %d bytes: %w", entry.Path, n, err)
+	}
+	if !entry.NoCRC32 && hasher.Sum32() != entry.CRC32 {
+		return 0, fmt.Errorf("archive stream: content of %s changed since its checksum was recorded", entry.Path)
+	}
+	return hasher.Sum32(), nil
+}
@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/storage"
+	"path"
+)
+
+// ZipExtractor unpacks zip archives. Zip keeps its directory at the end of the
+// file, so it reads the chunks through random access rather than as a stream.
+type ZipExtractor struct{}
+
+func (z *ZipExtractor) Extract(ctx context.Context, src *ChunkSource, fs storage.Storage, destPath string, limits Limits) error {
+	readerAt, closer, err := src.ReaderAt()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	zipReader, err := zip.NewReader(readerAt, src.Size())
+	if err != nil {
+		return fmt.Errorf("unzip:failed to create zip reader: %w", err)
+	}
+
+	// The whole central directory is checked before anything is written
+	err = checkZipHeaders(zipReader.File, limits)
+	if err != nil {
+		return err
+	}
+
+	var extracted int64
+	for _, f := range zipReader.File {
+		fPath := path.Join(destPath, f.Name)
+
+		if f.FileInfo().IsDir() {
+			err := fs.CreateFolder(ctx, fPath)
+			if err != nil {
+				return fmt.Errorf("unzip:failed to create folder %s: %w", fPath, err)
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue // Symlinks and other special entries are never extracted
+		}
+
+		fileInZip, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("unzip:failed to open file %s in zip: %w", f.Name, err)
+		}
+		// Never more than the header declared or the limits allow
+		written, err := writeEntry(ctx, fs, fPath, fileInZip, zipEntryBudget(f, limits, extracted))
+		fileInZip.Close()
+		if err != nil {
+			return err
+		}
+		extracted += written
+	}
+	return nil
+}
+
+// checkZipHeaders rejects archives whose central directory already breaks the limits.
+func checkZipHeaders(files []*zip.File, limits Limits) error {
+	if limits.MaxEntries > 0 && len(files) > limits.MaxEntries {
+		return fmt.Errorf("unzip: %d entries, max %d: %w", len(files), limits.MaxEntries, customerrors.ErrArchiveLimitExceeded)
+	}
+
+	var total uint64
+	for _, f := range files {
+		if err := checkEntryName(f.Name, limits); err != nil {
+			return err
+		}
+
+		total += f.UncompressedSize64
+		if limits.MaxTotalSize > 0 && total > uint64(limits.MaxTotalSize) {
+			return fmt.Errorf("unzip: uncompressed size exceeds %d bytes: %w", limits.MaxTotalSize, customerrors.ErrArchiveLimitExceeded)
+		}
+
+		if limits.MaxCompressionRatio > 0 && f.UncompressedSize64 >= ratioCheckMinSize {
+			if f.CompressedSize64 == 0 || float64(f.UncompressedSize64)/float64(f.CompressedSize64) > limits.MaxCompressionRatio {
+				return fmt.Errorf("unzip: entry %q compression ratio exceeds %.0f: %w", f.Name, limits.MaxCompressionRatio, customerrors.ErrArchiveLimitExceeded)
+			}
+		}
+	}
+	return nil
+}
+
+// zipEntryBudget is the most an entry may expand to: its declared size, what is
+// left of the total budget, and its compressed size times the allowed ratio.
+func zipEntryBudget(f *zip.File, limits Limits, extracted int64) int64 {
+	budget := int64(f.UncompressedSize64)
+	if limits.MaxTotalSize > 0 && limits.MaxTotalSize-extracted < budget {
+		budget = limits.MaxTotalSize - extracted
+	}
+	if limits.MaxCompressionRatio > 0 && budget >= ratioCheckMinSize {
+		byRatio := int64(float64(f.CompressedSize64) * limits.MaxCompressionRatio)
+		if byRatio < ratioCheckMinSize {
+			byRatio = ratioCheckMinSize
+		}
+		if byRatio < budget {
+			budget = byRatio
+		}
+	}
+	return budget
+}
@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"hash/crc32"
+	customerrors "large_fss/internals/customErrors"
+	"testing"
+)
+
+func zipHeader(name string, uncompressed uint64, compressed uint64) *zip.File {
+	return &zip.File{FileHeader: zip.FileHeader{Name: name, UncompressedSize64: uncompressed, CompressedSize64: compressed}}
+}
+
+func TestCheckZipHeaders(t *testing.T) {
+	const mb = 1024 * 1024
+	limits := Limits{MaxTotalSize: 10 * mb, MaxEntries: 3, MaxPathDepth: 2, MaxCompressionRatio: 100}
+	for _, test := range []struct {
+		name  string
+		files []*zip.File
+		valid bool
+	}{
+		{"within limits", []*zip.File{zipHeader("a.txt", 2*mb, mb), zipHeader("b/c.txt", 3*mb, 2*mb)}, true},
+		{"small files compress freely", []*zip.File{zipHeader("a.txt", 64*1024, 10)}, true},
+		{"too many entries", []*zip.File{zipHeader("a", 1, 1), zipHeader("b", 1, 1), zipHeader("c", 1, 1), zipHeader("d", 1, 1)}, false},
+		{"total size", []*zip.File{zipHeader("a.txt", 6*mb, 6*mb), zipHeader("b.txt", 6*mb, 6*mb)}, false},
+		{"compression ratio", []*zip.File{zipHeader("bomb", 5*mb, 10*1024)}, false},
+		{"no compressed size", []*zip.File{zipHeader("bomb", 5*mb, 0)}, false},
+		{"traversal", []*zip.File{zipHeader("../evil", 1, 1)}, false},
+		{"absolute", []*zip.File{zipHeader("/etc/evil", 1, 1)}, false},
+		{"too deep", []*zip.File{zipHeader("a/b/c.txt", 1, 1)}, false},
+	} {
+		err := checkZipHeaders(test.files, limits)
+		if test.valid && err != nil {
+			t.Errorf("%s: expected to be allowed, got %v", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, customerrors.ErrArchiveLimitExceeded) {
+			t.Errorf("%s: expected ErrArchiveLimitExceeded, got %v", test.name, err)
+		}
+	}
+}
+
+func TestZipEntryBudget(t *testing.T) {
+	const mb = 1024 * 1024
+	for _, test := range []struct {
+		name      string
+		file      *zip.File
+		limits    Limits
+		extracted int64
+		want      int64
+	}{
+		{"declared size", zipHeader("a", 3*mb, 2*mb), Limits{}, 0, 3 * mb},
+		{"left of the total", zipHeader("a", 3*mb, 2*mb), Limits{MaxTotalSize: 4 * mb}, 2 * mb, 2 * mb},
+		{"compressed times the ratio", zipHeader("a", 50*mb, 100*1024), Limits{MaxCompressionRatio: 100}, 0, 100 * 100 * 1024},
+		{"never below the ratio threshold", zipHeader("a", 50*mb, 10), Limits{MaxCompressionRatio: 100}, 0, ratioCheckMinSize},
+	} {
+		if got := zipEntryBudget(test.file, test.limits, test.extracted); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestZipExtractorStopsEntriesPastTheirDeclaredSize(t *testing.T) {
+	content := make([]byte, 4*1024*1024)
+	var deflated bytes.Buffer
+	fw, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	fw.Write(content)
+	fw.Close()
+
+	// The header claims a tiny file, the data expands to megabytes
+	var archived bytes.Buffer
+	zw := zip.NewWriter(&archived)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "liar.txt",
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(content),
+		CompressedSize64:   uint64(deflated.Len()),
+		UncompressedSize64: 100,
+	})
+	if err != nil {
+		t.Fatalf("create raw: %v", err)
+	}
+	w.Write(deflated.Bytes())
+	zw.Close()
+
+	fs, src := uploadChunk(t, archived.Bytes())
+	err = (&ZipExtractor{}).Extract(context.Background(), src, fs, "out", Limits{})
+	if err == nil {
+		t.Fatal("expected the lying entry to be refused")
+	}
+	info, err := fs.Stat(context.Background(), "out/liar.txt")
+	if err == nil && info.Size > 101 {
+		t.Fatalf("wrote %d bytes of an entry declared as 100", info.Size)
+	}
+}
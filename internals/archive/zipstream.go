@@ -0,0 +1,309 @@
+package archive
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"large_fss/internals/storage"
+	"strings"
+	"time"
+)
+
+const (
+	zipLocalHeaderSig     = 0x04034b50
+	zipCentralHeaderSig   = 0x02014b50
+	zipDataDescriptorSig  = 0x08074b50
+	zipEndSig             = 0x06054b50
+	zip64EndSig           = 0x06064b50
+	zip64LocatorSig       = 0x07064b50
+	zipLocalHeaderLen     = 30
+	zipCentralHeaderLen   = 46
+	zipEndLen             = 22
+	zip64EndLen           = 56
+	zip64LocatorLen       = 20
+	zipVersion20          = 20
+	zipVersion45          = 45
+	zipCreatorUnix        = 3 << 8
+	zipFlagDataDescriptor = 0x8
+	zipFlagUTF8           = 0x800
+	zipMethodStore        = 0
+	zip64ExtraID          = 0x0001
+	uint16max             = 0xffff
+	uint32max             = 0xffffffff
+)
+
+// Entry is a stored file or folder written into a download archive.
+type Entry struct {
+	Name     string // Slash separated path inside the archive, folders end with "/"
+	Path     string // Storage path of the content, empty for folders
+	Size     int64
+	CRC32    uint32 // Checksum of the content, zip entries carry it in their header
+	Modified time.Time
+	NoCRC32  bool // The checksum isn't known up front, zip entries carry it after their content
+}
+
+func (e Entry) isDir() bool {
+	return strings.HasSuffix(e.Name, "/")
+}
+
+// zipRecord is an entry placed in the archive.
+type zipRecord struct {
+	entry  Entry
+	offset uint64
+}
+
+// descriptor reports whether the checksum follows the content in a data descriptor.
+func (r *zipRecord) descriptor() bool {
+	return r.entry.NoCRC32 && !r.entry.isDir()
+}
+
+func (r *zipRecord) flags() uint16 {
+	if r.descriptor() {
+		return zipFlagUTF8 | zipFlagDataDescriptor
+	}
+	return zipFlagUTF8
+}
+
+func (r *zipRecord) localZip64() bool {
+	return uint64(r.entry.Size) >= uint32max
+}
+
+// ZipStream writes a zip straight to a writer, without seeking or temp files.
+// Entries are stored uncompressed with their known size, so the archive length is
+// always known up front. The output only depends on the entries, downloads of one
+// transfer are identical.
+type ZipStream struct {
+	records []*zipRecord
+}
+
+func NewZipStream(entries []Entry) *ZipStream {
+	z := &ZipStream{}
+	for _, entry := range entries {
+		z.records = append(z.records, &zipRecord{entry: entry})
+	}
+	return z
+}
+
+// Size returns the exact archive length.
+func (z *ZipStream) Size() (int64, bool) {
+	var offset uint64
+	for _, record := range z.records {
+		record.offset = offset
+		offset += uint64(len(record.localHeader())) + uint64(record.entry.Size)
+		if record.descriptor() {
+			offset += uint64(len(record.dataDescriptor()))
+		}
+	}
+	return int64(offset) + int64(len(z.directory(offset))), true
+}
+
+func (z *ZipStream) WriteTo(ctx context.Context, fs storage.Storage, w io.Writer) error {
+	cw := &countingWriter{w: w}
+	for _, record := range z.records {
+		record.offset = uint64(cw.n)
+		if _, err := cw.Write(record.localHeader()); err != nil {
+			return err
+		}
+		if record.entry.isDir() {
+			continue
+		}
+		if err := z.writeContent(ctx, fs, cw, record); err != nil {
+			return err
+		}
+	}
+	_, err := cw.Write(z.directory(uint64(cw.n)))
+	return err
+}
+
+func (z *ZipStream) writeContent(ctx context.Context, fs storage.Storage, cw *countingWriter, record *zipRecord) error {
+	crc, err := copyEntry(ctx, fs, cw, record.entry)
+	if err != nil {
+		return err
+	}
+	if !record.descriptor() {
+		return nil
+	}
+	record.entry.CRC32 = crc
+	_, err = cw.Write(record.dataDescriptor())
+	return err
+}
+
+func (r *zipRecord) localHeader() []byte {
+	name := r.entry.Name
+	buf := make([]byte, 0, zipLocalHeaderLen+len(name)+20)
+	version := uint16(zipVersion20)
+	if r.localZip64() {
+		version = zipVersion45
+	}
+	dosDate, dosTime := msDosTime(r.entry.Modified)
+
+	buf = binary.LittleEndian.AppendUint32(buf, zipLocalHeaderSig)
+	buf = binary.LittleEndian.AppendUint16(buf, version)
+	buf = binary.LittleEndian.AppendUint16(buf, r.flags())
+	buf = binary.LittleEndian.AppendUint16(buf, zipMethodStore)
+	buf = binary.LittleEndian.AppendUint16(buf, dosTime)
+	buf = binary.LittleEndian.AppendUint16(buf, dosDate)
+
+	var extra []byte
+	switch {
+	case r.descriptor():
+		// Checksum and sizes follow the data in the descriptor
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		if r.localZip64() {
+			buf = binary.LittleEndian.AppendUint32(buf, uint32max)
+			buf = binary.LittleEndian.AppendUint32(buf, uint32max)
+			extra = zip64Extra(0, 0)
+		} else {
+			buf = binary.LittleEndian.AppendUint32(buf, 0)
+			buf = binary.LittleEndian.AppendUint32(buf, 0)
+		}
+	case r.localZip64():
+		buf = binary.LittleEndian.AppendUint32(buf, r.entry.CRC32)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32max)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32max)
+		extra = zip64Extra(uint64(r.entry.Size), uint64(r.entry.Size))
+	default:
+		buf = binary.LittleEndian.AppendUint32(buf, r.entry.CRC32)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(r.entry.Size))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(r.entry.Size))
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(name)))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(extra)))
+	buf = append(buf, name...)
+	return append(buf, extra...)
+}
+
+func (r *zipRecord) dataDescriptor() []byte {
+	buf := make([]byte, 0, 24)
+	buf = binary.LittleEndian.AppendUint32(buf, zipDataDescriptorSig)
+	buf = binary.LittleEndian.AppendUint32(buf, r.entry.CRC32)
+	if r.localZip64() {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(r.entry.Size))
+		return binary.LittleEndian.AppendUint64(buf, uint64(r.entry.Size))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(r.entry.Size))
+	return binary.LittleEndian.AppendUint32(buf, uint32(r.entry.Size))
+}
+
+// centralHeader carries the final sizes, with a zip64 extra for every field that doesn't fit.
+func (r *zipRecord) centralHeader() ([]byte, bool) {
+	name := r.entry.Name
+	size := uint64(r.entry.Size)
+	var zip64Fields []uint64
+	if size >= uint32max {
+		// Content is stored, its compressed size is the same
+		zip64Fields = append(zip64Fields, size, size)
+	}
+	if r.offset >= uint32max {
+		zip64Fields = append(zip64Fields, r.offset)
+	}
+	var extra []byte
+	version := uint16(zipVersion20)
+	if len(zip64Fields) > 0 || r.localZip64() {
+		version = zipVersion45
+	}
+	if len(zip64Fields) > 0 {
+		extra = binary.LittleEndian.AppendUint16(extra, zip64ExtraID)
+		extra = binary.LittleEndian.AppendUint16(extra, uint16(8*len(zip64Fields)))
+		for _, field := range zip64Fields {
+			extra = binary.LittleEndian.AppendUint64(extra, field)
+		}
+	}
+	mode := uint32(0100644)
+	if r.entry.isDir() {
+		mode = 040755
+	}
+	dosDate, dosTime := msDosTime(r.entry.Modified)
+
+	buf := make([]byte, 0, zipCentralHeaderLen+len(name)+len(extra))
+	buf = binary.LittleEndian.AppendUint32(buf, zipCentralHeaderSig)
+	buf = binary.LittleEndian.AppendUint16(buf, zipCreatorUnix|version)
+	buf = binary.LittleEndian.AppendUint16(buf, version)
+	buf = binary.LittleEndian.AppendUint16(buf, r.flags())
+	buf = binary.LittleEndian.AppendUint16(buf, zipMethodStore)
+	buf = binary.LittleEndian.AppendUint16(buf, dosTime)
+	buf = binary.LittleEndian.AppendUint16(buf, dosDate)
+	buf = binary.LittleEndian.AppendUint32(buf, r.entry.CRC32)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(min(size, uint32max)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(min(size, uint32max)))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(name)))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(extra)))
+	buf = binary.LittleEndian.AppendUint16(buf, 0) // comment length
+	buf = binary.LittleEndian.AppendUint16(buf, 0) // disk number
+	buf = binary.LittleEndian.AppendUint16(buf, 0) // internal attributes
+	buf = binary.LittleEndian.AppendUint32(buf, mode<<16)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(min(r.offset, uint32max)))
+	buf = append(buf, name...)
+	return append(buf, extra...), version == zipVersion45
+}
+
+// directory returns the central directory and end records for a directory starting at start.
+func (z *ZipStream) directory(start uint64) []byte {
+	var buf []byte
+	usedZip64 := false
+	for _, record := range z.records {
+		header, zip64 := record.centralHeader()
+		usedZip64 = usedZip64 || zip64
+		buf = append(buf, header...)
+	}
+	size := uint64(len(buf))
+	records := uint64(len(z.records))
+	end := start + size
+
+	if usedZip64 || records >= uint16max || size >= uint32max || start >= uint32max {
+		buf = binary.LittleEndian.AppendUint32(buf, zip64EndSig)
+		buf = binary.LittleEndian.AppendUint64(buf, zip64EndLen-12)
+		buf = binary.LittleEndian.AppendUint16(buf, zipCreatorUnix|zipVersion45)
+		buf = binary.LittleEndian.AppendUint16(buf, zipVersion45)
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		buf = binary.LittleEndian.AppendUint64(buf, records)
+		buf = binary.LittleEndian.AppendUint64(buf, records)
+		buf = binary.LittleEndian.AppendUint64(buf, size)
+		buf = binary.LittleEndian.AppendUint64(buf, start)
+
+		buf = binary.LittleEndian.AppendUint32(buf, zip64LocatorSig)
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		buf = binary.LittleEndian.AppendUint64(buf, end)
+		buf = binary.LittleEndian.AppendUint32(buf, 1)
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, zipEndSig)
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(min(records, uint16max)))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(min(records, uint16max)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(min(size, uint32max)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(min(start, uint32max)))
+	return binary.LittleEndian.AppendUint16(buf, 0)
+}
+
+func zip64Extra(uncompressed, compressed uint64) []byte {
+	extra := make([]byte, 0, 20)
+	extra = binary.LittleEndian.AppendUint16(extra, zip64ExtraID)
+	extra = binary.LittleEndian.AppendUint16(extra, 16)
+	extra = binary.LittleEndian.AppendUint64(extra, uncompressed)
+	return binary.LittleEndian.AppendUint64(extra, compressed)
+}
+
+// msDosTime encodes t in UTC, zip dates before 1980 can't be represented.
+func msDosTime(t time.Time) (uint16, uint16) {
+	t = t.UTC()
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
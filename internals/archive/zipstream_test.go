@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"hash/crc32"
+	"io"
+	"large_fss/internals/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipTestEntries stores the contents in a temp folder and describes them as entries,
+// with the checksum recorded only for the names in indexed.
+func zipTestEntries(t *testing.T, contents map[string]string, indexed map[string]bool) (storage.Storage, []Entry) {
+	t.Helper()
+	dir := t.TempDir()
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{{Name: "folder/", Modified: modified}}
+	for name, content := range contents {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		entries = append(entries, Entry{
+			Name:     name,
+			Path:     name,
+			Size:     int64(len(content)),
+			CRC32:    crc32.ChecksumIEEE([]byte(content)),
+			Modified: modified,
+			NoCRC32:  !indexed[name],
+		})
+	}
+	return storage.NewLocalStorage(dir), entries
+}
+
+func TestZipStreamSizeMatchesOutput(t *testing.T) {
+	contents := map[string]string{
+		"a.txt":        strings.Repeat("compressible text ", 200),
+		"folder/b.bin": "\x00\x01\x02\x03",
+		"empty.txt":    "",
+	}
+	fs, entries := zipTestEntries(t, contents, map[string]bool{"a.txt": true})
+	for i := range entries {
+		// Checksums that aren't indexed must not be relied on
+		if entries[i].NoCRC32 {
+			entries[i].CRC32 = 0
+		}
+	}
+
+	stream := NewZipStream(entries)
+	size, known := stream.Size()
+	if !known {
+		t.Fatal("a zip of stored entries should know its size")
+	}
+	var out bytes.Buffer
+	if err := stream.WriteTo(context.Background(), fs, &out); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if int64(out.Len()) != size {
+		t.Fatalf("Size promised %d bytes, wrote %d", size, out.Len())
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("read zip: %v", err)
+	}
+	if len(reader.File) != len(entries) {
+		t.Fatalf("expected %d entries, got %d", len(entries), len(reader.File))
+	}
+	for _, file := range reader.File {
+		if file.Method != zip.Store {
+			t.Errorf("%s: expected a stored entry, got method %d", file.Name, file.Method)
+		}
+		if strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", file.Name, err)
+		}
+		// Reading to the end checks the content against the checksum
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", file.Name, err)
+		}
+		if string(content) != contents[file.Name] {
+			t.Errorf("%s: content differs", file.Name)
+		}
+	}
+}
+
+func TestZipStreamRejectsChangedContent(t *testing.T) {
+	fs, entries := zipTestEntries(t, map[string]string{"a.txt": "original"}, map[string]bool{"a.txt": true})
+	entries[1].CRC32++
+
+	err := NewZipStream(entries).WriteTo(context.Background(), fs, io.Discard)
+	if err == nil {
+		t.Fatal("expected a checksum mismatch")
+	}
+}
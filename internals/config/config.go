@@ -0,0 +1,246 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"large_fss/internals/constants"
+	"large_fss/internals/expiry"
+	"os"
+	"slices"
+	"time"
+)
+
+// Config holds the operator tunable policies of the service. Every field has a
+// default, a JSON file named by APP_CONFIG_PATH only needs the keys it overrides.
+type Config struct {
+	FileTypePolicy FileTypePolicy   `json:"file_type_policy"`
+	ArchiveLimits  ArchiveLimits    `json:"archive_limits"`
+	PlanQuotas     map[string]int64 `json:"plan_quotas"` // Bytes a user of the plan may store in one transfer
+	URLImport      URLImport        `json:"url_import"`
+	Preview        Preview          `json:"preview"`
+	Bandwidth      Bandwidth        `json:"bandwidth"`
+	Streams        Streams          `json:"streams"`
+	ArchiveCache   ArchiveCache     `json:"archive_cache"`
+	Expiry         Expiry           `json:"expiry"`
+	Trash          Trash            `json:"trash"`
+	Server         Server           `json:"server"`
+}
+
+// Server controls how requests reach the server. Client addresses are only taken from
+// X-Forwarded-For and X-Real-IP when the request comes from a trusted proxy.
+type Server struct {
+	TrustedProxies []string `json:"trusted_proxies"` // IPs or CIDRs of the reverse proxies, none by default
+}
+
+// Expiry controls which expiries users may give their transfers. Values are presets,
+// RFC 3339 timestamps or ISO 8601 durations, and must fall within the bounds of the
+// owner's plan. "never" is reserved to the listed roles.
+type Expiry struct {
+	Presets    map[string]string       `json:"presets"`     // Name to ISO 8601 duration, replaces the default presets
+	NeverRoles []string                `json:"never_roles"` // Roles allowed transfers that never expire
+	MinSeconds int64                   `json:"min_seconds"`
+	MaxSeconds int64                   `json:"max_seconds"` // 0 for no maximum
+	Plans      map[string]ExpiryBounds `json:"plans"`       // Replaces the bounds for users on the plan
+}
+
+// ExpiryBounds is the shortest and longest expiry from now a user may pick.
+type ExpiryBounds struct {
+	MinSeconds int64 `json:"min_seconds"`
+	MaxSeconds int64 `json:"max_seconds"` // 0 for no maximum
+}
+
+// defaultExpiryPresets are the choices offered before presets were configurable.
+var defaultExpiryPresets = map[string]string{
+	"5m":  "PT5M",
+	"3h":  "PT3H",
+	"12h": "PT12H",
+	"1d":  "P1D",
+	"3d":  "P3D",
+	"1w":  "P1W",
+}
+
+// PresetDurations returns the configured presets, or the default ones when none are.
+func (e Expiry) PresetDurations() map[string]string {
+	if e.Presets == nil {
+		return defaultExpiryPresets
+	}
+	return e.Presets
+}
+
+// BoundsForPlan returns the expiry bounds of users on the plan.
+func (e Expiry) BoundsForPlan(plan string) ExpiryBounds {
+	if bounds, ok := e.Plans[plan]; ok {
+		return bounds
+	}
+	return ExpiryBounds{MinSeconds: e.MinSeconds, MaxSeconds: e.MaxSeconds}
+}
+
+// AllowsNever reports whether users with the role may create transfers that never expire.
+func (e Expiry) AllowsNever(role string) bool {
+	return slices.Contains(e.NeverRoles, role)
+}
+
+// ArchiveCache keeps archives of whole transfers in storage once they were downloaded.
+type ArchiveCache struct {
+	MaxBytes int64 `json:"max_bytes"` // Total size before the least recently used are evicted, 0 disables the cache
+}
+
+// Trash keeps deleted and expired transfers restorable by their owners for a while.
+type Trash struct {
+	RetentionSeconds int `json:"retention_seconds"` // 0 purges at the next cleanup run
+}
+
+// Retention is how long a transfer stays in the trash before it is purged.
+func (t Trash) Retention() time.Duration {
+	return time.Duration(t.RetentionSeconds) * time.Second
+}
+
+// Streams controls how long downloads keep the files they read from alive.
+type Streams struct {
+	LeaseTTLSeconds            int `json:"lease_ttl_seconds"`             // Renewed while a download reads
+	ForcedDeletionAfterSeconds int `json:"forced_deletion_after_seconds"` // After the trash retention, purging cuts active downloads
+}
+
+// LeaseTTL is how long a stream lease lasts without being renewed.
+func (s Streams) LeaseTTL() time.Duration {
+	return time.Duration(s.LeaseTTLSeconds) * time.Second
+}
+
+// ForcedDeletionAfter is how long a transfer due for purging waits for its downloads to finish.
+func (s Streams) ForcedDeletionAfter() time.Duration {
+	return time.Duration(s.ForcedDeletionAfterSeconds) * time.Second
+}
+
+// Bandwidth throttles downloads. Rates are in bytes per second and 0 disables a limit.
+// Share links may set a rate of their own on top of these.
+type Bandwidth struct {
+	GlobalBytesPerSecond   int64            `json:"global_bytes_per_second"` // Shared by every download
+	UserBytesPerSecond     int64            `json:"user_bytes_per_second"`   // Shared by the downloads of one owner's transfers
+	PlanBytesPerSecond     map[string]int64 `json:"plan_bytes_per_second"`   // Replaces user_bytes_per_second for owners on the plan
+	MaxConcurrentDownloads int              `json:"max_concurrent_downloads"`
+	RetryAfterSeconds      int              `json:"retry_after_seconds"` // Sent with 503 when the cap is reached
+}
+
+// RateForPlan returns the bandwidth shared by the downloads of an owner on the plan.
+func (b Bandwidth) RateForPlan(plan string) int64 {
+	if rate, ok := b.PlanBytesPerSecond[plan]; ok {
+		return rate
+	}
+	return b.UserBytesPerSecond
+}
+
+// Preview lists the sniffed content types browsers may render inline. Anything
+// able to run script, such as HTML or SVG, should never be listed.
+type Preview struct {
+	AllowedMimeTypes []string `json:"allowed_mime_types"`
+}
+
+// Allows reports whether content of the sniffed type may be previewed.
+func (p Preview) Allows(mimeType string) bool {
+	return mimeType != "" && matchesMimeType(p.AllowedMimeTypes, mimeType)
+}
+
+// URLImport controls server side imports. Loopback, private and link-local
+// addresses are blocked unless a host or range is listed here.
+type URLImport struct {
+	AllowedHosts          []string `json:"allowed_hosts"`
+	AllowedCIDRs          []string `json:"allowed_cidrs"`
+	TimeoutSeconds        int      `json:"timeout_seconds"` // Whole download, 0 for no limit
+	MaxRedirects          int      `json:"max_redirects"`
+	MaxConcurrentPerOwner int      `json:"max_concurrent_per_owner"` // Imports one owner may run at once, 0 for no limit
+}
+
+// ArchiveLimits bounds what an uploaded archive may expand to. Zero disables a limit,
+// the uncompressed size is additionally capped by the owner's quota.
+type ArchiveLimits struct {
+	MaxUncompressedSize int64   `json:"max_uncompressed_size"`
+	MaxEntries          int     `json:"max_entries"`
+	MaxPathDepth        int     `json:"max_path_depth"`
+	MaxCompressionRatio float64 `json:"max_compression_ratio"`
+}
+
+// QuotaForPlan returns the per-transfer storage quota of a plan.
+func (c *Config) QuotaForPlan(plan string) int64 {
+	if quota, ok := c.PlanQuotas[plan]; ok {
+		return quota
+	}
+	return constants.ValidUserMaxUploadSize
+}
+
+// DefaultConfig returns the policies used when nothing is configured.
+func DefaultConfig() *Config {
+	return &Config{
+		FileTypePolicy: FileTypePolicy{
+			Plans: map[string]FileTypeRules{},
+		},
+		ArchiveLimits: ArchiveLimits{
+			MaxEntries:          constants.DefaultMaxArchiveEntries,
+			MaxPathDepth:        constants.DefaultMaxArchivePathDepth,
+			MaxCompressionRatio: constants.DefaultMaxArchiveCompressRatio,
+		},
+		PlanQuotas: map[string]int64{},
+		URLImport: URLImport{
+			TimeoutSeconds:        constants.DefaultURLImportTimeoutSeconds,
+			MaxRedirects:          constants.DefaultURLImportMaxRedirects,
+			MaxConcurrentPerOwner: constants.DefaultMaxConcurrentImports,
+		},
+		Bandwidth: Bandwidth{
+			PlanBytesPerSecond: map[string]int64{},
+			RetryAfterSeconds:  constants.DefaultDownloadRetryAfterSeconds,
+		},
+		ArchiveCache: ArchiveCache{
+			MaxBytes: constants.DefaultArchiveCacheMaxBytes,
+		},
+		Expiry: Expiry{
+			NeverRoles: []string{constants.RoleAdmin},
+			MinSeconds: constants.DefaultMinExpirySeconds,
+			MaxSeconds: constants.DefaultMaxExpirySeconds,
+			Plans:      map[string]ExpiryBounds{},
+		},
+		Trash: Trash{
+			RetentionSeconds: constants.DefaultTrashRetentionSeconds,
+		},
+		Streams: Streams{
+			LeaseTTLSeconds:            constants.DefaultStreamLeaseTTLSeconds,
+			ForcedDeletionAfterSeconds: constants.DefaultForcedDeletionAfterSeconds,
+		},
+		Preview: Preview{
+			AllowedMimeTypes: []string{
+				"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif", "image/bmp",
+				"application/pdf",
+				"text/plain",
+				"audio/mpeg", "audio/ogg", "audio/wav", "audio/webm", "audio/flac", "audio/aac", "audio/x-m4a",
+				"video/mp4", "video/webm", "video/ogg",
+			},
+		},
+	}
+}
+
+// LoadConfig reads the JSON file named by APP_CONFIG_PATH on top of the defaults.
+func LoadConfig() (*Config, error) {
+	cfg := DefaultConfig()
+
+	configPath := os.Getenv("APP_CONFIG_PATH")
+	if configPath == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("config: read %s: %w", configPath, err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("config: parse %s: %w", configPath, err)
+	}
+	if cfg.Streams.LeaseTTLSeconds <= 0 {
+		return nil, fmt.Errorf("config: streams.lease_ttl_seconds must be positive")
+	}
+	if cfg.Trash.RetentionSeconds < 0 {
+		return nil, fmt.Errorf("config: trash.retention_seconds must not be negative")
+	}
+	for name, duration := range cfg.Expiry.PresetDurations() {
+		if _, err := expiry.AddDuration(time.Now(), duration); err != nil || name == expiry.Never {
+			return nil, fmt.Errorf("config: expiry.presets.%s: %q is not an ISO 8601 duration", name, duration)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FileTypeRules decides which files may be shared. Deny lists win over allow
+// lists, and an empty allow list allows everything that isn't denied.
+// MIME types may use a wildcard subtype such as "image/*".
+type FileTypeRules struct {
+	AllowedMimeTypes  []string `json:"allowed_mime_types"`
+	DeniedMimeTypes   []string `json:"denied_mime_types"`
+	AllowedExtensions []string `json:"allowed_extensions"`
+	DeniedExtensions  []string `json:"denied_extensions"`
+}
+
+// FileTypePolicy holds the default rules and per-plan overrides. A list set in
+// a plan replaces the default list, lists left out are inherited.
+type FileTypePolicy struct {
+	FileTypeRules
+	Plans map[string]FileTypeRules `json:"plans"`
+}
+
+// ForPlan returns the effective rules for a user plan.
+func (p FileTypePolicy) ForPlan(plan string) FileTypeRules {
+	rules := p.FileTypeRules
+	override, ok := p.Plans[plan]
+	if !ok {
+		return rules
+	}
+	if override.AllowedMimeTypes != nil {
+		rules.AllowedMimeTypes = override.AllowedMimeTypes
+	}
+	if override.DeniedMimeTypes != nil {
+		rules.DeniedMimeTypes = override.DeniedMimeTypes
+	}
+	if override.AllowedExtensions != nil {
+		rules.AllowedExtensions = override.AllowedExtensions
+	}
+	if override.DeniedExtensions != nil {
+		rules.DeniedExtensions = override.DeniedExtensions
+	}
+	return rules
+}
+
+// Violation explains why a file is rejected, or returns "" when it is allowed.
+func (r FileTypeRules) Violation(fileName string, mimeType string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+
+	if containsExtension(r.DeniedExtensions, ext) {
+		return fmt.Sprintf("extension %q is not allowed", ext)
+	}
+	if matchesMimeType(r.DeniedMimeTypes, mimeType) {
+		return fmt.Sprintf("content type %q is not allowed", mimeType)
+	}
+	if len(r.AllowedExtensions) > 0 && !containsExtension(r.AllowedExtensions, ext) {
+		return fmt.Sprintf("extension %q is not allowed", ext)
+	}
+	if len(r.AllowedMimeTypes) > 0 && !matchesMimeType(r.AllowedMimeTypes, mimeType) {
+		return fmt.Sprintf("content type %q is not allowed", mimeType)
+	}
+	return ""
+}
+
+func containsExtension(extensions []string, ext string) bool {
+	for _, e := range extensions {
+		e = strings.ToLower(e)
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesMimeType(patterns []string, mimeType string) bool {
+	mimeType = strings.ToLower(mimeType)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
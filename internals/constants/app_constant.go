@@ -8,6 +8,13 @@ const (
 	ClaimPrimaryKey = "id"
 	
 	SuccessMessage = "success"
+	//User plans, new users start on the free plan
+	PlanFree = "free"
+	PlanPro  = "pro"
+	//User roles, new users get the user role
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+
 	//Dburl
 	DBURL="user=postgres password=yourpassword dbname=wetransfer host=localhost port=5432 sslmode=disable"
 	
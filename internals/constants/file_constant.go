@@ -5,12 +5,135 @@ const (
 	UploadDir     = "uploads"     // Directory to store final assembled files
 	ChunkDir      = "chunks"      // Directory to store individual chunks
 	TempDir	  ="temp"
+	QuarantineDir = "quarantine"  // Directory infected files are moved to
+	ThumbnailDir  = "thumbnails"  // Directory image previews are stored in, one folder per transfer
+	ArchiveCacheDir = "archive_cache" // Directory pre-built transfer archives are stored in, one folder per transfer
+	ThumbnailURLPrefix = "/api/transfer/thumbnail/" // Public route serving a file's thumbnail
+	UploadChunkURL     = "/api/auth/transfer/upload"   // Routes a client resumes an upload session with
+	AssembleURL        = "/api/auth/transfer/assemble"
+	CancelUploadURL    = "/api/auth/transfer/cancel"
+	ImportStatusURLPrefix = "/api/auth/transfer/import/" // Followed by the transfer ID
 	MaxChunkSize     = 5*1024 * 1024   // 1MB chunk size (example, can be adjusted)
 	ValidUserMaxUploadSize = 5 * 1024 * 1024 * 1024 // 5GB max file size (example)
 	NonUserMaxUploadSize=1*1024*1024*1024
 	MaxhoursUploadSessionValid=4
+	//Default archive extraction limits
+	DefaultMaxArchiveEntries      = 10000
+	DefaultMaxArchivePathDepth    = 16
+	DefaultMaxArchiveCompressRatio = 100
+	//Default url import limits
+	DefaultURLImportTimeoutSeconds = 3600
+	DefaultURLImportMaxRedirects   = 5
+	DefaultMaxConcurrentImports    = 3
+	//Default download throttling
+	DefaultDownloadRetryAfterSeconds = 30 // Retry-After sent when the concurrent download cap is reached
+	//Default archive cache
+	DefaultArchiveCacheMaxBytes = 10 * 1024 * 1024 * 1024 // Total size of cached archives before the least recently used are evicted
+	//Default expiry bounds
+	DefaultMinExpirySeconds = 5 * 60            // Shortest expiry users may pick
+	DefaultMaxExpirySeconds = 30 * 24 * 60 * 60 // Longest expiry users may pick
+	//Default trash
+	DefaultTrashRetentionSeconds = 30 * 24 * 60 * 60 // How long trashed transfers stay restorable
+	//Default stream leases
+	DefaultStreamLeaseTTLSeconds      = 120   // A download that reads nothing for this long no longer counts as active
+	DefaultForcedDeletionAfterSeconds = 86400 // Trashed transfers are purged this long after their retention even while downloads run
 	//error messages
 	ErrInvalidFileFormat = "Invalid file format"
 
 
 )
+
+//Malware scan status of files and transfers
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+	ScanStatusError    = "error"
+)
+
+//Share links
+const (
+	SharePagePrefix    = "/share/" // Followed by a link token
+	LinkTokenBytes     = 24        // Random bytes in a link token, 32 characters once encoded
+	MaxLinkLabelLength = 100
+	DefaultLinkLabel   = "Default link"
+)
+
+//Renaming files
+const (
+	MaxFileNameLength = 255 // Bytes per path segment, what common file systems allow
+	// Characters refused in file names, they break downloads on some platforms
+	InvalidFileNameChars = `\:*?"<>|`
+)
+
+//Password protected transfers
+const (
+	TransferAccessCookiePrefix = "transfer_access_" // Followed by the transfer ID, holds the access token
+	TransferAccessHeader       = "Transfer-Token"   // Alternative to the cookie for API clients
+	TransferAccessCookiePath   = "/api/transfer"    // Public transfer routes the cookie is sent to
+	TransferAccessTokenTTL     = 30 * 60            // Seconds an unlocked transfer stays accessible
+	MaxTransferPasswordLength  = 72                 // Longest password bcrypt can hash
+	MaxFailedUnlockAttempts    = 5                  // Failed passwords per transfer and IP before a lockout
+	MaxTransferUnlockAttempts  = 20                 // Failed passwords per transfer from any address before a lockout
+	UnlockLockoutSeconds       = 15 * 60
+)
+
+//Private transfers
+const (
+	RecipientAccessCookiePrefix = "transfer_recipient_" // Followed by the transfer ID, holds a guest recipient's token
+	RecipientAccessHeader       = "Recipient-Token"     // Alternative to the cookie for API clients
+	RecipientAccessTokenTTL     = 24 * 60 * 60          // Seconds a verified guest keeps access
+	RecipientCodeDigits         = 6
+	RecipientCodeTTL            = 10 * 60 // Seconds an emailed code stays valid
+	RecipientCodeResendSeconds  = 60      // Shortest wait between two codes for a recipient
+	MaxRecipientCodeAttempts    = 5       // Wrong codes before the pending code is dropped
+	MaxRecipientsPerRequest     = 50
+
+	RecipientStatusInvited    = "invited"    // Never opened the transfer
+	RecipientStatusAccessed   = "accessed"   // Opened it but completed no download
+	RecipientStatusDownloaded = "downloaded" // Completed at least one download
+)
+
+//What a download event was for
+const (
+	DownloadKindFile      = "file"
+	DownloadKindTransfer  = "transfer"
+	DownloadKindSelection = "selection"
+)
+
+//What owners are notified about
+const (
+	NotificationFirstDownload = "first_download" // The first completed download of a transfer
+	NotificationAllDownloaded = "all_downloaded" // Every file of a transfer was downloaded at least once
+	NotificationExpiredUnused = "expired_unused" // A transfer expired without any completed download
+)
+
+//Listing of a user's transfers
+const (
+	TransferStatusActive  = "active"  // Not expired yet, never-expiring ones included
+	TransferStatusExpired = "expired" // Expired but not trashed by cleanup yet
+	TransferStatusNever   = "never"   // Without an expiry
+	TransferStatusTrashed = "trashed" // Deleted, expired or used up, restorable until purged
+
+	TransferSortCreatedAt = "created_at"
+	TransferSortSize      = "size"
+	TransferSortExpiry    = "expiry" // Never-expiring transfers sort after every expiry
+
+	DefaultTransfersLimit = 50
+	MaxTransfersLimit     = 200
+)
+
+//Where an unassembled upload comes from
+const (
+	UploadSourceUpload = "upload" // A new transfer sent in chunks by the client
+	UploadSourceAppend = "append" // Files added to an existing transfer
+	UploadSourceImport = "import" // Downloaded from a url by the server
+)
+
+//Progress of a server side url import
+const (
+	ImportStatusDownloading = "downloading"
+	ImportStatusAssembling  = "assembling"
+	ImportStatusCompleted   = "completed"
+	ImportStatusFailed      = "failed"
+)
@@ -2,6 +2,8 @@ package customerrors
 
 import (
 	"errors"
+	"strings"
+	"time"
 )
 
 var (
@@ -14,5 +16,73 @@ var (
 	LimitExceeded=errors.New("limit Exceed")
 	ErrInvalidLink=errors.New("invalid link")
 	ErrExpiredLink=errors.New("link is expired or deleted")
+	ErrActiveStreams=errors.New("file is being downloaded, try again later")
+	ErrFileAlreadyExists=errors.New("file with the same name already exists in transfer")
+	ErrScanPending=errors.New("file is still being scanned for malware, try again later")
+	ErrFileInfected=errors.New("file was flagged as malicious and quarantined")
+	ErrFileTypeNotAllowed=errors.New("transfer contains file types that are not allowed")
+	ErrUnsupportedArchive=errors.New("upload is not a zip, tar, tar.gz or tar.zst archive")
+	ErrArchiveLimitExceeded=errors.New("archive exceeds the allowed size, entry count, depth or compression ratio")
+	ErrURLNotAllowed=errors.New("url cannot be imported from")
+	ErrRemoteFetchFailed=errors.New("failed to fetch the remote file")
+	ErrImportInterrupted=errors.New("import was interrupted by a server restart")
+	ErrImportCancelled=errors.New("import was cancelled")
+	ErrTooManyImports=errors.New("too many imports running, wait for one to finish")
+	ErrFileNotInTransfer=errors.New("selection contains files that are not part of the transfer")
+	ErrUnsupportedFormat=errors.New("format must be zip, tar, tar.gz or tar.zst")
+	ErrDownloadLimitReached=errors.New("transfer reached its download limit")
+	ErrPreviewNotSupported=errors.New("file type cannot be previewed, download it instead")
+	ErrPreviewLimited=errors.New("transfers with a download limit cannot be previewed, download it instead")
+	ErrPasswordRequired=errors.New("transfer is password protected")
+	ErrLinkNotFound=errors.New("share link not found")
+	ErrTooManyAttempts=errors.New("too many attempts, try again later")
+	ErrRecipientRequired=errors.New("transfer is private, sign in or verify your email")
+	ErrInvalidCode=errors.New("code is wrong or expired")
+	ErrRecipientNotFound=errors.New("recipient not found")
+	ErrServerBusy=errors.New("too many downloads in progress, try again later")
+	ErrStreamCut=errors.New("download stopped, the transfer was deleted")
+	ErrNotificationNotFound=errors.New("notification not found")
+	ErrExpiryNotAllowed=errors.New("expiry is outside the range your plan allows")
+	ErrInvalidFileName=errors.New("file name is empty, too long or contains characters that are not allowed")
+	ErrNotInTrash=errors.New("transfer is not in the trash")
 
 )
+
+// TooManyAttemptsError tells how long a client must wait before unlocking a transfer or asking for a code again.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *TooManyAttemptsError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// ServerBusyError tells how long a client should wait before starting a download again.
+type ServerBusyError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ServerBusyError) Error() string {
+	return ErrServerBusy.Error()
+}
+
+func (e *ServerBusyError) Unwrap() error {
+	return ErrServerBusy
+}
+
+// FileTypeViolationError lists every file rejected by the file type policy.
+type FileTypeViolationError struct {
+	Files []string
+}
+
+func (e *FileTypeViolationError) Error() string {
+	return ErrFileTypeNotAllowed.Error() + ": " + strings.Join(e.Files, "; ")
+}
+
+func (e *FileTypeViolationError) Unwrap() error {
+	return ErrFileTypeNotAllowed
+}
@@ -9,10 +9,115 @@ import (
 )
 
 type TransferDTO struct {
-	Message string `json:"message"`
-	Size    int64  `json:"size"`
-	Expiry  string `json:"expiry"`
-	OwnerID uuid.UUID
+	Message   string `json:"message"`
+	Size      int64  `json:"size"`
+	Expiry    string `json:"expiry"`
+	StoreAsIs bool   `json:"store_as_is"`
+	FileName  string `json:"file_name"`
+	MaxDownloads *int `json:"max_downloads"` // Delete the transfer after this many completed downloads
+	Password  string `json:"password"`      // Optional, recipients must enter it before downloading
+	OwnerID   uuid.UUID
+}
+
+type TransferAppendDTO struct {
+	TransferID uuid.UUID `json:"transfer_id"`
+	Size       int64     `json:"size"`
+	StoreAsIs  bool      `json:"store_as_is"`
+	FileName   string    `json:"file_name"`
+	OwnerID    uuid.UUID
+}
+
+type TransferImportDTO struct {
+	URL      string `json:"url"`
+	Message  string `json:"message"`
+	Expiry   string `json:"expiry"`
+	Extract  bool   `json:"extract"`   // Unpack the remote archive instead of storing it as one file
+	FileName string `json:"file_name"` // Defaults to the name sent by the remote server
+	MaxDownloads *int `json:"max_downloads"`
+	Password string `json:"password"`
+	OwnerID  uuid.UUID
+}
+
+type ImportStatusDTO struct {
+	TransferID    uuid.UUID `json:"transfer_id"`
+	Status        string    `json:"status"`
+	BytesReceived int64     `json:"bytes_received"`
+	TotalBytes    int64     `json:"total_bytes"` // -1 when the remote server did not send a size
+	Error         string    `json:"error,omitempty"`
+}
+
+// UploadSessionDTO is an upload of the user that was not assembled yet.
+type UploadSessionDTO struct {
+	TransferID       uuid.UUID        `json:"transfer_id"`
+	Source           string           `json:"source"` // upload, append or import
+	Message          string           `json:"message"`
+	DeclaredSize     int64            `json:"declared_size"` // Size given when the upload was started
+	StoreAsIs        bool             `json:"store_as_is"`
+	FileName         string           `json:"file_name,omitempty"`
+	UploadedChunks   int              `json:"uploaded_chunks"`
+	BytesReceived    int64            `json:"bytes_received"`
+	CreatedAt        time.Time        `json:"created_at"`
+	LastActivityAt   time.Time        `json:"last_activity_at"`
+	CleanupAt        time.Time        `json:"cleanup_at"` // Earliest time the failed-upload cleanup removes it
+	CleanupInSeconds int64            `json:"cleanup_in_seconds"`
+	Resume           *UploadResumeDTO `json:"resume,omitempty"`     // Only for uploads the client sends itself
+	StatusURL        string           `json:"status_url,omitempty"` // Only for url imports, which the server downloads
+}
+
+// UploadResumeDTO is what a client needs to continue an upload: chunks of ChunkSize bytes
+// are posted to UploadURL as the uploadId, index and chunk form fields, then the upload
+// is assembled by posting {"id": upload_id} to AssembleURL or cancelled by posting
+// {"transfer_id": upload_id} to CancelURL.
+type UploadResumeDTO struct {
+	UploadID        uuid.UUID `json:"upload_id"`
+	UploadURL       string    `json:"upload_url"`
+	AssembleURL     string    `json:"assemble_url"`
+	CancelURL       string    `json:"cancel_url"`
+	ChunkSize       int       `json:"chunk_size"`
+	UploadedIndexes []int     `json:"uploaded_indexes"`
+	NextIndex       int       `json:"next_index"` // Lowest index not uploaded yet
+}
+
+type DownloadStatsDTO struct {
+	TransferID     uuid.UUID              `json:"transfer_id"`
+	Downloads      int64                  `json:"downloads"`
+	Completed      int64                  `json:"completed"`
+	Aborted        int64                  `json:"aborted"`
+	BytesSent      int64                  `json:"bytes_sent"`
+	LastDownloadAt *time.Time             `json:"last_download_at,omitempty"`
+	Archives       int64                  `json:"archive_downloads"` // Whole transfer or selection downloads
+	Files          []FileDownloadStatsDTO `json:"files"`
+}
+
+type FileDownloadStatsDTO struct {
+	FileID         uuid.UUID  `json:"file_id"`
+	FileName       string     `json:"file_name"`
+	Downloads      int64      `json:"downloads"`
+	Completed      int64      `json:"completed"`
+	BytesSent      int64      `json:"bytes_sent"`
+	LastDownloadAt *time.Time `json:"last_download_at,omitempty"`
+}
+
+type DownloadEventDTO struct {
+	ID        uuid.UUID  `json:"id"`
+	FileID    *uuid.UUID `json:"file_id,omitempty"`
+	FileName  string     `json:"file_name,omitempty"`
+	LinkID    *uuid.UUID `json:"link_id,omitempty"`
+	LinkLabel string     `json:"link_label,omitempty"`
+	RecipientEmail string `json:"recipient_email,omitempty"` // Recipient of a private transfer who downloaded
+	Kind      string     `json:"kind"`
+	BytesSent int64      `json:"bytes_sent"`
+	Completed bool       `json:"completed"`
+	ClientIP  string     `json:"client_ip"`
+	UserAgent string     `json:"user_agent"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type DownloadSelectionDTO struct {
+	LinkToken  string
+	FileIDs    []uuid.UUID
+	Paths      []string // Folders or files relative to the transfer root
+	Format     string   // Archive format name, empty for zip
 }
 
 type CancelTransferDTO struct {
@@ -44,6 +149,91 @@ type TransferInfoDTO struct {
 	Expiry       time.Time     `json:"expiry"`
 	FileInfoList []FileInfoDTO `json:"file_info_list,omitempty"`
 	CreatedAt   time.Time  `json:"created_at" `
+	ScanStatus   string        `json:"scan_status"`
+	MaxDownloads       *int       `json:"max_downloads,omitempty"`
+	DownloadsLeft      *int       `json:"downloads_left,omitempty"`
+	DownloadCount      int64      `json:"download_count"`
+	CompletedDownloads int64      `json:"completed_downloads"`
+	LastDownloadAt     *time.Time `json:"last_download_at,omitempty"`
+	PasswordProtected  bool       `json:"password_protected"`
+	LinkLabel          string     `json:"link_label,omitempty"` // Label of the link the share page was opened with
+	Links              []LinkDTO  `json:"links,omitempty"`      // Every share link, only listed to the owner
+	Private            bool       `json:"private"`
+	Recipients         []RecipientDTO `json:"recipients,omitempty"` // Only listed to the owner
+	TrashedAt          *time.Time     `json:"trashed_at,omitempty"`
+	PurgeAt            *time.Time     `json:"purge_at,omitempty"` // When a trashed transfer is deleted for good
+}
+
+type RecipientDTO struct {
+	ID             uuid.UUID  `json:"id"`
+	Email          string     `json:"email"`
+	Registered     bool       `json:"registered"` // Signs in to open the transfer instead of using emailed codes
+	Status         string     `json:"status"`     // invited, accessed or downloaded
+	LastAccessAt   *time.Time `json:"last_access_at,omitempty"`
+	Downloads      int64      `json:"downloads"`
+	Completed      int64      `json:"completed"`
+	LastDownloadAt *time.Time `json:"last_download_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type RecipientAddDTO struct {
+	TransferID uuid.UUID
+	Emails     []string    `json:"emails"`
+	UserIDs    []uuid.UUID `json:"user_ids"` // Registered users, by ID
+	OwnerID    uuid.UUID
+}
+
+type RecipientCodeRequestDTO struct {
+	Email string `json:"email"`
+}
+
+type RecipientVerifyDTO struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+type LinkDTO struct {
+	ID             uuid.UUID  `json:"id"`
+	TransferID     uuid.UUID  `json:"transfer_id"`
+	Token          string     `json:"token"`
+	URL            string     `json:"url"` // Share page path, relative to the server
+	Label          string     `json:"label"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads   *int       `json:"max_downloads,omitempty"`
+	DownloadCount  int        `json:"download_count"`
+	DownloadsLeft  *int       `json:"downloads_left,omitempty"`
+	BytesPerSecond *int64     `json:"bytes_per_second,omitempty"`
+	Enabled        bool       `json:"enabled"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type LinkCreateDTO struct {
+	TransferID     uuid.UUID
+	Label          string `json:"label"`
+	Expiry         string `json:"expiry"` // Same values as a transfer's expiry, empty follows the transfer
+	MaxDownloads   *int   `json:"max_downloads"`
+	BytesPerSecond *int64 `json:"bytes_per_second"` // Bandwidth shared by the link's downloads
+	OwnerID        uuid.UUID
+}
+
+type LinkUpdateDTO struct {
+	LinkID         uuid.UUID
+	Label          *string `json:"label"`
+	Expiry         *string `json:"expiry"`           // "" follows the transfer again
+	MaxDownloads   *int    `json:"max_downloads"`    // 0 removes the limit
+	BytesPerSecond *int64  `json:"bytes_per_second"` // 0 removes the limit
+	Enabled        *bool   `json:"enabled"`
+	OwnerID        uuid.UUID
+}
+
+type TransferUnlockDTO struct {
+	Password string `json:"password"`
+}
+
+type TransferAccessDTO struct {
+	TransferID uuid.UUID `json:"transfer_id"` // Names the access cookie
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type FileInfoDTO struct {
@@ -51,14 +241,91 @@ type FileInfoDTO struct {
 	FileName      string    `json:"file_name" `
 	FileSize      int64     `json:"file_size" `
 	FileExtension string    `json:"file_extension" `
+	ScanStatus    string    `json:"scan_status"`
+	MimeType      string    `json:"mime_type"`
+	Previewable   bool      `json:"previewable"`
+	ThumbnailURL  string    `json:"thumbnail_url,omitempty"`
+}
+
+// TransferListQueryDTO is a request for a page of the user's transfers, read from the query string.
+type TransferListQueryDTO struct {
+	OwnerID       uuid.UUID
+	Status        string     // active, expired or never
+	MinSize       *int64
+	MaxSize       *int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Search        string
+	Sort          string // created_at, size or expiry
+	Order         string // asc or desc
+	Cursor        string // next_cursor of the previous page
+	Limit         int
+}
+
+// TransferListDTO is a page of transfers. NextCursor is empty on the last page.
+type TransferListDTO struct {
+	Transfers  []TransferInfoDTO `json:"transfers"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// ExpiryPolicyDTO tells a user which expiries they may pick. Besides the presets any
+// RFC 3339 timestamp or ISO 8601 duration within the bounds is accepted.
+type ExpiryPolicyDTO struct {
+	Presets      []ExpiryPresetDTO `json:"presets"`
+	MinSeconds   int64             `json:"min_seconds"`
+	MaxSeconds   int64             `json:"max_seconds"` // 0 for no maximum
+	NeverAllowed bool              `json:"never_allowed"`
+}
+
+type ExpiryPresetDTO struct {
+	Name     string `json:"name"`
+	Duration string `json:"duration"` // ISO 8601
+	Seconds  int64  `json:"seconds"`  // From now, for sorting and display
 }
 
 type TransferUpdateDTO struct {
 	TransferID uuid.UUID `json:"transfer_id"`
 	Message    string    `json:"message"`
 	Expiry     string    `json:"expiry"`
+	MaxDownloads *int    `json:"max_downloads"` // Left out keeps the limit, 0 removes it
+	Password   *string   `json:"password"`      // Left out keeps the password, "" removes it
+	Private    *bool     `json:"private"`       // Left out keeps the setting
 	OwnerID    uuid.UUID
 
 }
 
+// TransferRestoreDTO takes a transfer out of the trash. An expired transfer needs a new
+// expiry and one that used up its downloads a new limit.
+type TransferRestoreDTO struct {
+	TransferID   uuid.UUID
+	Expiry       string `json:"expiry"`        // Left out keeps the expiry
+	MaxDownloads *int   `json:"max_downloads"` // Left out keeps the limit, 0 removes it
+	OwnerID      uuid.UUID
+}
+
+type NotificationDTO struct {
+	ID         uuid.UUID  `json:"id"`
+	TransferID *uuid.UUID `json:"transfer_id,omitempty"` // The transfer may be deleted already
+	Kind       string     `json:"kind"`
+	Subject    string     `json:"subject"`
+	Message    string     `json:"message"`
+	Read       bool       `json:"read"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type NotificationsDTO struct {
+	Unread        int               `json:"unread"`
+	Notifications []NotificationDTO `json:"notifications"`
+}
 
+// NotificationPreferenceDTO tells on which channels one kind of notification is sent.
+type NotificationPreferenceDTO struct {
+	Kind  string `json:"kind"`
+	Email bool   `json:"email"`
+	InApp bool   `json:"in_app"`
+}
+
+type NotificationPreferencesUpdateDTO struct {
+	Preferences []NotificationPreferenceDTO `json:"preferences"`
+	UserID      uuid.UUID
+}
@@ -0,0 +1,99 @@
+// Package expiry reads the expiry users give to transfers and links: a preset name,
+// an absolute RFC 3339 timestamp or an ISO 8601 duration such as P3D or PT12H.
+package expiry
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Never is the value of transfers that do not expire.
+const Never = "never"
+
+var (
+	ErrInvalid = errors.New("expiry: not a preset, RFC 3339 timestamp or ISO 8601 duration")
+	ErrPast    = errors.New("expiry: timestamp is in the past")
+	ErrTooFar  = errors.New("expiry: duration reaches past the year 9999")
+)
+
+// maxYear is the last year an expiry can fall in, later ones have no RFC 3339 form.
+const maxYear = 9999
+
+// maxSeconds is the longest time part that fits a time.Duration.
+var maxSeconds = float64(math.MaxInt64) / float64(time.Second)
+
+// isoDuration matches ISO 8601 durations. Years, months and days follow the calendar,
+// the time part is exact. Fractions are only accepted on seconds.
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// Resolve returns when something expires that is given the value at now. Presets map
+// names to ISO 8601 durations. Never returns nil, whether it is allowed is up to the caller.
+func Resolve(value string, presets map[string]string, now time.Time) (*time.Time, error) {
+	if value == Never {
+		return nil, nil
+	}
+	if duration, ok := presets[value]; ok {
+		value = duration
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		if !at.After(now) {
+			return nil, ErrPast
+		}
+		at = at.UTC()
+		return &at, nil
+	}
+	at, err := AddDuration(now, value)
+	if err != nil {
+		return nil, err
+	}
+	return &at, nil
+}
+
+// AddDuration adds an ISO 8601 duration to from.
+func AddDuration(from time.Time, duration string) (time.Time, error) {
+	parts := isoDuration.FindStringSubmatch(duration)
+	// "P" and "PT" alone match the pattern but say nothing
+	if parts == nil || duration == "P" || duration[len(duration)-1] == 'T' {
+		return time.Time{}, ErrInvalid
+	}
+	var fields [6]int
+	for i := range fields {
+		if parts[i+1] == "" {
+			continue
+		}
+		value, err := strconv.Atoi(parts[i+1])
+		if err != nil {
+			return time.Time{}, ErrInvalid
+		}
+		fields[i] = value
+	}
+	var seconds float64
+	if parts[7] != "" {
+		value, err := strconv.ParseFloat(parts[7], 64)
+		if err != nil {
+			return time.Time{}, ErrInvalid
+		}
+		seconds = value
+	}
+	years, months, weeks, days, hours, minutes := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5]
+	// Larger fields would overflow the date arithmetic before the year could be checked
+	if years > maxYear || months > 12*maxYear || weeks > 53*maxYear || days > 366*maxYear {
+		return time.Time{}, ErrTooFar
+	}
+	timePart := float64(hours)*3600 + float64(minutes)*60 + seconds
+	if timePart >= maxSeconds {
+		return time.Time{}, ErrTooFar
+	}
+	at := from.UTC().AddDate(years, months, weeks*7+days)
+	at = at.Add(time.Duration(timePart * float64(time.Second)))
+	if at.Year() > maxYear {
+		return time.Time{}, ErrTooFar
+	}
+	if !at.After(from) {
+		return time.Time{}, ErrInvalid
+	}
+	return at, nil
+}
@@ -0,0 +1,92 @@
+package expiry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)
+
+func TestAddDuration(t *testing.T) {
+	for duration, want := range map[string]time.Time{
+		"PT5M":           testNow.Add(5 * time.Minute),
+		"PT12H":          testNow.Add(12 * time.Hour),
+		"PT1.5S":         testNow.Add(1500 * time.Millisecond),
+		"P1D":            testNow.AddDate(0, 0, 1),
+		"P2W":            testNow.AddDate(0, 0, 14),
+		"P1Y2M3DT4H5M6S": testNow.AddDate(1, 2, 3).Add(4*time.Hour + 5*time.Minute + 6*time.Second),
+		// Months follow the calendar, January 31st plus a month overflows into March
+		"P1M":   time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC),
+		"PT36H": testNow.Add(36 * time.Hour),
+	} {
+		got, err := AddDuration(testNow, duration)
+		if err != nil {
+			t.Errorf("%s: %v", duration, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: got %s, want %s", duration, got, want)
+		}
+	}
+}
+
+func TestAddDurationRejectsMalformed(t *testing.T) {
+	for _, duration := range []string{"", "P", "PT", "P1DT", "1D", "P1H", "PT1D", "P1.5D", "PT1.5H", "P-1D", "P0D", "PT0S", "p1d", "P1D "} {
+		if _, err := AddDuration(testNow, duration); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected ErrInvalid, got %v", duration, err)
+		}
+	}
+}
+
+func TestAddDurationBoundsHugeValues(t *testing.T) {
+	for _, duration := range []string{
+		"PT9999999999H",
+		"PT999999999999M",
+		"PT99999999999S",
+		"P10000Y",
+		"P8000Y",
+		"P999999999M",
+		"P99999999W",
+		"P99999999D",
+	} {
+		if _, err := AddDuration(testNow, duration); !errors.Is(err, ErrTooFar) {
+			t.Errorf("%s: expected ErrTooFar, got %v", duration, err)
+		}
+	}
+	// Too many digits for an int at all
+	if _, err := AddDuration(testNow, "PT99999999999999999999H"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for an unparsable number, got %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	presets := map[string]string{"1d": "P1D", "3h": "PT3H"}
+
+	at, err := Resolve("1d", presets, testNow)
+	if err != nil || !at.Equal(testNow.AddDate(0, 0, 1)) {
+		t.Fatalf("preset: got %v, %v", at, err)
+	}
+	at, err = Resolve("PT90M", presets, testNow)
+	if err != nil || !at.Equal(testNow.Add(90*time.Minute)) {
+		t.Fatalf("duration: got %v, %v", at, err)
+	}
+	at, err = Resolve("2024-02-01T12:00:00+02:00", presets, testNow)
+	if err != nil || !at.Equal(time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)) || at.Location() != time.UTC {
+		t.Fatalf("timestamp: got %v, %v", at, err)
+	}
+	at, err = Resolve(Never, presets, testNow)
+	if err != nil || at != nil {
+		t.Fatalf("never: got %v, %v", at, err)
+	}
+
+	if _, err := Resolve("2024-01-31T09:59:59Z", presets, testNow); !errors.Is(err, ErrPast) {
+		t.Errorf("expected ErrPast, got %v", err)
+	}
+	if _, err := Resolve("2024-01-31T10:00:00Z", presets, testNow); !errors.Is(err, ErrPast) {
+		t.Errorf("expected ErrPast for now itself, got %v", err)
+	}
+	if _, err := Resolve("1w", presets, testNow); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for an unknown preset, got %v", err)
+	}
+}
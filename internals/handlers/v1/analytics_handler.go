@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"errors"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDownloadEventsLimit = 100
+	maxDownloadEventsLimit     = 1000
+)
+
+// userAndTransferID reads the signed in user and the :transferid parameter,
+// answering the request itself when either is missing or malformed.
+func userAndTransferID(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
+	if !userExists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+	userID, err := uuid.Parse(userIDStr.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+	transferID, err := uuid.Parse(c.Param("transferid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, transferID, true
+}
+
+func respondAnalyticsError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, customerrors.ErrExpiredLink):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+		})
+	case errors.Is(err, customerrors.ErrUnauthorized):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+	default:
+		utils.LogErrorWithStack(c, msg, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+		})
+	}
+}
+
+// DownloadStatsHandler returns download counts of a transfer, in total and per file.
+func (h *Handler) DownloadStatsHandler(c *gin.Context) {
+	userID, transferID, ok := userAndTransferID(c)
+	if !ok {
+		return
+	}
+	stats, err := h.ser.DownloadStatsService(c, transferID, userID)
+	if err != nil {
+		respondAnalyticsError(c, "Internal Server Error in download stats", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    stats,
+	})
+}
+
+// DownloadEventsHandler returns the download log of a transfer, paged with limit and offset.
+func (h *Handler) DownloadEventsHandler(c *gin.Context) {
+	userID, transferID, ok := userAndTransferID(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultDownloadEventsLimit)))
+	if err != nil || limit < 1 || limit > maxDownloadEventsLimit {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+
+	events, err := h.ser.DownloadEventsService(c, transferID, userID, limit, offset)
+	if err != nil {
+		respondAnalyticsError(c, "Internal Server Error in download events", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    events,
+	})
+}
+
+// ExportDownloadEventsHandler sends the whole download log of a transfer as a CSV file.
+func (h *Handler) ExportDownloadEventsHandler(c *gin.Context) {
+	userID, transferID, ok := userAndTransferID(c)
+	if !ok {
+		return
+	}
+	content, err := h.ser.ExportDownloadEventsService(c, transferID, userID)
+	if err != nil {
+		respondAnalyticsError(c, "Internal Server Error in download events export", err)
+		return
+	}
+
+	c.Header("Content-Disposition", utils.ContentDisposition("attachment", transferID.String()+"-downloads.csv"))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", content)
+}
@@ -2,14 +2,17 @@ package v1
 
 import (
 	"errors"
-	"fmt"
 	"io"
+	"large_fss/internals/archive"
 	"large_fss/internals/constants"
 	customerrors "large_fss/internals/customErrors"
 	"large_fss/internals/dto"
 	"large_fss/utils"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -48,19 +51,23 @@ func (h *Handler) CreateTransferHandler(c *gin.Context) {
 		})
 		return
 	}
-	fmt.Println(uploadDTO, "-upload dto")
-
-	if _, err := utils.ParseExpiry(&uploadDTO.Expiry); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
-		})
-		return
-	}
 
 	uploadDTO.OwnerID = userID
 
 	fileID, err := h.ser.CreateTransferService(c, uploadDTO)
 	if err != nil {
+		if errors.Is(err, customerrors.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+			})
+			return
+		}
+		if errors.Is(err, customerrors.ErrExpiryNotAllowed) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.ErrExpiryNotAllowed.Error()},
+			})
+			return
+		}
 		utils.LogErrorWithStack(c, "Internal Server Error (Error in Uploading)", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
@@ -75,6 +82,119 @@ func (h *Handler) CreateTransferHandler(c *gin.Context) {
 	})
 }
 
+func (h *Handler) AppendTransferHandler(c *gin.Context) {
+	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
+	if !userExists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return
+	}
+
+	var appendDTO dto.TransferAppendDTO
+	if err := c.BindJSON(&appendDTO); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	appendDTO.OwnerID = userID
+
+	transferID, err := h.ser.CreateAppendTransferService(c, appendDTO)
+	if err != nil {
+		switch {
+		case errors.Is(err, customerrors.ErrExpiredLink):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+			})
+		case errors.Is(err, customerrors.ErrUnauthorized):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+			})
+		case errors.Is(err, customerrors.LimitExceeded):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": customerrors.LimitExceeded.Error() +
+						" - Max Upload Limit: " + strconv.Itoa(constants.ValidUserMaxUploadSize),
+				},
+			})
+		case errors.Is(err, customerrors.ErrActiveStreams):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": customerrors.ErrActiveStreams.Error()},
+			})
+		case errors.Is(err, customerrors.ErrRequestAlreadyExists):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": customerrors.ErrRequestAlreadyExists.Error()},
+			})
+		case errors.Is(err, customerrors.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error (Error in Appending)", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":        constants.SuccessMessage,
+		"transfer_id":    transferID,
+		"max_chunk_size": constants.MaxChunkSize,
+	})
+}
+
+// UploadSessionsHandler lists the user's uploads that were not assembled yet, with
+// what a client needs to resume them.
+func (h *Handler) UploadSessionsHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	sessions, err := h.ser.GetUploadSessionsService(c, userID)
+	if err != nil {
+		utils.LogErrorWithStack(c, "Internal Server Error in GetUploadSessionsService", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    sessions,
+	})
+}
+
+// ExpiryPolicyHandler returns the expiry presets and bounds that apply to the user.
+func (h *Handler) ExpiryPolicyHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	policy, err := h.ser.ExpiryPolicyService(c, userID)
+	if err != nil {
+		utils.LogErrorWithStack(c, "Internal Server Error in ExpiryPolicyService", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    policy,
+	})
+}
+
 func (h *Handler) GetAllUploadedChunksIndexHandler(c *gin.Context) {
 	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
 	if !userExists {
@@ -282,10 +402,46 @@ func (h *Handler) AssembleFileHandler(c *gin.Context) {
 
 	fileID, err := h.ser.AssembleFileService(c, assembleDTO)
 	if err != nil {
-		utils.LogErrorWithStack(c, "Internal Server Error in AssembleFileService", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
-		})
+		switch {
+		case errors.Is(err, customerrors.ErrUnauthorized):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+			})
+		case errors.Is(err, customerrors.ErrUploadRequestNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrUploadRequestNotFound.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileAlreadyExists), errors.Is(err, customerrors.ErrActiveStreams):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": err.Error()},
+			})
+		case errors.Is(err, customerrors.LimitExceeded):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.LimitExceeded.Error()},
+			})
+		case errors.Is(err, customerrors.ErrArchiveLimitExceeded):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": gin.H{"message": customerrors.ErrArchiveLimitExceeded.Error()},
+			})
+		case errors.Is(err, customerrors.ErrUnsupportedArchive):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": gin.H{"message": customerrors.ErrUnsupportedArchive.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileTypeNotAllowed):
+			var violation *customerrors.FileTypeViolationError
+			errors.As(err, &violation)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": gin.H{
+					"message": customerrors.ErrFileTypeNotAllowed.Error(),
+					"files":   violation.Files,
+				},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error in AssembleFileService", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
 		return
 	}
 
@@ -295,16 +451,7 @@ func (h *Handler) AssembleFileHandler(c *gin.Context) {
 	})
 }
 func (h *Handler) GetTransferInfoHandler(c *gin.Context) {
-	transferIDstr := c.Param("transferid")
-	transferID, err := uuid.Parse(transferIDstr)
-
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
-		})
-		return
-	}
-	transferinfo, err := h.ser.GetTransferInfoService(c, transferID)
+	transferinfo, err := h.ser.GetTransferInfoService(c, c.Param("token"))
 	if err != nil {
 		if errors.Is(err, customerrors.ErrExpiredLink) {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -312,6 +459,24 @@ func (h *Handler) GetTransferInfoHandler(c *gin.Context) {
 			})
 			return
 
+		} else if errors.Is(err, customerrors.ErrDownloadLimitReached) {
+			c.JSON(http.StatusGone, gin.H{
+				"error": gin.H{"message": customerrors.ErrDownloadLimitReached.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrPasswordRequired) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrPasswordRequired.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrRecipientRequired) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrRecipientRequired.Error()},
+			})
+			return
+
 		} else if errors.Is(err, customerrors.ErrFileNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": gin.H{"message": customerrors.ErrFileNotFound.Error()},
@@ -335,6 +500,71 @@ func (h *Handler) GetTransferInfoHandler(c *gin.Context) {
 
 }
 
+// UnlockTransferHandler exchanges the password of a protected transfer for an access
+// cookie scoped to the public transfer routes. The token is returned too for API clients.
+func (h *Handler) UnlockTransferHandler(c *gin.Context) {
+	var unlockDTO dto.TransferUnlockDTO
+	if err := c.BindJSON(&unlockDTO); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+
+	access, err := h.ser.UnlockTransferService(c, c.Param("token"), unlockDTO.Password)
+	if err != nil {
+		var tooMany *customerrors.TooManyAttemptsError
+		switch {
+		case errors.As(err, &tooMany):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(tooMany.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{"message": customerrors.ErrTooManyAttempts.Error()},
+			})
+		case errors.Is(err, customerrors.ErrExpiredLink):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+			})
+		case errors.Is(err, customerrors.ErrDownloadLimitReached):
+			c.JSON(http.StatusGone, gin.H{
+				"error": gin.H{"message": customerrors.ErrDownloadLimitReached.Error()},
+			})
+		case errors.Is(err, customerrors.ErrInvalidPassword):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrInvalidPassword.Error()},
+			})
+		case errors.Is(err, customerrors.ErrRecipientRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrRecipientRequired.Error()},
+			})
+		case errors.Is(err, customerrors.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error in unlock transfer", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		constants.TransferAccessCookiePrefix+access.TransferID.String(),
+		access.Token,
+		constants.TransferAccessTokenTTL,
+		constants.TransferAccessCookiePath,
+		"",
+		true,
+		true,
+	)
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    access,
+	})
+}
+
 func (h *Handler) FileDownloaderHandler(c *gin.Context) {
 	fileIDstr := c.Param("fileid")
 	fileID, err := uuid.Parse(fileIDstr)
@@ -346,14 +576,58 @@ func (h *Handler) FileDownloaderHandler(c *gin.Context) {
 	}
 
 	// Get the file path and deletion flag from service
-	file, filename, err := h.ser.FileDownloaderService(c, fileID)
+	file, filename, contentType, err := h.ser.FileDownloaderService(c, c.Param("token"), fileID)
 	if err != nil {
-		if errors.Is(err, customerrors.ErrFileNotFound) {
+		var busy *customerrors.ServerBusyError
+		if errors.As(err, &busy) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(busy.RetryAfter.Seconds()))))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{"message": customerrors.ErrServerBusy.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrFileNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": gin.H{"message": customerrors.ErrFileNotFound.Error()},
 			})
 			return
 
+		} else if errors.Is(err, customerrors.ErrExpiredLink) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrDownloadLimitReached) {
+			c.JSON(http.StatusGone, gin.H{
+				"error": gin.H{"message": customerrors.ErrDownloadLimitReached.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrPasswordRequired) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrPasswordRequired.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrRecipientRequired) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrRecipientRequired.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrScanPending) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": customerrors.ErrScanPending.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrFileInfected) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{"message": customerrors.ErrFileInfected.Error()},
+			})
+			return
+
 		} else {
 			utils.LogErrorWithStack(c, "Internal Server Error in Getting file path for transfer downloader", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -371,8 +645,9 @@ func (h *Handler) FileDownloaderHandler(c *gin.Context) {
 	}()
 
 	// Set headers for file download
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	c.Header("Content-Type", "application/octet-stream") // Or use http.DetectContentType for dynamic type
+	c.Header("Content-Disposition", utils.ContentDisposition("attachment", filename))
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
 
 	// Stream file to client
 	_, err = io.Copy(c.Writer, file)
@@ -387,31 +662,73 @@ func (h *Handler) FileDownloaderHandler(c *gin.Context) {
 }
 
 func (h *Handler) TransferDownloaderHandler(c *gin.Context) {
-	transferIDstr := c.Param("transferid")
-	transferID, err := uuid.Parse(transferIDstr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
-		})
-		return
+	// Without a format a single file is sent as-is
+	format := archive.FormatUnknown
+	if formatStr := c.Query("format"); formatStr != "" {
+		var err error
+		format, err = archive.ParseFormat(formatStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.ErrUnsupportedFormat.Error()},
+			})
+			return
+		}
 	}
 
 	// Get the file path and deletion flag from service
-	file, filename, err := h.ser.TransferDownloaderService(c, transferID)
+	file, filename, contentType, size, err := h.ser.TransferDownloaderService(c, c.Param("token"), format)
 	if err != nil {
 
-		if errors.Is(err, customerrors.ErrExpiredLink) {
+		var busy *customerrors.ServerBusyError
+		if errors.As(err, &busy) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(busy.RetryAfter.Seconds()))))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{"message": customerrors.ErrServerBusy.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrExpiredLink) {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
 			})
 			return
 
+		} else if errors.Is(err, customerrors.ErrDownloadLimitReached) {
+			c.JSON(http.StatusGone, gin.H{
+				"error": gin.H{"message": customerrors.ErrDownloadLimitReached.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrPasswordRequired) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrPasswordRequired.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrRecipientRequired) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrRecipientRequired.Error()},
+			})
+			return
+
 		} else if errors.Is(err, customerrors.ErrFileNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": gin.H{"message": customerrors.ErrFileNotFound.Error()},
 			})
 			return
 
+		} else if errors.Is(err, customerrors.ErrScanPending) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": customerrors.ErrScanPending.Error()},
+			})
+			return
+
+		} else if errors.Is(err, customerrors.ErrFileInfected) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{"message": customerrors.ErrFileInfected.Error()},
+			})
+			return
+
 		} else {
 			utils.LogErrorWithStack(c, "Internal Server Error in Getting file path for transfer downloader", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -429,43 +746,283 @@ func (h *Handler) TransferDownloaderHandler(c *gin.Context) {
 	}()
 
 	// Set headers for file download
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	c.Header("Content-Type", "application/octet-stream") // Or use http.DetectContentType for dynamic type
+	c.Header("Content-Disposition", utils.ContentDisposition("attachment", filename))
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+	}
 
 	// Stream file to client
 	_, err = io.Copy(c.Writer, file)
 	if err != nil {
 		utils.LogErrorWithStack(c, "Internal Server Error in Streaming Content", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+		// Once the body started the status can't change anymore
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+}
+
+// SelectionDownloaderHandler streams an archive of the files (file_id) and folders (path)
+// named in the query, e.g. ?file_id=<id>&path=photos/2024&format=tar.gz.
+func (h *Handler) SelectionDownloaderHandler(c *gin.Context) {
+	format, err := archive.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnsupportedFormat.Error()},
 		})
 		return
 	}
+	selection := dto.DownloadSelectionDTO{
+		LinkToken: c.Param("token"),
+		Paths:     c.QueryArray("path"),
+		Format:    string(format),
+	}
+	for _, fileIDStr := range c.QueryArray("file_id") {
+		fileID, err := uuid.Parse(fileIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+			})
+			return
+		}
+		selection.FileIDs = append(selection.FileIDs, fileID)
+	}
+
+	file, filename, size, err := h.ser.SelectionDownloaderService(c, selection)
+	if err != nil {
+		var busy *customerrors.ServerBusyError
+		switch {
+		case errors.As(err, &busy):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(busy.RetryAfter.Seconds()))))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{"message": customerrors.ErrServerBusy.Error()},
+			})
+		case errors.Is(err, customerrors.ErrExpiredLink):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+			})
+		case errors.Is(err, customerrors.ErrDownloadLimitReached):
+			c.JSON(http.StatusGone, gin.H{
+				"error": gin.H{"message": customerrors.ErrDownloadLimitReached.Error()},
+			})
+		case errors.Is(err, customerrors.ErrPasswordRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrPasswordRequired.Error()},
+			})
+		case errors.Is(err, customerrors.ErrRecipientRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrRecipientRequired.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileNotInTransfer), errors.Is(err, customerrors.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": err.Error()},
+			})
+		case errors.Is(err, customerrors.ErrScanPending):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": customerrors.ErrScanPending.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileInfected):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{"message": customerrors.ErrFileInfected.Error()},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error in selection downloader", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Disposition", utils.ContentDisposition("attachment", filename))
+	c.Header("Content-Type", archive.ContentType(format))
+	if size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	_, err = io.Copy(c.Writer, file)
+	if err != nil {
+		utils.LogErrorWithStack(c, "Internal Server Error in Streaming Content", err)
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
 }
 
-func (h *Handler) GetAllTransfersHandler(c *gin.Context) {
-	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
-	userID, err := uuid.Parse(userIDStr.(string))
+// Preview responses may only show media, scripts and plugins stay disabled and the
+// document can't be framed elsewhere. Chrome refuses to render PDFs in a sandbox,
+// so they get the policy without it.
+const (
+	previewCSP        = "default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'; frame-ancestors 'self'"
+	previewSandboxCSP = previewCSP + "; sandbox"
+)
+
+// FilePreviewHandler serves a file inline with its sniffed content type for display
+// in the browser. Range requests are honoured so audio and video can seek.
+func (h *Handler) FilePreviewHandler(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("fileid"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": gin.H{
-				"message": customerrors.ErrInvalidId.Error(),
-			},
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
 		})
 		return
 	}
 
-	if !userExists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": gin.H{
-				"message": customerrors.ErrUnauthorized.Error(),
-			},
+	file, filename, mimeType, err := h.ser.FilePreviewService(c, c.Param("token"), fileID)
+	if err != nil {
+		switch {
+		case errors.Is(err, customerrors.ErrFileNotFound), errors.Is(err, customerrors.ErrExpiredLink):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": err.Error()},
+			})
+		case errors.Is(err, customerrors.ErrDownloadLimitReached):
+			c.JSON(http.StatusGone, gin.H{
+				"error": gin.H{"message": customerrors.ErrDownloadLimitReached.Error()},
+			})
+		case errors.Is(err, customerrors.ErrPasswordRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrPasswordRequired.Error()},
+			})
+		case errors.Is(err, customerrors.ErrRecipientRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrRecipientRequired.Error()},
+			})
+		case errors.Is(err, customerrors.ErrPreviewNotSupported):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"error": gin.H{"message": customerrors.ErrPreviewNotSupported.Error()},
+			})
+		case errors.Is(err, customerrors.ErrPreviewLimited):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{"message": customerrors.ErrPreviewLimited.Error()},
+			})
+		case errors.Is(err, customerrors.ErrScanPending):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": customerrors.ErrScanPending.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileInfected):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{"message": customerrors.ErrFileInfected.Error()},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error in file preview", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+	defer file.Close()
+
+	contentType := mimeType
+	if strings.HasPrefix(mimeType, "text/") {
+		contentType += "; charset=utf-8"
+	}
+	csp := previewSandboxCSP
+	if mimeType == "application/pdf" {
+		csp = previewCSP
+	}
+	c.Header("Content-Disposition", utils.ContentDisposition("inline", filename))
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Security-Policy", csp)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Cache-Control", "private, no-cache")
+	// Stored files never change, the id identifies the content for If-Range
+	c.Header("ETag", `"`+fileID.String()+`"`)
+
+	http.ServeContent(c.Writer, c.Request, filename, time.Time{}, file)
+}
+
+// ThumbnailHandler serves the JPEG thumbnail of an image file.
+func (h *Handler) ThumbnailHandler(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("fileid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
 		})
 		return
 	}
-	transferlst, err := h.ser.GetAllTransfersService(c, userID)
+
+	thumb, err := h.ser.ThumbnailService(c, c.Param("token"), fileID)
+	if err != nil {
+		switch {
+		case errors.Is(err, customerrors.ErrFileNotFound), errors.Is(err, customerrors.ErrExpiredLink):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": err.Error()},
+			})
+		case errors.Is(err, customerrors.ErrDownloadLimitReached):
+			c.JSON(http.StatusGone, gin.H{
+				"error": gin.H{"message": customerrors.ErrDownloadLimitReached.Error()},
+			})
+		case errors.Is(err, customerrors.ErrPasswordRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrPasswordRequired.Error()},
+			})
+		case errors.Is(err, customerrors.ErrRecipientRequired):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrRecipientRequired.Error()},
+			})
+		case errors.Is(err, customerrors.ErrScanPending):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": customerrors.ErrScanPending.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileInfected):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{"message": customerrors.ErrFileInfected.Error()},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error in thumbnail", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+	defer thumb.Close()
+
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=3600")
+	_, err = io.Copy(c.Writer, thumb)
+	if err != nil {
+		utils.LogErrorWithStack(c, "Internal Server Error in Streaming Content", err)
+	}
+}
+
+// GetAllTransfersHandler lists a page of the user's transfers. The query string may
+// filter by status, size and creation date, search, sort and continue from a cursor.
+func (h *Handler) GetAllTransfersHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	query, err := transferListQuery(c)
 	if err != nil {
-		utils.LogErrorWithStack(c, "Internal Server Error in AssembleFileService", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	query.OwnerID = userID
+
+	transferlst, err := h.ser.GetAllTransfersService(c, query)
+	if err != nil {
+		if errors.Is(err, customerrors.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+			})
+			return
+		}
+		utils.LogErrorWithStack(c, "Internal Server Error in GetAllTransfersService", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
 		})
@@ -473,13 +1030,48 @@ func (h *Handler) GetAllTransfersHandler(c *gin.Context) {
 
 	}
 
-	c.JSON(http.StatusAccepted, gin.H{
+	c.JSON(http.StatusOK, gin.H{
 		"message": constants.SuccessMessage,
 		"data":    transferlst,
 	})
 
 }
 
+// transferListQuery reads the listing parameters, dates are RFC 3339 and sizes in bytes.
+func transferListQuery(c *gin.Context) (dto.TransferListQueryDTO, error) {
+	query := dto.TransferListQueryDTO{
+		Status: c.Query("status"),
+		Search: c.Query("q"),
+		Sort:   c.Query("sort"),
+		Order:  c.Query("order"),
+		Cursor: c.Query("cursor"),
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(constants.DefaultTransfersLimit)))
+	if err != nil {
+		return query, err
+	}
+	query.Limit = limit
+	for param, size := range map[string]**int64{"min_size": &query.MinSize, "max_size": &query.MaxSize} {
+		if value := c.Query(param); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return query, err
+			}
+			*size = &parsed
+		}
+	}
+	for param, date := range map[string]**time.Time{"created_after": &query.CreatedAfter, "created_before": &query.CreatedBefore} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, err
+			}
+			*date = &parsed
+		}
+	}
+	return query, nil
+}
+
 func (h *Handler) UpdateTransferHandler(c *gin.Context) {
 	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
 	if !userExists {
@@ -526,6 +1118,12 @@ func (h *Handler) UpdateTransferHandler(c *gin.Context) {
 			})
 			return
 
+		} else if errors.Is(err, customerrors.ErrExpiryNotAllowed) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.ErrExpiryNotAllowed.Error()},
+			})
+			return
+
 		} else {
 			utils.LogErrorWithStack(c, "Internal Server Error in Getting file path for transfer downloader", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -594,4 +1192,135 @@ func (h *Handler)DeleteTransferHandler(c *gin.Context){
 		"message": constants.SuccessMessage,
 	})
 
-}
\ No newline at end of file
+}
+
+func (h *Handler) DeleteFileHandler(c *gin.Context) {
+	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
+	if !userExists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return
+	}
+	fileID, err := uuid.Parse(c.Param("fileid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return
+	}
+
+	err = h.ser.DeleteFileService(c, fileID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, customerrors.ErrFileNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrFileNotFound.Error()},
+			})
+		case errors.Is(err, customerrors.ErrExpiredLink):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+			})
+		case errors.Is(err, customerrors.ErrUnauthorized):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+			})
+		case errors.Is(err, customerrors.ErrActiveStreams):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": customerrors.ErrActiveStreams.Error()},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error in DeleteFileService", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": constants.SuccessMessage,
+	})
+}
+
+// RenameFileHandler renames a file of a transfer or moves it to another folder of it.
+func (h *Handler) RenameFileHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	fileID, err := uuid.Parse(c.Param("fileid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return
+	}
+	var updateDTO dto.FileUpdateDTO
+	if err := c.BindJSON(&updateDTO); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	updateDTO.FileID = fileID
+	updateDTO.OwnerID = userID
+
+	fileInfo, err := h.ser.RenameFileService(c, updateDTO)
+	if err != nil {
+		switch {
+		case errors.Is(err, customerrors.ErrInvalidFileName):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": customerrors.ErrInvalidFileName.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrFileNotFound.Error()},
+			})
+		case errors.Is(err, customerrors.ErrExpiredLink):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+			})
+		case errors.Is(err, customerrors.ErrUnauthorized):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileInfected):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{"message": customerrors.ErrFileInfected.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileAlreadyExists), errors.Is(err, customerrors.ErrActiveStreams):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{"message": err.Error()},
+			})
+		case errors.Is(err, customerrors.ErrFileTypeNotAllowed):
+			var violation *customerrors.FileTypeViolationError
+			errors.As(err, &violation)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": gin.H{
+					"message": customerrors.ErrFileTypeNotAllowed.Error(),
+					"files":   violation.Files,
+				},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error in RenameFileService", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    fileInfo,
+	})
+}
@@ -0,0 +1,125 @@
+package v1
+
+import (
+	"errors"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (h *Handler) ImportTransferHandler(c *gin.Context) {
+	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
+	if !userExists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return
+	}
+
+	var importDTO dto.TransferImportDTO
+	if err := c.BindJSON(&importDTO); err != nil || importDTO.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	importDTO.OwnerID = userID
+
+	transferID, err := h.ser.ImportTransferService(c, importDTO)
+	if err != nil {
+		switch {
+		case errors.Is(err, customerrors.ErrURLNotAllowed), errors.Is(err, customerrors.ErrInvalidInput),
+			errors.Is(err, customerrors.ErrExpiryNotAllowed):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{"message": err.Error()},
+			})
+		case errors.Is(err, customerrors.ErrRemoteFetchFailed):
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": gin.H{"message": err.Error()},
+			})
+		case errors.Is(err, customerrors.LimitExceeded):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": gin.H{"message": customerrors.LimitExceeded.Error()},
+			})
+		case errors.Is(err, customerrors.ErrTooManyImports):
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{"message": customerrors.ErrTooManyImports.Error()},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error (Error in Importing)", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":     constants.SuccessMessage,
+		"transfer_id": transferID,
+	})
+}
+
+func (h *Handler) ImportStatusHandler(c *gin.Context) {
+	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
+	if !userExists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return
+	}
+
+	transferID, err := uuid.Parse(c.Param("transferid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return
+	}
+
+	status, err := h.ser.ImportStatusService(c, transferID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, customerrors.ErrUploadRequestNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{"message": customerrors.ErrUploadRequestNotFound.Error()},
+			})
+		case errors.Is(err, customerrors.ErrUnauthorized):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+			})
+		default:
+			utils.LogErrorWithStack(c, "Internal Server Error (Error in Import status)", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"import":  status,
+	})
+}
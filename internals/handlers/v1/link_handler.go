@@ -0,0 +1,153 @@
+package v1
+
+import (
+	"errors"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// userAndLinkID reads the signed in user and the :linkid parameter,
+// answering the request itself when either is missing or malformed.
+func userAndLinkID(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
+	if !userExists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+	userID, err := uuid.Parse(userIDStr.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+	linkID, err := uuid.Parse(c.Param("linkid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, linkID, true
+}
+
+func respondLinkError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, customerrors.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+	case errors.Is(err, customerrors.ErrLinkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{"message": customerrors.ErrLinkNotFound.Error()},
+		})
+	case errors.Is(err, customerrors.ErrExpiredLink):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+		})
+	case errors.Is(err, customerrors.ErrUnauthorized):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+	default:
+		utils.LogErrorWithStack(c, msg, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+		})
+	}
+}
+
+// CreateLinkHandler adds a share link with its own label, expiry and download limit to a transfer.
+func (h *Handler) CreateLinkHandler(c *gin.Context) {
+	userID, transferID, ok := userAndTransferID(c)
+	if !ok {
+		return
+	}
+	var createDTO dto.LinkCreateDTO
+	if err := c.ShouldBindJSON(&createDTO); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	createDTO.TransferID = transferID
+	createDTO.OwnerID = userID
+
+	link, err := h.ser.CreateLinkService(c, createDTO)
+	if err != nil {
+		respondLinkError(c, "Internal Server Error in creating link", err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    link,
+	})
+}
+
+// GetAllLinksHandler lists the share links of a transfer.
+func (h *Handler) GetAllLinksHandler(c *gin.Context) {
+	userID, transferID, ok := userAndTransferID(c)
+	if !ok {
+		return
+	}
+	links, err := h.ser.GetAllLinksService(c, transferID, userID)
+	if err != nil {
+		respondLinkError(c, "Internal Server Error in listing links", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    links,
+	})
+}
+
+// UpdateLinkHandler changes the fields of a link that are present in the body.
+func (h *Handler) UpdateLinkHandler(c *gin.Context) {
+	userID, linkID, ok := userAndLinkID(c)
+	if !ok {
+		return
+	}
+	var updateDTO dto.LinkUpdateDTO
+	if err := c.ShouldBindJSON(&updateDTO); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	updateDTO.LinkID = linkID
+	updateDTO.OwnerID = userID
+
+	link, err := h.ser.UpdateLinkService(c, updateDTO)
+	if err != nil {
+		respondLinkError(c, "Internal Server Error in updating link", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    link,
+	})
+}
+
+// RevokeLinkHandler deletes a share link, other links of the transfer keep working.
+func (h *Handler) RevokeLinkHandler(c *gin.Context) {
+	userID, linkID, ok := userAndLinkID(c)
+	if !ok {
+		return
+	}
+	err := h.ser.RevokeLinkService(c, linkID, userID)
+	if err != nil {
+		respondLinkError(c, "Internal Server Error in revoking link", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+	})
+}
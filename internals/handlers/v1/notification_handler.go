@@ -0,0 +1,177 @@
+package v1
+
+import (
+	"errors"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultNotificationsLimit = 50
+	maxNotificationsLimit     = 200
+)
+
+// signedInUserID reads the signed in user, answering the request itself when it is missing or malformed.
+func signedInUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDStr, userExists := c.Get(constants.ClaimPrimaryKey)
+	if !userExists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(userIDStr.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func respondNotificationError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, customerrors.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+	case errors.Is(err, customerrors.ErrNotificationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{"message": customerrors.ErrNotificationNotFound.Error()},
+		})
+	default:
+		utils.LogErrorWithStack(c, msg, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+		})
+	}
+}
+
+// GetNotificationsHandler lists the in-app notifications of the user, ?unread=true for unread ones only.
+func (h *Handler) GetNotificationsHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultNotificationsLimit)))
+	if err != nil || limit < 1 || limit > maxNotificationsLimit {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	unreadOnly, err := strconv.ParseBool(c.DefaultQuery("unread", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+
+	notifications, err := h.ser.GetNotificationsService(c, userID, unreadOnly, limit, offset)
+	if err != nil {
+		respondNotificationError(c, "Internal Server Error in listing notifications", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    notifications,
+	})
+}
+
+// MarkNotificationReadHandler marks one notification of the user as read.
+func (h *Handler) MarkNotificationReadHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	notificationID, err := uuid.Parse(c.Param("notificationid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return
+	}
+	err = h.ser.MarkNotificationReadService(c, notificationID, userID)
+	if err != nil {
+		respondNotificationError(c, "Internal Server Error in marking notification read", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+	})
+}
+
+// MarkAllNotificationsReadHandler marks every notification of the user as read.
+func (h *Handler) MarkAllNotificationsReadHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	err := h.ser.MarkAllNotificationsReadService(c, userID)
+	if err != nil {
+		respondNotificationError(c, "Internal Server Error in marking notifications read", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+	})
+}
+
+// GetNotificationPreferencesHandler returns the channels of every kind of notification.
+func (h *Handler) GetNotificationPreferencesHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	preferences, err := h.ser.GetNotificationPreferencesService(c, userID)
+	if err != nil {
+		respondNotificationError(c, "Internal Server Error in getting notification preferences", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    preferences,
+	})
+}
+
+// UpdateNotificationPreferencesHandler switches the email and in-app channels per kind of notification.
+func (h *Handler) UpdateNotificationPreferencesHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	var updateDTO dto.NotificationPreferencesUpdateDTO
+	if err := c.ShouldBindJSON(&updateDTO); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	updateDTO.UserID = userID
+
+	preferences, err := h.ser.UpdateNotificationPreferencesService(c, updateDTO)
+	if err != nil {
+		respondNotificationError(c, "Internal Server Error in updating notification preferences", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    preferences,
+	})
+}
@@ -0,0 +1,171 @@
+package v1
+
+import (
+	"errors"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func respondRecipientError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, customerrors.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+	case errors.Is(err, customerrors.ErrUserNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrUserNotFound.Error()},
+		})
+	case errors.Is(err, customerrors.ErrInvalidCode):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidCode.Error()},
+		})
+	case errors.Is(err, customerrors.ErrRecipientNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{"message": customerrors.ErrRecipientNotFound.Error()},
+		})
+	case errors.Is(err, customerrors.ErrExpiredLink):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+		})
+	case errors.Is(err, customerrors.ErrDownloadLimitReached):
+		c.JSON(http.StatusGone, gin.H{
+			"error": gin.H{"message": customerrors.ErrDownloadLimitReached.Error()},
+		})
+	case errors.Is(err, customerrors.ErrUnauthorized):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+	default:
+		utils.LogErrorWithStack(c, msg, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+		})
+	}
+}
+
+// AddRecipientsHandler adds emails and registered users to the recipients of a transfer.
+func (h *Handler) AddRecipientsHandler(c *gin.Context) {
+	userID, transferID, ok := userAndTransferID(c)
+	if !ok {
+		return
+	}
+	var addDTO dto.RecipientAddDTO
+	if err := c.ShouldBindJSON(&addDTO); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	addDTO.TransferID = transferID
+	addDTO.OwnerID = userID
+
+	recipients, err := h.ser.AddRecipientsService(c, addDTO)
+	if err != nil {
+		respondRecipientError(c, "Internal Server Error in adding recipients", err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    recipients,
+	})
+}
+
+// GetRecipientsHandler lists the recipients of a transfer with their access and download status.
+func (h *Handler) GetRecipientsHandler(c *gin.Context) {
+	userID, transferID, ok := userAndTransferID(c)
+	if !ok {
+		return
+	}
+	recipients, err := h.ser.GetRecipientsService(c, transferID, userID)
+	if err != nil {
+		respondRecipientError(c, "Internal Server Error in listing recipients", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    recipients,
+	})
+}
+
+// RemoveRecipientHandler takes a recipient off a transfer.
+func (h *Handler) RemoveRecipientHandler(c *gin.Context) {
+	userID, ok := signedInUserID(c)
+	if !ok {
+		return
+	}
+	recipientID, err := uuid.Parse(c.Param("recipientid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidId.Error()},
+		})
+		return
+	}
+
+	err = h.ser.RemoveRecipientService(c, recipientID, userID)
+	if err != nil {
+		respondRecipientError(c, "Internal Server Error in removing recipient", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+	})
+}
+
+// RequestRecipientCodeHandler emails a one-time code to a guest recipient of a private transfer.
+// It answers the same whether or not the email is a recipient.
+func (h *Handler) RequestRecipientCodeHandler(c *gin.Context) {
+	var requestDTO dto.RecipientCodeRequestDTO
+	if err := c.ShouldBindJSON(&requestDTO); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	err := h.ser.RequestRecipientCodeService(c, c.Param("token"), requestDTO.Email)
+	if err != nil {
+		respondRecipientError(c, "Internal Server Error in sending recipient code", err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": constants.SuccessMessage,
+	})
+}
+
+// VerifyRecipientCodeHandler exchanges an emailed code for an access cookie scoped to the
+// public transfer routes. The token is returned too for API clients.
+func (h *Handler) VerifyRecipientCodeHandler(c *gin.Context) {
+	var verifyDTO dto.RecipientVerifyDTO
+	if err := c.ShouldBindJSON(&verifyDTO); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	access, err := h.ser.VerifyRecipientCodeService(c, c.Param("token"), verifyDTO.Email, verifyDTO.Code)
+	if err != nil {
+		respondRecipientError(c, "Internal Server Error in verifying recipient code", err)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		constants.RecipientAccessCookiePrefix+access.TransferID.String(),
+		access.Token,
+		constants.RecipientAccessTokenTTL,
+		constants.TransferAccessCookiePath,
+		"",
+		true,
+		true,
+	)
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+		"data":    access,
+	})
+}
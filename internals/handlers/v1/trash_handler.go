@@ -0,0 +1,83 @@
+package v1
+
+import (
+	"errors"
+	"io"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func respondTrashError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, customerrors.ErrExpiredLink):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{"message": customerrors.ErrExpiredLink.Error()},
+		})
+	case errors.Is(err, customerrors.ErrUnauthorized):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{"message": customerrors.ErrUnauthorized.Error()},
+		})
+	case errors.Is(err, customerrors.ErrNotInTrash), errors.Is(err, customerrors.ErrActiveStreams):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": gin.H{"message": err.Error()},
+		})
+	case errors.Is(err, customerrors.ErrInvalidInput), errors.Is(err, customerrors.ErrExpiryNotAllowed),
+		errors.Is(err, customerrors.ErrDownloadLimitReached):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": err.Error()},
+		})
+	default:
+		utils.LogErrorWithStack(c, msg, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{"message": customerrors.ErrInternalServer.Error()},
+		})
+	}
+}
+
+// RestoreTransferHandler takes a transfer out of the trash. The body is optional and may
+// give a new expiry or download limit, which expired or used up transfers need.
+func (h *Handler) RestoreTransferHandler(c *gin.Context) {
+	userID, transferID, ok := userAndTransferID(c)
+	if !ok {
+		return
+	}
+	var restoreDTO dto.TransferRestoreDTO
+	if err := c.ShouldBindJSON(&restoreDTO); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{"message": customerrors.ErrInvalidInput.Error()},
+		})
+		return
+	}
+	restoreDTO.TransferID = transferID
+	restoreDTO.OwnerID = userID
+
+	err := h.ser.RestoreTransferService(c, restoreDTO)
+	if err != nil {
+		respondTrashError(c, "Internal Server Error in RestoreTransferService", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": constants.SuccessMessage,
+	})
+}
+
+// PurgeTransferHandler deletes a trashed transfer for good.
+func (h *Handler) PurgeTransferHandler(c *gin.Context) {
+	userID, transferID, ok := userAndTransferID(c)
+	if !ok {
+		return
+	}
+	err := h.ser.PurgeTransferService(c, transferID, userID)
+	if err != nil {
+		respondTrashError(c, "Internal Server Error in PurgeTransferService", err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": constants.SuccessMessage,
+	})
+}
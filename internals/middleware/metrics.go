@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	customerrors "large_fss/internals/customErrors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsTokenMiddleware lets through requests carrying the operator's metrics token
+// as "Authorization: Bearer <token>".
+func MetricsTokenMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{
+					"message": customerrors.ErrInvalidToken.Error(),
+				},
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -12,6 +12,8 @@ type User struct {
 	Password  string    `json:"-" db:"password"`
 	FirstName string    `json:"first_name" db:"first_name"`
 	LastName  string    `json:"last_name" db:"last_name"`
+	Plan      string    `json:"plan" db:"plan"`
+	Role      string    `json:"role" db:"role"`
 }
 
 type Transfer struct {
@@ -22,32 +24,132 @@ type Transfer struct {
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	Expiry       *time.Time `json:"expiry" db:"expiry"`
 	Message      string     `json:"message" db:"message"`
+	ScanStatus   string     `json:"scan_status" db:"scan_status"`
+	// Downloads allowed before the transfer is deleted, nil for no limit
+	MaxDownloads  *int   `json:"max_downloads" db:"max_downloads"`
+	DownloadCount int    `json:"download_count" db:"download_count"`
+	PasswordHash  string `json:"-" db:"password_hash"` // bcrypt hash, empty when the transfer is not protected
+	Private       bool   `json:"private" db:"private"` // Only the owner and the recipients may open it
+	// Set once, when the owner was notified
+	FirstDownloadedAt *time.Time `json:"first_downloaded_at" db:"first_downloaded_at"`
+	AllDownloadedAt   *time.Time `json:"all_downloaded_at" db:"all_downloaded_at"`
+	TrashedAt         *time.Time `json:"trashed_at" db:"trashed_at"` // Set while in the trash, recipients can't open it
+}
+
+// TransferFilter selects a page of a user's transfers. Unset fields don't filter.
+type TransferFilter struct {
+	OwnerID       uuid.UUID
+	Status        string // One of the constants.TransferStatus values
+	MinSize       *int64
+	MaxSize       *int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Search        string // Words matched as prefixes against the message and the file names
+	Sort          string // One of the constants.TransferSort values
+	Descending    bool
+	After         *TransferCursor // Position of the last transfer of the previous page
+	Limit         int
+}
+
+// TransferCursor is the position of a transfer in a sorted listing, its sort value and
+// its ID to break ties. Time sorts hold the value as RFC 3339 or "infinity".
+type TransferCursor struct {
+	Value string
+	ID    uuid.UUID
 }
 
 type File struct {
-	ID                uuid.UUID `json:"id" db:"id"`
-	FileName          string    `json:"file_name" db:"file_name"`
-	FileSize          int64     `json:"file_size" db:"file_size"`
-	FilePath          string    `json:"file_path" db:"file_path"`
-	TransferID        uuid.UUID `json:"transfer_id" db:"transfer_id"`
-	FileExtension     string    `json:"file_extension" db:"file_extension"`
-	NumOfActiveStream int       `json:"num_of_active_stream" db:"num_of_active_stream"`
+	ID            uuid.UUID  `json:"id" db:"id"`
+	FileName      string     `json:"file_name" db:"file_name"`
+	FileSize      int64      `json:"file_size" db:"file_size"`
+	FilePath      string     `json:"file_path" db:"file_path"`
+	TransferID    uuid.UUID  `json:"transfer_id" db:"transfer_id"`
+	FileExtension string     `json:"file_extension" db:"file_extension"`
+	ScanStatus    string     `json:"scan_status" db:"scan_status"`
+	MimeType      string     `json:"mime_type" db:"mime_type"`
+	ThumbnailPath string     `json:"thumbnail_path" db:"thumbnail_path"`
+	DownloadedAt  *time.Time `json:"downloaded_at" db:"downloaded_at"` // First completed download containing the file
+}
+
+// DownloadEvent is one download of a file or of an archive of a transfer.
+type DownloadEvent struct {
+	ID          uuid.UUID     `json:"id" db:"id"`
+	TransferID  uuid.UUID     `json:"transfer_id" db:"transfer_id"`
+	FileID      uuid.NullUUID `json:"file_id" db:"file_id"`           // Null for archive downloads
+	LinkID      uuid.NullUUID `json:"link_id" db:"link_id"`           // Share link the download came through
+	RecipientID uuid.NullUUID `json:"recipient_id" db:"recipient_id"` // Recipient of a private transfer who downloaded
+	Kind        string        `json:"kind" db:"kind"`
+	BytesSent   int64         `json:"bytes_sent" db:"bytes_sent"`
+	Completed   bool          `json:"completed" db:"completed"`
+	ClientIP    string        `json:"client_ip" db:"client_ip"`
+	UserAgent   string        `json:"user_agent" db:"user_agent"`
+	CreatedAt   time.Time     `json:"created_at" db:"created_at"`
+}
+
+// DownloadStats aggregates the download events of a transfer, or of one of its files.
+type DownloadStats struct {
+	TransferID     uuid.UUID     `db:"transfer_id"`
+	FileID         uuid.NullUUID `db:"file_id"`
+	Downloads      int64         `db:"downloads"`
+	Completed      int64         `db:"completed"`
+	BytesSent      int64         `db:"bytes_sent"`
+	LastDownloadAt *time.Time    `db:"last_download_at"`
+}
+
+// StoredObject records the checksum and sniffed type of a stored file of a
+// transfer, including files inside extracted folders that have no File row.
+type StoredObject struct {
+	Path       string    `json:"path" db:"path"`
+	TransferID uuid.UUID `json:"transfer_id" db:"transfer_id"`
+	Size       int64     `json:"size" db:"size"`
+	CRC32      int64     `json:"crc32" db:"crc32"`
+	MimeType   string    `json:"mime_type" db:"mime_type"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type TempTransfer struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	OwnerID     uuid.UUID `json:"owner_id" db:"owner_id"`
-	Message     string    `json:"message" db:"message"`
-	Size        int64     `json:"size" db:"size"`
-	Expiry      string    `json:"expiry" db:"expiry"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	LastUpdated time.Time `json:"last_updated" db:"last_updated"`
+	ID           uuid.UUID  `json:"id" db:"id"`
+	OwnerID      uuid.UUID  `json:"owner_id" db:"owner_id"`
+	Message      string     `json:"message" db:"message"`
+	Size         int64      `json:"size" db:"size"`
+	Expiry       *time.Time `json:"expiry" db:"expiry"`  // Computed when the upload starts, nil never expires
+	ExpiryValue  string     `json:"-" db:"expiry_value"` // As picked, resolved again once assembled
+	StoreAsIs    bool       `json:"store_as_is" db:"store_as_is"`
+	FileName     string     `json:"file_name" db:"file_name"`
+	MaxDownloads *int       `json:"max_downloads" db:"max_downloads"`
+	PasswordHash string     `json:"-" db:"password_hash"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	LastUpdated  time.Time  `json:"last_updated" db:"last_updated"`
+}
+
+// UploadSession is an upload that was not assembled yet, with what it received so far.
+type UploadSession struct {
+	TempTransfer
+	UploadedChunks int   `db:"uploaded_chunks"` // Distinct chunk indexes
+	ReceivedBytes  int64 `db:"received_bytes"`
+	Append         bool  `db:"append"`     // Adds files to the existing transfer with the same ID
+	URLImport      bool  `db:"url_import"` // Downloaded by the server, never resumed by a client
+	ChunkIndexes   []int `db:"-"`          // Distinct chunk indexes, ascending
+}
+
+// URLImport is the state of a url import, saved as it progresses.
+type URLImport struct {
+	TransferID    uuid.UUID  `db:"transfer_id"`
+	OwnerID       uuid.UUID  `db:"owner_id"`
+	Status        string     `db:"status"`
+	BytesReceived int64      `db:"bytes_received"`
+	TotalBytes    int64      `db:"total_bytes"`   // -1 when the remote server did not send a size
+	ErrorMessage  string     `db:"error_message"` // Safe to show to the owner
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+	FinishedAt    *time.Time `db:"finished_at"`
 }
 
 type Chunk struct {
 	ID         uuid.UUID `json:"id" db:"id"`
 	TranferID  uuid.UUID `json:"transfer_id" db:"transfer_id"`
 	Index      int       `json:"index" db:"index"`
+	Size       int64     `json:"size" db:"size"`
 	UploadedAt time.Time `json:"uploaded_at" db:"uploaded_at"`
 }
 
@@ -59,16 +161,74 @@ type SysFileInfo struct {
 	Path    string    `json:"path"`
 }
 
-// type Link struct {
-// 	ID          uuid.UUID `json:"id" db:"id"`                 // UUID
-// 	FileID      uuid.UUID `json:"file_id" db:"file_id"`       // FK to File.ID
-// 	Type        string    `json:"type" db:"type"`             // "public" or "private"
-// 	AccessList  []string  `json:"access_list" db:"-"`         // Not directly DB-storable
-// 	CreatedByID string    `json:"created_by" db:"created_by"` // FK to User.ID
-// 	ExpiresAt   string    `json:"expires_at" db:"expires_at"` // Optional expiration
-// }
+// Link is a share link of a transfer. Public routes resolve transfers through the
+// link token only, so a link can be disabled or revoked without touching the transfer.
+type Link struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	TransferID     uuid.UUID  `json:"transfer_id" db:"transfer_id"`
+	Token          string     `json:"token" db:"token"`
+	Label          string     `json:"label" db:"label"`
+	ExpiresAt      *time.Time `json:"expires_at" db:"expires_at"`       // Nil follows the transfer's expiry
+	MaxDownloads   *int       `json:"max_downloads" db:"max_downloads"` // Downloads allowed through this link, nil for no limit
+	DownloadCount  int        `json:"download_count" db:"download_count"`
+	BytesPerSecond *int64     `json:"bytes_per_second" db:"bytes_per_second"` // Bandwidth shared by downloads through this link, nil for no limit
+	Enabled        bool       `json:"enabled" db:"enabled"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// TransferRecipient may open a private transfer, either signed in as the registered
+// user or, as a guest, with a one-time code emailed to the address.
+type TransferRecipient struct {
+	ID            uuid.UUID     `json:"id" db:"id"`
+	TransferID    uuid.UUID     `json:"transfer_id" db:"transfer_id"`
+	Email         string        `json:"email" db:"email"`     // Lower case
+	UserID        uuid.NullUUID `json:"user_id" db:"user_id"` // Set when the email belongs to a registered user
+	CodeHash      string        `json:"-" db:"code_hash"`     // bcrypt hash of the pending one-time code, empty when none
+	CodeExpiresAt *time.Time    `json:"-" db:"code_expires_at"`
+	CodeSentAt    *time.Time    `json:"-" db:"code_sent_at"`
+	CodeAttempts  int           `json:"-" db:"code_attempts"` // Wrong codes entered for the pending code
+	LastAccessAt  *time.Time    `json:"last_access_at" db:"last_access_at"`
+	CreatedAt     time.Time     `json:"created_at" db:"created_at"`
+}
+
+// RecipientStatus is a recipient with the totals of its downloads.
+type RecipientStatus struct {
+	TransferRecipient
+	Downloads      int64      `db:"downloads"`
+	Completed      int64      `db:"completed"`
+	LastDownloadAt *time.Time `db:"last_download_at"`
+}
+
+// Notification is an in-app notification about one of the user's transfers. The transfer
+// may be gone by the time it is read.
+type Notification struct {
+	ID         uuid.UUID     `json:"id" db:"id"`
+	UserID     uuid.UUID     `json:"user_id" db:"user_id"`
+	TransferID uuid.NullUUID `json:"transfer_id" db:"transfer_id"`
+	Kind       string        `json:"kind" db:"kind"`
+	Subject    string        `json:"subject" db:"subject"`
+	Message    string        `json:"message" db:"message"`
+	ReadAt     *time.Time    `json:"read_at" db:"read_at"`
+	CreatedAt  time.Time     `json:"created_at" db:"created_at"`
+}
 
-// type LinkAccess struct {
-// 	LinkID uuid.UUID `db:"link_id"`
-// 	UserID uuid.UUID `db:"user_id"`
-// }
+// NotificationPreference is the channels a user wants one kind of notification on.
+// Kinds without a row are sent on every channel.
+type NotificationPreference struct {
+	UserID uuid.UUID `json:"user_id" db:"user_id"`
+	Kind   string    `json:"kind" db:"kind"`
+	Email  bool      `json:"email" db:"email"`
+	InApp  bool      `json:"in_app" db:"in_app"`
+}
+
+// ArchiveCacheEntry is a pre-built archive of a whole transfer kept in storage. The key
+// is derived from the archived content, so it stops matching once any file changes.
+type ArchiveCacheEntry struct {
+	Key        string    `json:"key" db:"key"`
+	TransferID uuid.UUID `json:"transfer_id" db:"transfer_id"`
+	Format     string    `json:"format" db:"format"`
+	Path       string    `json:"path" db:"path"`
+	Size       int64     `json:"size" db:"size"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
+}
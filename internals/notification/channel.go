@@ -0,0 +1,73 @@
+package notification
+
+import (
+	"context"
+	"large_fss/internals/models"
+
+	"github.com/google/uuid"
+)
+
+// Names of the channels users pick per kind of event
+const (
+	ChannelEmail = "email"
+	ChannelInApp = "in_app"
+)
+
+// Event is something that happened to one of a user's transfers.
+type Event struct {
+	Kind       string
+	TransferID uuid.UUID
+	Subject    string
+	Message    string
+}
+
+// Channel delivers events to users.
+type Channel interface {
+	Name() string
+	Deliver(ctx context.Context, user models.User, event Event) error
+}
+
+// EmailChannel delivers events through a Notifier, such as SMTP.
+type EmailChannel struct {
+	notifier Notifier
+}
+
+func NewEmailChannel(notifier Notifier) Channel {
+	return &EmailChannel{notifier: notifier}
+}
+
+func (e *EmailChannel) Name() string {
+	return ChannelEmail
+}
+
+func (e *EmailChannel) Deliver(ctx context.Context, user models.User, event Event) error {
+	return e.notifier.Notify(ctx, user, event.Subject, event.Message)
+}
+
+// Store keeps in-app notifications until their user reads them.
+type Store interface {
+	CreateNotification(ctx context.Context, notification models.Notification) error
+}
+
+// InAppChannel stores events for the notifications API.
+type InAppChannel struct {
+	store Store
+}
+
+func NewInAppChannel(store Store) Channel {
+	return &InAppChannel{store: store}
+}
+
+func (i *InAppChannel) Name() string {
+	return ChannelInApp
+}
+
+func (i *InAppChannel) Deliver(ctx context.Context, user models.User, event Event) error {
+	return i.store.CreateNotification(ctx, models.Notification{
+		UserID:     user.ID,
+		TransferID: uuid.NullUUID{UUID: event.TransferID, Valid: event.TransferID != uuid.Nil},
+		Kind:       event.Kind,
+		Subject:    event.Subject,
+		Message:    event.Message,
+	})
+}
@@ -0,0 +1,24 @@
+package notification
+
+import (
+	"context"
+	"large_fss/internals/models"
+	"log"
+)
+
+// Notifier delivers a message to a user.
+type Notifier interface {
+	Notify(ctx context.Context, user models.User, subject string, message string) error
+}
+
+// LogNotifier writes notifications to the application log.
+type LogNotifier struct{}
+
+func NewLogNotifier() Notifier {
+	return &LogNotifier{}
+}
+
+func (l *LogNotifier) Notify(ctx context.Context, user models.User, subject string, message string) error {
+	log.Printf("notification to %s: %s - %s", user.Email, subject, message)
+	return nil
+}
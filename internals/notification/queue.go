@@ -0,0 +1,51 @@
+package notification
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Queue sends notifications in the background on a fixed number of workers, so slow
+// mail servers hold up neither requests nor cron jobs. When it is full new jobs are
+// dropped and logged rather than piling up goroutines.
+type Queue struct {
+	jobs    chan queuedJob
+	timeout time.Duration
+}
+
+type queuedJob struct {
+	name string
+	send func(ctx context.Context) error
+}
+
+// NewQueue starts workers that each send one job at a time, within timeout.
+func NewQueue(workers int, capacity int, timeout time.Duration) *Queue {
+	q := &Queue{jobs: make(chan queuedJob, capacity), timeout: timeout}
+	for range workers {
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue schedules send, named in the log when it fails. It reports false when the
+// queue is full and the job was dropped.
+func (q *Queue) Enqueue(name string, send func(ctx context.Context) error) bool {
+	select {
+	case q.jobs <- queuedJob{name: name, send: send}:
+		return true
+	default:
+		log.Printf("notification queue: full, dropped %s", name)
+		return false
+	}
+}
+
+func (q *Queue) work() {
+	for job := range q.jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+		if err := job.send(ctx); err != nil {
+			log.Printf("notification queue: failed to send %s: %v", job.name, err)
+		}
+		cancel()
+	}
+}
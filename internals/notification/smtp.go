@@ -0,0 +1,125 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"large_fss/internals/models"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPConfig is the mail server notifications are sent through. Without a username
+// the server is used unauthenticated, as local SMTP stand-ins expect.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// A whole delivery, from dialing to QUIT, must not take longer than this even when
+// the caller's context has no deadline.
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier emails notifications.
+type SMTPNotifier struct {
+	host string
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPNotifier(cfg SMTPConfig) Notifier {
+	notifier := &SMTPNotifier{
+		host: cfg.Host,
+		addr: net.JoinHostPort(cfg.Host, cfg.Port),
+		from: cfg.From,
+	}
+	if cfg.Username != "" {
+		// PlainAuth only sends credentials over TLS or to localhost
+		notifier.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return notifier
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, user models.User, subject string, message string) error {
+	if strings.ContainsAny(user.Email, "\r\n") {
+		return fmt.Errorf("smtp notifier: invalid recipient address %q", user.Email)
+	}
+	var mail bytes.Buffer
+	fmt.Fprintf(&mail, "From: %s\r\n", n.from)
+	fmt.Fprintf(&mail, "To: %s\r\n", user.Email)
+	fmt.Fprintf(&mail, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)))
+	fmt.Fprintf(&mail, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	mail.WriteString("MIME-Version: 1.0\r\n")
+	mail.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	mail.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	mail.WriteString(strings.ReplaceAll(message, "\n", "\r\n"))
+	mail.WriteString("\r\n")
+
+	if err := n.send(ctx, user.Email, mail.Bytes()); err != nil {
+		return fmt.Errorf("smtp notifier: send to %s: %w", user.Email, err)
+	}
+	return nil
+}
+
+// send delivers the mail like smtp.SendMail, over a connection that is bound to the
+// context and to smtpTimeout.
+func (n *SMTPNotifier) send(ctx context.Context, to string, mail []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	// A cancelled context interrupts whatever the client is waiting for
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := client.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	body, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := body.Write(mail); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
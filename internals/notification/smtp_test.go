@@ -0,0 +1,158 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"large_fss/internals/models"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts one session at a time and records the mail it was given.
+// rcptReply replaces the answer to RCPT TO when set.
+type fakeSMTPServer struct {
+	listener  net.Listener
+	rcptReply string
+	mails     chan string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return &fakeSMTPServer{listener: listener, mails: make(chan string, 1)}
+}
+
+func (f *fakeSMTPServer) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.session(conn)
+	}
+}
+
+func (f *fakeSMTPServer) session(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 fake ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(command, "MAIL FROM"):
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO"):
+			if f.rcptReply != "" {
+				reply(f.rcptReply)
+				continue
+			}
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 go ahead")
+			var mail strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				mail.WriteString(line)
+			}
+			f.mails <- mail.String()
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (f *fakeSMTPServer) notifier() Notifier {
+	host, port, _ := net.SplitHostPort(f.listener.Addr().String())
+	return NewSMTPNotifier(SMTPConfig{Host: host, Port: port, From: "noreply@example.com"})
+}
+
+func TestSMTPNotifierSendsMail(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	go server.serve()
+
+	err := server.notifier().Notify(context.Background(), models.User{Email: "user@example.com"}, "Hello", "line one\nline two")
+	if err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	select {
+	case mail := <-server.mails:
+		for _, want := range []string{"From: noreply@example.com\r\n", "To: user@example.com\r\n", "Subject: Hello\r\n", "line one\r\nline two\r\n"} {
+			if !strings.Contains(mail, want) {
+				t.Errorf("mail is missing %q:\n%s", want, mail)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+}
+
+func TestSMTPNotifierReportsRejectedRecipient(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	server.rcptReply = "550 no such user"
+	go server.serve()
+
+	err := server.notifier().Notify(context.Background(), models.User{Email: "nobody@example.com"}, "Hello", "body")
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("expected the 550 rejection, got %v", err)
+	}
+}
+
+func TestSMTPNotifierStopsWithContext(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	// Accepts the connection but never greets
+	go func() {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(10 * time.Second)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := server.notifier().Notify(ctx, models.User{Email: "user@example.com"}, "Hello", "body")
+	if err == nil {
+		t.Fatal("expected an error from a server that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("notify returned after %s, the context expired after 200ms", elapsed)
+	}
+}
+
+func TestSMTPNotifierRejectsHeaderInjection(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	err := server.notifier().Notify(context.Background(), models.User{Email: "user@example.com\r\nBcc: other@example.com"}, "Hello", "body")
+	if err == nil {
+		t.Fatal("expected an invalid recipient error")
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		t.Fatalf("the address should be refused before dialing, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"large_fss/internals/models"
+
+	"github.com/google/uuid"
+)
+
+func (p *PostgresSQLDB) CreateDownloadEvent(ctx context.Context, event models.DownloadEvent) error {
+	event.ID = uuid.New()
+	query := `
+		INSERT INTO download_events (id, transfer_id, file_id, link_id, recipient_id, kind, bytes_sent, completed, client_ip, user_agent)
+		VALUES (:id, :transfer_id, :file_id, :link_id, :recipient_id, :kind, :bytes_sent, :completed, :client_ip, :user_agent)`
+
+	_, err := p.db.NamedExecContext(ctx, query, &event)
+	if err != nil {
+		return fmt.Errorf("postgres: create download event for transfer %s: %w", event.TransferID, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) FindDownloadEventsByTransferID(ctx context.Context, transferID uuid.UUID, limit int, offset int) ([]models.DownloadEvent, error) {
+	query := `SELECT * FROM download_events WHERE transfer_id = $1 ORDER BY created_at DESC, id LIMIT $2 OFFSET $3`
+	var queryLimit interface{}
+	if limit > 0 {
+		queryLimit = limit
+	}
+	events := []models.DownloadEvent{}
+	err := p.db.SelectContext(ctx, &events, query, transferID, queryLimit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find download events by TransferID %s: %w", transferID, err)
+	}
+	return events, nil
+}
+
+func (p *PostgresSQLDB) FindDownloadStatsByTransferID(ctx context.Context, transferID uuid.UUID) ([]models.DownloadStats, error) {
+	query := `
+		SELECT transfer_id, file_id, COUNT(*) AS downloads,
+			COUNT(*) FILTER (WHERE completed) AS completed,
+			COALESCE(SUM(bytes_sent), 0) AS bytes_sent,
+			MAX(created_at) AS last_download_at
+		FROM download_events
+		WHERE transfer_id = $1
+		GROUP BY transfer_id, file_id`
+	var stats []models.DownloadStats
+	err := p.db.SelectContext(ctx, &stats, query, transferID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find download stats by TransferID %s: %w", transferID, err)
+	}
+	return stats, nil
+}
+
+func (p *PostgresSQLDB) FindDownloadStatsByTransferIDs(ctx context.Context, transferIDs []uuid.UUID) ([]models.DownloadStats, error) {
+	query := `
+		SELECT e.transfer_id, COUNT(*) AS downloads,
+			COUNT(*) FILTER (WHERE e.completed) AS completed,
+			COALESCE(SUM(e.bytes_sent), 0) AS bytes_sent,
+			MAX(e.created_at) AS last_download_at
+		FROM download_events e
+		WHERE e.transfer_id = ANY($1::uuid[])
+		GROUP BY e.transfer_id`
+	var stats []models.DownloadStats
+	err := p.db.SelectContext(ctx, &stats, query, uuidArray(transferIDs))
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find download stats by TransferIDs: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"large_fss/internals/models"
+
+	"github.com/google/uuid"
+)
+
+func (p *PostgresSQLDB) FindArchiveCacheEntry(ctx context.Context, key string) (*models.ArchiveCacheEntry, error) {
+	query := `SELECT * FROM archive_cache WHERE key = $1`
+	var entry models.ArchiveCacheEntry
+	err := p.db.GetContext(ctx, &entry, query, key)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find archive cache entry %s: %w", key, err)
+	}
+	return &entry, nil
+}
+
+func (p *PostgresSQLDB) CreateArchiveCacheEntry(ctx context.Context, entry models.ArchiveCacheEntry) error {
+	query := `
+		INSERT INTO archive_cache (key, transfer_id, format, path, size)
+		VALUES (:key, :transfer_id, :format, :path, :size)
+		ON CONFLICT (key) DO NOTHING`
+	_, err := p.db.NamedExecContext(ctx, query, entry)
+	if err != nil {
+		return fmt.Errorf("postgres: create archive cache entry %s: %w", entry.Key, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) TouchArchiveCacheEntry(ctx context.Context, key string) error {
+	query := `UPDATE archive_cache SET last_used_at = NOW() WHERE key = $1`
+	_, err := p.db.ExecContext(ctx, query, key)
+	if err != nil {
+		return fmt.Errorf("postgres: touch archive cache entry %s: %w", key, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) DeleteArchiveCacheEntry(ctx context.Context, key string) error {
+	query := `DELETE FROM archive_cache WHERE key = $1`
+	_, err := p.db.ExecContext(ctx, query, key)
+	if err != nil {
+		return fmt.Errorf("postgres: delete archive cache entry %s: %w", key, err)
+	}
+	return nil
+}
+
+// DeleteArchiveCacheEntriesByTransferID removes the entries of a transfer and returns them,
+// so their archives can be deleted from storage.
+func (p *PostgresSQLDB) DeleteArchiveCacheEntriesByTransferID(ctx context.Context, transferID uuid.UUID) ([]models.ArchiveCacheEntry, error) {
+	query := `DELETE FROM archive_cache WHERE transfer_id = $1 RETURNING *`
+	entries := []models.ArchiveCacheEntry{}
+	err := p.db.SelectContext(ctx, &entries, query, transferID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: delete archive cache entries of transfer %s: %w", transferID, err)
+	}
+	return entries, nil
+}
+
+func (p *PostgresSQLDB) FindAllArchiveCacheEntries(ctx context.Context) ([]models.ArchiveCacheEntry, error) {
+	query := `SELECT * FROM archive_cache ORDER BY last_used_at ASC`
+	entries := []models.ArchiveCacheEntry{}
+	err := p.db.SelectContext(ctx, &entries, query)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find archive cache entries: %w", err)
+	}
+	return entries, nil
+}
+
+func (p *PostgresSQLDB) SumArchiveCacheSize(ctx context.Context) (int64, error) {
+	query := `SELECT COALESCE(SUM(size), 0) FROM archive_cache`
+	var size int64
+	err := p.db.GetContext(ctx, &size, query)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: sum archive cache size: %w", err)
+	}
+	return size, nil
+}
+
+// SumStoredSizeByOwnerID adds up what an owner stores, their transfers and the cached
+// archives of them.
+func (p *PostgresSQLDB) SumStoredSizeByOwnerID(ctx context.Context, ownerID uuid.UUID) (int64, error) {
+	query := `
+		SELECT
+			COALESCE((SELECT SUM(size) FROM transfers WHERE owner_id = $1), 0) +
+			COALESCE((SELECT SUM(a.size) FROM archive_cache a JOIN transfers t ON t.id = a.transfer_id WHERE t.owner_id = $1), 0)`
+	var size int64
+	err := p.db.GetContext(ctx, &size, query, ownerID)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: sum stored size of owner %s: %w", ownerID, err)
+	}
+	return size, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"large_fss/internals/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// reserveDownload takes one of the downloads left on a row of table, transfers or links,
+// for the reservation. The row stays locked while the unexpired reservations are counted,
+// so concurrent downloads can't both take the last one. Reserving again under the same
+// ID replaces the earlier reservation, as a download does after its reservation lapsed.
+func (p *PostgresSQLDB) reserveDownload(ctx context.Context, table string, column string, reservationID uuid.UUID, targetID uuid.UUID, expiresAt time.Time) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var limit struct {
+		MaxDownloads  *int `db:"max_downloads"`
+		DownloadCount int  `db:"download_count"`
+	}
+	err = tx.GetContext(ctx, &limit, `SELECT max_downloads, download_count FROM `+table+` WHERE id = $1 FOR UPDATE`, targetID)
+	if err != nil {
+		return err
+	}
+	if limit.MaxDownloads != nil {
+		var active int
+		query := `SELECT COUNT(*) FROM download_reservations WHERE ` + column + ` = $1 AND id <> $2 AND expires_at > NOW()`
+		err = tx.GetContext(ctx, &active, query, targetID, reservationID)
+		if err != nil {
+			return err
+		}
+		if limit.DownloadCount+active >= *limit.MaxDownloads {
+			return sql.ErrNoRows
+		}
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM download_reservations WHERE id = $1 AND `+column+` = $2`, reservationID, targetID)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO download_reservations (id, ` + column + `, expires_at) VALUES ($1, $2, $3)`
+	_, err = tx.ExecContext(ctx, query, reservationID, targetID, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReserveTransferDownloadByID counts a download in flight against the transfer's limit
+// until the reservation is released or expires. sql.ErrNoRows is returned when the
+// transfer is missing or no download is left.
+func (p *PostgresSQLDB) ReserveTransferDownloadByID(ctx context.Context, reservationID uuid.UUID, transferID uuid.UUID, expiresAt time.Time) error {
+	err := p.reserveDownload(ctx, "transfers", "transfer_id", reservationID, transferID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("postgres: reserve download of transfer %s: %w", transferID, err)
+	}
+	return nil
+}
+
+// ReserveLinkDownloadByID counts a download in flight against the link's limit
+// until the reservation is released or expires. sql.ErrNoRows is returned when the
+// link is missing or no download is left.
+func (p *PostgresSQLDB) ReserveLinkDownloadByID(ctx context.Context, reservationID uuid.UUID, linkID uuid.UUID, expiresAt time.Time) error {
+	err := p.reserveDownload(ctx, "links", "link_id", reservationID, linkID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("postgres: reserve download of link %s: %w", linkID, err)
+	}
+	return nil
+}
+
+// RenewDownloadReservation pushes the expiry of a reservation back. sql.ErrNoRows means
+// it lapsed and was purged.
+func (p *PostgresSQLDB) RenewDownloadReservation(ctx context.Context, reservationID uuid.UUID, expiresAt time.Time) error {
+	query := `UPDATE download_reservations SET expires_at = $1 WHERE id = $2`
+	result, err := p.db.ExecContext(ctx, query, expiresAt, reservationID)
+	if err != nil {
+		return fmt.Errorf("postgres: renew download reservation %s: %w", reservationID, err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("postgres: renew download reservation %s: %w", reservationID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// ReleaseTransferDownloadByID ends a reserved download, a completed one is counted
+// even when its reservation already lapsed.
+func (p *PostgresSQLDB) ReleaseTransferDownloadByID(ctx context.Context, reservationID uuid.UUID, transferID uuid.UUID, completed bool) (*models.Transfer, error) {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM download_reservations WHERE id = $1 AND transfer_id = $2`, reservationID, transferID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: release download of transfer %s: %w", transferID, err)
+	}
+	query := `
+		UPDATE transfers SET download_count = download_count + CASE WHEN $2 THEN 1 ELSE 0 END
+		WHERE id = $1
+		RETURNING *`
+	var transfer models.Transfer
+	err = p.db.GetContext(ctx, &transfer, query, transferID, completed)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: release download of transfer %s: %w", transferID, err)
+	}
+	return &transfer, nil
+}
+
+// ReleaseLinkDownloadByID ends a reserved download, a completed one is counted
+// even when its reservation already lapsed.
+func (p *PostgresSQLDB) ReleaseLinkDownloadByID(ctx context.Context, reservationID uuid.UUID, linkID uuid.UUID, completed bool) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM download_reservations WHERE id = $1 AND link_id = $2`, reservationID, linkID)
+	if err != nil {
+		return fmt.Errorf("postgres: release download of link %s: %w", linkID, err)
+	}
+	query := `UPDATE links SET download_count = download_count + CASE WHEN $2 THEN 1 ELSE 0 END WHERE id = $1`
+	_, err = p.db.ExecContext(ctx, query, linkID, completed)
+	if err != nil {
+		return fmt.Errorf("postgres: release download of link %s: %w", linkID, err)
+	}
+	return nil
+}
+
+// CountActiveDownloadsByTransferID counts the unexpired reservations against the transfer's limit.
+func (p *PostgresSQLDB) CountActiveDownloadsByTransferID(ctx context.Context, transferID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM download_reservations WHERE transfer_id = $1 AND expires_at > NOW()`
+	var count int
+	err := p.db.GetContext(ctx, &count, query, transferID)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: count active downloads of transfer %s: %w", transferID, err)
+	}
+	return count, nil
+}
+
+// DeleteExpiredDownloadReservations purges the reservations of downloads that stopped
+// renewing them, such as those of a crashed server or a reader that was never closed.
+func (p *PostgresSQLDB) DeleteExpiredDownloadReservations(ctx context.Context) (int64, error) {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM download_reservations WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: delete expired download reservations: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
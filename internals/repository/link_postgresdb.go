@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"large_fss/internals/models"
+
+	"github.com/google/uuid"
+)
+
+func (p *PostgresSQLDB) CreateLink(ctx context.Context, link models.Link) (*models.Link, error) {
+	link.ID = uuid.New()
+	query := `
+		INSERT INTO links (id, transfer_id, token, label, expires_at, max_downloads, bytes_per_second, enabled)
+		VALUES (:id, :transfer_id, :token, :label, :expires_at, :max_downloads, :bytes_per_second, :enabled)
+		RETURNING *`
+
+	rows, err := p.db.NamedQueryContext(ctx, query, &link)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: create link for transfer %s: %w", link.TransferID, err)
+	}
+	defer rows.Close()
+	var created models.Link
+	if !rows.Next() {
+		return nil, fmt.Errorf("postgres: create link for transfer %s: no row returned", link.TransferID)
+	}
+	err = rows.StructScan(&created)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: create link for transfer %s: %w", link.TransferID, err)
+	}
+	return &created, nil
+}
+
+func (p *PostgresSQLDB) FindLinkByToken(ctx context.Context, token string) (*models.Link, error) {
+	query := `SELECT * FROM links WHERE token = $1`
+	var link models.Link
+	err := p.db.GetContext(ctx, &link, query, token)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find link by token: %w", err)
+	}
+	return &link, nil
+}
+
+func (p *PostgresSQLDB) FindLinkByID(ctx context.Context, linkID uuid.UUID) (*models.Link, error) {
+	query := `SELECT * FROM links WHERE id = $1`
+	var link models.Link
+	err := p.db.GetContext(ctx, &link, query, linkID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find link by ID %s: %w", linkID, err)
+	}
+	return &link, nil
+}
+
+func (p *PostgresSQLDB) FindAllLinksByTransferID(ctx context.Context, transferID uuid.UUID) ([]models.Link, error) {
+	query := `SELECT * FROM links WHERE transfer_id = $1 ORDER BY created_at ASC`
+	links := []models.Link{}
+	err := p.db.SelectContext(ctx, &links, query, transferID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find links by TransferID %s: %w", transferID, err)
+	}
+	return links, nil
+}
+
+func (p *PostgresSQLDB) FindAllLinksByTransferIDs(ctx context.Context, transferIDs []uuid.UUID) ([]models.Link, error) {
+	query := `
+		SELECT * FROM links
+		WHERE transfer_id = ANY($1::uuid[])
+		ORDER BY created_at ASC`
+	links := []models.Link{}
+	err := p.db.SelectContext(ctx, &links, query, uuidArray(transferIDs))
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find links by TransferIDs: %w", err)
+	}
+	return links, nil
+}
+
+func (p *PostgresSQLDB) UpdateLinkByID(ctx context.Context, link models.Link) error {
+	query := `
+		UPDATE links SET label = $1, expires_at = $2, max_downloads = $3, bytes_per_second = $4, enabled = $5
+		WHERE id = $6`
+	_, err := p.db.ExecContext(ctx, query, link.Label, link.ExpiresAt, link.MaxDownloads, link.BytesPerSecond, link.Enabled, link.ID)
+	if err != nil {
+		return fmt.Errorf("postgres: update link by ID %s: %w", link.ID, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) DeleteLinkByID(ctx context.Context, linkID uuid.UUID) error {
+	query := `DELETE FROM links WHERE id = $1`
+	_, err := p.db.ExecContext(ctx, query, linkID)
+	if err != nil {
+		return fmt.Errorf("postgres: delete link by ID %s: %w", linkID, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"large_fss/internals/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// MarkFilesDownloaded records the first completed download of each file.
+func (p *PostgresSQLDB) MarkFilesDownloaded(ctx context.Context, fileIDs []uuid.UUID) error {
+	ids := make([]string, len(fileIDs))
+	for i, fileID := range fileIDs {
+		ids[i] = fileID.String()
+	}
+	query := `UPDATE files SET downloaded_at = NOW() WHERE id = ANY($1::uuid[]) AND downloaded_at IS NULL`
+	_, err := p.db.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("postgres: mark files downloaded: %w", err)
+	}
+	return nil
+}
+
+// MarkTransferFirstDownloaded returns true only for the call that recorded the first download.
+func (p *PostgresSQLDB) MarkTransferFirstDownloaded(ctx context.Context, transferID uuid.UUID) (bool, error) {
+	query := `UPDATE transfers SET first_downloaded_at = NOW() WHERE id = $1 AND first_downloaded_at IS NULL`
+	result, err := p.db.ExecContext(ctx, query, transferID)
+	if err != nil {
+		return false, fmt.Errorf("postgres: mark transfer %s first downloaded: %w", transferID, err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+// MarkTransferAllDownloaded returns true only for the call that found every file of the
+// transfer downloaded for the first time.
+func (p *PostgresSQLDB) MarkTransferAllDownloaded(ctx context.Context, transferID uuid.UUID) (bool, error) {
+	query := `
+		UPDATE transfers SET all_downloaded_at = NOW()
+		WHERE id = $1 AND all_downloaded_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM files WHERE transfer_id = $1 AND downloaded_at IS NULL)`
+	result, err := p.db.ExecContext(ctx, query, transferID)
+	if err != nil {
+		return false, fmt.Errorf("postgres: mark transfer %s all downloaded: %w", transferID, err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+func (p *PostgresSQLDB) CreateNotification(ctx context.Context, notification models.Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, transfer_id, kind, subject, message)
+		VALUES (:user_id, :transfer_id, :kind, :subject, :message)`
+	_, err := p.db.NamedExecContext(ctx, query, notification)
+	if err != nil {
+		return fmt.Errorf("postgres: create notification for user %s: %w", notification.UserID, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) FindNotificationsByUserID(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit int, offset int) ([]models.Notification, error) {
+	query := `
+		SELECT * FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4`
+	notifications := []models.Notification{}
+	err := p.db.SelectContext(ctx, &notifications, query, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find notifications of user %s: %w", userID, err)
+	}
+	return notifications, nil
+}
+
+func (p *PostgresSQLDB) CountUnreadNotificationsByUserID(ctx context.Context, userID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`
+	var count int
+	err := p.db.GetContext(ctx, &count, query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: count unread notifications of user %s: %w", userID, err)
+	}
+	return count, nil
+}
+
+// MarkNotificationReadByID returns sql.ErrNoRows when the user has no such notification.
+func (p *PostgresSQLDB) MarkNotificationReadByID(ctx context.Context, notificationID uuid.UUID, userID uuid.UUID) error {
+	query := `UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2`
+	result, err := p.db.ExecContext(ctx, query, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("postgres: mark notification %s read: %w", notificationID, err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("postgres: mark notification %s read: %w", notificationID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) MarkAllNotificationsReadByUserID(ctx context.Context, userID uuid.UUID) error {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+	_, err := p.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("postgres: mark notifications of user %s read: %w", userID, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) FindNotificationPreferencesByUserID(ctx context.Context, userID uuid.UUID) ([]models.NotificationPreference, error) {
+	query := `SELECT * FROM notification_preferences WHERE user_id = $1`
+	preferences := []models.NotificationPreference{}
+	err := p.db.SelectContext(ctx, &preferences, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find notification preferences of user %s: %w", userID, err)
+	}
+	return preferences, nil
+}
+
+func (p *PostgresSQLDB) UpsertNotificationPreference(ctx context.Context, preference models.NotificationPreference) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, kind, email, in_app)
+		VALUES (:user_id, :kind, :email, :in_app)
+		ON CONFLICT (user_id, kind) DO UPDATE SET email = EXCLUDED.email, in_app = EXCLUDED.in_app`
+	_, err := p.db.NamedExecContext(ctx, query, preference)
+	if err != nil {
+		return fmt.Errorf("postgres: save notification preference of user %s: %w", preference.UserID, err)
+	}
+	return nil
+}
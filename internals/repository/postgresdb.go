@@ -48,7 +48,9 @@ func createTables(db *sqlx.DB) {
 		email TEXT NOT NULL UNIQUE,
 		password TEXT NOT NULL,
 		first_name TEXT,
-		last_name TEXT
+		last_name TEXT,
+		plan TEXT NOT NULL DEFAULT 'free',
+		role TEXT NOT NULL DEFAULT 'user'
 	);`
 	executeTableQuery(userTableQuery, "users")
 
@@ -62,6 +64,14 @@ func createTables(db *sqlx.DB) {
 		size BIGINT NOT NULL,
 		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 		expiry TIMESTAMP WITH TIME ZONE,
+		scan_status TEXT NOT NULL DEFAULT 'pending',
+		max_downloads INT,
+		download_count INT NOT NULL DEFAULT 0,
+		password_hash TEXT NOT NULL DEFAULT '',
+		private BOOLEAN NOT NULL DEFAULT false,
+		first_downloaded_at TIMESTAMP WITH TIME ZONE,
+		all_downloaded_at TIMESTAMP WITH TIME ZONE,
+		trashed_at TIMESTAMP WITH TIME ZONE,
 		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
 	);`
 	executeTableQuery(transferTableQuery, "transfers")
@@ -75,7 +85,10 @@ func createTables(db *sqlx.DB) {
 		file_path TEXT NOT NULL,
 		transfer_id UUID NOT NULL,
 		file_extension TEXT,
-		num_of_active_stream  INT DEFAULT 0,
+		scan_status TEXT NOT NULL DEFAULT 'pending',
+		mime_type TEXT NOT NULL DEFAULT '',
+		thumbnail_path TEXT NOT NULL DEFAULT '',
+		downloaded_at TIMESTAMP WITH TIME ZONE,
 		FOREIGN KEY (transfer_id) REFERENCES transfers(id) ON DELETE CASCADE
 	);`
 	executeTableQuery(fileTableQuery, "files")
@@ -87,7 +100,12 @@ func createTables(db *sqlx.DB) {
 		owner_id UUID NOT NULL,
 		message TEXT DEFAULT '',
 		size BIGINT NOT NULL,
-		expiry TEXT NOT NULL,
+		expiry TIMESTAMP WITH TIME ZONE,
+		expiry_value TEXT NOT NULL DEFAULT '',
+		store_as_is BOOLEAN NOT NULL DEFAULT false,
+		file_name TEXT NOT NULL DEFAULT '',
+		max_downloads INT,
+		password_hash TEXT NOT NULL DEFAULT '',
 		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 		last_updated TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
@@ -99,11 +117,278 @@ func createTables(db *sqlx.DB) {
 		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
 		transfer_id UUID NOT NULL,
 		index INTEGER NOT NULL,
+		size BIGINT NOT NULL DEFAULT 0,
 		uploaded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
 		FOREIGN KEY (transfer_id) REFERENCES temp_transfers(id) ON DELETE CASCADE
 	);`
 	executeTableQuery(chunkTableQuery, "chunks")
 
+	// Url imports under the ID of their upload session, and later of their transfer.
+	// Kept past the import so its outcome can still be asked for.
+	urlImportTableQuery := `
+	CREATE TABLE IF NOT EXISTS url_imports (
+		transfer_id UUID PRIMARY KEY,
+		owner_id UUID NOT NULL,
+		status TEXT NOT NULL,
+		bytes_received BIGINT NOT NULL DEFAULT 0,
+		total_bytes BIGINT NOT NULL DEFAULT -1,
+		error_message TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		finished_at TIMESTAMP WITH TIME ZONE,
+		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+	executeTableQuery(urlImportTableQuery, "url_imports")
+
+	// Checksums and sniffed types of every stored file, nested folders included
+	storedObjectTableQuery := `
+	CREATE TABLE IF NOT EXISTS stored_objects (
+		path TEXT PRIMARY KEY,
+		transfer_id UUID NOT NULL,
+		size BIGINT NOT NULL,
+		crc32 BIGINT NOT NULL,
+		mime_type TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		FOREIGN KEY (transfer_id) REFERENCES transfers(id) ON DELETE CASCADE
+	);`
+	executeTableQuery(storedObjectTableQuery, "stored_objects")
+
+	// Share links, public routes find transfers through their tokens
+	var linksExisted bool
+	if err := tx.Get(&linksExisted, `SELECT to_regclass('links') IS NOT NULL`); err != nil {
+		fmt.Printf("Error checking links table: %v\n", err)
+	}
+	linkTableQuery := `
+	CREATE TABLE IF NOT EXISTS links (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		transfer_id UUID NOT NULL,
+		token TEXT NOT NULL UNIQUE,
+		label TEXT NOT NULL DEFAULT '',
+		expires_at TIMESTAMP WITH TIME ZONE,
+		max_downloads INT,
+		download_count INT NOT NULL DEFAULT 0,
+		bytes_per_second BIGINT,
+		enabled BOOLEAN NOT NULL DEFAULT true,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		FOREIGN KEY (transfer_id) REFERENCES transfers(id) ON DELETE CASCADE
+	);`
+	executeTableQuery(linkTableQuery, "links")
+
+	// Who may open a private transfer
+	recipientTableQuery := `
+	CREATE TABLE IF NOT EXISTS transfer_recipients (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		transfer_id UUID NOT NULL,
+		email TEXT NOT NULL,
+		user_id UUID,
+		code_hash TEXT NOT NULL DEFAULT '',
+		code_expires_at TIMESTAMP WITH TIME ZONE,
+		code_sent_at TIMESTAMP WITH TIME ZONE,
+		code_attempts INT NOT NULL DEFAULT 0,
+		last_access_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		UNIQUE (transfer_id, email),
+		FOREIGN KEY (transfer_id) REFERENCES transfers(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+	);`
+	executeTableQuery(recipientTableQuery, "transfer_recipients")
+
+	// One row per download of a file or archive, file_id is NULL for archives
+	downloadEventTableQuery := `
+	CREATE TABLE IF NOT EXISTS download_events (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		transfer_id UUID NOT NULL,
+		file_id UUID,
+		link_id UUID,
+		recipient_id UUID,
+		kind TEXT NOT NULL,
+		bytes_sent BIGINT NOT NULL DEFAULT 0,
+		completed BOOLEAN NOT NULL DEFAULT false,
+		client_ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		FOREIGN KEY (transfer_id) REFERENCES transfers(id) ON DELETE CASCADE
+	);`
+	executeTableQuery(downloadEventTableQuery, "download_events")
+
+	// Files being streamed, a lease lapses unless its download keeps renewing it.
+	// A lease covers every file of an archive download under the same ID.
+	streamLeaseTableQuery := `
+	CREATE TABLE IF NOT EXISTS stream_leases (
+		id UUID NOT NULL,
+		file_id UUID NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (id, file_id),
+		FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+	);`
+	executeTableQuery(streamLeaseTableQuery, "stream_leases")
+
+	// Downloads in flight that count against a download limit, one row per transfer or
+	// link under the same ID. Like stream leases they lapse unless they are renewed.
+	downloadReservationTableQuery := `
+	CREATE TABLE IF NOT EXISTS download_reservations (
+		id UUID NOT NULL,
+		transfer_id UUID,
+		link_id UUID,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		CHECK ((transfer_id IS NULL) <> (link_id IS NULL)),
+		FOREIGN KEY (transfer_id) REFERENCES transfers(id) ON DELETE CASCADE,
+		FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+	);`
+	executeTableQuery(downloadReservationTableQuery, "download_reservations")
+
+	// In-app notifications, kept after their transfer is deleted
+	notificationTableQuery := `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		user_id UUID NOT NULL,
+		transfer_id UUID,
+		kind TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		read_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+	executeTableQuery(notificationTableQuery, "notifications")
+
+	notificationPreferenceTableQuery := `
+	CREATE TABLE IF NOT EXISTS notification_preferences (
+		user_id UUID NOT NULL,
+		kind TEXT NOT NULL,
+		email BOOLEAN NOT NULL DEFAULT true,
+		in_app BOOLEAN NOT NULL DEFAULT true,
+		PRIMARY KEY (user_id, kind),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+	executeTableQuery(notificationPreferenceTableQuery, "notification_preferences")
+
+	// Pre-built transfer archives, evicted least recently used first
+	archiveCacheTableQuery := `
+	CREATE TABLE IF NOT EXISTS archive_cache (
+		key TEXT PRIMARY KEY,
+		transfer_id UUID NOT NULL,
+		format TEXT NOT NULL,
+		path TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		FOREIGN KEY (transfer_id) REFERENCES transfers(id) ON DELETE CASCADE
+	);`
+	executeTableQuery(archiveCacheTableQuery, "archive_cache")
+
+	// Columns added after the first release, so existing databases pick them up
+	executeAlterQuery := func(query, columnName string) {
+		if _, err := tx.Exec(query); err != nil {
+			fmt.Printf("Error adding %s column: %v\n", columnName, err)
+		}
+	}
+	executeAlterQuery(`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS scan_status TEXT NOT NULL DEFAULT 'pending'`, "transfers.scan_status")
+	executeAlterQuery(`ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_status TEXT NOT NULL DEFAULT 'pending'`, "files.scan_status")
+	executeAlterQuery(`ALTER TABLE users ADD COLUMN IF NOT EXISTS plan TEXT NOT NULL DEFAULT 'free'`, "users.plan")
+	executeAlterQuery(`ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user'`, "users.role")
+	executeAlterQuery(`ALTER TABLE files ADD COLUMN IF NOT EXISTS mime_type TEXT NOT NULL DEFAULT ''`, "files.mime_type")
+	executeAlterQuery(`ALTER TABLE chunks ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0`, "chunks.size")
+	executeAlterQuery(`ALTER TABLE temp_transfers ADD COLUMN IF NOT EXISTS store_as_is BOOLEAN NOT NULL DEFAULT false`, "temp_transfers.store_as_is")
+	executeAlterQuery(`ALTER TABLE temp_transfers ADD COLUMN IF NOT EXISTS file_name TEXT NOT NULL DEFAULT ''`, "temp_transfers.file_name")
+	executeAlterQuery(`ALTER TABLE files ADD COLUMN IF NOT EXISTS thumbnail_path TEXT NOT NULL DEFAULT ''`, "files.thumbnail_path")
+	executeAlterQuery(`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS max_downloads INT`, "transfers.max_downloads")
+	executeAlterQuery(`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS download_count INT NOT NULL DEFAULT 0`, "transfers.download_count")
+	executeAlterQuery(`ALTER TABLE temp_transfers ADD COLUMN IF NOT EXISTS max_downloads INT`, "temp_transfers.max_downloads")
+	executeAlterQuery(`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT ''`, "transfers.password_hash")
+	executeAlterQuery(`ALTER TABLE temp_transfers ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT ''`, "temp_transfers.password_hash")
+	executeAlterQuery(`ALTER TABLE temp_transfers ADD COLUMN IF NOT EXISTS expiry_value TEXT NOT NULL DEFAULT ''`, "temp_transfers.expiry_value")
+	executeAlterQuery(`ALTER TABLE download_events ADD COLUMN IF NOT EXISTS link_id UUID`, "download_events.link_id")
+	executeAlterQuery(`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS private BOOLEAN NOT NULL DEFAULT false`, "transfers.private")
+	executeAlterQuery(`ALTER TABLE download_events ADD COLUMN IF NOT EXISTS recipient_id UUID`, "download_events.recipient_id")
+	executeAlterQuery(`ALTER TABLE links ADD COLUMN IF NOT EXISTS bytes_per_second BIGINT`, "links.bytes_per_second")
+	var firstDownloadExisted bool
+	if err := tx.Get(&firstDownloadExisted, `
+		SELECT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'transfers' AND column_name = 'first_downloaded_at')`); err != nil {
+		fmt.Printf("Error checking transfers.first_downloaded_at column: %v\n", err)
+	}
+	executeAlterQuery(`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS first_downloaded_at TIMESTAMP WITH TIME ZONE`, "transfers.first_downloaded_at")
+	// Transfers downloaded before notifications existed must not be reported as expired unused
+	if !firstDownloadExisted {
+		if _, err := tx.Exec(`
+			UPDATE transfers t SET first_downloaded_at = e.first_download
+			FROM (SELECT transfer_id, MIN(created_at) AS first_download FROM download_events
+				WHERE completed GROUP BY transfer_id) e
+			WHERE t.id = e.transfer_id`); err != nil {
+			fmt.Printf("Error backfilling transfers.first_downloaded_at: %v\n", err)
+		}
+	}
+	executeAlterQuery(`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS all_downloaded_at TIMESTAMP WITH TIME ZONE`, "transfers.all_downloaded_at")
+	executeAlterQuery(`ALTER TABLE files ADD COLUMN IF NOT EXISTS downloaded_at TIMESTAMP WITH TIME ZONE`, "files.downloaded_at")
+	executeAlterQuery(`ALTER TABLE transfers ADD COLUMN IF NOT EXISTS trashed_at TIMESTAMP WITH TIME ZONE`, "transfers.trashed_at")
+	// Upload sessions stored the expiry preset and computed it on assembly, the presets are
+	// resolved the way they would have been had the uploads finished now
+	var tempExpiryType string
+	if err := tx.Get(&tempExpiryType, `
+		SELECT data_type FROM information_schema.columns
+		WHERE table_name = 'temp_transfers' AND column_name = 'expiry'`); err != nil {
+		fmt.Printf("Error checking temp_transfers.expiry column: %v\n", err)
+	}
+	if tempExpiryType == "text" {
+		executeAlterQuery(`
+			ALTER TABLE temp_transfers ALTER COLUMN expiry DROP NOT NULL,
+			ALTER COLUMN expiry TYPE TIMESTAMP WITH TIME ZONE USING CASE expiry
+				WHEN '5m' THEN NOW() + INTERVAL '5 minutes'
+				WHEN '3h' THEN NOW() + INTERVAL '3 hours'
+				WHEN '12h' THEN NOW() + INTERVAL '12 hours'
+				WHEN '1d' THEN NOW() + INTERVAL '1 day'
+				WHEN '3d' THEN NOW() + INTERVAL '3 days'
+				WHEN '1w' THEN NOW() + INTERVAL '7 days'
+				ELSE NULL
+			END`, "temp_transfers.expiry")
+	}
+	// Replaced by stream_leases, a crash left the counter up forever
+	executeAlterQuery(`ALTER TABLE files DROP COLUMN IF EXISTS num_of_active_stream`, "files.num_of_active_stream")
+	// Replaced by download_reservations for the same reason
+	executeAlterQuery(`ALTER TABLE transfers DROP COLUMN IF EXISTS reserved_downloads`, "transfers.reserved_downloads")
+	executeAlterQuery(`ALTER TABLE links DROP COLUMN IF EXISTS reserved_downloads`, "links.reserved_downloads")
+
+	executeIndexQuery := func(query, indexName string) {
+		if _, err := tx.Exec(query); err != nil {
+			fmt.Printf("Error creating %s index: %v\n", indexName, err)
+		}
+	}
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS download_events_transfer_idx ON download_events (transfer_id, created_at DESC)`, "download_events_transfer_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS links_transfer_idx ON links (transfer_id, created_at)`, "links_transfer_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS transfer_recipients_user_idx ON transfer_recipients (user_id)`, "transfer_recipients_user_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_id, created_at DESC)`, "notifications_user_idx")
+	// Keyset pagination of a user's transfers, one index per sort order
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS transfers_owner_created_idx ON transfers (owner_id, created_at, id)`, "transfers_owner_created_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS transfers_owner_size_idx ON transfers (owner_id, size, id)`, "transfers_owner_size_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS transfers_owner_expiry_idx ON transfers (owner_id, (COALESCE(expiry, 'infinity'::timestamptz)), id)`, "transfers_owner_expiry_idx")
+	// Full-text search over messages and file names, same expressions as the search queries
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS transfers_message_search_idx ON transfers USING GIN (`+searchableText("message")+`)`, "transfers_message_search_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS files_name_search_idx ON files USING GIN (`+searchableText("file_name")+`)`, "files_name_search_idx")
+	// Purging finds trashed transfers by age, the rest are not indexed
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS transfers_trashed_idx ON transfers (trashed_at) WHERE trashed_at IS NOT NULL`, "transfers_trashed_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS temp_transfers_owner_idx ON temp_transfers (owner_id, last_updated DESC)`, "temp_transfers_owner_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS chunks_transfer_idx ON chunks (transfer_id, index)`, "chunks_transfer_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS archive_cache_transfer_idx ON archive_cache (transfer_id)`, "archive_cache_transfer_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS archive_cache_last_used_idx ON archive_cache (last_used_at)`, "archive_cache_last_used_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS stream_leases_file_idx ON stream_leases (file_id, expires_at)`, "stream_leases_file_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS download_reservations_id_idx ON download_reservations (id)`, "download_reservations_id_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS download_reservations_transfer_idx ON download_reservations (transfer_id, expires_at) WHERE transfer_id IS NOT NULL`, "download_reservations_transfer_idx")
+	executeIndexQuery(`CREATE INDEX IF NOT EXISTS download_reservations_link_idx ON download_reservations (link_id, expires_at) WHERE link_id IS NOT NULL`, "download_reservations_link_idx")
+
+	// Transfers shared before links existed keep working under their old URL, the transfer ID.
+	// Only done once, owners may revoke these links later.
+	if !linksExisted {
+		if _, err := tx.Exec(`
+			INSERT INTO links (transfer_id, token, label, created_at)
+			SELECT id, id::text, 'Original link', created_at FROM transfers
+		`); err != nil {
+			fmt.Printf("Error creating links of existing transfers: %v\n", err)
+		}
+	}
+
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		fmt.Printf("Error committing transaction: %v\n", err)
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"large_fss/internals/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (p *PostgresSQLDB) CreateRecipient(ctx context.Context, recipient models.TransferRecipient) (*models.TransferRecipient, error) {
+	recipient.ID = uuid.New()
+	// A repeated email keeps its row, picking up the user ID once it is known
+	query := `
+		INSERT INTO transfer_recipients (id, transfer_id, email, user_id)
+		VALUES (:id, :transfer_id, :email, :user_id)
+		ON CONFLICT (transfer_id, email) DO UPDATE
+			SET user_id = COALESCE(EXCLUDED.user_id, transfer_recipients.user_id)
+		RETURNING *`
+
+	rows, err := p.db.NamedQueryContext(ctx, query, &recipient)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: create recipient of transfer %s: %w", recipient.TransferID, err)
+	}
+	defer rows.Close()
+	var created models.TransferRecipient
+	if !rows.Next() {
+		return nil, fmt.Errorf("postgres: create recipient of transfer %s: no row returned", recipient.TransferID)
+	}
+	err = rows.StructScan(&created)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: create recipient of transfer %s: %w", recipient.TransferID, err)
+	}
+	return &created, nil
+}
+
+func (p *PostgresSQLDB) FindRecipientByID(ctx context.Context, recipientID uuid.UUID) (*models.TransferRecipient, error) {
+	query := `SELECT * FROM transfer_recipients WHERE id = $1`
+	var recipient models.TransferRecipient
+	err := p.db.GetContext(ctx, &recipient, query, recipientID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find recipient by ID %s: %w", recipientID, err)
+	}
+	return &recipient, nil
+}
+
+func (p *PostgresSQLDB) FindRecipientByEmail(ctx context.Context, transferID uuid.UUID, email string) (*models.TransferRecipient, error) {
+	query := `SELECT * FROM transfer_recipients WHERE transfer_id = $1 AND email = lower($2)`
+	var recipient models.TransferRecipient
+	err := p.db.GetContext(ctx, &recipient, query, transferID, email)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find recipient of transfer %s by email: %w", transferID, err)
+	}
+	return &recipient, nil
+}
+
+func (p *PostgresSQLDB) FindRecipientByUser(ctx context.Context, transferID uuid.UUID, userID uuid.UUID, email string) (*models.TransferRecipient, error) {
+	query := `
+		SELECT * FROM transfer_recipients
+		WHERE transfer_id = $1 AND (user_id = $2 OR email = lower($3))
+		ORDER BY user_id IS NULL
+		LIMIT 1`
+	var recipient models.TransferRecipient
+	err := p.db.GetContext(ctx, &recipient, query, transferID, userID, email)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find recipient of transfer %s by user %s: %w", transferID, userID, err)
+	}
+	return &recipient, nil
+}
+
+// recipientStatusQuery totals the downloads of each recipient, the caller adds the WHERE clause.
+const recipientStatusQuery = `
+	SELECT r.*,
+		COUNT(e.id) AS downloads,
+		COUNT(e.id) FILTER (WHERE e.completed) AS completed,
+		MAX(e.created_at) AS last_download_at
+	FROM transfer_recipients r
+	LEFT JOIN download_events e ON e.recipient_id = r.id`
+
+func (p *PostgresSQLDB) FindRecipientStatusesByTransferID(ctx context.Context, transferID uuid.UUID) ([]models.RecipientStatus, error) {
+	query := recipientStatusQuery + `
+		WHERE r.transfer_id = $1
+		GROUP BY r.id
+		ORDER BY r.created_at ASC, r.email`
+	statuses := []models.RecipientStatus{}
+	err := p.db.SelectContext(ctx, &statuses, query, transferID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find recipients by TransferID %s: %w", transferID, err)
+	}
+	return statuses, nil
+}
+
+func (p *PostgresSQLDB) FindRecipientStatusesByTransferIDs(ctx context.Context, transferIDs []uuid.UUID) ([]models.RecipientStatus, error) {
+	query := recipientStatusQuery + `
+		WHERE r.transfer_id = ANY($1::uuid[])
+		GROUP BY r.id
+		ORDER BY r.created_at ASC, r.email`
+	statuses := []models.RecipientStatus{}
+	err := p.db.SelectContext(ctx, &statuses, query, uuidArray(transferIDs))
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find recipients by TransferIDs: %w", err)
+	}
+	return statuses, nil
+}
+
+// UpdateRecipientCodeByID stores a new one-time code, replacing any pending one.
+func (p *PostgresSQLDB) UpdateRecipientCodeByID(ctx context.Context, recipientID uuid.UUID, codeHash string, expiresAt time.Time) error {
+	query := `
+		UPDATE transfer_recipients SET code_hash = $1, code_expires_at = $2, code_sent_at = NOW(), code_attempts = 0
+		WHERE id = $3`
+	_, err := p.db.ExecContext(ctx, query, codeHash, expiresAt, recipientID)
+	if err != nil {
+		return fmt.Errorf("postgres: update code of recipient %s: %w", recipientID, err)
+	}
+	return nil
+}
+
+// ClaimRecipientCodeAttemptByID counts an attempt at the pending code before it is checked
+// and returns the attempts made so far. sql.ErrNoRows is returned when no code is pending
+// or its attempts are used up.
+func (p *PostgresSQLDB) ClaimRecipientCodeAttemptByID(ctx context.Context, recipientID uuid.UUID, maxAttempts int) (int, error) {
+	query := `
+		UPDATE transfer_recipients SET code_attempts = code_attempts + 1
+		WHERE id = $1 AND code_hash <> '' AND code_expires_at > NOW() AND code_attempts < $2
+		RETURNING code_attempts`
+	var attempts int
+	err := p.db.GetContext(ctx, &attempts, query, recipientID, maxAttempts)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: claim code attempt of recipient %s: %w", recipientID, err)
+	}
+	return attempts, nil
+}
+
+// UseRecipientCodeByID drops the pending code once it was entered right. sql.ErrNoRows
+// is returned when that code was already used or replaced.
+func (p *PostgresSQLDB) UseRecipientCodeByID(ctx context.Context, recipientID uuid.UUID, codeHash string) error {
+	query := `
+		UPDATE transfer_recipients SET code_hash = '', code_expires_at = NULL, code_attempts = 0
+		WHERE id = $1 AND code_hash = $2`
+	result, err := p.db.ExecContext(ctx, query, recipientID, codeHash)
+	if err != nil {
+		return fmt.Errorf("postgres: use code of recipient %s: %w", recipientID, err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("postgres: use code of recipient %s: %w", recipientID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// ClearRecipientCodeByID drops the pending code, so it can't be used again.
+func (p *PostgresSQLDB) ClearRecipientCodeByID(ctx context.Context, recipientID uuid.UUID) error {
+	query := `
+		UPDATE transfer_recipients SET code_hash = '', code_expires_at = NULL, code_attempts = 0
+		WHERE id = $1`
+	_, err := p.db.ExecContext(ctx, query, recipientID)
+	if err != nil {
+		return fmt.Errorf("postgres: clear code of recipient %s: %w", recipientID, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) UpdateRecipientLastAccessByID(ctx context.Context, recipientID uuid.UUID) error {
+	query := `UPDATE transfer_recipients SET last_access_at = NOW() WHERE id = $1`
+	_, err := p.db.ExecContext(ctx, query, recipientID)
+	if err != nil {
+		return fmt.Errorf("postgres: update last access of recipient %s: %w", recipientID, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) DeleteRecipientByID(ctx context.Context, recipientID uuid.UUID) error {
+	query := `DELETE FROM transfer_recipients WHERE id = $1`
+	_, err := p.db.ExecContext(ctx, query, recipientID)
+	if err != nil {
+		return fmt.Errorf("postgres: delete recipient by ID %s: %w", recipientID, err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"large_fss/internals/models"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -26,6 +27,7 @@ type DbRepository interface {
 	CreateChunk(ctx context.Context,chunk models.Chunk)(error)
 
 	GetAllUploadedChunksIndex(ctx context.Context,transferID uuid.UUID)([]int,error)
+	FindUploadSessionsByOwnerID(ctx context.Context,ownerID uuid.UUID)([]models.UploadSession,error)
 
 	DeleteTempTransferByID(ctx context.Context,transferID uuid.UUID)(error)
 
@@ -35,6 +37,7 @@ type DbRepository interface {
 	FindTempTransferByID(ctx context.Context, id uuid.UUID) (*models.TempTransfer, error)
 
 	UpdateTempTransferLastUpdatedTimeByID(ctx context.Context, id uuid.UUID)(error)
+	UpdateTempTransferSizeByID(ctx context.Context, id uuid.UUID, size int64) error
 
 	CreateTransfer(ctx context.Context, trans models.Transfer) (uuid.UUID, error)
 
@@ -42,8 +45,29 @@ type DbRepository interface {
 
 	DeleteTransferByID(ctx context.Context,transID uuid.UUID)(error)
 
+	// Trash, sql.ErrNoRows when the transfer is missing or already in the state asked for
+	TrashTransferByID(ctx context.Context,transferID uuid.UUID)(*models.Transfer,error)
+	RestoreTransferByID(ctx context.Context,trans models.Transfer)(error)
+	FindTrashedTransfersBefore(ctx context.Context,cutoff time.Time)([]models.Transfer,error)
+
+	//Download reservations, held by a download under one ID for its transfer and its link
+	// sql.ErrNoRows from a reservation means no download is left, from a renewal that it lapsed
+	ReserveTransferDownloadByID(ctx context.Context,reservationID uuid.UUID,transferID uuid.UUID,expiresAt time.Time)(error)
+	ReleaseTransferDownloadByID(ctx context.Context,reservationID uuid.UUID,transferID uuid.UUID,completed bool)(*models.Transfer,error)
+	ReserveLinkDownloadByID(ctx context.Context,reservationID uuid.UUID,linkID uuid.UUID,expiresAt time.Time)(error)
+	ReleaseLinkDownloadByID(ctx context.Context,reservationID uuid.UUID,linkID uuid.UUID,completed bool)(error)
+	RenewDownloadReservation(ctx context.Context,reservationID uuid.UUID,expiresAt time.Time)(error)
+	CountActiveDownloadsByTransferID(ctx context.Context,transferID uuid.UUID)(int,error)
+	DeleteExpiredDownloadReservations(ctx context.Context)(int64,error)
+
 	FindAllExpiredTransfers(ctx context.Context)([]models.Transfer,error)
 
+	UpdateTransferSizeByID(ctx context.Context,transferID uuid.UUID,delta int64)(error)
+
+	UpdateTransferScanStatusByID(ctx context.Context,transferID uuid.UUID,status string)(error)
+
+	FindAllTransfersByScanStatus(ctx context.Context,statuses []string)([]models.Transfer,error)
+
 	
 
 
@@ -58,10 +82,104 @@ type DbRepository interface {
 
 	FindFileByID(ctx context.Context,fileID uuid.UUID)(*models.File,error)
 
-	IncrementActiveStreamByID(ctx context.Context,fileID uuid.UUID)(error)
-	DecrementActiveStreamByID(ctx context.Context,fileID uuid.UUID)(error)
-
-	FindAllTransfersByUserID(ctx context.Context,userID uuid.UUID)([]models.Transfer,error)
+	// sql.ErrNoRows when the file is missing or still being downloaded
+	// remove deletes the stored file before the row deletion is committed
+	DeleteFileByID(ctx context.Context,fileID uuid.UUID,remove func(file *models.File) error)(*models.File,error)
+
+	// sql.ErrNoRows when the transfer is missing or any of its files is being downloaded
+	// move puts the files into the transfer before the rows are committed
+	AppendFilesByTransferID(ctx context.Context,transferID uuid.UUID,files []models.File,addedSize int64,move func() error)(error)
+
+	// sql.ErrNoRows when the file is missing or still being downloaded
+	// move stores the object under the new path before the rename is committed
+	RenameFileByID(ctx context.Context,fileID uuid.UUID,fileName string,filePath string,fileExtension string,move func(oldPath string) error)(*models.File,error)
+
+	UpdateFileScanStatusByID(ctx context.Context,fileID uuid.UUID,status string,filePath string)(error)
+
+	UpdateFileThumbnailPathByID(ctx context.Context,fileID uuid.UUID,thumbnailPath string)(error)
+
+	//Url imports
+	CreateURLImport(ctx context.Context,urlImport models.URLImport)(error)
+	UpdateURLImport(ctx context.Context,urlImport models.URLImport)(error)
+	FindURLImportByID(ctx context.Context,transferID uuid.UUID)(*models.URLImport,error)
+	// Imports still running when the server stopped, their download is gone
+	FailInterruptedURLImports(ctx context.Context,errorMessage string)(int64,error)
+	DeleteURLImportsFinishedBefore(ctx context.Context,cutoff time.Time)(int64,error)
+
+	//Stream leases
+	// One lease covers all the files, sql.ErrNoRows from a renewal means the lease was removed
+	CreateStreamLease(ctx context.Context,leaseID uuid.UUID,fileIDs []uuid.UUID,expiresAt time.Time)(error)
+	RenewStreamLease(ctx context.Context,leaseID uuid.UUID,expiresAt time.Time)(error)
+	DeleteStreamLease(ctx context.Context,leaseID uuid.UUID)(error)
+	CountActiveStreamsByTransferID(ctx context.Context,transferID uuid.UUID)(int,error)
+	DeleteExpiredStreamLeases(ctx context.Context)(int64,error)
+
+	// A page of the owner's transfers in the filter's order
+	FindTransfersByFilter(ctx context.Context,filter models.TransferFilter)([]models.Transfer,error)
+
+	UpsertStoredObject(ctx context.Context,object models.StoredObject)(error)
+	FindStoredObjectsByTransferID(ctx context.Context,transferID uuid.UUID)([]models.StoredObject,error)
+	FindTransfersWithUnindexedFiles(ctx context.Context)([]models.Transfer,error)
+
+	//Share links
+	CreateLink(ctx context.Context,link models.Link)(*models.Link,error)
+	FindLinkByToken(ctx context.Context,token string)(*models.Link,error)
+	FindLinkByID(ctx context.Context,linkID uuid.UUID)(*models.Link,error)
+	FindAllLinksByTransferID(ctx context.Context,transferID uuid.UUID)([]models.Link,error)
+	FindAllLinksByTransferIDs(ctx context.Context,transferIDs []uuid.UUID)([]models.Link,error)
+	UpdateLinkByID(ctx context.Context,link models.Link)(error)
+	DeleteLinkByID(ctx context.Context,linkID uuid.UUID)(error)
+
+	//Recipients of private transfers
+	// Adding an email that is already a recipient returns the existing one
+	CreateRecipient(ctx context.Context,recipient models.TransferRecipient)(*models.TransferRecipient,error)
+	FindRecipientByID(ctx context.Context,recipientID uuid.UUID)(*models.TransferRecipient,error)
+	FindRecipientByEmail(ctx context.Context,transferID uuid.UUID,email string)(*models.TransferRecipient,error)
+	// Matches the user's ID or, for users who signed up after being added, their email
+	FindRecipientByUser(ctx context.Context,transferID uuid.UUID,userID uuid.UUID,email string)(*models.TransferRecipient,error)
+	FindRecipientStatusesByTransferID(ctx context.Context,transferID uuid.UUID)([]models.RecipientStatus,error)
+	FindRecipientStatusesByTransferIDs(ctx context.Context,transferIDs []uuid.UUID)([]models.RecipientStatus,error)
+	UpdateRecipientCodeByID(ctx context.Context,recipientID uuid.UUID,codeHash string,expiresAt time.Time)(error)
+	ClaimRecipientCodeAttemptByID(ctx context.Context,recipientID uuid.UUID,maxAttempts int)(int,error)
+	UseRecipientCodeByID(ctx context.Context,recipientID uuid.UUID,codeHash string)(error)
+	ClearRecipientCodeByID(ctx context.Context,recipientID uuid.UUID)(error)
+	UpdateRecipientLastAccessByID(ctx context.Context,recipientID uuid.UUID)(error)
+	DeleteRecipientByID(ctx context.Context,recipientID uuid.UUID)(error)
+
+	//Analytics
+	CreateDownloadEvent(ctx context.Context,event models.DownloadEvent)(error)
+	// Newest first, a limit of 0 returns every event
+	FindDownloadEventsByTransferID(ctx context.Context,transferID uuid.UUID,limit int,offset int)([]models.DownloadEvent,error)
+	// One row per downloaded file plus one with a null file for archives
+	FindDownloadStatsByTransferID(ctx context.Context,transferID uuid.UUID)([]models.DownloadStats,error)
+	// Totals of every given transfer that was downloaded at least once
+	FindDownloadStatsByTransferIDs(ctx context.Context,transferIDs []uuid.UUID)([]models.DownloadStats,error)
+
+	//Archive cache
+	FindArchiveCacheEntry(ctx context.Context,key string)(*models.ArchiveCacheEntry,error)
+	// An entry already cached under the key is kept
+	CreateArchiveCacheEntry(ctx context.Context,entry models.ArchiveCacheEntry)(error)
+	TouchArchiveCacheEntry(ctx context.Context,key string)(error)
+	DeleteArchiveCacheEntry(ctx context.Context,key string)(error)
+	DeleteArchiveCacheEntriesByTransferID(ctx context.Context,transferID uuid.UUID)([]models.ArchiveCacheEntry,error)
+	// Least recently used first
+	FindAllArchiveCacheEntries(ctx context.Context)([]models.ArchiveCacheEntry,error)
+	SumArchiveCacheSize(ctx context.Context)(int64,error)
+	SumStoredSizeByOwnerID(ctx context.Context,ownerID uuid.UUID)(int64,error)
+
+	//Notifications
+	MarkFilesDownloaded(ctx context.Context,fileIDs []uuid.UUID)(error)
+	// True only for the call that set the flag, so each owner is notified once
+	MarkTransferFirstDownloaded(ctx context.Context,transferID uuid.UUID)(bool,error)
+	MarkTransferAllDownloaded(ctx context.Context,transferID uuid.UUID)(bool,error)
+	CreateNotification(ctx context.Context,notification models.Notification)(error)
+	// Newest first
+	FindNotificationsByUserID(ctx context.Context,userID uuid.UUID,unreadOnly bool,limit int,offset int)([]models.Notification,error)
+	CountUnreadNotificationsByUserID(ctx context.Context,userID uuid.UUID)(int,error)
+	MarkNotificationReadByID(ctx context.Context,notificationID uuid.UUID,userID uuid.UUID)(error)
+	MarkAllNotificationsReadByUserID(ctx context.Context,userID uuid.UUID)(error)
+	FindNotificationPreferencesByUserID(ctx context.Context,userID uuid.UUID)([]models.NotificationPreference,error)
+	UpsertNotificationPreference(ctx context.Context,preference models.NotificationPreference)(error)
 
 
 	// ModifyTimeById(ctx context.Context,id uuid.UUID)(error)
@@ -2,23 +2,28 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"large_fss/internals/constants"
 	"large_fss/internals/models"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // CreateTempTransfer inserts a new temp transfer and returns its ID.
+// A preset ID is kept so appends can upload against an existing transfer ID.
 func (p *PostgresSQLDB) CreateTempTransfer(ctx context.Context, temptrans models.TempTransfer) (uuid.UUID, error) {
-	temptrans.ID = uuid.New()
+	if temptrans.ID == uuid.Nil {
+		temptrans.ID = uuid.New()
+	}
 	temptrans.CreatedAt = time.Now()
 	temptrans.LastUpdated = time.Now()
 
 	query := `
-		INSERT INTO temp_transfers (id, owner_id, message,size, expiry, created_at, last_updated)
-		VALUES (:id, :owner_id,:message, :size, :expiry, :created_at, :last_updated)`
+		INSERT INTO temp_transfers (id, owner_id, message,size, expiry, expiry_value, store_as_is, file_name, max_downloads, password_hash, created_at, last_updated)
+		VALUES (:id, :owner_id,:message, :size, :expiry, :expiry_value, :store_as_is, :file_name, :max_downloads, :password_hash, :created_at, :last_updated)`
 
 	_, err := p.db.NamedExecContext(ctx, query, &temptrans)
 	if err != nil {
@@ -31,7 +36,7 @@ func (p *PostgresSQLDB) CreateTempTransfer(ctx context.Context, temptrans models
 
 func (p *PostgresSQLDB) FindAllFailedTempTransfers(ctx context.Context) ([]models.TempTransfer, error) {
 	query := fmt.Sprintf(`
-		SELECT id, owner_id, message, size, expiry, created_at, last_updated
+		SELECT id, owner_id, message, size, expiry, expiry_value, store_as_is, file_name, max_downloads, password_hash, created_at, last_updated
 		FROM temp_transfers
 		WHERE last_updated < NOW() - INTERVAL '%d hours'
 		ORDER BY last_updated ASC;
@@ -89,14 +94,25 @@ func (p *PostgresSQLDB) UpdateTempTransferLastUpdatedTimeByID(ctx context.Contex
 	return nil
 }
 
+// UpdateTempTransferSizeByID records the final size of an upload whose size was not known upfront.
+func (p *PostgresSQLDB) UpdateTempTransferSizeByID(ctx context.Context, id uuid.UUID, size int64) error {
+	query := `UPDATE temp_transfers SET size = $1, last_updated = $2 WHERE id = $3`
+
+	_, err := p.db.ExecContext(ctx, query, size, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("postgres: update temp transfer size by ID %s: %w", id, err)
+	}
+	return nil
+}
+
 // CreateTransfer inserts a new permanent transfer record.
 func (p *PostgresSQLDB) CreateTransfer(ctx context.Context, trans models.Transfer) (uuid.UUID, error) {
 	fmt.Println("transfer-", trans)
 	trans.CreatedAt = time.Now()
 
 	query := `
-		INSERT INTO transfers (id, owner_id, transfer_path,message, size, created_at, expiry)
-		VALUES (:id, :owner_id, :transfer_path,:message, :size, :created_at, :expiry)`
+		INSERT INTO transfers (id, owner_id, transfer_path,message, size, created_at, expiry, max_downloads, password_hash)
+		VALUES (:id, :owner_id, :transfer_path,:message, :size, :created_at, :expiry, :max_downloads, :password_hash)`
 
 	_, err := p.db.NamedExecContext(ctx, query, &trans)
 	if err != nil {
@@ -109,9 +125,9 @@ func (p *PostgresSQLDB) CreateTransfer(ctx context.Context, trans models.Transfe
 // Update Transfer
 func (p *PostgresSQLDB) UpdateTransferByID(ctx context.Context, trans models.Transfer) error {
 	query := `
-		UPDATE transfers SET message = $1,expiry = $2
-		WHERE id = $3 `
-	_, err := p.db.ExecContext(ctx, query, trans.Message, trans.Expiry, trans.ID)
+		UPDATE transfers SET message = $1,expiry = $2, max_downloads = $3, password_hash = $4, private = $5
+		WHERE id = $6 `
+	_, err := p.db.ExecContext(ctx, query, trans.Message, trans.Expiry, trans.MaxDownloads, trans.PasswordHash, trans.Private, trans.ID)
 	if err != nil {
 		return fmt.Errorf("postgres: update transfer by id %v: %w", trans.ID, err)
 	}
@@ -119,6 +135,49 @@ func (p *PostgresSQLDB) UpdateTransferByID(ctx context.Context, trans models.Tra
 	return nil
 }
 
+// TrashTransferByID moves a transfer to the trash. sql.ErrNoRows is returned when it is
+// missing or already trashed.
+func (p *PostgresSQLDB) TrashTransferByID(ctx context.Context, transferID uuid.UUID) (*models.Transfer, error) {
+	query := `UPDATE transfers SET trashed_at = NOW() WHERE id = $1 AND trashed_at IS NULL RETURNING *`
+	var transfer models.Transfer
+	err := p.db.GetContext(ctx, &transfer, query, transferID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: trash transfer by ID %s: %w", transferID, err)
+	}
+	return &transfer, nil
+}
+
+// RestoreTransferByID takes a transfer out of the trash with the given expiry and download
+// limit. sql.ErrNoRows is returned when it is missing or not trashed.
+func (p *PostgresSQLDB) RestoreTransferByID(ctx context.Context, trans models.Transfer) error {
+	query := `
+		UPDATE transfers SET trashed_at = NULL, expiry = $1, max_downloads = $2
+		WHERE id = $3 AND trashed_at IS NOT NULL`
+	result, err := p.db.ExecContext(ctx, query, trans.Expiry, trans.MaxDownloads, trans.ID)
+	if err != nil {
+		return fmt.Errorf("postgres: restore transfer by ID %s: %w", trans.ID, err)
+	}
+	restored, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgres: restore transfer by ID %s: %w", trans.ID, err)
+	}
+	if restored == 0 {
+		return fmt.Errorf("postgres: restore transfer by ID %s: %w", trans.ID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// FindTrashedTransfersBefore lists transfers trashed before the cutoff, oldest first.
+func (p *PostgresSQLDB) FindTrashedTransfersBefore(ctx context.Context, cutoff time.Time) ([]models.Transfer, error) {
+	query := `SELECT * FROM transfers WHERE trashed_at IS NOT NULL AND trashed_at < $1 ORDER BY trashed_at ASC`
+	var transfers []models.Transfer
+	err := p.db.SelectContext(ctx, &transfers, query, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find trashed transfers before %s: %w", cutoff, err)
+	}
+	return transfers, nil
+}
+
 // Delete Transfer
 func (p *PostgresSQLDB) DeleteTransferByID(ctx context.Context, transferID uuid.UUID) error {
 	query := `DELETE FROM transfers WHERE id = $1`
@@ -130,13 +189,24 @@ func (p *PostgresSQLDB) DeleteTransferByID(ctx context.Context, transferID uuid.
 	return nil
 }
 
+// UpdateTransferSizeByID adds delta (which may be negative) to the transfer size.
+func (p *PostgresSQLDB) UpdateTransferSizeByID(ctx context.Context, transferID uuid.UUID, delta int64) error {
+	query := `UPDATE transfers SET size = GREATEST(size + $1, 0) WHERE id = $2`
+
+	_, err := p.db.ExecContext(ctx, query, delta, transferID)
+	if err != nil {
+		return fmt.Errorf("postgres: update transfer size by ID %s: %w", transferID, err)
+	}
+	return nil
+}
+
 // CreateFile inserts a file associated with a transfer.
 func (p *PostgresSQLDB) CreateFile(ctx context.Context, fileData models.File) (uuid.UUID, error) {
 	fileData.ID = uuid.New()
 
 	query := `
-		INSERT INTO files (id, file_name, file_size, file_path, transfer_id, file_extension)
-		VALUES (:id, :file_name, :file_size, :file_path, :transfer_id, :file_extension)`
+		INSERT INTO files (id, file_name, file_size, file_path, transfer_id, file_extension, mime_type)
+		VALUES (:id, :file_name, :file_size, :file_path, :transfer_id, :file_extension, :mime_type)`
 
 	_, err := p.db.NamedExecContext(ctx, query, &fileData)
 	if err != nil {
@@ -149,15 +219,58 @@ func (p *PostgresSQLDB) CreateFile(ctx context.Context, fileData models.File) (u
 func (p *PostgresSQLDB) CreateChunk(ctx context.Context, chunk models.Chunk) error {
 	chunk.ID = uuid.New()
 	query := `
-		INSERT INTO chunks (id,transfer_id, index, uploaded_at)
-		VALUES ($1, $2, $3,$4)`
-	_, err := p.db.ExecContext(ctx, query, chunk.ID, chunk.TranferID, chunk.Index, chunk.UploadedAt)
+		INSERT INTO chunks (id,transfer_id, index, size, uploaded_at)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err := p.db.ExecContext(ctx, query, chunk.ID, chunk.TranferID, chunk.Index, chunk.Size, chunk.UploadedAt)
 	if err != nil {
 		return fmt.Errorf("postgres: create chunk: %w", err)
 	}
 	return nil
 }
 
+// uploadSessionRow scans the chunk indexes of a session, aggregated into an array.
+type uploadSessionRow struct {
+	models.UploadSession
+	ChunkIndexes pq.Int64Array `db:"chunk_indexes"`
+}
+
+// FindUploadSessionsByOwnerID lists the user's unassembled uploads, most recently active first.
+// A chunk uploaded again counts once, with its latest size.
+func (p *PostgresSQLDB) FindUploadSessionsByOwnerID(ctx context.Context, ownerID uuid.UUID) ([]models.UploadSession, error) {
+	query := `
+		SELECT t.id, t.owner_id, COALESCE(t.message, '') AS message, t.size, t.expiry, t.expiry_value, t.store_as_is,
+			t.file_name, t.max_downloads, t.password_hash, t.created_at, t.last_updated,
+			COUNT(c.index) AS uploaded_chunks,
+			COALESCE(SUM(c.size), 0) AS received_bytes,
+			COALESCE(array_agg(c.index ORDER BY c.index) FILTER (WHERE c.index IS NOT NULL), '{}') AS chunk_indexes,
+			EXISTS (SELECT 1 FROM transfers WHERE transfers.id = t.id) AS append,
+			EXISTS (SELECT 1 FROM url_imports WHERE url_imports.transfer_id = t.id) AS url_import
+		FROM temp_transfers t
+		LEFT JOIN (
+			SELECT DISTINCT ON (transfer_id, index) transfer_id, index, size
+			FROM chunks
+			ORDER BY transfer_id, index, uploaded_at DESC
+		) c ON c.transfer_id = t.id
+		WHERE t.owner_id = $1
+		GROUP BY t.id
+		ORDER BY t.last_updated DESC`
+	rows := []uploadSessionRow{}
+	err := p.db.SelectContext(ctx, &rows, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find upload sessions by OwnerID %s: %w", ownerID, err)
+	}
+	sessions := make([]models.UploadSession, 0, len(rows))
+	for _, row := range rows {
+		session := row.UploadSession
+		session.ChunkIndexes = make([]int, 0, len(row.ChunkIndexes))
+		for _, index := range row.ChunkIndexes {
+			session.ChunkIndexes = append(session.ChunkIndexes, int(index))
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
 func (p *PostgresSQLDB) GetAllUploadedChunksIndex(ctx context.Context, transferID uuid.UUID) ([]int, error) {
 	query := `SELECT index FROM chunks WHERE transfer_id = $1 ORDER BY index ASC`
 	rows, err := p.db.QueryxContext(ctx, query, transferID)
@@ -197,39 +310,160 @@ func (p *PostgresSQLDB) FindFileByID(ctx context.Context, fileID uuid.UUID) (*mo
 	return &file, nil
 }
 
-func (p *PostgresSQLDB) IncrementActiveStreamByID(ctx context.Context, fileID uuid.UUID) error {
+// DeleteFileByID removes a file row only while no unexpired stream lease holds it, along with
+// its stored object and its share of the transfer size. remove is called once the rows are
+// deleted and before they are committed, so a file that can't be removed from storage keeps
+// its row. sql.ErrNoRows is returned when the file is missing or still being downloaded.
+func (p *PostgresSQLDB) DeleteFileByID(ctx context.Context, fileID uuid.UUID, remove func(file *models.File) error) (*models.File, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: delete file by FileID %s: %w", fileID, err)
+	}
+	defer tx.Rollback()
+
+	// The deleted row stays locked until commit, which keeps new stream leases out
 	query := `
-        UPDATE files 
-        SET num_of_active_stream = num_of_active_stream + 1 
-        WHERE id = $1;
-    `
-	result, err := p.db.ExecContext(ctx, query, fileID)
+		DELETE FROM files WHERE id = $1
+			AND NOT EXISTS (SELECT 1 FROM stream_leases WHERE file_id = $1 AND expires_at > NOW())
+		RETURNING *`
+	var file models.File
+	err = tx.GetContext(ctx, &file, query, fileID)
 	if err != nil {
-		return fmt.Errorf("failed to increment active stream: %w", err)
+		return nil, fmt.Errorf("postgres: delete file by FileID %s: %w", fileID, err)
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("no file found with ID %s", fileID)
+	_, err = tx.ExecContext(ctx, `DELETE FROM stored_objects WHERE path = $1`, file.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: delete stored object %s: %w", file.FilePath, err)
 	}
-	return nil
+	_, err = tx.ExecContext(ctx, `UPDATE transfers SET size = GREATEST(size - $1, 0) WHERE id = $2`, file.FileSize, file.TransferID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: update transfer size by ID %s: %w", file.TransferID, err)
+	}
+	err = remove(&file)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("postgres: delete file by FileID %s: %w", fileID, err)
+	}
+	return &file, nil
 }
 
-func (p *PostgresSQLDB) DecrementActiveStreamByID(ctx context.Context, fileID uuid.UUID) error {
+// AppendFilesByTransferID registers appended files on a transfer only while none of its files
+// holds an unexpired stream lease, grows the transfer by addedSize and marks it for a rescan.
+// move is called once the rows are written and before they are committed, and the file rows
+// stay locked until then so no download of the transfer can start in between.
+// sql.ErrNoRows is returned when the transfer is missing or still being downloaded.
+func (p *PostgresSQLDB) AppendFilesByTransferID(ctx context.Context, transferID uuid.UUID, files []models.File, addedSize int64, move func() error) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("postgres: append files to transfer %s: %w", transferID, err)
+	}
+	defer tx.Rollback()
+
+	var id uuid.UUID
+	err = tx.GetContext(ctx, &id, `SELECT id FROM transfers WHERE id = $1 FOR UPDATE`, transferID)
+	if err != nil {
+		return fmt.Errorf("postgres: append files to transfer %s: %w", transferID, err)
+	}
+	_, err = tx.ExecContext(ctx, `SELECT id FROM files WHERE transfer_id = $1 FOR UPDATE`, transferID)
+	if err != nil {
+		return fmt.Errorf("postgres: append files to transfer %s: %w", transferID, err)
+	}
 	query := `
-        UPDATE files 
-        SET num_of_active_stream = GREATEST(num_of_active_stream - 1, 0)
-        WHERE id = $1;
-    `
-	result, err := p.db.ExecContext(ctx, query, fileID)
+		SELECT COUNT(*)
+		FROM stream_leases l
+		JOIN files f ON f.id = l.file_id
+		WHERE f.transfer_id = $1 AND l.expires_at > NOW()`
+	var active int
+	err = tx.GetContext(ctx, &active, query, transferID)
+	if err != nil {
+		return fmt.Errorf("postgres: append files to transfer %s: %w", transferID, err)
+	}
+	if active > 0 {
+		return fmt.Errorf("postgres: append files to transfer %s: %w", transferID, sql.ErrNoRows)
+	}
+
+	query = `
+		INSERT INTO files (id, file_name, file_size, file_path, transfer_id, file_extension, mime_type)
+		VALUES (:id, :file_name, :file_size, :file_path, :transfer_id, :file_extension, :mime_type)`
+	for _, fileData := range files {
+		fileData.ID = uuid.New()
+		fileData.TransferID = transferID
+		_, err = tx.NamedExecContext(ctx, query, &fileData)
+		if err != nil {
+			return fmt.Errorf("postgres: create file: %w", err)
+		}
+	}
+	query = `UPDATE transfers SET size = GREATEST(size + $1, 0), scan_status = $2 WHERE id = $3`
+	_, err = tx.ExecContext(ctx, query, addedSize, constants.ScanStatusPending, transferID)
+	if err != nil {
+		return fmt.Errorf("postgres: update transfer size by ID %s: %w", transferID, err)
+	}
+	err = move()
 	if err != nil {
-		return fmt.Errorf("failed to decrement active stream: %w", err)
+		return err
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("no file found with ID %s", fileID)
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("postgres: append files to transfer %s: %w", transferID, err)
 	}
 	return nil
 }
+
+// RenameFileByID changes a file's name and path only while no unexpired stream lease holds it.
+// move is called with the old path once the rows are updated and before they are committed,
+// so a failed move leaves the rows as they were. sql.ErrNoRows is returned when the file
+// is missing or still being downloaded.
+func (p *PostgresSQLDB) RenameFileByID(ctx context.Context, fileID uuid.UUID, fileName string, filePath string, fileExtension string, move func(oldPath string) error) (*models.File, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: rename file by FileID %s: %w", fileID, err)
+	}
+	defer tx.Rollback()
+
+	// Renames of one transfer take turns, and the file row lock keeps new stream leases
+	// out until the rename is committed
+	query := `
+		SELECT t.id FROM transfers t JOIN files f ON f.transfer_id = t.id
+		WHERE f.id = $1
+		FOR UPDATE OF t`
+	var transferID uuid.UUID
+	err = tx.GetContext(ctx, &transferID, query, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: rename file by FileID %s: %w", fileID, err)
+	}
+	var old models.File
+	err = tx.GetContext(ctx, &old, `SELECT * FROM files WHERE id = $1 FOR UPDATE`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: rename file by FileID %s: %w", fileID, err)
+	}
+	query = `
+		UPDATE files SET file_name = $1, file_path = $2, file_extension = $3
+		WHERE id = $4
+			AND NOT EXISTS (SELECT 1 FROM stream_leases WHERE file_id = $4 AND expires_at > NOW())
+		RETURNING *`
+	var file models.File
+	err = tx.GetContext(ctx, &file, query, fileName, filePath, fileExtension, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: rename file by FileID %s: %w", fileID, err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE stored_objects SET path = $2, updated_at = NOW() WHERE path = $1`, old.FilePath, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: rename stored object %s: %w", old.FilePath, err)
+	}
+	err = move(old.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("postgres: rename file by FileID %s: %w", fileID, err)
+	}
+	return &file, nil
+}
+
 func (p *PostgresSQLDB) FindTransferByID(ctx context.Context, transferID uuid.UUID) (*models.Transfer, error) {
 	query := `SELECT * FROM transfers WHERE id = $1`
 	var transfer models.Transfer
@@ -240,21 +474,15 @@ func (p *PostgresSQLDB) FindTransferByID(ctx context.Context, transferID uuid.UU
 	return &transfer, nil
 }
 
-func (p *PostgresSQLDB) FindAllTransfersByUserID(ctx context.Context, userID uuid.UUID) ([]models.Transfer, error) {
-	query := `SELECT * FROM transfers WHERE owner_id = $1 ORDER BY created_at DESC`
-	var transfers []models.Transfer
-	err := p.db.SelectContext(ctx, &transfers, query, userID)
-	if err != nil {
-		return nil, fmt.Errorf("postgres: find all transfers by UserID %s: %w", userID, err)
-	}
-	return transfers, nil
-}
-
 func (p *PostgresSQLDB) FindAllExpiredTransfers(ctx context.Context) ([]models.Transfer, error) {
 	query := `
-		SELECT id, owner_id, transfer_path, message, size, created_at, expiry
+		SELECT id, owner_id, transfer_path, message, size, created_at, expiry, scan_status,
+			max_downloads, download_count, password_hash, first_downloaded_at
 		FROM transfers
-		WHERE expiry IS NOT NULL AND expiry < NOW()
+		WHERE trashed_at IS NULL AND (
+			(expiry IS NOT NULL AND expiry < NOW())
+			OR (max_downloads IS NOT NULL AND download_count >= max_downloads
+				AND NOT EXISTS (SELECT 1 FROM download_reservations r WHERE r.transfer_id = transfers.id AND r.expires_at > NOW())))
 		ORDER BY expiry ASC;
 	`
 
@@ -276,6 +504,55 @@ func (p *PostgresSQLDB) FindAllExpiredTransfers(ctx context.Context) ([]models.T
 	return transfers, nil
 }
 
+// UpdateTransferScanStatusByID records the aggregated malware scan status of a transfer.
+// A transfer with files still pending is never marked clean.
+func (p *PostgresSQLDB) UpdateTransferScanStatusByID(ctx context.Context, transferID uuid.UUID, status string) error {
+	query := `
+		UPDATE transfers SET scan_status = $1
+		WHERE id = $2 AND ($1 <> 'clean' OR NOT EXISTS (
+			SELECT 1 FROM files WHERE files.transfer_id = $2 AND files.scan_status = 'pending'
+		))`
+
+	_, err := p.db.ExecContext(ctx, query, status, transferID)
+	if err != nil {
+		return fmt.Errorf("postgres: update transfer scan status by ID %s: %w", transferID, err)
+	}
+	return nil
+}
+
+// UpdateFileThumbnailPathByID records where a file's thumbnail is stored, "" for none.
+func (p *PostgresSQLDB) UpdateFileThumbnailPathByID(ctx context.Context, fileID uuid.UUID, thumbnailPath string) error {
+	query := `UPDATE files SET thumbnail_path = $1 WHERE id = $2`
+
+	_, err := p.db.ExecContext(ctx, query, thumbnailPath, fileID)
+	if err != nil {
+		return fmt.Errorf("postgres: update file thumbnail path by ID %s: %w", fileID, err)
+	}
+	return nil
+}
+
+// UpdateFileScanStatusByID records a file's scan status and its (possibly quarantined) path.
+func (p *PostgresSQLDB) UpdateFileScanStatusByID(ctx context.Context, fileID uuid.UUID, status string, filePath string) error {
+	query := `UPDATE files SET scan_status = $1, file_path = $2 WHERE id = $3`
+
+	_, err := p.db.ExecContext(ctx, query, status, filePath, fileID)
+	if err != nil {
+		return fmt.Errorf("postgres: update file scan status by ID %s: %w", fileID, err)
+	}
+	return nil
+}
+
+// FindAllTransfersByScanStatus lists transfers whose scan is in one of the given states.
+func (p *PostgresSQLDB) FindAllTransfersByScanStatus(ctx context.Context, statuses []string) ([]models.Transfer, error) {
+	query := `SELECT * FROM transfers WHERE scan_status = ANY($1) ORDER BY created_at ASC`
+	var transfers []models.Transfer
+	err := p.db.SelectContext(ctx, &transfers, query, pq.Array(statuses))
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find all transfers by scan status %v: %w", statuses, err)
+	}
+	return transfers, nil
+}
+
 // func (p *PostgresSQLDB)CreateChunk(ctx context.Context,chunk models.Chunk)(error){
 // 	return nil
 // }
@@ -295,3 +572,52 @@ func (p *PostgresSQLDB) FindAllExpiredTransfers(ctx context.Context) ([]models.T
 // func (p *PostgresSQLDB)FindTransferByID(ctx context.Context,transferID uuid.UUID)(*models.Transfer,error){
 // 	return nil,nil
 // }
+
+// UpsertStoredObject records the checksum of a stored file, replacing an older record of the same path.
+func (p *PostgresSQLDB) UpsertStoredObject(ctx context.Context, object models.StoredObject) error {
+	object.UpdatedAt = time.Now()
+	query := `
+		INSERT INTO stored_objects (path, transfer_id, size, crc32, mime_type, updated_at)
+		VALUES (:path, :transfer_id, :size, :crc32, :mime_type, :updated_at)
+		ON CONFLICT (path) DO UPDATE SET
+			transfer_id = EXCLUDED.transfer_id,
+			size = EXCLUDED.size,
+			crc32 = EXCLUDED.crc32,
+			mime_type = EXCLUDED.mime_type,
+			updated_at = EXCLUDED.updated_at`
+
+	_, err := p.db.NamedExecContext(ctx, query, &object)
+	if err != nil {
+		return fmt.Errorf("postgres: upsert stored object %s: %w", object.Path, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) FindStoredObjectsByTransferID(ctx context.Context, transferID uuid.UUID) ([]models.StoredObject, error) {
+	query := `SELECT * FROM stored_objects WHERE transfer_id = $1`
+	var objects []models.StoredObject
+	err := p.db.SelectContext(ctx, &objects, query, transferID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find stored objects by TransferID %s: %w", transferID, err)
+	}
+	return objects, nil
+}
+
+// FindTransfersWithUnindexedFiles lists transfers with a clean file that has no stored
+// object record, or one that doesn't match its size.
+func (p *PostgresSQLDB) FindTransfersWithUnindexedFiles(ctx context.Context) ([]models.Transfer, error) {
+	query := `
+		SELECT * FROM transfers t
+		WHERE t.trashed_at IS NULL AND EXISTS (
+			SELECT 1 FROM files f
+			LEFT JOIN stored_objects o ON o.path = f.file_path
+			WHERE f.transfer_id = t.id AND f.scan_status = $1
+				AND (o.path IS NULL OR o.size <> f.file_size))
+		ORDER BY t.created_at ASC`
+	var transfers []models.Transfer
+	err := p.db.SelectContext(ctx, &transfers, query, constants.ScanStatusClean)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find transfers with unindexed files: %w", err)
+	}
+	return transfers, nil
+}
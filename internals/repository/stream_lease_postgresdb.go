@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// CreateStreamLease leases the files under leaseID. It fails when any of them is gone.
+func (p *PostgresSQLDB) CreateStreamLease(ctx context.Context, leaseID uuid.UUID, fileIDs []uuid.UUID, expiresAt time.Time) error {
+	ids := make([]string, len(fileIDs))
+	for i, fileID := range fileIDs {
+		ids[i] = fileID.String()
+	}
+	query := `
+		INSERT INTO stream_leases (id, file_id, expires_at)
+		SELECT $1, file_id, $3 FROM unnest($2::uuid[]) AS file_id`
+	result, err := p.db.ExecContext(ctx, query, leaseID, pq.Array(ids), expiresAt)
+	if err != nil {
+		return fmt.Errorf("postgres: create stream lease %s: %w", leaseID, err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected != int64(len(fileIDs)) {
+		return fmt.Errorf("postgres: create stream lease %s: leased %d of %d files", leaseID, rowsAffected, len(fileIDs))
+	}
+	return nil
+}
+
+// RenewStreamLease pushes the expiry of a lease back. sql.ErrNoRows means the lease lapsed
+// and was purged, or its files were deleted.
+func (p *PostgresSQLDB) RenewStreamLease(ctx context.Context, leaseID uuid.UUID, expiresAt time.Time) error {
+	query := `UPDATE stream_leases SET expires_at = $1 WHERE id = $2`
+	result, err := p.db.ExecContext(ctx, query, expiresAt, leaseID)
+	if err != nil {
+		return fmt.Errorf("postgres: renew stream lease %s: %w", leaseID, err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("postgres: renew stream lease %s: %w", leaseID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) DeleteStreamLease(ctx context.Context, leaseID uuid.UUID) error {
+	query := `DELETE FROM stream_leases WHERE id = $1`
+	_, err := p.db.ExecContext(ctx, query, leaseID)
+	if err != nil {
+		return fmt.Errorf("postgres: delete stream lease %s: %w", leaseID, err)
+	}
+	return nil
+}
+
+// CountActiveStreamsByTransferID counts the unexpired leases on files of the transfer.
+func (p *PostgresSQLDB) CountActiveStreamsByTransferID(ctx context.Context, transferID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT l.id)
+		FROM stream_leases l
+		JOIN files f ON f.id = l.file_id
+		WHERE f.transfer_id = $1 AND l.expires_at > NOW()`
+	var count int
+	err := p.db.GetContext(ctx, &count, query, transferID)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: count active streams of transfer %s: %w", transferID, err)
+	}
+	return count, nil
+}
+
+// DeleteExpiredStreamLeases purges the leases of downloads that stopped renewing them,
+// such as those of a crashed server.
+func (p *PostgresSQLDB) DeleteExpiredStreamLeases(ctx context.Context) (int64, error) {
+	query := `DELETE FROM stream_leases WHERE expires_at <= NOW()`
+	result, err := p.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: delete expired stream leases: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"large_fss/internals/constants"
+	"large_fss/internals/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// transferSortKeys are the expressions transfers are ordered by, matching the owner indexes.
+var transferSortKeys = map[string]string{
+	constants.TransferSortCreatedAt: "created_at",
+	constants.TransferSortSize:      "size",
+	constants.TransferSortExpiry:    "COALESCE(expiry, 'infinity'::timestamptz)",
+}
+
+// searchableText splits names such as "q3_report.pdf" into words before they are indexed,
+// the expression must stay the same as in the search indexes.
+func searchableText(column string) string {
+	return fmt.Sprintf(`to_tsvector('simple', regexp_replace(COALESCE(%s, ''), '[^[:alnum:]]+', ' ', 'g'))`, column)
+}
+
+// FindTransfersByFilter pages through the owner's transfers with keyset pagination, the
+// filter's cursor is compared with the sort key and the ID so pages never overlap.
+func (p *PostgresSQLDB) FindTransfersByFilter(ctx context.Context, filter models.TransferFilter) ([]models.Transfer, error) {
+	sortKey, ok := transferSortKeys[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("postgres: find transfers by filter: unknown sort %q", filter.Sort)
+	}
+	conditions := []string{"owner_id = $1"}
+	args := []any{filter.OwnerID}
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// The trash is only listed on its own
+	if filter.Status == constants.TransferStatusTrashed {
+		conditions = append(conditions, "trashed_at IS NOT NULL")
+	} else {
+		conditions = append(conditions, "trashed_at IS NULL")
+	}
+	switch filter.Status {
+	case constants.TransferStatusActive:
+		conditions = append(conditions, "(expiry IS NULL OR expiry > NOW())")
+	case constants.TransferStatusExpired:
+		conditions = append(conditions, "expiry <= NOW()")
+	case constants.TransferStatusNever:
+		conditions = append(conditions, "expiry IS NULL")
+	}
+	if filter.MinSize != nil {
+		conditions = append(conditions, "size >= "+arg(*filter.MinSize))
+	}
+	if filter.MaxSize != nil {
+		conditions = append(conditions, "size <= "+arg(*filter.MaxSize))
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*filter.CreatedBefore))
+	}
+	if filter.Search != "" {
+		search := arg(filter.Search)
+		conditions = append(conditions, fmt.Sprintf(
+			"(%s @@ to_tsquery('simple', %s) OR id IN (SELECT transfer_id FROM files WHERE %s @@ to_tsquery('simple', %s)))",
+			searchableText("message"), search, searchableText("file_name"), search))
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		value := arg(filter.After.Value)
+		if filter.Sort == constants.TransferSortSize {
+			value += "::bigint"
+		} else {
+			value += "::timestamptz"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", sortKey, comparison, value, arg(filter.After.ID)))
+	}
+
+	query := fmt.Sprintf(`SELECT * FROM transfers WHERE %s ORDER BY %s %s, id %s LIMIT %s`,
+		strings.Join(conditions, " AND "), sortKey, direction, direction, arg(filter.Limit))
+	transfers := []models.Transfer{}
+	err := p.db.SelectContext(ctx, &transfers, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find transfers by filter of UserID %s: %w", filter.OwnerID, err)
+	}
+	return transfers, nil
+}
+
+// uuidArray passes IDs as a uuid[] parameter.
+func uuidArray(ids []uuid.UUID) any {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = id.String()
+	}
+	return pq.Array(values)
+}
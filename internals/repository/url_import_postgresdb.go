@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"large_fss/internals/constants"
+	"large_fss/internals/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (p *PostgresSQLDB) CreateURLImport(ctx context.Context, urlImport models.URLImport) error {
+	query := `
+		INSERT INTO url_imports (transfer_id, owner_id, status, bytes_received, total_bytes, error_message)
+		VALUES (:transfer_id, :owner_id, :status, :bytes_received, :total_bytes, :error_message)`
+	_, err := p.db.NamedExecContext(ctx, query, urlImport)
+	if err != nil {
+		return fmt.Errorf("postgres: create url import %s: %w", urlImport.TransferID, err)
+	}
+	return nil
+}
+
+// UpdateURLImport saves the progress of an import, a finished one gets its finish time.
+func (p *PostgresSQLDB) UpdateURLImport(ctx context.Context, urlImport models.URLImport) error {
+	query := `
+		UPDATE url_imports SET status = :status, bytes_received = :bytes_received, total_bytes = :total_bytes,
+			error_message = :error_message, updated_at = NOW(), finished_at = :finished_at
+		WHERE transfer_id = :transfer_id`
+	_, err := p.db.NamedExecContext(ctx, query, urlImport)
+	if err != nil {
+		return fmt.Errorf("postgres: update url import %s: %w", urlImport.TransferID, err)
+	}
+	return nil
+}
+
+func (p *PostgresSQLDB) FindURLImportByID(ctx context.Context, transferID uuid.UUID) (*models.URLImport, error) {
+	query := `SELECT * FROM url_imports WHERE transfer_id = $1`
+	var urlImport models.URLImport
+	err := p.db.GetContext(ctx, &urlImport, query, transferID)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: find url import %s: %w", transferID, err)
+	}
+	return &urlImport, nil
+}
+
+// FailInterruptedURLImports marks the imports that were still running as failed.
+func (p *PostgresSQLDB) FailInterruptedURLImports(ctx context.Context, errorMessage string) (int64, error) {
+	query := `
+		UPDATE url_imports SET status = $1, error_message = $2, updated_at = NOW(), finished_at = NOW()
+		WHERE status IN ($3, $4)`
+	result, err := p.db.ExecContext(ctx, query, constants.ImportStatusFailed, errorMessage,
+		constants.ImportStatusDownloading, constants.ImportStatusAssembling)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: fail interrupted url imports: %w", err)
+	}
+	failed, _ := result.RowsAffected()
+	return failed, nil
+}
+
+func (p *PostgresSQLDB) DeleteURLImportsFinishedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := `DELETE FROM url_imports WHERE finished_at < $1`
+	result, err := p.db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: delete url imports finished before %s: %w", cutoff, err)
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
@@ -27,7 +27,7 @@ func (r *PostgresSQLDB) CreateUser(ctx context.Context, user models.User) (uuid.
 
 func (r *PostgresSQLDB) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	query := `SELECT id, email, password,first_name,last_name FROM users WHERE email = $1`
+	query := `SELECT id, email, password,first_name,last_name,plan,role FROM users WHERE email = $1`
 	err := r.db.GetContext(ctx, &user, query, email)
 	if err != nil {
 		return nil, fmt.Errorf("postgres:find user by email: %w", err)
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	clamdChunkSize = 64 * 1024       // Size of each INSTREAM chunk
+	clamdTimeout   = 2 * time.Minute // Idle timeout for a single read/write on the socket
+)
+
+// ClamdScanner streams content to a clamd daemon with the INSTREAM command.
+type ClamdScanner struct {
+	Network string // "tcp" or "unix"
+	Address string
+	Timeout time.Duration
+}
+
+// NewClamdScanner builds a scanner from an address such as
+// tcp://127.0.0.1:3310 or unix:///var/run/clamav/clamd.ctl.
+func NewClamdScanner(address string) (Scanner, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("clamd scanner: invalid address %q: %w", address, err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		return &ClamdScanner{Network: "tcp", Address: u.Host, Timeout: clamdTimeout}, nil
+	case "unix":
+		return &ClamdScanner{Network: "unix", Address: u.Path, Timeout: clamdTimeout}, nil
+	default:
+		return nil, fmt.Errorf("clamd scanner: unsupported scheme %q in %q", u.Scheme, address)
+	}
+}
+
+func (c *ClamdScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return ScanResult{}, fmt.Errorf("clamd scanner: dial %s: %w", c.Address, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanResult{}, fmt.Errorf("clamd scanner: send command: %w", err)
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	var size [4]byte
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			conn.SetDeadline(time.Now().Add(c.Timeout))
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, err := conn.Write(size[:]); err != nil {
+				return ScanResult{}, fmt.Errorf("clamd scanner: send chunk size: %w", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return ScanResult{}, fmt.Errorf("clamd scanner: send chunk: %w", err)
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return ScanResult{}, fmt.Errorf("clamd scanner: read content: %w", readErr)
+		}
+	}
+
+	// A zero length chunk terminates the stream
+	binary.BigEndian.PutUint32(size[:], 0)
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	if _, err := conn.Write(size[:]); err != nil {
+		return ScanResult{}, fmt.Errorf("clamd scanner: terminate stream: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return ScanResult{}, fmt.Errorf("clamd scanner: read reply: %w", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply understands "stream: OK", "stream: <name> FOUND" and "<msg> ERROR".
+func parseClamdReply(reply string) (ScanResult, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	reply = strings.TrimPrefix(reply, "stream:")
+	reply = strings.TrimSpace(reply)
+
+	switch {
+	case reply == "OK":
+		return ScanResult{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return ScanResult{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return ScanResult{}, fmt.Errorf("clamd scanner: unexpected reply %q", reply)
+	}
+}
@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd answers every INSTREAM session with reply once the stream was terminated,
+// and hands the content it received to streams.
+func fakeClamd(t *testing.T, reply string) (*ClamdScanner, chan []byte) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	streams := make(chan []byte, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				command, err := reader.ReadString('\x00')
+				if err != nil || command != "zINSTREAM\x00" {
+					return
+				}
+				var content bytes.Buffer
+				var size [4]byte
+				for {
+					if _, err := io.ReadFull(reader, size[:]); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size[:])
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&content, reader, int64(n)); err != nil {
+						return
+					}
+				}
+				streams <- content.Bytes()
+				if reply != "" {
+					conn.Write([]byte(reply + "\x00"))
+				}
+			}()
+		}
+	}()
+	return &ClamdScanner{Network: "tcp", Address: listener.Addr().String(), Timeout: 5 * time.Second}, streams
+}
+
+func TestClamdScanClean(t *testing.T) {
+	scanner, streams := fakeClamd(t, "stream: OK")
+	// Larger than a chunk, so the content is sent in several
+	content := strings.Repeat("clean content ", clamdChunkSize/7)
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if result.Infected {
+		t.Fatalf("clean content reported infected: %+v", result)
+	}
+	if received := <-streams; string(received) != content {
+		t.Fatalf("clamd received %d bytes, sent %d", len(received), len(content))
+	}
+}
+
+func TestClamdScanFound(t *testing.T) {
+	scanner, _ := fakeClamd(t, "stream: Eicar-Test-Signature FOUND")
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader("X5O!P%@AP"))
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("expected the Eicar signature, got %+v", result)
+	}
+}
+
+func TestClamdScanErrors(t *testing.T) {
+	for name, reply := range map[string]string{
+		"error reply":   "INSTREAM size limit exceeded. ERROR",
+		"closed silent": "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			scanner, _ := fakeClamd(t, reply)
+			_, err := scanner.Scan(context.Background(), strings.NewReader("content"))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	// Nothing listens on a closed listener's address
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	scanner := &ClamdScanner{Network: "tcp", Address: address, Timeout: time.Second}
+	if _, err := scanner.Scan(context.Background(), strings.NewReader("content")); err == nil {
+		t.Fatal("expected a dial error")
+	}
+}
+
+func TestNewClamdScannerAddresses(t *testing.T) {
+	for address, want := range map[string]ClamdScanner{
+		"tcp://127.0.0.1:3310":             {Network: "tcp", Address: "127.0.0.1:3310"},
+		"unix:///var/run/clamav/clamd.ctl": {Network: "unix", Address: "/var/run/clamav/clamd.ctl"},
+	} {
+		scanner, err := NewClamdScanner(address)
+		if err != nil {
+			t.Fatalf("%s: %v", address, err)
+		}
+		clamd := scanner.(*ClamdScanner)
+		if clamd.Network != want.Network || clamd.Address != want.Address {
+			t.Errorf("%s: got %s %s", address, clamd.Network, clamd.Address)
+		}
+	}
+	if _, err := NewClamdScanner("http://127.0.0.1:3310"); err == nil {
+		t.Error("expected an unsupported scheme error")
+	}
+}
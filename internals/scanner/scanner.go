@@ -0,0 +1,28 @@
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// ScanResult is the verdict for a single scanned stream.
+type ScanResult struct {
+	Infected  bool
+	Signature string // Name of the matched signature when infected
+}
+
+// Scanner inspects file content for malware before it is made downloadable.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (ScanResult, error)
+}
+
+// NoopScanner reports every stream as clean, used when no scanner is configured.
+type NoopScanner struct{}
+
+func NewNoopScanner() Scanner {
+	return &NoopScanner{}
+}
+
+func (n *NoopScanner) Scan(ctx context.Context, r io.Reader) (ScanResult, error) {
+	return ScanResult{}, nil
+}
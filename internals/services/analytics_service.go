@@ -0,0 +1,407 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"io"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/models"
+	"large_fss/internals/throttle"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Events are written after the response, when the request may already be cancelled.
+const downloadEventTimeout = 10 * time.Second
+
+// downloadTracker counts what is read from a download and records the event on Close.
+// The handler copies everything it reads to the client, so reaching EOF means the
+// whole content was handed to the connection.
+type downloadTracker struct {
+	io.ReadCloser
+	event         models.DownloadEvent
+	limited       bool      // Holds a reserved download of a transfer with a download limit
+	linkLimited   bool      // Holds a reserved download of a link with a download limit
+	reservationID uuid.UUID // Reservation of both, renewed while data flows like a stream lease
+	transfer      models.Transfer
+	fileIDs       []uuid.UUID // Files contained in the download
+	s             *Service
+	read          atomic.Int64 // Bytes read so far, for the heartbeat
+	cut           atomic.Bool  // Set once the reservation lapsed and no download was left to take it again
+	done          chan struct{}
+	once          sync.Once
+}
+
+func (t *downloadTracker) Read(p []byte) (int, error) {
+	if t.cut.Load() {
+		return 0, customerrors.ErrStreamCut
+	}
+	n, err := t.ReadCloser.Read(p)
+	t.event.BytesSent += int64(n)
+	t.read.Add(int64(n))
+	if errors.Is(err, io.EOF) {
+		t.event.Completed = true
+	}
+	return n, err
+}
+
+func (t *downloadTracker) Close() error {
+	err := t.ReadCloser.Close()
+	t.once.Do(func() {
+		close(t.done)
+		ctx, cancel := context.WithTimeout(context.Background(), downloadEventTimeout)
+		defer cancel()
+		if recordErr := t.s.repo.CreateDownloadEvent(ctx, t.event); recordErr != nil {
+			log.Printf("download tracker: failed to record download of transfer %s: %v", t.event.TransferID, recordErr)
+		}
+		if t.event.Completed {
+			// Before finishDownload, which may delete an exhausted transfer
+			t.s.recordCompletedDownload(ctx, &t.transfer, t.fileIDs)
+		}
+		if t.linkLimited {
+			if releaseErr := t.s.repo.ReleaseLinkDownloadByID(ctx, t.reservationID, t.event.LinkID.UUID, t.event.Completed); releaseErr != nil {
+				log.Printf("download tracker: failed to release download of link %s: %v", t.event.LinkID.UUID, releaseErr)
+			}
+		}
+		if t.limited {
+			t.s.finishDownload(ctx, t.reservationID, t.event.TransferID, t.event.Completed)
+		}
+	})
+	return err
+}
+
+// reserve takes a download of the link and of the transfer when they limit downloads.
+// Reserving again after the reservation lapsed keeps the same ID.
+func (t *downloadTracker) reserve(ctx context.Context) error {
+	expiresAt := time.Now().Add(t.s.cfg.Streams.LeaseTTL())
+	if t.linkLimited {
+		err := t.s.repo.ReserveLinkDownloadByID(ctx, t.reservationID, t.event.LinkID.UUID, expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+	if t.limited {
+		return t.s.repo.ReserveTransferDownloadByID(ctx, t.reservationID, t.event.TransferID, expiresAt)
+	}
+	return nil
+}
+
+// heartbeat renews the reservation a few times per TTL as long as the download made
+// progress, so the reservations of stalled or lost downloads lapse and are purged.
+func (t *downloadTracker) heartbeat() {
+	ttl := t.s.cfg.Streams.LeaseTTL()
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	var renewedAt int64
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+		read := t.read.Load()
+		if read == renewedAt {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), streamLeaseTimeout)
+		err := t.s.repo.RenewDownloadReservation(ctx, t.reservationID, time.Now().Add(ttl))
+		if errors.Is(err, sql.ErrNoRows) {
+			// The reservation lapsed during a stall and was purged, its download may
+			// have gone to someone else meanwhile
+			err = t.reserve(ctx)
+			if err != nil {
+				cancel()
+				log.Printf("download tracker: cutting download of reservation %s: %v", t.reservationID, err)
+				t.cut.Store(true)
+				return
+			}
+		}
+		cancel()
+		if err != nil {
+			log.Printf("download tracker: failed to renew download reservation %s: %v", t.reservationID, err)
+			continue
+		}
+		renewedAt = read
+	}
+}
+
+// trackDownload records a download event of the reader's content, the files in fileIDs, once it is closed.
+// When the link or the transfer limits downloads it also reserves one of the remaining
+// downloads of each, closing the reader when none is left.
+func (s *Service) trackDownload(c *gin.Context, reader io.ReadCloser, link *models.Link, transferData *models.Transfer, fileID uuid.NullUUID, fileIDs []uuid.UUID, kind string) (io.ReadCloser, error) {
+	reader, err := s.throttleDownload(c, reader, link, transferData)
+	if err != nil {
+		return nil, err
+	}
+	tracker := &downloadTracker{
+		ReadCloser:    reader,
+		s:             s,
+		transfer:      *transferData,
+		fileIDs:       fileIDs,
+		reservationID: uuid.New(),
+		limited:       transferData.MaxDownloads != nil,
+		linkLimited:   link.MaxDownloads != nil,
+		done:          make(chan struct{}),
+		event: models.DownloadEvent{
+			TransferID:  transferData.ID,
+			FileID:      fileID,
+			LinkID:      uuid.NullUUID{UUID: link.ID, Valid: true},
+			RecipientID: recipientOf(c),
+			Kind:        kind,
+			ClientIP:    c.ClientIP(),
+			UserAgent:   c.Request.UserAgent(),
+		},
+	}
+	if !tracker.limited && !tracker.linkLimited {
+		return tracker, nil
+	}
+	err = tracker.reserve(c)
+	if err != nil {
+		reader.Close()
+		if tracker.linkLimited {
+			// Released without counting, whether or not it was taken
+			if releaseErr := s.repo.ReleaseLinkDownloadByID(c, tracker.reservationID, link.ID, false); releaseErr != nil {
+				log.Printf("download tracker: failed to release download of link %s: %v", link.ID, releaseErr)
+			}
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, customerrors.ErrDownloadLimitReached
+		}
+		return nil, err
+	}
+	go tracker.heartbeat()
+	return tracker, nil
+}
+
+// throttleDownload admits a download under the concurrent download cap and limits it to
+// the global bandwidth, the bandwidth of the owner's plan and that of the link. The plan's
+// bandwidth is shared by all downloads of the owner's transfers, whoever downloads them.
+// The reader is closed when the download is turned away.
+func (s *Service) throttleDownload(c *gin.Context, reader io.ReadCloser, link *models.Link, transferData *models.Transfer) (io.ReadCloser, error) {
+	owner, err := s.repo.FindUserById(c, transferData.OwnerID)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	limits := []throttle.Limit{{
+		Key:            "owner:" + owner.ID.String(),
+		BytesPerSecond: s.cfg.Bandwidth.RateForPlan(owner.Plan),
+	}}
+	if link.BytesPerSecond != nil {
+		limits = append(limits, throttle.Limit{Key: "link:" + link.ID.String(), BytesPerSecond: *link.BytesPerSecond})
+	}
+	throttled, err := s.bandwidth.Start(c.Request.Context(), reader, limits...)
+	if err != nil {
+		reader.Close()
+		if errors.Is(err, throttle.ErrBusy) {
+			return nil, &customerrors.ServerBusyError{RetryAfter: time.Duration(s.cfg.Bandwidth.RetryAfterSeconds) * time.Second}
+		}
+		return nil, err
+	}
+	return throttled, nil
+}
+
+// finishDownload releases a reserved download, counting it when it completed.
+// The transfer goes to the trash once its last allowed download finished.
+func (s *Service) finishDownload(ctx context.Context, reservationID uuid.UUID, transferID uuid.UUID, completed bool) {
+	transferData, err := s.repo.ReleaseTransferDownloadByID(ctx, reservationID, transferID, completed)
+	if err != nil {
+		log.Printf("download tracker: failed to release download of transfer %s: %v", transferID, err)
+		return
+	}
+	if transferData.MaxDownloads == nil || transferData.DownloadCount < *transferData.MaxDownloads {
+		return
+	}
+	// Downloads still running finish this one, or the cleanup cron once their reservations lapse
+	active, err := s.repo.CountActiveDownloadsByTransferID(ctx, transferID)
+	if err != nil {
+		log.Printf("download tracker: failed to count downloads of transfer %s: %v", transferID, err)
+		return
+	}
+	if active > 0 {
+		return
+	}
+	if _, err := s.trashTransfer(ctx, transferID); err != nil && !errors.Is(err, customerrors.ErrExpiredLink) {
+		log.Printf("download tracker: failed to trash exhausted transfer %s: %v", transferID, err)
+	}
+}
+
+// DownloadStatsService sums up the downloads of a transfer the user owns, per file and in total.
+func (s *Service) DownloadStatsService(c context.Context, transferID uuid.UUID, userID uuid.UUID) (*dto.DownloadStatsDTO, error) {
+	_, err := s.ownedTransfer(c, transferID, userID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.FindDownloadStatsByTransferID(c, transferID)
+	if err != nil {
+		return nil, err
+	}
+	fileNames, err := s.fileNamesOf(c, transferID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dto.DownloadStatsDTO{TransferID: transferID, Files: []dto.FileDownloadStatsDTO{}}
+	for _, stat := range stats {
+		result.Downloads += stat.Downloads
+		result.Completed += stat.Completed
+		result.BytesSent += stat.BytesSent
+		if stat.LastDownloadAt != nil && (result.LastDownloadAt == nil || stat.LastDownloadAt.After(*result.LastDownloadAt)) {
+			result.LastDownloadAt = stat.LastDownloadAt
+		}
+		if !stat.FileID.Valid {
+			result.Archives += stat.Downloads
+			continue
+		}
+		result.Files = append(result.Files, dto.FileDownloadStatsDTO{
+			FileID:         stat.FileID.UUID,
+			FileName:       fileNames[stat.FileID.UUID],
+			Downloads:      stat.Downloads,
+			Completed:      stat.Completed,
+			BytesSent:      stat.BytesSent,
+			LastDownloadAt: stat.LastDownloadAt,
+		})
+	}
+	result.Aborted = result.Downloads - result.Completed
+	return result, nil
+}
+
+// DownloadEventsService returns the download log of a transfer the user owns, newest first.
+// A limit of 0 returns every event.
+func (s *Service) DownloadEventsService(c context.Context, transferID uuid.UUID, userID uuid.UUID, limit int, offset int) ([]dto.DownloadEventDTO, error) {
+	_, err := s.ownedTransfer(c, transferID, userID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.repo.FindDownloadEventsByTransferID(c, transferID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	fileNames, err := s.fileNamesOf(c, transferID)
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.repo.FindAllLinksByTransferID(c, transferID)
+	if err != nil {
+		return nil, err
+	}
+	// Revoked links lose their label like deleted files lose their name
+	linkLabels := make(map[uuid.UUID]string, len(links))
+	for _, link := range links {
+		linkLabels[link.ID] = link.Label
+	}
+
+	recipients, err := s.repo.FindRecipientStatusesByTransferID(c, transferID)
+	if err != nil {
+		return nil, err
+	}
+	recipientEmails := make(map[uuid.UUID]string, len(recipients))
+	for _, recipient := range recipients {
+		recipientEmails[recipient.ID] = recipient.Email
+	}
+
+	eventDTOs := make([]dto.DownloadEventDTO, 0, len(events))
+	for _, event := range events {
+		eventDTO := dto.DownloadEventDTO{
+			ID:        event.ID,
+			Kind:      event.Kind,
+			BytesSent: event.BytesSent,
+			Completed: event.Completed,
+			ClientIP:  event.ClientIP,
+			UserAgent: event.UserAgent,
+			CreatedAt: event.CreatedAt,
+		}
+		if event.FileID.Valid {
+			fileID := event.FileID.UUID
+			eventDTO.FileID = &fileID
+			eventDTO.FileName = fileNames[fileID]
+		}
+		if event.LinkID.Valid {
+			linkID := event.LinkID.UUID
+			eventDTO.LinkID = &linkID
+			eventDTO.LinkLabel = linkLabels[linkID]
+		}
+		if event.RecipientID.Valid {
+			eventDTO.RecipientEmail = recipientEmails[event.RecipientID.UUID]
+		}
+		eventDTOs = append(eventDTOs, eventDTO)
+	}
+	return eventDTOs, nil
+}
+
+// ExportDownloadEventsService returns the whole download log of a transfer as CSV.
+func (s *Service) ExportDownloadEventsService(c context.Context, transferID uuid.UUID, userID uuid.UUID) ([]byte, error) {
+	events, err := s.DownloadEventsService(c, transferID, userID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	csvWriter := csv.NewWriter(&buf)
+	err = csvWriter.Write([]string{"timestamp", "kind", "file_id", "file_name", "link_id", "link_label", "recipient_email", "bytes_sent", "completed", "client_ip", "user_agent"})
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		fileID := ""
+		if event.FileID != nil {
+			fileID = event.FileID.String()
+		}
+		linkID := ""
+		if event.LinkID != nil {
+			linkID = event.LinkID.String()
+		}
+		err = csvWriter.Write([]string{
+			event.CreatedAt.UTC().Format(time.RFC3339),
+			event.Kind,
+			fileID,
+			csvSafe(event.FileName),
+			linkID,
+			csvSafe(event.LinkLabel),
+			csvSafe(event.RecipientEmail),
+			strconv.FormatInt(event.BytesSent, 10),
+			strconv.FormatBool(event.Completed),
+			event.ClientIP,
+			csvSafe(event.UserAgent),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// csvSafe keeps spreadsheets from evaluating client controlled text as a formula.
+func csvSafe(value string) string {
+	if value != "" && (value[0] == '=' || value[0] == '+' || value[0] == '-' || value[0] == '@' || value[0] == '\t' || value[0] == '\r') {
+		return "'" + value
+	}
+	return value
+}
+
+// fileNamesOf maps the file ids of a transfer to their names. Events of deleted
+// files keep their id but lose the name.
+func (s *Service) fileNamesOf(c context.Context, transferID uuid.UUID) (map[uuid.UUID]string, error) {
+	filesData, err := s.repo.FindAllFilesByTransferID(c, transferID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uuid.UUID]string, len(filesData))
+	for _, file := range filesData {
+		names[file.ID] = file.FileName
+	}
+	return names, nil
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"large_fss/internals/archive"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/models"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// archiveCacheVersion is part of every cache key, bumping it orphans archives built
+// by an older writer so they are evicted instead of served.
+const archiveCacheVersion = "archive-cache-v2"
+
+var errArchiveCacheBudget = errors.New("archive cache: archive exceeds the remaining quota of the owner")
+
+// archiveCacheKey identifies the archive of a transfer in a format by its content, any
+// added, removed or changed file gives a different key.
+func archiveCacheKey(transferID uuid.UUID, format archive.Format, entries []archive.Entry) string {
+	hash := sha256.New()
+	io.WriteString(hash, archiveCacheVersion+"\x00"+transferID.String()+"\x00"+string(format)+"\x00")
+	var field [8]byte
+	for _, entry := range entries {
+		io.WriteString(hash, entry.Name+"\x00")
+		binary.BigEndian.PutUint64(field[:], uint64(entry.Size))
+		hash.Write(field[:])
+		binary.BigEndian.PutUint64(field[:], uint64(entry.CRC32))
+		hash.Write(field[:])
+		binary.BigEndian.PutUint64(field[:], uint64(entry.Modified.Unix()))
+		hash.Write(field[:])
+		if entry.NoCRC32 {
+			hash.Write([]byte{1})
+		} else {
+			hash.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// archiveCachePath is where the archive with the given key is stored.
+func archiveCachePath(transferID uuid.UUID, key string, format archive.Format) string {
+	return filepath.Join(constants.ArchiveCacheDir, transferID.String(), key+archive.Extension(format))
+}
+
+// openCachedArchive opens the cached archive of a transfer when there is one for its
+// current content. The files of the transfer count as being downloaded while it is read.
+func (s *Service) openCachedArchive(c *gin.Context, key string, filesData []models.File) (io.ReadCloser, int64, bool) {
+	if s.cfg.ArchiveCache.MaxBytes <= 0 {
+		return nil, 0, false
+	}
+	entry, err := s.repo.FindArchiveCacheEntry(c, key)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("archive cache: failed to look up %s: %v", key, err)
+		}
+		return nil, 0, false
+	}
+	reader, err := s.filestorage.ReadFile(c, entry.Path)
+	if err != nil {
+		// The archive is gone from storage, forget it and rebuild
+		log.Printf("archive cache: failed to open %s: %v", entry.Path, err)
+		err = s.repo.DeleteArchiveCacheEntry(c, key)
+		if err != nil {
+			log.Printf("archive cache: failed to delete entry %s: %v", key, err)
+		}
+		return nil, 0, false
+	}
+	wrappedReader, err := s.leaseStreams(c, reader, fileIDsOf(filesData)...)
+	if err != nil {
+		log.Printf("archive cache: failed to lease streams for %s: %v", key, err)
+		return nil, 0, false
+	}
+	err = s.repo.TouchArchiveCacheEntry(c, key)
+	if err != nil {
+		log.Printf("archive cache: failed to touch entry %s: %v", key, err)
+	}
+	return wrappedReader, entry.Size, true
+}
+
+// cacheWhileStreaming tees a freshly streamed archive of a transfer into the cache, so the
+// first download builds it for the ones after. Only one download of a key writes it at a
+// time, the others just stream. It only uses the part of the owner's quota left free by
+// their transfers and cached archives.
+func (s *Service) cacheWhileStreaming(transferData *models.Transfer, format archive.Format, key string, reader io.ReadCloser, size int64) io.ReadCloser {
+	if s.cfg.ArchiveCache.MaxBytes <= 0 {
+		return reader
+	}
+	if _, busy := s.archiveBuilds.LoadOrStore(key, struct{}{}); busy {
+		return reader
+	}
+	ctx := context.Background()
+	tee, err := s.openArchiveCacheTee(ctx, transferData, format, key, reader, size)
+	if err != nil {
+		if !errors.Is(err, errArchiveCacheBudget) {
+			log.Printf("archive cache: failed to start caching archive of transfer %s: %v", transferData.ID, err)
+		}
+		s.archiveBuilds.Delete(key)
+		return reader
+	}
+	return tee
+}
+
+func (s *Service) openArchiveCacheTee(ctx context.Context, transferData *models.Transfer, format archive.Format, key string, reader io.ReadCloser, size int64) (*archiveCacheTee, error) {
+	owner, err := s.repo.FindUserById(ctx, transferData.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := s.repo.SumStoredSizeByOwnerID(ctx, transferData.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	budget := s.cfg.QuotaForPlan(owner.Plan) - used
+	if budget <= 0 || size > budget {
+		return nil, errArchiveCacheBudget
+	}
+
+	folderPath := filepath.Join(constants.ArchiveCacheDir, transferData.ID.String())
+	err = s.filestorage.CreateFolder(ctx, folderPath)
+	if err != nil {
+		return nil, err
+	}
+	finalPath := archiveCachePath(transferData.ID, key, format)
+	partialPath := finalPath + ".partial"
+	fileWriter, err := s.filestorage.WriteFile(ctx, partialPath)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveCacheTee{
+		ReadCloser: reader,
+		file:       fileWriter,
+		budget:     budget,
+		finish: func(written int64, complete bool) {
+			defer s.archiveBuilds.Delete(key)
+			entry := models.ArchiveCacheEntry{
+				Key:        key,
+				TransferID: transferData.ID,
+				Format:     string(format),
+				Path:       finalPath,
+				Size:       written,
+			}
+			err := s.keepCachedArchive(ctx, partialPath, entry, complete)
+			if err != nil {
+				log.Printf("archive cache: failed to cache archive of transfer %s: %v", transferData.ID, err)
+				return
+			}
+			err = s.evictArchiveCache(ctx)
+			if err != nil {
+				log.Printf("archive cache: failed to evict archives: %v", err)
+			}
+		},
+	}, nil
+}
+
+// keepCachedArchive moves a fully written archive in place and records it. Partial ones
+// are deleted.
+func (s *Service) keepCachedArchive(ctx context.Context, partialPath string, entry models.ArchiveCacheEntry, complete bool) error {
+	discard := func() {
+		err := s.filestorage.DeleteFile(ctx, partialPath)
+		if err != nil {
+			log.Printf("archive cache: failed to delete %s: %v", partialPath, err)
+		}
+	}
+	if !complete {
+		discard()
+		return nil
+	}
+	err := s.filestorage.Rename(ctx, partialPath, entry.Path)
+	if err != nil {
+		discard()
+		return err
+	}
+	err = s.repo.CreateArchiveCacheEntry(ctx, entry)
+	if err != nil {
+		// Without its row nothing would ever serve or evict the archive
+		if deleteErr := s.filestorage.DeleteFile(ctx, entry.Path); deleteErr != nil {
+			log.Printf("archive cache: failed to delete %s: %v", entry.Path, deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// archiveCacheTee writes what a download reads into the cache file. The archive is only
+// kept when the download read it to the end within the budget, finish runs once closed.
+type archiveCacheTee struct {
+	io.ReadCloser
+	file    io.WriteCloser
+	budget  int64
+	written int64
+	failed  bool
+	ended   bool
+	once    sync.Once
+	finish  func(written int64, complete bool)
+}
+
+func (t *archiveCacheTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 && !t.failed {
+		t.written += int64(n)
+		if t.written > t.budget {
+			t.failed = true
+		} else if _, writeErr := t.file.Write(p[:n]); writeErr != nil {
+			log.Printf("archive cache: failed to write archive: %v", writeErr)
+			t.failed = true
+		}
+	}
+	if err == io.EOF {
+		t.ended = true
+	}
+	return n, err
+}
+
+func (t *archiveCacheTee) Close() error {
+	err := t.ReadCloser.Close()
+	t.once.Do(func() {
+		closeErr := t.file.Close()
+		complete := t.ended && !t.failed && closeErr == nil
+		// Storing the archive must not hold up the response
+		go t.finish(t.written, complete)
+	})
+	return err
+}
+
+// evictArchiveCache deletes the least recently used archives until the cache fits its
+// size limit. Archives of transfers that are being downloaded are kept for now.
+func (s *Service) evictArchiveCache(ctx context.Context) error {
+	total, err := s.repo.SumArchiveCacheSize(ctx)
+	if err != nil {
+		return err
+	}
+	if total <= s.cfg.ArchiveCache.MaxBytes {
+		return nil
+	}
+	entries, err := s.repo.FindAllArchiveCacheEntries(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if total <= s.cfg.ArchiveCache.MaxBytes {
+			break
+		}
+		err := s.checkNoActiveStreams(ctx, entry.TransferID)
+		if errors.Is(err, customerrors.ErrActiveStreams) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = s.repo.DeleteArchiveCacheEntry(ctx, entry.Key)
+		if err != nil {
+			return err
+		}
+		err = s.filestorage.DeleteFile(ctx, entry.Path)
+		if err != nil {
+			log.Printf("archive cache: failed to delete %s: %v", entry.Path, err)
+		}
+		total -= entry.Size
+	}
+	return nil
+}
+
+// invalidateArchiveCache drops the cached archives of a transfer whose files changed.
+func (s *Service) invalidateArchiveCache(ctx context.Context, transferID uuid.UUID) error {
+	entries, err := s.repo.DeleteArchiveCacheEntriesByTransferID(ctx, transferID)
+	if err != nil {
+		return err
+	}
+	// Leftover files are removed with the transfer folder
+	for _, entry := range entries {
+		err := s.filestorage.DeleteFile(ctx, entry.Path)
+		if err != nil {
+			log.Printf("archive cache: failed to delete %s: %v", entry.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"io"
+	"large_fss/internals/archive"
+	"large_fss/internals/config"
+	"large_fss/internals/models"
+	"large_fss/internals/repository"
+	"large_fss/internals/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cacheRepo records the archive cache entries created, with the owner storing used bytes.
+type cacheRepo struct {
+	repository.DbRepository
+	owner   models.User
+	used    int64
+	entries chan models.ArchiveCacheEntry
+}
+
+func (r *cacheRepo) FindUserById(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	owner := r.owner
+	return &owner, nil
+}
+
+func (r *cacheRepo) SumStoredSizeByOwnerID(ctx context.Context, ownerID uuid.UUID) (int64, error) {
+	return r.used, nil
+}
+
+func (r *cacheRepo) CreateArchiveCacheEntry(ctx context.Context, entry models.ArchiveCacheEntry) error {
+	r.entries <- entry
+	return nil
+}
+
+func (r *cacheRepo) SumArchiveCacheSize(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+const testCacheQuota = 1024
+
+func newCacheService(t *testing.T, used int64) (*Service, *cacheRepo, string) {
+	t.Helper()
+	repo := &cacheRepo{owner: models.User{ID: uuid.New(), Plan: "free"}, used: used, entries: make(chan models.ArchiveCacheEntry, 1)}
+	cfg := config.DefaultConfig()
+	cfg.PlanQuotas[repo.owner.Plan] = testCacheQuota
+	dir := t.TempDir()
+	return &Service{repo: repo, filestorage: storage.NewLocalStorage(dir), cfg: cfg}, repo, dir
+}
+
+// waitForArchiveBuild waits until the build of key finished, kept or not.
+func waitForArchiveBuild(t *testing.T, s *Service, key string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, busy := s.archiveBuilds.Load(key); !busy {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the archive build never finished")
+}
+
+func TestCacheWhileStreamingKeepsTheFirstFullStream(t *testing.T) {
+	s, repo, dir := newCacheService(t, 0)
+	transferData := &models.Transfer{ID: uuid.New(), OwnerID: repo.owner.ID}
+	content := strings.Repeat("archive ", 64)
+
+	first := s.cacheWhileStreaming(transferData, archive.FormatZip, "key", io.NopCloser(strings.NewReader(content)), int64(len(content)))
+	plain := io.NopCloser(strings.NewReader(content))
+	// A concurrent download of the same archive streams without writing it again
+	if second := s.cacheWhileStreaming(transferData, archive.FormatZip, "key", plain, int64(len(content))); second != plain {
+		t.Fatal("a second download of the key should not write the cache")
+	}
+
+	read, err := io.ReadAll(first)
+	if err != nil || string(read) != content {
+		t.Fatalf("the download got %d bytes: %v", len(read), err)
+	}
+	first.Close()
+
+	select {
+	case entry := <-repo.entries:
+		if entry.Size != int64(len(content)) {
+			t.Fatalf("expected %d cached bytes, got %d", len(content), entry.Size)
+		}
+		cached, err := os.ReadFile(filepath.Join(dir, entry.Path))
+		if err != nil || string(cached) != content {
+			t.Fatalf("the cached archive differs from the download: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the archive was not cached")
+	}
+	// The next miss of the key may cache again
+	waitForArchiveBuild(t, s, "key")
+}
+
+func TestCacheWhileStreamingDropsAbortedStreams(t *testing.T) {
+	s, repo, _ := newCacheService(t, 0)
+	transferData := &models.Transfer{ID: uuid.New(), OwnerID: repo.owner.ID}
+	content := strings.Repeat("archive ", 64)
+
+	reader := s.cacheWhileStreaming(transferData, archive.FormatZip, "key", io.NopCloser(strings.NewReader(content)), int64(len(content)))
+	reader.Read(make([]byte, 16))
+	reader.Close()
+
+	waitForArchiveBuild(t, s, "key")
+	select {
+	case entry := <-repo.entries:
+		t.Fatalf("a partial archive was cached: %+v", entry)
+	default:
+	}
+}
+
+func TestCacheWhileStreamingCountsTheOwnersStorage(t *testing.T) {
+	content := strings.Repeat("x", 100)
+
+	// What the owner already stores leaves no room for the archive
+	s, repo, _ := newCacheService(t, testCacheQuota-50)
+	transferData := &models.Transfer{ID: uuid.New(), OwnerID: repo.owner.ID}
+	plain := io.NopCloser(strings.NewReader(content))
+	if reader := s.cacheWhileStreaming(transferData, archive.FormatZip, "key", plain, int64(len(content))); reader != plain {
+		t.Fatal("an archive over the owner's remaining quota should not be cached")
+	}
+
+	// Archives of unknown size are dropped once they outgrow the budget
+	s, repo, _ = newCacheService(t, testCacheQuota-50)
+	reader := s.cacheWhileStreaming(transferData, archive.FormatTarGzip, "key", io.NopCloser(strings.NewReader(content)), -1)
+	if read, _ := io.ReadAll(reader); len(read) != len(content) {
+		t.Fatal("the download must be served in full past the cache budget")
+	}
+	reader.Close()
+	waitForArchiveBuild(t, s, "key")
+	select {
+	case entry := <-repo.entries:
+		t.Fatalf("an archive over budget was cached: %+v", entry)
+	default:
+	}
+}
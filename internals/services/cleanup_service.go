@@ -12,6 +12,22 @@ import (
 func (s *Service) CleanupService() {
 	c := cron.New()
 
+	// Imports only run in the server that started them
+	if err := s.FailInterruptedImportsService(); err != nil {
+		log.Printf("cleanup service: error failing interrupted imports: %v", err)
+	}
+	// Transfers stored before scanning existed start out pending and can't be downloaded
+	// until scanned, so they are queued right away rather than on the first retry
+	go func() {
+		if err := s.ScanPendingTransfersService(); err != nil {
+			log.Printf("cleanup service: error scanning pending transfers: %v", err)
+		}
+		// Transfers stored before checksums were taken at assembly
+		if err := s.IndexStoredObjectsService(); err != nil {
+			log.Printf("cleanup service: error indexing stored objects: %v", err)
+		}
+	}()
+
 	// Run CleanFailedUploadsService every hour
 	_, err := c.AddFunc("@every 1h", func() {
 		if err := s.CleanFailedUploadsService(); err != nil {
@@ -32,6 +48,42 @@ func (s *Service) CleanupService() {
 		log.Fatalf("cron: failed to schedule CleanExpiredTransfersService: %v", err)
 	}
 
+	// Run PurgeTrashService every hour
+	_, err = c.AddFunc("@every 1h", func() {
+		if err := s.PurgeTrashService(); err != nil {
+			log.Printf("cron: error purging trash: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("cron: failed to schedule PurgeTrashService: %v", err)
+	}
+
+	// Leases of crashed or stalled downloads no longer count, purging them keeps the table small
+	_, err = c.AddFunc("@every 10m", func() {
+		if err := s.CleanStreamLeasesService(); err != nil {
+			log.Printf("cron: error cleaning stream leases: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("cron: failed to schedule CleanStreamLeasesService: %v", err)
+	}
+
+	// Retry malware scans that were interrupted or failed
+	_, err = c.AddFunc("@every 10m", func() {
+		if err := s.ScanPendingTransfersService(); err != nil {
+			log.Printf("cron: error scanning pending transfers: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("cron: failed to schedule ScanPendingTransfersService: %v", err)
+	}
+
+	// Forget the status of url imports that finished a while ago
+	_, err = c.AddFunc("@every 1h", s.PruneImportProgressService)
+	if err != nil {
+		log.Fatalf("cron: failed to schedule PruneImportProgressService: %v", err)
+	}
+
 	// Start the cron scheduler in the background
 	c.Start()
 
@@ -52,12 +104,12 @@ func (s *Service) CleanFailedUploadsService() error {
 		transPath := filepath.Join(constants.ChunkDir, ftrans.ID.String())
 		err := s.filestorage.DeleteAll(ctx, transPath)
 		if err != nil {
-			log.Printf("cleanfailed upload service: error in deleting fs of %s: %w", ftrans.ID, err)
+			log.Printf("cleanfailed upload service: error in deleting fs of %s: %v", ftrans.ID, err)
 			continue
 		}
 		err = s.repo.DeleteTempTransferByID(ctx, ftrans.ID)
 		if err != nil {
-			log.Printf("cleanfailed upload service: error in deleting db of %s: %w", ftrans.ID, err)
+			log.Printf("cleanfailed upload service: error in deleting db of %s: %v", ftrans.ID, err)
 
 		}
 
@@ -65,6 +117,8 @@ func (s *Service) CleanFailedUploadsService() error {
 	return nil
 
 }
+// CleanExpiredTransfersService moves expired transfers and those that used up their
+// downloads to the trash, where their owners may restore them until they are purged.
 func (s *Service) CleanExpiredTransfersService() error {
 
 	ctx := context.Background()
@@ -74,27 +128,32 @@ func (s *Service) CleanExpiredTransfersService() error {
 		return err
 	}
 	for _, exptrans := range expiredtransfers {
-		filelst, err := s.repo.FindAllFilesByTransferID(ctx, exptrans.ID)
-		shouldSkip:=false
-		for _, file := range filelst {
-			if file.NumOfActiveStream > 0 {
-				shouldSkip=true
-				break
-			}
-		}
-		if(shouldSkip){
-			continue
-		}
-		err = s.filestorage.DeleteAll(ctx, exptrans.TransferPath)
+		_, err := s.trashTransfer(ctx, exptrans.ID)
 		if err != nil {
-			log.Printf("clean expired transfers service: error in deleting fs of %s: %w", exptrans.ID, err)
+			log.Printf("clean expired transfers service: error in trashing %s: %v", exptrans.ID, err)
 			continue
 		}
-		err = s.repo.DeleteTransferByID(ctx, exptrans.ID)
-		if err != nil {
-			log.Printf("clean expired transfers service: error in deleting db of %s: %w", exptrans.ID, err)
+		s.notifyExpiredUnused(&exptrans)
+	}
+	return nil
+}
 
-		}
+// CleanStreamLeasesService purges the stream leases and download reservations of
+// downloads that stopped renewing them.
+func (s *Service) CleanStreamLeasesService() error {
+	deleted, err := s.repo.DeleteExpiredStreamLeases(context.Background())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("clean stream leases service: purged %d expired leases", deleted)
+	}
+	deleted, err = s.repo.DeleteExpiredDownloadReservations(context.Background())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("clean stream leases service: purged %d expired download reservations", deleted)
 	}
 	return nil
 }
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/expiry"
+	"large_fss/internals/models"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// transferExpiry resolves the expiry a user picked for a transfer and checks it against
+// the bounds of their plan. Nil means it never expires, which only some roles may pick.
+func (s *Service) transferExpiry(c context.Context, ownerID uuid.UUID, value string) (*time.Time, error) {
+	owner, err := s.repo.FindUserById(c, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.expiryForUser(owner, value)
+}
+
+func (s *Service) expiryForUser(owner *models.User, value string) (*time.Time, error) {
+	policy := s.cfg.Expiry
+	now := time.Now().UTC()
+	expiresAt, err := expiry.Resolve(value, policy.PresetDurations(), now)
+	if err != nil {
+		if errors.Is(err, expiry.ErrPast) {
+			return nil, customerrors.ErrExpiryNotAllowed
+		}
+		return nil, customerrors.ErrInvalidInput
+	}
+	if expiresAt == nil {
+		if !policy.AllowsNever(owner.Role) {
+			return nil, customerrors.ErrExpiryNotAllowed
+		}
+		return nil, nil
+	}
+	bounds := policy.BoundsForPlan(owner.Plan)
+	until := expiresAt.Sub(now)
+	if until < time.Duration(bounds.MinSeconds)*time.Second {
+		return nil, customerrors.ErrExpiryNotAllowed
+	}
+	if bounds.MaxSeconds > 0 && until > time.Duration(bounds.MaxSeconds)*time.Second {
+		return nil, customerrors.ErrExpiryNotAllowed
+	}
+	return expiresAt, nil
+}
+
+// assembledExpiry resolves the expiry picked for an upload again once it is assembled, so
+// durations count from then. The upload is never lost over its expiry: a pick that is no
+// longer allowed is clamped to the owner's current bounds, and one that can't be resolved
+// anymore, like a removed preset, keeps the expiry computed when the upload started.
+func (s *Service) assembledExpiry(c context.Context, tempTransfer *models.TempTransfer) (*time.Time, error) {
+	owner, err := s.repo.FindUserById(c, tempTransfer.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	expiresAt := tempTransfer.Expiry
+	if tempTransfer.ExpiryValue != "" {
+		resolved, err := expiry.Resolve(tempTransfer.ExpiryValue, s.cfg.Expiry.PresetDurations(), now)
+		switch {
+		case err == nil:
+			expiresAt = resolved
+		case errors.Is(err, expiry.ErrPast):
+			expiresAt = &now
+		}
+	}
+	return s.clampExpiry(owner, expiresAt, now), nil
+}
+
+// clampExpiry moves an expiry into the bounds of the owner's plan. Transfers that never
+// expire get the longest expiry instead when the owner's role may no longer pick that.
+func (s *Service) clampExpiry(owner *models.User, expiresAt *time.Time, now time.Time) *time.Time {
+	bounds := s.cfg.Expiry.BoundsForPlan(owner.Plan)
+	if expiresAt == nil {
+		if s.cfg.Expiry.AllowsNever(owner.Role) {
+			return nil
+		}
+		longest := bounds.MaxSeconds
+		if longest == 0 {
+			longest = constants.DefaultMaxExpirySeconds
+		}
+		clamped := now.Add(time.Duration(longest) * time.Second)
+		return &clamped
+	}
+	if earliest := now.Add(time.Duration(bounds.MinSeconds) * time.Second); expiresAt.Before(earliest) {
+		return &earliest
+	}
+	if latest := now.Add(time.Duration(bounds.MaxSeconds) * time.Second); bounds.MaxSeconds > 0 && expiresAt.After(latest) {
+		return &latest
+	}
+	return expiresAt
+}
+
+// ExpiryPolicyService returns the expiries the user may pick, presets outside their
+// bounds left out.
+func (s *Service) ExpiryPolicyService(c context.Context, userID uuid.UUID) (*dto.ExpiryPolicyDTO, error) {
+	owner, err := s.repo.FindUserById(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	bounds := s.cfg.Expiry.BoundsForPlan(owner.Plan)
+	policy := dto.ExpiryPolicyDTO{
+		Presets:      []dto.ExpiryPresetDTO{},
+		MinSeconds:   bounds.MinSeconds,
+		MaxSeconds:   bounds.MaxSeconds,
+		NeverAllowed: s.cfg.Expiry.AllowsNever(owner.Role),
+	}
+	now := time.Now().UTC()
+	for name, duration := range s.cfg.Expiry.PresetDurations() {
+		if _, err := s.expiryForUser(owner, name); err != nil {
+			continue
+		}
+		expiresAt, err := expiry.AddDuration(now, duration)
+		if err != nil {
+			continue
+		}
+		policy.Presets = append(policy.Presets, dto.ExpiryPresetDTO{
+			Name:     name,
+			Duration: duration,
+			Seconds:  int64(expiresAt.Sub(now).Seconds()),
+		})
+	}
+	sort.Slice(policy.Presets, func(i, j int) bool {
+		return policy.Presets[i].Seconds < policy.Presets[j].Seconds
+	})
+	return &policy, nil
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"large_fss/internals/constants"
+	"large_fss/internals/models"
+	"testing"
+	"time"
+)
+
+func TestAssembledExpiryCountsFromAssembly(t *testing.T) {
+	repo := newImportRepo("free")
+	s := newImportService(t, repo)
+	// Computed when a long upload started
+	started := time.Now().Add(-20 * time.Hour)
+	startExpiry := started.Add(24 * time.Hour)
+
+	expiresAt, err := s.assembledExpiry(context.Background(), &models.TempTransfer{OwnerID: repo.owner.ID, Expiry: &startExpiry, ExpiryValue: "P1D"})
+	if err != nil {
+		t.Fatalf("assembled expiry: %v", err)
+	}
+	if until := time.Until(*expiresAt); until < 23*time.Hour || until > 24*time.Hour {
+		t.Fatalf("expected a day from now, the transfer expires in %s", until)
+	}
+}
+
+func TestAssembledExpiryClampsInsteadOfFailing(t *testing.T) {
+	repo := newImportRepo("free")
+	s := newImportService(t, repo)
+	minimum := time.Duration(s.cfg.Expiry.MinSeconds) * time.Second
+	maximum := time.Duration(s.cfg.Expiry.MaxSeconds) * time.Second
+	started := time.Now().Add(-time.Hour)
+
+	for name, session := range map[string]models.TempTransfer{
+		// A timestamp that passed, or got too close, during the upload
+		"passed timestamp": {ExpiryValue: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)},
+		"close timestamp":  {ExpiryValue: time.Now().Add(time.Minute).UTC().Format(time.RFC3339)},
+		// Sessions started before the pick was kept only have the computed expiry
+		"passed legacy": {Expiry: &started},
+	} {
+		session.OwnerID = repo.owner.ID
+		expiresAt, err := s.assembledExpiry(context.Background(), &session)
+		if err != nil {
+			t.Fatalf("%s: the upload must be assembled, got %v", name, err)
+		}
+		if until := time.Until(*expiresAt); until < minimum-time.Minute || until > minimum {
+			t.Errorf("%s: expected the shortest expiry allowed, expires in %s", name, until)
+		}
+	}
+
+	// The plan's bounds shrank during the upload
+	far := time.Now().Add(2 * maximum)
+	expiresAt, err := s.assembledExpiry(context.Background(), &models.TempTransfer{OwnerID: repo.owner.ID, Expiry: &far, ExpiryValue: far.UTC().Format(time.RFC3339)})
+	if err != nil || time.Until(*expiresAt) > maximum {
+		t.Fatalf("expected the longest expiry allowed, got %v, %v", expiresAt, err)
+	}
+
+	// Never is no longer allowed for the owner's role
+	expiresAt, err = s.assembledExpiry(context.Background(), &models.TempTransfer{OwnerID: repo.owner.ID, ExpiryValue: "never"})
+	if err != nil || expiresAt == nil || time.Until(*expiresAt) > maximum {
+		t.Fatalf("expected never to become the longest expiry allowed, got %v, %v", expiresAt, err)
+	}
+	repo.owner.Role = constants.RoleAdmin
+	expiresAt, err = s.assembledExpiry(context.Background(), &models.TempTransfer{OwnerID: repo.owner.ID, ExpiryValue: "never"})
+	if err != nil || expiresAt != nil {
+		t.Fatalf("expected never to be kept for admins, got %v, %v", expiresAt, err)
+	}
+}
+
+func TestAssembledExpiryKeepsUnresolvablePicks(t *testing.T) {
+	repo := newImportRepo("free")
+	s := newImportService(t, repo)
+
+	// The preset was removed from the config during the upload
+	computed := time.Now().Add(48 * time.Hour)
+	expiresAt, err := s.assembledExpiry(context.Background(), &models.TempTransfer{OwnerID: repo.owner.ID, Expiry: &computed, ExpiryValue: "removed"})
+	if err != nil || !expiresAt.Equal(computed) {
+		t.Fatalf("expected the computed expiry to be kept, got %v, %v", expiresAt, err)
+	}
+}
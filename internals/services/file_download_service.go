@@ -6,25 +6,29 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"large_fss/internals/archive"
 	"large_fss/internals/constants"
 	customerrors "large_fss/internals/customErrors"
 	"large_fss/internals/dto"
-	"large_fss/utils"
+	"large_fss/internals/models"
+	"large_fss/internals/storage"
+	"log"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-func (s *Service) GetTransferInfoService(c context.Context, transferID uuid.UUID) (*dto.TransferInfoDTO, error) {
-	transferData, err := s.repo.FindTransferByID(c, transferID)
+// GetTransferInfoService describes the transfer of a share link and its files for the share page.
+func (s *Service) GetTransferInfoService(c *gin.Context, token string) (*dto.TransferInfoDTO, error) {
+	link, transferData, err := s.sharedTransfer(c, token)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, customerrors.ErrExpiredLink
-		}
 		return nil, err
 	}
-	filesData, err := s.repo.FindAllFilesByTransferID(c, transferID)
+	filesData, err := s.repo.FindAllFilesByTransferID(c, transferData.ID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, customerrors.ErrFileNotFound
@@ -39,160 +43,443 @@ func (s *Service) GetTransferInfoService(c context.Context, transferID uuid.UUID
 			FileName:      file.FileName,
 			FileSize:      file.FileSize,
 			FileExtension: file.FileExtension,
+			ScanStatus:    file.ScanStatus,
+			MimeType:      file.MimeType,
+			Previewable:   s.cfg.Preview.Allows(file.MimeType) && !downloadLimited(link, transferData),
+		}
+		if file.ThumbnailPath != "" {
+			fileinfo.ThumbnailURL = constants.ThumbnailURLPrefix + token + "/" + file.ID.String()
 		}
 		fileInfoList = append(fileInfoList, fileinfo)
 	}
 	transferInfo := dto.TransferInfoDTO{
-		ID:           transferData.ID,
-		Message:      transferData.Message,
-		Size:         int64(transferData.Size),
-		Expiry:       *transferData.Expiry,
-		FileInfoList: fileInfoList,
+		ID:                transferData.ID,
+		Message:           transferData.Message,
+		Size:              int64(transferData.Size),
+		FileInfoList:      fileInfoList,
+		ScanStatus:        transferData.ScanStatus,
+		MaxDownloads:      transferData.MaxDownloads,
+		DownloadsLeft:     downloadsLeft(transferData),
+		PasswordProtected: transferData.PasswordHash != "",
+		LinkLabel:         link.Label,
+		Private:           transferData.Private,
+	}
+	// The link may expire or run out of downloads before the transfer does
+	if expiry := linkExpiry(link, transferData); expiry != nil {
+		transferInfo.Expiry = *expiry
+	}
+	if link.MaxDownloads != nil {
+		linkLeft := max(*link.MaxDownloads-link.DownloadCount, 0)
+		if transferInfo.DownloadsLeft == nil || linkLeft < *transferInfo.DownloadsLeft {
+			transferInfo.DownloadsLeft = &linkLeft
+		}
 	}
 	return &transferInfo, nil
 
 }
 
-func (s *Service) TransferDownloaderService(c *gin.Context, transferID uuid.UUID) (io.ReadCloser, string, error) {
+// TransferDownloaderService returns the content of a transfer with its file name and content
+// type. Without a requested format a single file is returned as-is and several files as a zip,
+// archives are streamed on the fly. The size is -1 when it isn't known up front.
+func (s *Service) TransferDownloaderService(c *gin.Context, token string, format archive.Format) (io.ReadCloser, string, string, int64, error) {
 	// Retrieve transfer metadata
-	transferData, err := s.repo.FindTransferByID(c, transferID)
+	link, transferData, err := s.sharedTransfer(c, token)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, "", customerrors.ErrExpiredLink
-		}
-		return nil, "", err
+		return nil, "", "", 0, err
+	}
+	transferID := transferData.ID
+	err = checkScanStatus(transferData.ScanStatus)
+	if err != nil {
+		return nil, "", "", 0, err
 	}
 
 	// Retrieve all files associated with the transfer
 	filesData, err := s.repo.FindAllFilesByTransferID(c, transferID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, "", customerrors.ErrFileNotFound
+			return nil, "", "", 0, customerrors.ErrFileNotFound
 		}
-		return nil, "", err
+		return nil, "", "", 0, err
 	}
 
 	// Single file: stream directly
-	if len(filesData) == 1 {
+	if len(filesData) == 1 && format == archive.FormatUnknown {
 		resourcePath := filesData[0].FilePath
 		reader, err := s.filestorage.ReadFile(c, resourcePath)
 		_, filename := filepath.Split(resourcePath)
 		if err != nil {
-			return nil, "", err
+			return nil, "", "", 0, err
 		}
-		err = s.repo.IncrementActiveStreamByID(c, filesData[0].ID)
+		wrappedfileReader, err := s.leaseStreams(c, reader, filesData[0].ID)
 		if err != nil {
-			return nil, "", fmt.Errorf("transfer downloader service:failed to increment active stream for fileID-%s: %w", filesData[0].ID, err)
-
+			return nil, "", "", 0, err
 		}
-		wrappedfileReader := &autoFileReader{
-			ReadCloser: reader,
-			repo:       s.repo,
-			FileID:     filesData[0].ID,
-			ctx:        c,
+
+		trackedReader, err := s.trackDownload(c, wrappedfileReader, link, transferData, uuid.NullUUID{UUID: filesData[0].ID, Valid: true}, []uuid.UUID{filesData[0].ID}, constants.DownloadKindFile)
+		if err != nil {
+			return nil, "", "", 0, err
 		}
+		return trackedReader, filename, downloadContentType(filesData[0].MimeType), filesData[0].FileSize, nil
+	}
+	if format == archive.FormatUnknown {
+		format = archive.FormatZip
+	}
 
-		return wrappedfileReader, filename, nil
+	// Multiple files: archive them while streaming
+	storedFiles, err := s.filestorage.ListFilesRecursive(c, transferData.TransferPath)
+	if err != nil {
+		return nil, "", "", 0, fmt.Errorf("transfer downloader service:failed to list files of tranferID-%s: %w", transferID, err)
+	}
+	entries, err := s.archiveEntries(c, transferData, storedFiles)
+	if err != nil {
+		return nil, "", "", 0, err
+	}
+	// Whole transfers are downloaded repeatedly, the first stream is kept for the next ones
+	key := archiveCacheKey(transferID, format, entries)
+	reader, size, cached := s.openCachedArchive(c, key, filesData)
+	if !cached {
+		reader, size, err = s.streamArchive(c, format, entries, filesData)
+		if err != nil {
+			return nil, "", "", 0, err
+		}
+		reader = s.cacheWhileStreaming(transferData, format, key, reader, size)
 	}
-	err = s.filestorage.CreateFolder(c, constants.TempDir)
+	trackedReader, err := s.trackDownload(c, reader, link, transferData, uuid.NullUUID{}, fileIDsOf(filesData), constants.DownloadKindTransfer)
 	if err != nil {
-		return nil, "", fmt.Errorf("transfer downloader service:failed to create transfer folder for tranferID-%s: %w", transferID, err)
+		return nil, "", "", 0, err
 	}
+	return trackedReader, transferID.String() + archive.Extension(format), archive.ContentType(format), size, nil
+}
 
-	// Multiple files: zip them, then stream
-	tempTransferZipPath := filepath.Join(constants.TempDir, transferID.String()+".zip")
-	transferPath := transferData.TransferPath
+// SelectionDownloaderService streams an archive of the chosen files and folders of a transfer.
+// Folder paths are relative to the transfer and include everything below them.
+func (s *Service) SelectionDownloaderService(c *gin.Context, selection dto.DownloadSelectionDTO) (io.ReadCloser, string, int64, error) {
+	link, transferData, err := s.sharedTransfer(c, selection.LinkToken)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	err = checkScanStatus(transferData.ScanStatus)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if len(selection.FileIDs) == 0 && len(selection.Paths) == 0 {
+		return nil, "", 0, customerrors.ErrInvalidInput
+	}
+	format, err := archive.ParseFormat(selection.Format)
+	if err != nil {
+		return nil, "", 0, err
+	}
 
-	fmt.Println("transfer path -", transferPath)
+	filesData, err := s.repo.FindAllFilesByTransferID(c, transferData.ID)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	fileByID := make(map[uuid.UUID]models.File, len(filesData))
+	for _, file := range filesData {
+		fileByID[file.ID] = file
+	}
 
-	err = utils.CreateZip(c, s.filestorage, transferPath, tempTransferZipPath)
+	storedFiles, err := s.filestorage.ListFilesRecursive(c, transferData.TransferPath)
 	if err != nil {
-		return nil, "", err
+		return nil, "", 0, fmt.Errorf("selection downloader service:failed to list files of tranferID-%s: %w", transferData.ID, err)
+	}
+
+	selectedPaths := make(map[string]bool)
+	for _, fileID := range selection.FileIDs {
+		file, ok := fileByID[fileID]
+		if !ok {
+			return nil, "", 0, customerrors.ErrFileNotInTransfer
+		}
+		selectedPaths[file.FilePath] = true
+	}
+	for _, selectedPath := range selection.Paths {
+		folderPath, err := transferRelativePath(transferData.TransferPath, selectedPath)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		found := false
+		for _, stored := range storedFiles {
+			if stored.Path == folderPath || strings.HasPrefix(stored.Path, folderPath+string(filepath.Separator)) {
+				selectedPaths[stored.Path] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, "", 0, customerrors.ErrFileNotInTransfer
+		}
 	}
 
-	reader, err := s.filestorage.ReadFile(c, tempTransferZipPath)
+	var selectedFiles []models.SysFileInfo
+	for _, stored := range storedFiles {
+		if selectedPaths[stored.Path] {
+			selectedFiles = append(selectedFiles, stored)
+		}
+	}
+	var selectedRows []models.File
+	for _, file := range filesData {
+		if selectedPaths[file.FilePath] {
+			selectedRows = append(selectedRows, file)
+		}
+	}
+
+	entries, err := s.archiveEntries(c, transferData, selectedFiles)
 	if err != nil {
-		return nil, "", err
+		return nil, "", 0, err
 	}
+	reader, size, err := s.streamArchive(c, format, entries, selectedRows)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	trackedReader, err := s.trackDownload(c, reader, link, transferData, uuid.NullUUID{}, fileIDsOf(selectedRows), constants.DownloadKindSelection)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	return trackedReader, transferData.ID.String() + "-selection" + archive.Extension(format), size, nil
+}
 
-	wrappedReader := &autoDeleteReader{
-		ReadCloser:  reader,
-		path:        tempTransferZipPath,
-		fileStorage: s.filestorage,
-		ctx:         c,
+// transferRelativePath resolves a client supplied path inside the transfer folder.
+func transferRelativePath(transferPath string, relPath string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(relPath, "/")))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", customerrors.ErrInvalidInput
+	}
+	return filepath.Join(transferPath, cleaned), nil
+}
+
+// streamArchive archives the entries while streaming. The registered files among
+// them count as being downloaded until the returned reader is closed.
+func (s *Service) streamArchive(c *gin.Context, format archive.Format, entries []archive.Entry, filesData []models.File) (io.ReadCloser, int64, error) {
+	archiveWriter, err := archive.NewWriter(format, entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, known := archiveWriter.Size()
+	if !known {
+		size = -1
 	}
-	_, filename := filepath.Split(tempTransferZipPath)
 
-	return wrappedReader, filename, nil
+	pipeReader, pipeWriter := io.Pipe()
+	wrappedReader, err := s.leaseStreams(c, pipeReader, fileIDsOf(filesData)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	go func() {
+		// Closing the reader early makes the writes fail and ends the stream
+		pipeWriter.CloseWithError(archiveWriter.WriteTo(c, s.filestorage, pipeWriter))
+	}()
+	return wrappedReader, size, nil
 }
 
-func (s *Service) FileDownloaderService(c *gin.Context, fileID uuid.UUID) (io.ReadCloser, string, error) {
-	fileData, err := s.repo.FindFileByID(c, fileID)
+// archiveEntries describes the stored files of a transfer as archive entries named
+// relative to the transfer folder, in name order so archives are reproducible.
+func (s *Service) archiveEntries(c context.Context, transferData *models.Transfer, storedFiles []models.SysFileInfo) ([]archive.Entry, error) {
+	objects, err := s.storedObjectsFor(c, transferData.ID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, "", customerrors.ErrFileNotFound
+		return nil, err
+	}
+
+	entries := make([]archive.Entry, 0, len(storedFiles))
+	for _, stored := range storedFiles {
+		relPath, err := filepath.Rel(transferData.TransferPath, stored.Path)
+		if err != nil {
+			return nil, fmt.Errorf("transfer downloader service:failed to compute relative path: %w", err)
 		}
-		return nil, "", err
+		name := filepath.ToSlash(relPath)
+		if stored.IsDir {
+			entries = append(entries, archive.Entry{Name: name + "/", Modified: stored.ModTime})
+			continue
+		}
+		// Files not indexed yet are checksummed while they are streamed
+		object, indexed := objects[stored.Path]
+		entries = append(entries, archive.Entry{
+			Name:     name,
+			Path:     stored.Path,
+			Size:     stored.Size,
+			CRC32:    uint32(object.CRC32),
+			Modified: stored.ModTime,
+			NoCRC32:  !indexed || object.Size != stored.Size,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// FileDownloaderService opens a file for download with its name and sniffed content type.
+func (s *Service) FileDownloaderService(c *gin.Context, token string, fileID uuid.UUID) (io.ReadCloser, string, string, error) {
+	link, transferData, fileData, err := s.sharedFile(c, token, fileID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	err = checkScanStatus(fileData.ScanStatus)
+	if err != nil {
+		return nil, "", "", err
 	}
 	reader, err := s.filestorage.ReadFile(c, fileData.FilePath)
 	if err != nil {
-		return nil, "", err
+		return nil, "", "", err
 	}
 	_, filename := filepath.Split(fileData.FilePath)
-	err = s.repo.IncrementActiveStreamByID(c, fileData.ID)
+	wrappedReader, err := s.leaseStreams(c, reader, fileData.ID)
 	if err != nil {
-		return nil, "", fmt.Errorf("transfer downloader service:failed to increment active stream for fileID-%s: %w", fileData.ID, err)
+		return nil, "", "", err
+	}
 
+	trackedReader, err := s.trackDownload(c, wrappedReader, link, transferData, uuid.NullUUID{UUID: fileData.ID, Valid: true}, []uuid.UUID{fileData.ID}, constants.DownloadKindFile)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return trackedReader, filename, downloadContentType(fileData.MimeType), nil
+}
+
+// FilePreviewService opens a file for inline display when its sniffed content type
+// is on the preview allowlist. The reader seeks so range requests can be served.
+// Previews share the bandwidth and concurrency cap of downloads but are not counted, so
+// transfers and links with a download limit refuse them rather than be read past it.
+func (s *Service) FilePreviewService(c *gin.Context, token string, fileID uuid.UUID) (io.ReadSeekCloser, string, string, error) {
+	link, transferData, fileData, err := s.sharedFile(c, token, fileID)
+	if err != nil {
+		return nil, "", "", err
 	}
-	wrappedReader := &autoFileReader{
-		ReadCloser: reader,
-		repo:       s.repo,
-		FileID:     fileData.ID,
-		ctx:        c,
+	err = checkScanStatus(fileData.ScanStatus)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if !s.cfg.Preview.Allows(fileData.MimeType) {
+		return nil, "", "", customerrors.ErrPreviewNotSupported
+	}
+	if downloadLimited(link, transferData) {
+		return nil, "", "", customerrors.ErrPreviewLimited
 	}
 
-	return wrappedReader, filename, nil
+	rangeReader := storage.NewRangeReader(c, s.filestorage, fileData.FilePath, fileData.FileSize)
+	leased, err := s.leaseStreams(c, rangeReader, fileData.ID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	throttled, err := s.throttleDownload(c, leased, link, transferData)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return &leasedSeekReader{ReadCloser: throttled, seeker: rangeReader}, filepath.Base(fileData.FilePath), fileData.MimeType, nil
 }
 
-func (s *Service) GetAllTransfersService(c context.Context, userID uuid.UUID) ([]dto.TransferInfoDTO, error) {
-	transferLst, err := s.repo.FindAllTransfersByUserID(c, userID)
+// GetAllTransfersService returns a page of the user's transfers matching the query, with
+// the cursor of the next page when there is one.
+func (s *Service) GetAllTransfersService(c context.Context, query dto.TransferListQueryDTO) (*dto.TransferListDTO, error) {
+	filter, err := transferFilterFor(query)
+	if err != nil {
+		return nil, err
+	}
+	// One more than asked tells whether another page follows
+	filter.Limit++
+	transferLst, err := s.repo.FindTransfersByFilter(c, filter)
 	if err != nil {
-		return []dto.TransferInfoDTO{}, err
+		return nil, err
+	}
+	page := dto.TransferListDTO{Transfers: []dto.TransferInfoDTO{}}
+	if len(transferLst) == 0 {
+		return &page, nil
+	}
+	if len(transferLst) > query.Limit {
+		transferLst = transferLst[:query.Limit]
+		page.NextCursor = encodeTransferCursor(filter, transferLst[len(transferLst)-1])
+	}
+	transferIDs := make([]uuid.UUID, len(transferLst))
+	for i, trans := range transferLst {
+		transferIDs[i] = trans.ID
+	}
 
+	downloadStats, err := s.repo.FindDownloadStatsByTransferIDs(c, transferIDs)
+	if err != nil {
+		return nil, err
+	}
+	statsByTransfer := make(map[uuid.UUID]models.DownloadStats, len(downloadStats))
+	for _, stat := range downloadStats {
+		statsByTransfer[stat.TransferID] = stat
+	}
+	links, err := s.repo.FindAllLinksByTransferIDs(c, transferIDs)
+	if err != nil {
+		return nil, err
+	}
+	linksByTransfer := make(map[uuid.UUID][]dto.LinkDTO)
+	for _, link := range links {
+		linksByTransfer[link.TransferID] = append(linksByTransfer[link.TransferID], linkToDTO(link))
+	}
+	recipients, err := s.repo.FindRecipientStatusesByTransferIDs(c, transferIDs)
+	if err != nil {
+		return nil, err
+	}
+	recipientsByTransfer := make(map[uuid.UUID][]dto.RecipientDTO)
+	for _, recipient := range recipients {
+		recipientsByTransfer[recipient.TransferID] = append(recipientsByTransfer[recipient.TransferID], recipientToDTO(recipient))
 	}
-	var transferDTOLst []dto.TransferInfoDTO
 
 	for _, trans := range transferLst {
+		stat := statsByTransfer[trans.ID]
 		transDTO := dto.TransferInfoDTO{
-			ID:        trans.ID,
-			Expiry:    *trans.Expiry,
-			Message:   trans.Message,
-			Size:      trans.Size,
-			CreatedAt: trans.CreatedAt,
+			ID:                 trans.ID,
+			Message:            trans.Message,
+			Size:               trans.Size,
+			CreatedAt:          trans.CreatedAt,
+			ScanStatus:         trans.ScanStatus,
+			DownloadCount:      stat.Downloads,
+			CompletedDownloads: stat.Completed,
+			LastDownloadAt:     stat.LastDownloadAt,
+			MaxDownloads:       trans.MaxDownloads,
+			DownloadsLeft:      downloadsLeft(&trans),
+			PasswordProtected:  trans.PasswordHash != "",
+			Links:              linksByTransfer[trans.ID],
+			Private:            trans.Private,
+			Recipients:         recipientsByTransfer[trans.ID],
 		}
-		transferDTOLst = append(transferDTOLst, transDTO)
+		if trans.Expiry != nil {
+			transDTO.Expiry = *trans.Expiry
+		}
+		if trans.TrashedAt != nil {
+			transDTO.TrashedAt = trans.TrashedAt
+			transDTO.PurgeAt = s.purgeAt(&trans)
+		}
+		page.Transfers = append(page.Transfers, transDTO)
 	}
-	return transferDTOLst, nil
+	return &page, nil
 
 }
 
 func (s *Service) UpdateTransferService(c context.Context, updateDTO dto.TransferUpdateDTO) error {
-	transferData, err := s.repo.FindTransferByID(c, updateDTO.TransferID)
+	transferData, err := s.ownedTransfer(c, updateDTO.TransferID, updateDTO.OwnerID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return customerrors.ErrExpiredLink
-		}
 		return err
 	}
-	if transferData.OwnerID != updateDTO.OwnerID {
-		return customerrors.ErrUnauthorized
-
-	}
 	transferData.Message = updateDTO.Message
+	if updateDTO.MaxDownloads != nil {
+		switch {
+		case *updateDTO.MaxDownloads == 0:
+			transferData.MaxDownloads = nil
+		case *updateDTO.MaxDownloads <= transferData.DownloadCount:
+			// A limit that is already used up would delete the transfer right away
+			return customerrors.ErrInvalidInput
+		default:
+			transferData.MaxDownloads = updateDTO.MaxDownloads
+		}
+	}
+	if updateDTO.Password != nil {
+		transferData.PasswordHash = ""
+		if *updateDTO.Password != "" {
+			transferData.PasswordHash, err = hashTransferPassword(*updateDTO.Password)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if updateDTO.Private != nil {
+		transferData.Private = *updateDTO.Private
+	}
 	if updateDTO.Expiry != "" {
-		expiryTime, err := utils.ParseExpiry(&updateDTO.Expiry)
+		expiryTime, err := s.transferExpiry(c, transferData.OwnerID, updateDTO.Expiry)
 		if err != nil {
-			return customerrors.ErrInvalidInput
+			return err
 		}
 		transferData.Expiry = expiryTime
 	}
@@ -203,25 +490,140 @@ func (s *Service) UpdateTransferService(c context.Context, updateDTO dto.Transfe
 	return nil
 }
 
+// DeleteTransferService moves a transfer the user owns to the trash, purging deletes it for good.
 func (s *Service) DeleteTransferService(c context.Context, transferID uuid.UUID, userID uuid.UUID) error {
-	transferData, err := s.repo.FindTransferByID(c, transferID)
+	transferData, err := s.ownedTransfer(c, transferID, userID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return customerrors.ErrExpiredLink
-		}
 		return err
 	}
-	if transferData.OwnerID != userID {
-		return customerrors.ErrUnauthorized
+	_, err = s.trashTransfer(c, transferData.ID)
+	return err
+}
 
+// removeTransfer deletes everything stored for a transfer, then its record.
+func (s *Service) removeTransfer(c context.Context, transferData *models.Transfer) error {
+	paths := []string{
+		transferData.TransferPath,
+		filepath.Join(constants.QuarantineDir, transferData.ID.String()),
+		filepath.Join(constants.ThumbnailDir, transferData.ID.String()),
+		filepath.Join(constants.ArchiveCacheDir, transferData.ID.String()),
 	}
-	err = s.filestorage.DeleteAll(c, transferData.TransferPath)
+	for _, path := range paths {
+		err := s.filestorage.DeleteAll(c, path)
+		if err != nil {
+			return fmt.Errorf("remove transfer: failed to remove/delete path %s: %w", path, err)
+		}
+	}
+	return s.repo.DeleteTransferByID(c, transferData.ID)
+}
+
+// DeleteFileService removes a single file from a transfer the user owns.
+func (s *Service) DeleteFileService(c context.Context, fileID uuid.UUID, userID uuid.UUID) error {
+	fileData, err := s.repo.FindFileByID(c, fileID)
 	if err != nil {
-		return fmt.Errorf("delete transfer service: failed to remove/delete path %s: %w", transferData.TransferPath, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return customerrors.ErrFileNotFound
+		}
+		return err
 	}
-	err = s.repo.DeleteTransferByID(c, transferID)
+	transferData, err := s.ownedTransfer(c, fileData.TransferID, userID)
 	if err != nil {
 		return err
 	}
+
+	// The row is only deleted while no stream is open, and only once the stored file is gone
+	deletedFile, err := s.repo.DeleteFileByID(c, fileID, func(file *models.File) error {
+		err := s.filestorage.DeleteFile(c, file.FilePath)
+		if err != nil {
+			return fmt.Errorf("delete file service: failed to remove/delete path %s: %w", file.FilePath, err)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return customerrors.ErrActiveStreams
+		}
+		return err
+	}
+	// A leftover thumbnail is only wasted space, the file is already gone
+	if deletedFile.ThumbnailPath != "" {
+		err = s.filestorage.DeleteFile(c, deletedFile.ThumbnailPath)
+		if err != nil {
+			log.Printf("delete file service: error in deleting thumbnail %s: %v", deletedFile.ThumbnailPath, err)
+		}
+	}
+	err = s.invalidateArchiveCache(c, transferData.ID)
+	if err != nil {
+		log.Printf("delete file service: failed to invalidate archive cache of transfer %s: %v", transferData.ID, err)
+	}
+	// Removing a quarantined file may leave the rest of the transfer clean
+	if transferData.ScanStatus != constants.ScanStatusClean {
+		s.scanTransferInBackground(transferData.ID)
+	}
 	return nil
 }
+
+// downloadContentType is the sniffed type of a file, files recorded before sniffing are generic binaries.
+func downloadContentType(mimeType string) string {
+	if mimeType == "" {
+		return "application/octet-stream"
+	}
+	return mimeType
+}
+
+func fileIDsOf(files []models.File) []uuid.UUID {
+	fileIDs := make([]uuid.UUID, 0, len(files))
+	for _, file := range files {
+		fileIDs = append(fileIDs, file.ID)
+	}
+	return fileIDs
+}
+
+// checkTransferAvailable rejects transfers that are in the trash, expired or used up their downloads.
+// Cleanup runs periodically, so such a transfer may still be stored.
+func checkTransferAvailable(transferData *models.Transfer) error {
+	if transferData.TrashedAt != nil {
+		return customerrors.ErrExpiredLink
+	}
+	if transferData.Expiry != nil && transferData.Expiry.Before(time.Now()) {
+		return customerrors.ErrExpiredLink
+	}
+	if transferData.MaxDownloads != nil && transferData.DownloadCount >= *transferData.MaxDownloads {
+		return customerrors.ErrDownloadLimitReached
+	}
+	return nil
+}
+
+// linkExpiry is when a link stops working, the earlier of its own and its transfer's expiry.
+func linkExpiry(link *models.Link, transferData *models.Transfer) *time.Time {
+	if link.ExpiresAt == nil || (transferData.Expiry != nil && transferData.Expiry.Before(*link.ExpiresAt)) {
+		return transferData.Expiry
+	}
+	return link.ExpiresAt
+}
+
+// downloadsLeft is how many downloads a limited transfer still allows, nil without a limit.
+func downloadsLeft(transferData *models.Transfer) *int {
+	if transferData.MaxDownloads == nil {
+		return nil
+	}
+	left := max(*transferData.MaxDownloads-transferData.DownloadCount, 0)
+	return &left
+}
+
+// downloadLimited tells whether the transfer or the link counts its downloads.
+func downloadLimited(link *models.Link, transferData *models.Transfer) bool {
+	return transferData.MaxDownloads != nil || link.MaxDownloads != nil
+}
+
+// checkScanStatus only lets content through once the malware scan marked it clean.
+func checkScanStatus(status string) error {
+	switch status {
+	case constants.ScanStatusClean:
+		return nil
+	case constants.ScanStatusInfected:
+		return customerrors.ErrFileInfected
+	default:
+		return customerrors.ErrScanPending
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"large_fss/internals/archive"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/utils"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// enforceFileTypePolicy sniffs every file under folderPath and checks it against the
+// owner's plan rules. It returns the detected MIME type by storage path, or a
+// FileTypeViolationError naming every offending file.
+func (s *Service) enforceFileTypePolicy(c context.Context, ownerID uuid.UUID, folderPath string) (map[string]string, error) {
+	owner, err := s.repo.FindUserById(c, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	rules := s.cfg.FileTypePolicy.ForPlan(owner.Plan)
+
+	files, err := s.filestorage.ListFilesRecursive(c, folderPath)
+	if err != nil {
+		return nil, fmt.Errorf("file policy service:failed to list extracted files: %w", err)
+	}
+
+	mimeTypes := make(map[string]string, len(files))
+	var violations []string
+	for _, f := range files {
+		if f.IsDir {
+			continue
+		}
+		mimeType, err := s.sniffStoredFile(c, f.Path)
+		if err != nil {
+			return nil, err
+		}
+		mimeTypes[f.Path] = mimeType
+
+		if reason := rules.Violation(f.Name, mimeType); reason != "" {
+			relPath, err := filepath.Rel(folderPath, f.Path)
+			if err != nil {
+				relPath = f.Name
+			}
+			violations = append(violations, fmt.Sprintf("%s: %s", relPath, reason))
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, &customerrors.FileTypeViolationError{Files: violations}
+	}
+	return mimeTypes, nil
+}
+
+// archiveLimitsFor returns the extraction limits for an upload of the given user,
+// with the uncompressed size never above their plan quota.
+func (s *Service) archiveLimitsFor(c context.Context, ownerID uuid.UUID) (archive.Limits, error) {
+	owner, err := s.repo.FindUserById(c, ownerID)
+	if err != nil {
+		return archive.Limits{}, err
+	}
+	configured := s.cfg.ArchiveLimits
+	maxTotalSize := s.cfg.QuotaForPlan(owner.Plan)
+	if configured.MaxUncompressedSize > 0 && configured.MaxUncompressedSize < maxTotalSize {
+		maxTotalSize = configured.MaxUncompressedSize
+	}
+	return archive.Limits{
+		MaxTotalSize:        maxTotalSize,
+		MaxEntries:          configured.MaxEntries,
+		MaxPathDepth:        configured.MaxPathDepth,
+		MaxCompressionRatio: configured.MaxCompressionRatio,
+	}, nil
+}
+
+// sniffStoredFile detects the MIME type of a stored file from its content.
+func (s *Service) sniffStoredFile(c context.Context, path string) (string, error) {
+	reader, err := s.filestorage.ReadFile(c, path)
+	if err != nil {
+		return "", fmt.Errorf("file policy service:failed to open %s: %w", path, err)
+	}
+	defer reader.Close()
+
+	mimeType, err := utils.DetectContentTypeFromReader(reader)
+	if err != nil {
+		return "", fmt.Errorf("file policy service:failed to sniff %s: %w", path, err)
+	}
+	return mimeType, nil
+}
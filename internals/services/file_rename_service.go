@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"log"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// cleanFileName checks a new name for a file, relative to its transfer. Slashes put
+// the file in folders, which are created as needed.
+func cleanFileName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || !utf8.ValidString(name) || strings.ContainsAny(name, constants.InvalidFileNameChars) {
+		return "", customerrors.ErrInvalidFileName
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", customerrors.ErrInvalidFileName
+		}
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." ||
+			strings.TrimSpace(segment) != segment || len(segment) > constants.MaxFileNameLength {
+			return "", customerrors.ErrInvalidFileName
+		}
+	}
+	return name, nil
+}
+
+// fileNameTaken reports whether a file can't be stored under name in the transfer:
+// something already has that name, or a file sits where one of its folders would go.
+func (s *Service) fileNameTaken(c context.Context, transferPath string, name string) (bool, error) {
+	exists, err := s.filestorage.Exists(c, filepath.Join(transferPath, name))
+	if err != nil || exists {
+		return exists, err
+	}
+	for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+		dirPath := filepath.Join(transferPath, dir)
+		exists, err := s.filestorage.Exists(c, dirPath)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			continue
+		}
+		isFolder, err := s.filestorage.IsFolder(c, dirPath)
+		if err != nil {
+			return false, err
+		}
+		if !isFolder {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RenameFileService renames a file of a transfer the user owns, or moves it to another
+// folder of the transfer. Files being downloaded are left alone, as ranged and archive
+// downloads open them again by path.
+func (s *Service) RenameFileService(c context.Context, updateDTO dto.FileUpdateDTO) (*dto.FileInfoDTO, error) {
+	fileData, err := s.repo.FindFileByID(c, updateDTO.FileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, customerrors.ErrFileNotFound
+		}
+		return nil, err
+	}
+	transferData, err := s.ownedTransfer(c, fileData.TransferID, updateDTO.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	// Quarantined files live outside the transfer and stay there
+	if fileData.ScanStatus == constants.ScanStatusInfected {
+		return nil, customerrors.ErrFileInfected
+	}
+	fileName, err := cleanFileName(updateDTO.FileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if fileName != fileData.FileName {
+		owner, err := s.repo.FindUserById(c, transferData.OwnerID)
+		if err != nil {
+			return nil, err
+		}
+		// The content was checked on upload, a new extension may still be denied
+		rules := s.cfg.FileTypePolicy.ForPlan(owner.Plan)
+		if reason := rules.Violation(filepath.Base(fileName), fileData.MimeType); reason != "" {
+			return nil, &customerrors.FileTypeViolationError{Files: []string{fmt.Sprintf("%s: %s", fileName, reason)}}
+		}
+		// The collision check and the move run while the transfer is locked for renames,
+		// and the row is only committed once the object was moved
+		oldPath := fileData.FilePath
+		newPath := filepath.Join(transferData.TransferPath, fileName)
+		moved := false
+		renamed, err := s.repo.RenameFileByID(c, fileData.ID, fileName, newPath, filepath.Ext(fileName), func(oldPath string) error {
+			taken, err := s.fileNameTaken(c, transferData.TransferPath, fileName)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return customerrors.ErrFileAlreadyExists
+			}
+			err = s.filestorage.Rename(c, oldPath, newPath)
+			if err != nil {
+				return fmt.Errorf("rename file service: failed to move %s to %s: %w", oldPath, newPath, err)
+			}
+			moved = true
+			return nil
+		})
+		if err != nil {
+			if moved {
+				// The commit failed after the move, the object goes back to where the row says it is
+				if revertErr := s.filestorage.Rename(c, newPath, oldPath); revertErr != nil {
+					log.Printf("rename file service: failed to move %s back to %s: %v", newPath, oldPath, revertErr)
+				}
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, customerrors.ErrActiveStreams
+			}
+			return nil, err
+		}
+		fileData = renamed
+		// Cached archives still hold the old name. The rename is done by now, so a cache
+		// that can't be dropped is only logged and ages out of the cache.
+		err = s.invalidateArchiveCache(c, transferData.ID)
+		if err != nil {
+			log.Printf("rename file service: failed to invalidate archive cache of transfer %s: %v", transferData.ID, err)
+		}
+	}
+
+	return &dto.FileInfoDTO{
+		ID:            fileData.ID,
+		FileName:      fileData.FileName,
+		FileSize:      fileData.FileSize,
+		FileExtension: fileData.FileExtension,
+		ScanStatus:    fileData.ScanStatus,
+		MimeType:      fileData.MimeType,
+		Previewable:   s.cfg.Preview.Allows(fileData.MimeType),
+	}, nil
+}
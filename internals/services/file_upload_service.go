@@ -5,14 +5,15 @@ import (
 	"database/sql"
 	"errors"
 	"io"
+	"large_fss/internals/archive"
 	"large_fss/internals/constants"
 	customerrors "large_fss/internals/customErrors"
 	"large_fss/internals/dto"
 	"large_fss/internals/models"
-	"large_fss/utils"
+	"log"
 	"path/filepath"
-	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"fmt"
@@ -26,8 +27,33 @@ func (s *Service) CreateTransferService(c context.Context, fileUploadRequest dto
 	tempTransfer.Size = fileUploadRequest.Size
 	tempTransfer.OwnerID = fileUploadRequest.OwnerID
 	tempTransfer.CreatedAt = time.Now()
-	tempTransfer.Expiry = fileUploadRequest.Expiry
+	expiresAt, err := s.transferExpiry(c, fileUploadRequest.OwnerID, fileUploadRequest.Expiry)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	tempTransfer.Expiry = expiresAt
+	tempTransfer.ExpiryValue = fileUploadRequest.Expiry
 	tempTransfer.Message = fileUploadRequest.Message
+	if fileUploadRequest.MaxDownloads != nil && *fileUploadRequest.MaxDownloads < 1 {
+		return uuid.UUID{}, customerrors.ErrInvalidInput
+	}
+	tempTransfer.MaxDownloads = fileUploadRequest.MaxDownloads
+	if fileUploadRequest.Password != "" {
+		passwordHash, err := hashTransferPassword(fileUploadRequest.Password)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+		tempTransfer.PasswordHash = passwordHash
+	}
+	// Store-as-is uploads skip extraction and keep the upload as one named file
+	if fileUploadRequest.StoreAsIs {
+		fileName, err := storedFileName(fileUploadRequest.FileName)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+		tempTransfer.StoreAsIs = true
+		tempTransfer.FileName = fileName
+	}
 	fileId, err := s.repo.CreateTempTransfer(c, tempTransfer)
 	if err != nil {
 		return uuid.UUID{}, err
@@ -36,6 +62,44 @@ func (s *Service) CreateTransferService(c context.Context, fileUploadRequest dto
 
 }
 
+// CreateAppendTransferService opens an upload session whose ID is the existing
+// transfer ID, so the regular chunk upload and assemble endpoints append to it.
+func (s *Service) CreateAppendTransferService(c context.Context, appendRequest dto.TransferAppendDTO) (uuid.UUID, error) {
+	transferData, err := s.ownedTransfer(c, appendRequest.TransferID, appendRequest.OwnerID)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	if transferData.Size+appendRequest.Size > constants.ValidUserMaxUploadSize {
+		return uuid.UUID{}, customerrors.LimitExceeded
+	}
+	err = s.checkNoActiveStreams(c, transferData.ID)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	_, err = s.repo.FindTempTransferByID(c, transferData.ID)
+	if err == nil {
+		return uuid.UUID{}, customerrors.ErrRequestAlreadyExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.UUID{}, err
+	}
+
+	tempTransfer := models.TempTransfer{
+		ID:      transferData.ID,
+		OwnerID: transferData.OwnerID,
+		Size:    appendRequest.Size,
+	}
+	if appendRequest.StoreAsIs {
+		fileName, err := storedFileName(appendRequest.FileName)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+		tempTransfer.StoreAsIs = true
+		tempTransfer.FileName = fileName
+	}
+	return s.repo.CreateTempTransfer(c, tempTransfer)
+}
+
 func (s *Service) CancelTransferService(c context.Context, transferID uuid.UUID, ownerID uuid.UUID) error {
 	tempTransferData, err := s.repo.FindTempTransferByID(c, transferID)
 	if err != nil {
@@ -49,6 +113,7 @@ func (s *Service) CancelTransferService(c context.Context, transferID uuid.UUID,
 	if tempTransferData.OwnerID != ownerID {
 		return customerrors.ErrUnauthorized
 	}
+	s.cancelImport(transferID)
 	chunkPath := filepath.Join(constants.ChunkDir, transferID.String())
 	err = s.filestorage.DeleteAll(c, chunkPath)
 	if err != nil {
@@ -119,15 +184,17 @@ func (s *Service) UploadChunkService(c *gin.Context, chunkUploadRequest dto.Chun
 	if err != nil {
 		return fmt.Errorf("upload chunk service:failed to open chunk file in storage in write mode: index-%d tranferID-%s: %w", chunkUploadRequest.ChunkIndex, chunkUploadRequest.ID, err)
 	}
-	_, err = io.Copy(chunkwriter, chunkfile)
+	written, err := io.Copy(chunkwriter, chunkfile)
 	if err != nil {
 		return fmt.Errorf("upload chunk service:failed to copy data from request chunk file to storage chunk file: index-%d tranferID-%s: %w", chunkUploadRequest.ChunkIndex, chunkUploadRequest.ID, err)
 	}
 	defer chunkwriter.Close()
 
 	chunk := models.Chunk{
-		Index:     chunkUploadRequest.ChunkIndex,
-		TranferID: chunkUploadRequest.ID,
+		Index:      chunkUploadRequest.ChunkIndex,
+		TranferID:  chunkUploadRequest.ID,
+		Size:       written,
+		UploadedAt: time.Now(),
 	}
 	err = s.repo.CreateChunk(c, chunk)
 	if err != nil {
@@ -164,14 +231,6 @@ func (s *Service) AssembleFileService(c context.Context, assembleRequest dto.Fil
 
 	}
 
-	TempPath := filepath.Join(constants.TempDir, assembleRequest.ID.String())
-
-	err = s.filestorage.CreateFolder(c, TempPath)
-	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("assemble file service:failed to create temp folder for tranferID-%s: %w", assembleRequest.ID, err)
-
-	}
-
 	transferPath := filepath.Join(constants.UploadDir, assembleRequest.ID.String())
 	err = s.filestorage.CreateFolder(c, transferPath)
 	if err != nil {
@@ -179,50 +238,67 @@ func (s *Service) AssembleFileService(c context.Context, assembleRequest dto.Fil
 
 	}
 
-	finalZipPath, err := s.AssembleAllChunk(c, chunkPath, TempPath)
-	if err != nil {
+	// Upload sessions sharing an existing transfer's ID are appends
+	existingTransfer, err := s.repo.FindTransferByID(c, tempTransferData.ID)
+	if err == nil {
+		return s.appendAssembledFiles(c, existingTransfer, tempTransferData, chunkPath)
+	} else if !errors.Is(err, sql.ErrNoRows) {
 		return uuid.UUID{}, err
 	}
-	time.Sleep(2 * time.Second)
-	// Delete the zip file after extraction
-	err = s.filestorage.DeleteAll(c, chunkPath)
 
+	// Uploads can take hours, the transfer's lifetime starts once it is assembled
+	expiresAt, err := s.assembledExpiry(c, tempTransferData)
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("assemble service:failed to delete temp chunk files: %w", err)
+		return uuid.UUID{}, err
 	}
-	// Decompress the zip file
-
-	err = utils.Unzip(c, s.filestorage, finalZipPath, transferPath)
+	limits, err := s.archiveLimitsFor(c, tempTransferData.OwnerID)
 	if err != nil {
 		return uuid.UUID{}, err
 	}
-	err = s.filestorage.DeleteAll(c, finalZipPath)
+	err = s.unpackUpload(c, tempTransferData, chunkPath, transferPath, limits)
 	if err != nil {
+		// Nothing of a partial extraction may stay behind
+		s.discardAssembledUpload(c, tempTransferData.ID, chunkPath, transferPath)
 		return uuid.UUID{}, err
 	}
+	err = s.filestorage.DeleteAll(c, chunkPath)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("assemble service:failed to delete temp chunk files: %w", err)
+	}
 
-	// Create and store final transfer record
-
-	expiryTime, err := utils.ParseExpiry(&tempTransferData.Expiry)
+	// A single disallowed file rejects the whole transfer
+	mimeTypes, err := s.enforceFileTypePolicy(c, tempTransferData.OwnerID, transferPath)
 	if err != nil {
+		if errors.Is(err, customerrors.ErrFileTypeNotAllowed) {
+			s.discardAssembledUpload(c, tempTransferData.ID, transferPath)
+		}
 		return uuid.UUID{}, err
 	}
 
+	// Create and store final transfer record
 	transferData := models.Transfer{
 		ID:           tempTransferData.ID,
 		Message:      tempTransferData.Message,
-		Expiry:       expiryTime,
+		Expiry:       expiresAt,
 		TransferPath: transferPath,
 		OwnerID:      tempTransferData.OwnerID,
 		Size:         tempTransferData.Size,
+		MaxDownloads: tempTransferData.MaxDownloads,
+		PasswordHash: tempTransferData.PasswordHash,
 	}
 
 	transferID, err := s.repo.CreateTransfer(c, transferData)
 	if err != nil {
 		return uuid.UUID{}, err
 	}
+	// Transfers are only reachable through links, every new one starts with one
+	_, err = s.createLink(c, models.Link{TransferID: transferID, Label: constants.DefaultLinkLabel})
+	if err != nil {
+		return uuid.UUID{}, err
+	}
 
-	filesInTransferPath, err := s.filestorage.ReadFolder(c, transferPath)
+	// Files in folders are registered too, named by their path within the transfer
+	filesInTransferPath, err := s.filestorage.ListFilesRecursive(c, transferPath)
 	if err != nil {
 		return uuid.UUID{}, fmt.Errorf("assemble service:failed to read extracted files: %w", err)
 	}
@@ -230,11 +306,16 @@ func (s *Service) AssembleFileService(c context.Context, assembleRequest dto.Fil
 	for _, f := range filesInTransferPath {
 		var fileData models.File
 		if !f.IsDir {
-			fileData.FileName = f.Name
-			fileData.FilePath = filepath.Join(transferPath, f.Name)
+			relPath, err := filepath.Rel(transferPath, f.Path)
+			if err != nil {
+				return uuid.UUID{}, fmt.Errorf("assemble service:failed to compute relative path: %w", err)
+			}
+			fileData.FileName = filepath.ToSlash(relPath)
+			fileData.FilePath = f.Path
 			fileData.TransferID = transferID
 			fileData.FileSize = f.Size
 			fileData.FileExtension = filepath.Ext(f.Name)
+			fileData.MimeType = mimeTypes[fileData.FilePath]
 			_, err = s.repo.CreateFile(c, fileData)
 			if err != nil {
 				return uuid.UUID{}, err
@@ -242,74 +323,187 @@ func (s *Service) AssembleFileService(c context.Context, assembleRequest dto.Fil
 
 		}
 	}
+	// Archive downloads read the checksums from the records
+	err = s.indexStoredFiles(c, transferID, transferPath)
+	if err != nil {
+		log.Printf("assemble service: error in indexing files of %s: %v", transferID, err)
+	}
 	err = s.repo.DeleteTempTransferByID(c, tempTransferData.ID)
 	if err != nil {
 		return uuid.UUID{}, err
 	}
+	// Files stay undownloadable until the scan marks them clean
+	s.scanTransferInBackground(transferID)
 	return transferID, nil
 }
 
-func (s *Service) AssembleAllChunk(c context.Context, chunkPath string, tempPath string) (string, error) {
-	// Read chunk files
-	files, err := s.filestorage.ReadFolder(c, chunkPath)
+// appendAssembledFiles extracts an append upload into a staging folder and moves
+// its files into the existing transfer. Name collisions reject the whole upload.
+func (s *Service) appendAssembledFiles(c context.Context, transferData *models.Transfer, tempTransferData *models.TempTransfer, chunkPath string) (uuid.UUID, error) {
+	tempPath := filepath.Join(constants.TempDir, transferData.ID.String())
+	discard := func() {
+		s.discardAssembledUpload(c, transferData.ID, chunkPath, tempPath)
+	}
 
+	// Checked again when the files are moved in, this only fails early
+	err := s.checkNoActiveStreams(c, transferData.ID)
 	if err != nil {
-		return "", fmt.Errorf("assemble chunk service:failed to read chunk directory: %w", err)
+		discard()
+		return uuid.UUID{}, err
 	}
-	err = s.filestorage.CreateFolder(c, tempPath)
+
+	stagingPath := filepath.Join(tempPath, "extracted")
+	err = s.filestorage.CreateFolder(c, stagingPath)
 	if err != nil {
-		return "", fmt.Errorf("assemble chunk service:failed to create upload directory: %w", err)
+		return uuid.UUID{}, fmt.Errorf("append assemble service:failed to create staging folder for tranferID-%s: %w", transferData.ID, err)
 	}
-
-	// Sort chunk files numerically by filename
-	chunkFiles := make([]string, 0)
-	for _, file := range files {
-		if !file.IsDir {
-			chunkFiles = append(chunkFiles, file.Name)
-		}
+	limits, err := s.archiveLimitsFor(c, transferData.OwnerID)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	// What the transfer already holds counts against the quota
+	limits.MaxTotalSize -= transferData.Size
+	if limits.MaxTotalSize <= 0 {
+		discard()
+		return uuid.UUID{}, customerrors.LimitExceeded
+	}
+	err = s.unpackUpload(c, tempTransferData, chunkPath, stagingPath, limits)
+	if err != nil {
+		discard()
+		return uuid.UUID{}, err
+	}
+	err = s.filestorage.DeleteAll(c, chunkPath)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("append assemble service:failed to delete temp chunk files: %w", err)
 	}
-	sort.Slice(chunkFiles, func(i, j int) bool {
-		iInt, _ := strconv.Atoi(chunkFiles[i])
-		jInt, _ := strconv.Atoi(chunkFiles[j])
-		return iInt < jInt
-	})
-
-	// Create the final zip file from chunks
 
-	err = s.filestorage.CreateFolder(c, tempPath)
+	mimeTypes, err := s.enforceFileTypePolicy(c, transferData.OwnerID, stagingPath)
 	if err != nil {
-		return "", fmt.Errorf("assemble chunk service:failed to create transfer folder: %w", err)
+		if errors.Is(err, customerrors.ErrFileTypeNotAllowed) {
+			discard()
+		}
+		return uuid.UUID{}, err
 	}
 
-	finalZipPath := filepath.Join(tempPath, "temp.zip")
-	outFile, err := s.filestorage.WriteFile(c, finalZipPath)
+	stagedFiles, err := s.filestorage.ListFilesRecursive(c, stagingPath)
 	if err != nil {
-		return "", fmt.Errorf("assemble chunk service:error in opening final zip file for write: %w", err)
+		return uuid.UUID{}, fmt.Errorf("append assemble service:failed to read extracted files: %w", err)
 	}
-	defer func() {
-		outFile.Close()
-	}()
 
-	// Merge chunks into final zip
-	for _, chunk := range chunkFiles {
-		chunkFilePath := filepath.Join(chunkPath, chunk)
-		chunkData, err := s.filestorage.ReadFile(c, chunkFilePath)
-		if err != nil {
-			return "", fmt.Errorf("assemble chunk service:failed to open chunk %s: %w", chunk, err)
+	var addedSize int64
+	var movable []models.SysFileInfo
+	for _, f := range stagedFiles {
+		if f.IsDir {
+			continue
 		}
-		_, err = io.Copy(outFile, chunkData)
+		relPath, err := filepath.Rel(stagingPath, f.Path)
 		if err != nil {
-			return "", fmt.Errorf("assemble chunk service:failed to write chunk %s to output file %s : %w", chunk, finalZipPath, err)
+			return uuid.UUID{}, fmt.Errorf("append assemble service:failed to compute relative path: %w", err)
 		}
-		err = chunkData.Close() // close immediately
-		fmt.Println("chunk closed")
+		exists, err := s.filestorage.Exists(c, filepath.Join(transferData.TransferPath, relPath))
 		if err != nil {
-			return "", fmt.Errorf("assemble chunk service: failed to close chunk %s: %w", chunk, err)
+			return uuid.UUID{}, err
+		}
+		if exists {
+			discard()
+			return uuid.UUID{}, fmt.Errorf("append assemble service: %s: %w", relPath, customerrors.ErrFileAlreadyExists)
+		}
+		addedSize += f.Size
+		f.Path = relPath
+		movable = append(movable, f)
+	}
+	if transferData.Size+addedSize > constants.ValidUserMaxUploadSize {
+		discard()
+		return uuid.UUID{}, customerrors.LimitExceeded
+	}
+
+	// Files in folders are registered too, same as a fresh assembly
+	var files []models.File
+	for _, f := range movable {
+		files = append(files, models.File{
+			FileName:      filepath.ToSlash(f.Path),
+			FilePath:      filepath.Join(transferData.TransferPath, f.Path),
+			FileSize:      f.Size,
+			FileExtension: filepath.Ext(f.Path),
+			MimeType:      mimeTypes[filepath.Join(stagingPath, f.Path)],
+		})
+	}
+	var moved []string
+	moveBack := func() {
+		for _, relPath := range moved {
+			err := s.filestorage.Rename(c, filepath.Join(transferData.TransferPath, relPath), filepath.Join(stagingPath, relPath))
+			if err != nil {
+				log.Printf("append assemble service: error in moving %s of %s back: %v", relPath, transferData.ID, err)
+			}
 		}
-
 	}
+	err = s.repo.AppendFilesByTransferID(c, transferData.ID, files, addedSize, func() error {
+		for _, f := range movable {
+			err := s.filestorage.Rename(c, filepath.Join(stagingPath, f.Path), filepath.Join(transferData.TransferPath, f.Path))
+			if err != nil {
+				return fmt.Errorf("append assemble service:failed to move %s into transfer: %w", f.Path, err)
+			}
+			moved = append(moved, f.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		moveBack()
+		discard()
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.UUID{}, customerrors.ErrActiveStreams
+		}
+		return uuid.UUID{}, err
+	}
+	// Cached archives of the transfer miss the new files
+	err = s.invalidateArchiveCache(c, transferData.ID)
+	if err != nil {
+		log.Printf("append assemble service: failed to invalidate archive cache of transfer %s: %v", transferData.ID, err)
+	}
+	err = s.indexStoredFiles(c, transferData.ID, transferData.TransferPath)
+	if err != nil {
+		log.Printf("append assemble service: error in indexing files of %s: %v", transferData.ID, err)
+	}
+	discard()
+	s.scanTransferInBackground(transferData.ID)
+	return transferData.ID, nil
+}
 
-	return finalZipPath, nil
+// discardAssembledUpload removes an upload session that failed after its chunks were
+// merged, since it can't be retried. paths are storage folders holding its leftovers.
+func (s *Service) discardAssembledUpload(c context.Context, transferID uuid.UUID, paths ...string) {
+	for _, path := range paths {
+		if err := s.filestorage.DeleteAll(c, path); err != nil {
+			log.Printf("assemble service: error in deleting %s of %s: %v", path, transferID, err)
+		}
+	}
+	if err := s.repo.DeleteTempTransferByID(c, transferID); err != nil {
+		log.Printf("assemble service: error in deleting db of %s: %v", transferID, err)
+	}
+}
 
+// unpackUpload extracts the upload's chunks into destPath, or stores them as a
+// single file when the uploader asked to keep the archive as-is.
+func (s *Service) unpackUpload(c context.Context, tempTransferData *models.TempTransfer, chunkPath string, destPath string, limits archive.Limits) error {
+	source, err := archive.NewChunkSource(c, s.filestorage, chunkPath)
+	if err != nil {
+		return err
+	}
+	if tempTransferData.StoreAsIs {
+		return archive.Store(c, source, s.filestorage, filepath.Join(destPath, tempTransferData.FileName), limits.MaxTotalSize)
+	}
+	extractor, err := archive.DetectExtractor(source)
+	if err != nil {
+		return err
+	}
+	return extractor.Extract(c, source, s.filestorage, destPath, limits)
 }
 
+// storedFileName reduces a client supplied name to a bare file name.
+func storedFileName(name string) (string, error) {
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "", customerrors.ErrInvalidInput
+	}
+	return name, nil
+}
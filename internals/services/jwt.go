@@ -44,7 +44,26 @@ func (j *JWTService) CreateJWT(id uuid.UUID) (string, error) {
 }
 
 func (j *JWTService) ValidateJWT(tokenString string) (*jwt.MapClaims, error) {
-	fmt.Println("val secret key-", j.secret)
+	claims, err := j.parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	// Transfer and recipient access tokens carry a scope and must not pass as a login
+	if _, scoped := (*claims)[claimScope]; scoped {
+		log.Println("JWT token is scoped to a transfer")
+		return nil, customerrors.ErrInvalidToken
+	}
+
+	// Optional: Log the primary claim
+	if primaryKey, ok := (*claims)[constants.ClaimPrimaryKey]; ok {
+		log.Printf("Authenticated user ID: %v", primaryKey)
+	}
+
+	return claims, nil
+}
+
+// parseJWT verifies the signature and time claims of a token signed by this service.
+func (j *JWTService) parseJWT(tokenString string) (*jwt.MapClaims, error) {
 	// Parse the JWT token with validation
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Ensure the signing method is HMAC-SHA256
@@ -70,10 +89,90 @@ func (j *JWTService) ValidateJWT(tokenString string) (*jwt.MapClaims, error) {
 		return nil, customerrors.ErrInvalidToken
 	}
 
-	// Optional: Log the primary claim
-	if primaryKey, ok := claims[constants.ClaimPrimaryKey]; ok {
-		log.Printf("Authenticated user ID: %v", primaryKey)
+	return &claims, nil
+}
+
+// Claims of the tokens that unlock a password protected transfer
+const (
+	claimScope          = "scope"
+	claimTransferID     = "transfer_id"
+	claimPasswordPrint  = "pwd"
+	scopeTransferAccess = "transfer_access"
+)
+
+// CreateTransferAccessJWT issues a token granting access to one transfer until expiresAt.
+// The password fingerprint ties it to the current password, changing it revokes the token.
+func (j *JWTService) CreateTransferAccessJWT(transferID uuid.UUID, passwordPrint string, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		claimScope:         scopeTransferAccess,
+		claimTransferID:    transferID.String(),
+		claimPasswordPrint: passwordPrint,
+		"exp":              expiresAt.Unix(),
+	})
+	if j.secret == "" {
+		return "", customerrors.ErrSecretKeyNotFound
+	}
+	tokenstr, err := token.SignedString([]byte(j.secret))
+	if err != nil {
+		return "", fmt.Errorf("jwt service: create transfer access token: %w", err)
 	}
+	return tokenstr, nil
+}
 
-	return &claims, nil
+// ValidateTransferAccessJWT checks that the token unlocks the transfer under its current password.
+func (j *JWTService) ValidateTransferAccessJWT(tokenString string, transferID uuid.UUID, passwordPrint string) error {
+	claims, err := j.parseJWT(tokenString)
+	if err != nil {
+		return err
+	}
+	if (*claims)[claimScope] != scopeTransferAccess ||
+		(*claims)[claimTransferID] != transferID.String() ||
+		(*claims)[claimPasswordPrint] != passwordPrint {
+		return customerrors.ErrInvalidToken
+	}
+	return nil
+}
+
+// Claims of the tokens given to guest recipients of a private transfer
+const (
+	claimRecipientID     = "recipient_id"
+	scopeRecipientAccess = "recipient_access"
+)
+
+// CreateRecipientAccessJWT issues a token letting a verified guest recipient open one transfer until expiresAt.
+func (j *JWTService) CreateRecipientAccessJWT(transferID uuid.UUID, recipientID uuid.UUID, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		claimScope:       scopeRecipientAccess,
+		claimTransferID:  transferID.String(),
+		claimRecipientID: recipientID.String(),
+		"exp":            expiresAt.Unix(),
+	})
+	if j.secret == "" {
+		return "", customerrors.ErrSecretKeyNotFound
+	}
+	tokenstr, err := token.SignedString([]byte(j.secret))
+	if err != nil {
+		return "", fmt.Errorf("jwt service: create recipient access token: %w", err)
+	}
+	return tokenstr, nil
+}
+
+// ValidateRecipientAccessJWT returns the recipient a token was issued to for the transfer.
+func (j *JWTService) ValidateRecipientAccessJWT(tokenString string, transferID uuid.UUID) (uuid.UUID, error) {
+	claims, err := j.parseJWT(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if (*claims)[claimScope] != scopeRecipientAccess || (*claims)[claimTransferID] != transferID.String() {
+		return uuid.Nil, customerrors.ErrInvalidToken
+	}
+	recipientID, ok := (*claims)[claimRecipientID].(string)
+	if !ok {
+		return uuid.Nil, customerrors.ErrInvalidToken
+	}
+	parsed, err := uuid.Parse(recipientID)
+	if err != nil {
+		return uuid.Nil, customerrors.ErrInvalidToken
+	}
+	return parsed, nil
 }
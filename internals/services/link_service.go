@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/expiry"
+	"large_fss/internals/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// newLinkToken returns an unguessable URL-safe token for a share link.
+func newLinkToken() (string, error) {
+	buf := make([]byte, constants.LinkTokenBytes)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("link token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// createLink stores a new enabled link of a transfer under a fresh token.
+func (s *Service) createLink(c context.Context, link models.Link) (*models.Link, error) {
+	token, err := newLinkToken()
+	if err != nil {
+		return nil, err
+	}
+	link.Token = token
+	link.Enabled = true
+	return s.repo.CreateLink(c, link)
+}
+
+func linkToDTO(link models.Link) dto.LinkDTO {
+	linkDTO := dto.LinkDTO{
+		ID:             link.ID,
+		TransferID:     link.TransferID,
+		Token:          link.Token,
+		URL:            constants.SharePagePrefix + link.Token,
+		Label:          link.Label,
+		ExpiresAt:      link.ExpiresAt,
+		MaxDownloads:   link.MaxDownloads,
+		DownloadCount:  link.DownloadCount,
+		BytesPerSecond: link.BytesPerSecond,
+		Enabled:        link.Enabled,
+		CreatedAt:      link.CreatedAt,
+	}
+	if link.MaxDownloads != nil {
+		left := max(*link.MaxDownloads-link.DownloadCount, 0)
+		linkDTO.DownloadsLeft = &left
+	}
+	return linkDTO
+}
+
+// checkLinkAvailable rejects links that were disabled, expired or used up their downloads.
+func checkLinkAvailable(link *models.Link) error {
+	if !link.Enabled {
+		return customerrors.ErrExpiredLink
+	}
+	if link.ExpiresAt != nil && link.ExpiresAt.Before(time.Now()) {
+		return customerrors.ErrExpiredLink
+	}
+	if link.MaxDownloads != nil && link.DownloadCount >= *link.MaxDownloads {
+		return customerrors.ErrDownloadLimitReached
+	}
+	return nil
+}
+
+// linkedTransfer resolves a link token to its transfer while both are available,
+// without checking who is asking.
+func (s *Service) linkedTransfer(c context.Context, token string) (*models.Link, *models.Transfer, error) {
+	link, err := s.repo.FindLinkByToken(c, token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, customerrors.ErrExpiredLink
+		}
+		return nil, nil, err
+	}
+	err = checkLinkAvailable(link)
+	if err != nil {
+		return nil, nil, err
+	}
+	transferData, err := s.repo.FindTransferByID(c, link.TransferID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, customerrors.ErrExpiredLink
+		}
+		return nil, nil, err
+	}
+	err = checkTransferAvailable(transferData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return link, transferData, nil
+}
+
+// sharedTransfer resolves a link token of a public request to its transfer, once both
+// are available, the requester is a recipient of a private transfer and a protected
+// transfer was unlocked.
+func (s *Service) sharedTransfer(c *gin.Context, token string) (*models.Link, *models.Transfer, error) {
+	link, transferData, err := s.linkedTransfer(c, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.checkRecipientAccess(c, transferData)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.checkTransferAccess(c, transferData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return link, transferData, nil
+}
+
+// sharedFile is sharedTransfer for a file, which must belong to the link's transfer.
+func (s *Service) sharedFile(c *gin.Context, token string, fileID uuid.UUID) (*models.Link, *models.Transfer, *models.File, error) {
+	link, transferData, err := s.sharedTransfer(c, token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fileData, err := s.repo.FindFileByID(c, fileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, nil, customerrors.ErrFileNotFound
+		}
+		return nil, nil, nil, err
+	}
+	if fileData.TransferID != transferData.ID {
+		return nil, nil, nil, customerrors.ErrFileNotFound
+	}
+	return link, transferData, fileData, nil
+}
+
+// ownedLink returns a link of a transfer the user owns.
+func (s *Service) ownedLink(c context.Context, linkID uuid.UUID, userID uuid.UUID) (*models.Link, error) {
+	link, err := s.repo.FindLinkByID(c, linkID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, customerrors.ErrLinkNotFound
+		}
+		return nil, err
+	}
+	_, err = s.ownedTransfer(c, link.TransferID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// parseLinkExpiry reads a link expiry, empty and "never" follow the transfer's expiry.
+func (s *Service) parseLinkExpiry(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	expiresAt, err := expiry.Resolve(value, s.cfg.Expiry.PresetDurations(), time.Now().UTC())
+	if err != nil {
+		return nil, customerrors.ErrInvalidInput
+	}
+	return expiresAt, nil
+}
+
+// CreateLinkService adds a share link to a transfer the user owns.
+func (s *Service) CreateLinkService(c context.Context, createDTO dto.LinkCreateDTO) (*dto.LinkDTO, error) {
+	_, err := s.ownedTransfer(c, createDTO.TransferID, createDTO.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	if createDTO.MaxDownloads != nil && *createDTO.MaxDownloads < 1 {
+		return nil, customerrors.ErrInvalidInput
+	}
+	if createDTO.BytesPerSecond != nil && *createDTO.BytesPerSecond < 1 {
+		return nil, customerrors.ErrInvalidInput
+	}
+	if len(createDTO.Label) > constants.MaxLinkLabelLength {
+		return nil, customerrors.ErrInvalidInput
+	}
+	expiresAt, err := s.parseLinkExpiry(createDTO.Expiry)
+	if err != nil {
+		return nil, err
+	}
+	link, err := s.createLink(c, models.Link{
+		TransferID:     createDTO.TransferID,
+		Label:          createDTO.Label,
+		ExpiresAt:      expiresAt,
+		MaxDownloads:   createDTO.MaxDownloads,
+		BytesPerSecond: createDTO.BytesPerSecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+	linkDTO := linkToDTO(*link)
+	return &linkDTO, nil
+}
+
+// GetAllLinksService lists the share links of a transfer the user owns, oldest first.
+func (s *Service) GetAllLinksService(c context.Context, transferID uuid.UUID, userID uuid.UUID) ([]dto.LinkDTO, error) {
+	_, err := s.ownedTransfer(c, transferID, userID)
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.repo.FindAllLinksByTransferID(c, transferID)
+	if err != nil {
+		return nil, err
+	}
+	linkDTOs := make([]dto.LinkDTO, 0, len(links))
+	for _, link := range links {
+		linkDTOs = append(linkDTOs, linkToDTO(link))
+	}
+	return linkDTOs, nil
+}
+
+// UpdateLinkService changes the label, expiry, download limit, bandwidth or enabled flag of a link.
+func (s *Service) UpdateLinkService(c context.Context, updateDTO dto.LinkUpdateDTO) (*dto.LinkDTO, error) {
+	link, err := s.ownedLink(c, updateDTO.LinkID, updateDTO.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	if updateDTO.Label != nil {
+		if len(*updateDTO.Label) > constants.MaxLinkLabelLength {
+			return nil, customerrors.ErrInvalidInput
+		}
+		link.Label = *updateDTO.Label
+	}
+	if updateDTO.Expiry != nil {
+		link.ExpiresAt, err = s.parseLinkExpiry(*updateDTO.Expiry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if updateDTO.MaxDownloads != nil {
+		switch {
+		case *updateDTO.MaxDownloads == 0:
+			link.MaxDownloads = nil
+		case *updateDTO.MaxDownloads < 0:
+			return nil, customerrors.ErrInvalidInput
+		default:
+			link.MaxDownloads = updateDTO.MaxDownloads
+		}
+	}
+	if updateDTO.BytesPerSecond != nil {
+		switch {
+		case *updateDTO.BytesPerSecond == 0:
+			link.BytesPerSecond = nil
+		case *updateDTO.BytesPerSecond < 0:
+			return nil, customerrors.ErrInvalidInput
+		default:
+			link.BytesPerSecond = updateDTO.BytesPerSecond
+		}
+	}
+	if updateDTO.Enabled != nil {
+		link.Enabled = *updateDTO.Enabled
+	}
+	err = s.repo.UpdateLinkByID(c, *link)
+	if err != nil {
+		return nil, err
+	}
+	linkDTO := linkToDTO(*link)
+	return &linkDTO, nil
+}
+
+// RevokeLinkService deletes a link, its URL stops working at once. Downloads
+// already streaming through it finish.
+func (s *Service) RevokeLinkService(c context.Context, linkID uuid.UUID, userID uuid.UUID) error {
+	link, err := s.ownedLink(c, linkID, userID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteLinkByID(c, link.ID)
+}
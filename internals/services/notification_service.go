@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/models"
+	"large_fss/internals/notification"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notifications are delivered after the request that caused them, mail servers may be slow.
+const (
+	notificationTimeout   = time.Minute
+	notificationWorkers   = 4
+	notificationQueueSize = 256 // Notifications waiting for a worker before new ones are dropped
+)
+
+// notificationKinds are the notifications owners can configure, in display order.
+var notificationKinds = []string{
+	constants.NotificationFirstDownload,
+	constants.NotificationAllDownloaded,
+	constants.NotificationExpiredUnused,
+}
+
+// describeTransfer names a transfer in notifications by its message when it has one.
+func describeTransfer(transferData *models.Transfer) string {
+	if transferData.Message == "" {
+		return transferData.ID.String()
+	}
+	return fmt.Sprintf("%q (%s)", transferData.Message, transferData.ID)
+}
+
+// recordCompletedDownload marks the downloaded files and notifies the owner of the first
+// download of the transfer and of the one that completed its files.
+func (s *Service) recordCompletedDownload(ctx context.Context, transferData *models.Transfer, fileIDs []uuid.UUID) {
+	if len(fileIDs) > 0 {
+		if err := s.repo.MarkFilesDownloaded(ctx, fileIDs); err != nil {
+			log.Printf("notification service: failed to mark files of transfer %s downloaded: %v", transferData.ID, err)
+		}
+	}
+	first, err := s.repo.MarkTransferFirstDownloaded(ctx, transferData.ID)
+	if err != nil {
+		log.Printf("notification service: failed to mark transfer %s downloaded: %v", transferData.ID, err)
+	}
+	if first {
+		s.notifyOwner(transferData.OwnerID, notification.Event{
+			Kind:       constants.NotificationFirstDownload,
+			TransferID: transferData.ID,
+			Subject:    "Your transfer was downloaded",
+			Message:    fmt.Sprintf("Transfer %s was downloaded for the first time.", describeTransfer(transferData)),
+		})
+	}
+	all, err := s.repo.MarkTransferAllDownloaded(ctx, transferData.ID)
+	if err != nil {
+		log.Printf("notification service: failed to mark transfer %s fully downloaded: %v", transferData.ID, err)
+	}
+	if all {
+		s.notifyOwner(transferData.OwnerID, notification.Event{
+			Kind:       constants.NotificationAllDownloaded,
+			TransferID: transferData.ID,
+			Subject:    "All files of your transfer were downloaded",
+			Message:    fmt.Sprintf("Every file of transfer %s has been downloaded at least once.", describeTransfer(transferData)),
+		})
+	}
+}
+
+// notifyExpiredUnused tells the owner a transfer was deleted at expiry without a completed download.
+func (s *Service) notifyExpiredUnused(transferData *models.Transfer) {
+	if transferData.FirstDownloadedAt != nil || transferData.Expiry == nil || transferData.Expiry.After(time.Now()) {
+		return
+	}
+	s.notifyOwner(transferData.OwnerID, notification.Event{
+		Kind:       constants.NotificationExpiredUnused,
+		TransferID: transferData.ID,
+		Subject:    "Your transfer expired without being downloaded",
+		Message: fmt.Sprintf("Transfer %s expired on %s without being downloaded and was moved to the trash.",
+			describeTransfer(transferData), transferData.Expiry.UTC().Format(time.RFC1123)),
+	})
+}
+
+// notifyOwner queues the event for delivery to the owner.
+func (s *Service) notifyOwner(ownerID uuid.UUID, event notification.Event) {
+	s.notifications.Enqueue(fmt.Sprintf("%s of transfer %s", event.Kind, event.TransferID), func(ctx context.Context) error {
+		s.deliverToOwner(ctx, ownerID, event)
+		return nil
+	})
+}
+
+// deliverToOwner delivers the event on every channel the owner keeps on for its kind.
+func (s *Service) deliverToOwner(ctx context.Context, ownerID uuid.UUID, event notification.Event) {
+	owner, err := s.repo.FindUserById(ctx, ownerID)
+	if err != nil {
+		log.Printf("notification service: failed to find owner of transfer %s: %v", event.TransferID, err)
+		return
+	}
+	preferences, err := s.repo.FindNotificationPreferencesByUserID(ctx, ownerID)
+	if err != nil {
+		log.Printf("notification service: failed to find notification preferences of %s: %v", ownerID, err)
+		return
+	}
+	preference := preferenceFor(preferences, event.Kind)
+	for _, channel := range s.channels {
+		if !channelEnabled(preference, channel.Name()) {
+			continue
+		}
+		if err := channel.Deliver(ctx, *owner, event); err != nil {
+			log.Printf("notification service: failed to deliver %s of transfer %s by %s: %v", event.Kind, event.TransferID, channel.Name(), err)
+		}
+	}
+}
+
+// preferenceFor returns the user's preference for a kind, every channel when none was saved.
+func preferenceFor(preferences []models.NotificationPreference, kind string) dto.NotificationPreferenceDTO {
+	for _, preference := range preferences {
+		if preference.Kind == kind {
+			return dto.NotificationPreferenceDTO{Kind: kind, Email: preference.Email, InApp: preference.InApp}
+		}
+	}
+	return dto.NotificationPreferenceDTO{Kind: kind, Email: true, InApp: true}
+}
+
+// channelEnabled tells whether a preference allows a channel. Channels without a
+// setting of their own are always on.
+func channelEnabled(preference dto.NotificationPreferenceDTO, channel string) bool {
+	switch channel {
+	case notification.ChannelEmail:
+		return preference.Email
+	case notification.ChannelInApp:
+		return preference.InApp
+	default:
+		return true
+	}
+}
+
+func notificationToDTO(notification models.Notification) dto.NotificationDTO {
+	notificationDTO := dto.NotificationDTO{
+		ID:        notification.ID,
+		Kind:      notification.Kind,
+		Subject:   notification.Subject,
+		Message:   notification.Message,
+		Read:      notification.ReadAt != nil,
+		CreatedAt: notification.CreatedAt,
+	}
+	if notification.TransferID.Valid {
+		notificationDTO.TransferID = &notification.TransferID.UUID
+	}
+	return notificationDTO
+}
+
+// GetNotificationsService lists the in-app notifications of a user, newest first, with the unread count.
+func (s *Service) GetNotificationsService(c context.Context, userID uuid.UUID, unreadOnly bool, limit int, offset int) (*dto.NotificationsDTO, error) {
+	notifications, err := s.repo.FindNotificationsByUserID(c, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := s.repo.CountUnreadNotificationsByUserID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := &dto.NotificationsDTO{
+		Unread:        unread,
+		Notifications: make([]dto.NotificationDTO, 0, len(notifications)),
+	}
+	for _, notification := range notifications {
+		result.Notifications = append(result.Notifications, notificationToDTO(notification))
+	}
+	return result, nil
+}
+
+func (s *Service) MarkNotificationReadService(c context.Context, notificationID uuid.UUID, userID uuid.UUID) error {
+	err := s.repo.MarkNotificationReadByID(c, notificationID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return customerrors.ErrNotificationNotFound
+	}
+	return err
+}
+
+func (s *Service) MarkAllNotificationsReadService(c context.Context, userID uuid.UUID) error {
+	return s.repo.MarkAllNotificationsReadByUserID(c, userID)
+}
+
+// GetNotificationPreferencesService returns the user's channels for every kind of notification.
+func (s *Service) GetNotificationPreferencesService(c context.Context, userID uuid.UUID) ([]dto.NotificationPreferenceDTO, error) {
+	preferences, err := s.repo.FindNotificationPreferencesByUserID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]dto.NotificationPreferenceDTO, 0, len(notificationKinds))
+	for _, kind := range notificationKinds {
+		result = append(result, preferenceFor(preferences, kind))
+	}
+	return result, nil
+}
+
+// UpdateNotificationPreferencesService saves the channels of the kinds listed, leaving the others as they were.
+func (s *Service) UpdateNotificationPreferencesService(c context.Context, updateDTO dto.NotificationPreferencesUpdateDTO) ([]dto.NotificationPreferenceDTO, error) {
+	if len(updateDTO.Preferences) == 0 {
+		return nil, customerrors.ErrInvalidInput
+	}
+	for _, preference := range updateDTO.Preferences {
+		if !slices.Contains(notificationKinds, preference.Kind) {
+			return nil, customerrors.ErrInvalidInput
+		}
+	}
+	for _, preference := range updateDTO.Preferences {
+		err := s.repo.UpsertNotificationPreference(c, models.NotificationPreference{
+			UserID: updateDTO.UserID,
+			Kind:   preference.Kind,
+			Email:  preference.Email,
+			InApp:  preference.InApp,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.GetNotificationPreferencesService(c, updateDTO.UserID)
+}
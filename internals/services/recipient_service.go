@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/models"
+	"math/big"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recipientContextKey holds the ID of the recipient a public request was let in as.
+const recipientContextKey = "transfer_recipient_id"
+
+// normalizeEmail accepts a bare address and returns it in lower case.
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", customerrors.ErrInvalidInput
+	}
+	return strings.ToLower(email), nil
+}
+
+// loginUserID returns the signed in user of a public request, read like the
+// authorization middleware does.
+func (s *Service) loginUserID(c *gin.Context) (uuid.UUID, bool) {
+	authorization, err := c.Cookie("auth_token")
+	if err != nil || authorization == "" {
+		authorization = c.GetHeader("auth_token")
+	}
+	if authorization == "" {
+		return uuid.Nil, false
+	}
+	claims, err := s.JwtService.ValidateJWT(authorization)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	userIDStr, ok := (*claims)[constants.ClaimPrimaryKey].(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// checkRecipientAccess lets requests through to a private transfer only from its owner and
+// its recipients. Registered recipients are recognised by their login, guests by the token
+// they got for a verified code, from the transfer's cookie or the Recipient-Token header.
+func (s *Service) checkRecipientAccess(c *gin.Context, transferData *models.Transfer) error {
+	if !transferData.Private {
+		return nil
+	}
+	if userID, ok := s.loginUserID(c); ok {
+		if userID == transferData.OwnerID {
+			return nil
+		}
+		user, err := s.repo.FindUserById(c, userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err == nil {
+			recipient, err := s.repo.FindRecipientByUser(c, transferData.ID, userID, user.Email)
+			if err == nil {
+				return s.admitRecipient(c, recipient)
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+	}
+
+	token, err := c.Cookie(constants.RecipientAccessCookiePrefix + transferData.ID.String())
+	if err != nil || token == "" {
+		token = c.GetHeader(constants.RecipientAccessHeader)
+	}
+	if token == "" {
+		return customerrors.ErrRecipientRequired
+	}
+	recipientID, err := s.JwtService.ValidateRecipientAccessJWT(token, transferData.ID)
+	if err != nil {
+		return customerrors.ErrRecipientRequired
+	}
+	// Removed recipients lose access even with a token that has not expired
+	recipient, err := s.repo.FindRecipientByID(c, recipientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return customerrors.ErrRecipientRequired
+		}
+		return err
+	}
+	if recipient.TransferID != transferData.ID {
+		return customerrors.ErrRecipientRequired
+	}
+	return s.admitRecipient(c, recipient)
+}
+
+// admitRecipient records the access and remembers the recipient for the download log.
+func (s *Service) admitRecipient(c *gin.Context, recipient *models.TransferRecipient) error {
+	c.Set(recipientContextKey, recipient.ID)
+	return s.repo.UpdateRecipientLastAccessByID(c, recipient.ID)
+}
+
+// recipientOf returns the recipient a request was let in as, if any.
+func recipientOf(c *gin.Context) uuid.NullUUID {
+	value, ok := c.Get(recipientContextKey)
+	if !ok {
+		return uuid.NullUUID{}
+	}
+	recipientID, ok := value.(uuid.UUID)
+	return uuid.NullUUID{UUID: recipientID, Valid: ok}
+}
+
+// newRecipientCode returns a random numeric one-time code.
+func newRecipientCode() (string, error) {
+	limit := big.NewInt(1)
+	for i := 0; i < constants.RecipientCodeDigits; i++ {
+		limit.Mul(limit, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", fmt.Errorf("recipient code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", constants.RecipientCodeDigits, n), nil
+}
+
+// privateTransfer resolves the link token of a code request to a private transfer and
+// the recipient with the given email. The recipient is nil when the email isn't one.
+func (s *Service) privateTransfer(c context.Context, token string, email string) (*models.Transfer, *models.TransferRecipient, error) {
+	_, transferData, err := s.linkedTransfer(c, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !transferData.Private {
+		return nil, nil, customerrors.ErrInvalidInput
+	}
+	email, err = normalizeEmail(email)
+	if err != nil {
+		return nil, nil, err
+	}
+	recipient, err := s.repo.FindRecipientByEmail(c, transferData.ID, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return transferData, nil, nil
+		}
+		return nil, nil, err
+	}
+	return transferData, recipient, nil
+}
+
+// RequestRecipientCodeService emails a one-time code to a recipient of a private transfer.
+// Unknown emails and repeated requests within a minute are ignored without telling the
+// client, so the recipients of a transfer can't be probed.
+func (s *Service) RequestRecipientCodeService(c context.Context, token string, email string) error {
+	_, recipient, err := s.privateTransfer(c, token, email)
+	if err != nil || recipient == nil {
+		return err
+	}
+	now := time.Now()
+	if recipient.CodeSentAt != nil && now.Before(recipient.CodeSentAt.Add(constants.RecipientCodeResendSeconds*time.Second)) {
+		return nil
+	}
+
+	code, err := newRecipientCode()
+	if err != nil {
+		return err
+	}
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash recipient code: %w", err)
+	}
+	err = s.repo.UpdateRecipientCodeByID(c, recipient.ID, string(codeHash), now.Add(constants.RecipientCodeTTL*time.Second))
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Your code to open the shared transfer is %s. It is valid for %d minutes and can be used once.",
+		code, constants.RecipientCodeTTL/60)
+	// Sent in the background, a code that didn't arrive can be asked for again after a minute
+	s.notifications.Enqueue(fmt.Sprintf("access code of recipient %s", recipient.ID), func(ctx context.Context) error {
+		return s.notifier.Notify(ctx, models.User{Email: recipient.Email}, "Your access code", message)
+	})
+	return nil
+}
+
+// VerifyRecipientCodeService exchanges an emailed code for a token that lets the guest
+// recipient open the transfer. A code works once and is dropped after too many wrong tries.
+func (s *Service) VerifyRecipientCodeService(c context.Context, token string, email string, code string) (*dto.TransferAccessDTO, error) {
+	transferData, recipient, err := s.privateTransfer(c, token, email)
+	if err != nil {
+		return nil, err
+	}
+	if recipient == nil || recipient.CodeHash == "" {
+		return nil, customerrors.ErrInvalidCode
+	}
+	now := time.Now()
+	if recipient.CodeExpiresAt == nil || !now.Before(*recipient.CodeExpiresAt) {
+		return nil, customerrors.ErrInvalidCode
+	}
+	// The attempt is counted before the code is checked, so concurrent guesses can't
+	// get past the limit
+	attempts, err := s.repo.ClaimRecipientCodeAttemptByID(c, recipient.ID, constants.MaxRecipientCodeAttempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, customerrors.ErrInvalidCode
+		}
+		return nil, err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(recipient.CodeHash), []byte(strings.TrimSpace(code)))
+	if err != nil {
+		if attempts >= constants.MaxRecipientCodeAttempts {
+			err = s.repo.ClearRecipientCodeByID(c, recipient.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, customerrors.ErrInvalidCode
+	}
+	err = s.repo.UseRecipientCodeByID(c, recipient.ID, recipient.CodeHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, customerrors.ErrInvalidCode
+		}
+		return nil, err
+	}
+
+	expiresAt := now.Add(constants.RecipientAccessTokenTTL * time.Second)
+	accessToken, err := s.JwtService.CreateRecipientAccessJWT(transferData.ID, recipient.ID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.TransferAccessDTO{TransferID: transferData.ID, Token: accessToken, ExpiresAt: expiresAt}, nil
+}
+
+func recipientToDTO(status models.RecipientStatus) dto.RecipientDTO {
+	recipientDTO := dto.RecipientDTO{
+		ID:             status.ID,
+		Email:          status.Email,
+		Registered:     status.UserID.Valid,
+		Status:         constants.RecipientStatusInvited,
+		LastAccessAt:   status.LastAccessAt,
+		Downloads:      status.Downloads,
+		Completed:      status.Completed,
+		LastDownloadAt: status.LastDownloadAt,
+		CreatedAt:      status.CreatedAt,
+	}
+	switch {
+	case status.Completed > 0:
+		recipientDTO.Status = constants.RecipientStatusDownloaded
+	case status.LastAccessAt != nil:
+		recipientDTO.Status = constants.RecipientStatusAccessed
+	}
+	return recipientDTO
+}
+
+// AddRecipientsService adds emails and registered users as recipients of a transfer the
+// user owns. Emails of registered users are linked to them, so they can sign in instead.
+func (s *Service) AddRecipientsService(c context.Context, addDTO dto.RecipientAddDTO) ([]dto.RecipientDTO, error) {
+	_, err := s.ownedTransfer(c, addDTO.TransferID, addDTO.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	count := len(addDTO.Emails) + len(addDTO.UserIDs)
+	if count == 0 || count > constants.MaxRecipientsPerRequest {
+		return nil, customerrors.ErrInvalidInput
+	}
+
+	recipients := make([]models.TransferRecipient, 0, count)
+	for _, userID := range addDTO.UserIDs {
+		user, err := s.repo.FindUserById(c, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, customerrors.ErrUserNotFound
+			}
+			return nil, err
+		}
+		recipients = append(recipients, models.TransferRecipient{
+			Email:  strings.ToLower(user.Email),
+			UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		})
+	}
+	for _, email := range addDTO.Emails {
+		email, err := normalizeEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		recipient := models.TransferRecipient{Email: email}
+		user, err := s.repo.FindUserByEmail(c, email)
+		if err == nil {
+			recipient.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	for _, recipient := range recipients {
+		recipient.TransferID = addDTO.TransferID
+		_, err := s.repo.CreateRecipient(c, recipient)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.GetRecipientsService(c, addDTO.TransferID, addDTO.OwnerID)
+}
+
+// GetRecipientsService lists the recipients of a transfer the user owns with whether
+// they opened and downloaded it.
+func (s *Service) GetRecipientsService(c context.Context, transferID uuid.UUID, userID uuid.UUID) ([]dto.RecipientDTO, error) {
+	_, err := s.ownedTransfer(c, transferID, userID)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := s.repo.FindRecipientStatusesByTransferID(c, transferID)
+	if err != nil {
+		return nil, err
+	}
+	recipientDTOs := make([]dto.RecipientDTO, 0, len(statuses))
+	for _, status := range statuses {
+		recipientDTOs = append(recipientDTOs, recipientToDTO(status))
+	}
+	return recipientDTOs, nil
+}
+
+// RemoveRecipientService takes a recipient off a transfer the user owns. Access tokens
+// already handed to the recipient stop working with it.
+func (s *Service) RemoveRecipientService(c context.Context, recipientID uuid.UUID, userID uuid.UUID) error {
+	recipient, err := s.repo.FindRecipientByID(c, recipientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return customerrors.ErrRecipientNotFound
+		}
+		return err
+	}
+	_, err = s.ownedTransfer(c, recipient.TransferID, userID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteRecipientByID(c, recipient.ID)
+}
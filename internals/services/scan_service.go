@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"large_fss/internals/constants"
+	"large_fss/internals/models"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// scanSeverity orders scan statuses so a transfer takes its worst file's status.
+var scanSeverity = map[string]int{
+	constants.ScanStatusClean:    0,
+	constants.ScanStatusPending:  1,
+	constants.ScanStatusError:    2,
+	constants.ScanStatusInfected: 3,
+}
+
+func worseScanStatus(a string, b string) string {
+	if scanSeverity[b] > scanSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// scanTransferInBackground starts a scan without holding up the request that triggered it.
+func (s *Service) scanTransferInBackground(transferID uuid.UUID) {
+	go func() {
+		if err := s.ScanTransferService(context.Background(), transferID); err != nil {
+			log.Printf("scan service: error scanning transfer %s: %v", transferID, err)
+		}
+	}()
+}
+
+// scanRequests tracks the transfers being scanned. A scan asked for while one runs
+// can't join it, files may have been added after it listed them, so it runs again.
+type scanRequests struct {
+	mu      sync.Mutex
+	running map[uuid.UUID]bool // Whether another scan was asked for meanwhile
+}
+
+// start reports whether the caller should scan the transfer, otherwise the running
+// scan is asked to go again once it finished.
+func (r *scanRequests) start(transferID uuid.UUID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running == nil {
+		r.running = make(map[uuid.UUID]bool)
+	}
+	if _, busy := r.running[transferID]; busy {
+		r.running[transferID] = true
+		return false
+	}
+	r.running[transferID] = false
+	return true
+}
+
+// finish reports whether the scan has to run again, otherwise the transfer is released.
+func (r *scanRequests) finish(transferID uuid.UUID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running[transferID] {
+		r.running[transferID] = false
+		return true
+	}
+	delete(r.running, transferID)
+	return false
+}
+
+// ScanTransferService scans every stored file of a transfer that is not known to be clean,
+// moves infected ones to quarantine, records file and transfer scan status, makes
+// thumbnails of clean images and notifies the owner about infections.
+func (s *Service) ScanTransferService(ctx context.Context, transferID uuid.UUID) error {
+	if !s.scans.start(transferID) {
+		return nil
+	}
+	for {
+		err := s.scanTransfer(ctx, transferID)
+		if !s.scans.finish(transferID) {
+			return err
+		}
+		if err != nil {
+			log.Printf("scan service: error scanning transfer %s, scanning again: %v", transferID, err)
+		}
+	}
+}
+
+func (s *Service) scanTransfer(ctx context.Context, transferID uuid.UUID) error {
+	transferData, err := s.repo.FindTransferByID(ctx, transferID)
+	if err != nil {
+		return err
+	}
+	filesData, err := s.repo.FindAllFilesByTransferID(ctx, transferID)
+	if err != nil {
+		return err
+	}
+
+	status := constants.ScanStatusClean
+	fileByPath := make(map[string]models.File, len(filesData))
+	for _, file := range filesData {
+		fileByPath[file.FilePath] = file
+		// Quarantined files are no longer under the transfer path but keep it infected
+		if file.ScanStatus == constants.ScanStatusInfected {
+			status = constants.ScanStatusInfected
+		}
+	}
+
+	storedFiles, err := s.filestorage.ListFilesRecursive(ctx, transferData.TransferPath)
+	if err != nil {
+		return fmt.Errorf("scan service: failed to list files of transfer %s: %w", transferID, err)
+	}
+
+	var infectedNames []string
+	for _, stored := range storedFiles {
+		if stored.IsDir {
+			continue
+		}
+		fileData, registered := fileByPath[stored.Path]
+		if registered && fileData.ScanStatus == constants.ScanStatusClean {
+			continue
+		}
+
+		fileStatus, signature := s.scanStoredFile(ctx, stored.Path)
+		filePath := stored.Path
+		if fileStatus == constants.ScanStatusInfected {
+			relPath, err := filepath.Rel(transferData.TransferPath, stored.Path)
+			if err != nil {
+				return fmt.Errorf("scan service: failed to compute relative path: %w", err)
+			}
+			filePath = filepath.Join(constants.QuarantineDir, transferID.String(), relPath)
+			err = s.filestorage.Rename(ctx, stored.Path, filePath)
+			if err != nil {
+				return fmt.Errorf("scan service: failed to quarantine %s: %w", stored.Path, err)
+			}
+			log.Printf("scan service: quarantined %s of transfer %s (%s)", relPath, transferID, signature)
+			infectedNames = append(infectedNames, fmt.Sprintf("%s (%s)", relPath, signature))
+		}
+		if registered {
+			err = s.repo.UpdateFileScanStatusByID(ctx, fileData.ID, fileStatus, filePath)
+			if err != nil {
+				return err
+			}
+		}
+		status = worseScanStatus(status, fileStatus)
+	}
+
+	// Files added since the listing are still pending, the transfer then stays pending too
+	err = s.repo.UpdateTransferScanStatusByID(ctx, transferID, status)
+	if err != nil {
+		return err
+	}
+	// Only content known to be clean is decoded
+	s.createThumbnails(ctx, transferID)
+
+	if len(infectedNames) > 0 {
+		// Archives built before the scan finished may hold the quarantined files
+		err = s.invalidateArchiveCache(ctx, transferID)
+		if err != nil {
+			log.Printf("scan service: failed to invalidate archive cache of transfer %s: %v", transferID, err)
+		}
+		s.notifyInfectedTransfer(ctx, transferData, infectedNames)
+	}
+	return nil
+}
+
+// scanStoredFile returns the scan status of a single stored file and the matched signature.
+func (s *Service) scanStoredFile(ctx context.Context, path string) (string, string) {
+	reader, err := s.filestorage.ReadFile(ctx, path)
+	if err != nil {
+		log.Printf("scan service: failed to open %s: %v", path, err)
+		return constants.ScanStatusError, ""
+	}
+	defer reader.Close()
+
+	result, err := s.scanner.Scan(ctx, reader)
+	if err != nil {
+		log.Printf("scan service: failed to scan %s: %v", path, err)
+		return constants.ScanStatusError, ""
+	}
+	if result.Infected {
+		return constants.ScanStatusInfected, result.Signature
+	}
+	return constants.ScanStatusClean, ""
+}
+
+func (s *Service) notifyInfectedTransfer(ctx context.Context, transferData *models.Transfer, infectedNames []string) {
+	owner, err := s.repo.FindUserById(ctx, transferData.OwnerID)
+	if err != nil {
+		log.Printf("scan service: failed to find owner of transfer %s: %v", transferData.ID, err)
+		return
+	}
+	subject := "Malware detected in your transfer"
+	message := fmt.Sprintf("The following files of transfer %s were quarantined and can't be downloaded: %s",
+		transferData.ID, strings.Join(infectedNames, ", "))
+	s.notifications.Enqueue(fmt.Sprintf("malware notice of transfer %s", transferData.ID), func(ctx context.Context) error {
+		return s.notifier.Notify(ctx, *owner, subject, message)
+	})
+}
+
+// ScanPendingTransfersService retries transfers whose scan never finished or failed.
+func (s *Service) ScanPendingTransfersService() error {
+	ctx := context.Background()
+
+	transfers, err := s.repo.FindAllTransfersByScanStatus(ctx, []string{constants.ScanStatusPending, constants.ScanStatusError})
+	if err != nil {
+		return err
+	}
+	for _, trans := range transfers {
+		if err := s.ScanTransferService(ctx, trans.ID); err != nil {
+			log.Printf("scan pending transfers service: error scanning %s: %v", trans.ID, err)
+		}
+	}
+	return nil
+}
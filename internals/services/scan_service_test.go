@@ -0,0 +1,29 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestScanRequestsRunAgainWhenAskedMeanwhile(t *testing.T) {
+	var scans scanRequests
+	transferID := uuid.New()
+
+	if !scans.start(transferID) {
+		t.Fatal("the first scan of a transfer should run")
+	}
+	// Files appended during the scan ask for another one
+	if scans.start(transferID) || scans.start(transferID) {
+		t.Fatal("a scan must not run beside the running one")
+	}
+	if !scans.finish(transferID) {
+		t.Fatal("the running scan should go again for the requests it missed")
+	}
+	if scans.finish(transferID) {
+		t.Fatal("requests made before the second pass started are covered by it")
+	}
+	if !scans.start(transferID) {
+		t.Fatal("the transfer should be released once no scan was asked for")
+	}
+}
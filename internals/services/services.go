@@ -2,11 +2,18 @@ package services
 
 import (
 	"context"
-	"fmt"
-	"io"
+	"database/sql"
+	"errors"
+	"large_fss/internals/config"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/models"
+	"large_fss/internals/notification"
 	"large_fss/internals/repository"
+	"large_fss/internals/scanner"
 	"large_fss/internals/storage"
-	"log"
+	"large_fss/internals/throttle"
+	"large_fss/internals/urlimport"
+	"sync"
 
 	"github.com/google/uuid"
 )
@@ -15,57 +22,43 @@ type Service struct {
 	JwtService  *JWTService
 	repo        repository.DbRepository
 	filestorage storage.Storage
+	scanner     scanner.Scanner
+	notifier    notification.Notifier
+	cfg         *config.Config
+	fetcher     *urlimport.Fetcher
+	scans       scanRequests // Transfer IDs with a scan in progress
+	imports     sync.Map // Transfer ID to *importProgress of url imports
+	importSlots importSlots // Running url imports per owner
+	unlocks     unlockLimiter // Failed transfer passwords per transfer, and per transfer and client IP
+	bandwidth   *throttle.Limiter // Concurrent downloads and their bandwidth
+	channels    []notification.Channel // Where owners are notified about their transfers
+	notifications *notification.Queue   // Sends notifications off the request and cron paths
+	archiveBuilds sync.Map            // Cache keys of archives being built
 }
 
-func NewService(jwtservice *JWTService,repo repository.DbRepository, filestore storage.Storage) *Service {
-	return &Service{JwtService: jwtservice, repo: repo, filestorage: filestore}
+func NewService(jwtservice *JWTService,repo repository.DbRepository, filestore storage.Storage, filescanner scanner.Scanner, notifier notification.Notifier, fetcher *urlimport.Fetcher, cfg *config.Config) *Service {
+	bandwidth := throttle.NewLimiter(cfg.Bandwidth.GlobalBytesPerSecond, cfg.Bandwidth.MaxConcurrentDownloads)
+	channels := []notification.Channel{notification.NewEmailChannel(notifier), notification.NewInAppChannel(repo)}
+	notifications := notification.NewQueue(notificationWorkers, notificationQueueSize, notificationTimeout)
+	return &Service{JwtService: jwtservice, repo: repo, filestorage: filestore, scanner: filescanner, notifier: notifier, fetcher: fetcher, cfg: cfg, bandwidth: bandwidth, channels: channels, notifications: notifications}
 }
 
-type autoDeleteReader struct {
-	io.ReadCloser
-	path        string
-	fileStorage storage.Storage
-	ctx         context.Context
-}
-
-type autoFileReader struct {
-	io.ReadCloser
-	FileID uuid.UUID
-	ctx    context.Context
-	repo   repository.DbRepository
-}
-
-func (r *autoFileReader) Close() error {
-	readErr := r.ReadCloser.Close()
-
-	// DecrementActiveStreamByID is called after closing the stream
-	streamErr := r.repo.DecrementActiveStreamByID(r.ctx, r.FileID)
-	if streamErr != nil {
-		// Log stream decrement error, or optionally handle it
-		log.Printf("autoFileReader: error decrementing active stream: %v", streamErr)
+// ownedTransfer returns a transfer of the user, ErrExpiredLink when it is gone
+// and ErrUnauthorized when someone else owns it.
+func (s *Service) ownedTransfer(c context.Context, transferID uuid.UUID, userID uuid.UUID) (*models.Transfer, error) {
+	transferData, err := s.repo.FindTransferByID(c, transferID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, customerrors.ErrExpiredLink
+		}
+		return nil, err
 	}
-
-	// Return the error only if closing ReadCloser failed
-	if readErr != nil {
-		return fmt.Errorf("autoFileReader: close operation failed: %w", readErr)
+	if transferData.OwnerID != userID {
+		return nil, customerrors.ErrUnauthorized
 	}
-
-	return nil
-}
-
-func (r *autoDeleteReader) Close() error {
-	readErr := r.ReadCloser.Close()
-
-	// Attempt to delete the file (log or handle the error if needed)
-	delErr := r.fileStorage.DeleteFile(r.ctx, r.path)
-	if delErr != nil {
-		log.Printf("autoDeleteReader: error deleting file at %s: %v", r.path, delErr)
+	// Trashed transfers can only be restored or purged
+	if transferData.TrashedAt != nil {
+		return nil, customerrors.ErrExpiredLink
 	}
-
-	// Return readErr only if there was an actual error
-	if readErr != nil {
-		return fmt.Errorf("autoDeleteReader: close operation failed: %w", readErr)
-	}
-
-	return nil
+	return transferData, nil
 }
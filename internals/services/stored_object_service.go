@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"large_fss/internals/models"
+	"large_fss/utils"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// Leading bytes kept for content type detection, as much as the detector reads.
+const sniffHeadSize = 3072
+
+// objectDigest collects the checksum, size and leading bytes of the content written to it.
+type objectDigest struct {
+	crc  hash.Hash32
+	size int64
+	head []byte
+}
+
+func newObjectDigest() *objectDigest {
+	return &objectDigest{crc: crc32.NewIEEE()}
+}
+
+func (d *objectDigest) Write(p []byte) (int, error) {
+	d.crc.Write(p)
+	d.size += int64(len(p))
+	if missing := sniffHeadSize - len(d.head); missing > 0 {
+		d.head = append(d.head, p[:min(missing, len(p))]...)
+	}
+	return len(p), nil
+}
+
+func (d *objectDigest) object(transferID uuid.UUID, path string) models.StoredObject {
+	mimeType, err := utils.DetectContentTypeFromReader(bytes.NewReader(d.head))
+	if err != nil {
+		mimeType = ""
+	}
+	return models.StoredObject{
+		Path:       path,
+		TransferID: transferID,
+		Size:       d.size,
+		CRC32:      int64(d.crc.Sum32()),
+		MimeType:   mimeType,
+	}
+}
+
+// indexStoredFile reads a stored file to record its checksum and content type.
+func (s *Service) indexStoredFile(ctx context.Context, transferID uuid.UUID, path string) (models.StoredObject, error) {
+	reader, err := s.filestorage.ReadFile(ctx, path)
+	if err != nil {
+		return models.StoredObject{}, fmt.Errorf("stored object service:failed to open %s: %w", path, err)
+	}
+	defer reader.Close()
+
+	digest := newObjectDigest()
+	if _, err := io.Copy(digest, reader); err != nil {
+		return models.StoredObject{}, fmt.Errorf("stored object service:failed to read %s: %w", path, err)
+	}
+	object := digest.object(transferID, path)
+	if err := s.repo.UpsertStoredObject(ctx, object); err != nil {
+		return models.StoredObject{}, err
+	}
+	return object, nil
+}
+
+// indexStoredFiles records the checksums of the files under folderPath that have no
+// record yet, or whose record no longer matches their size. Archive downloads read them
+// from the records instead of hashing the files on the spot.
+func (s *Service) indexStoredFiles(ctx context.Context, transferID uuid.UUID, folderPath string) error {
+	files, err := s.filestorage.ListFilesRecursive(ctx, folderPath)
+	if err != nil {
+		return fmt.Errorf("stored object service:failed to list files of transfer %s: %w", transferID, err)
+	}
+	objects, err := s.storedObjectsFor(ctx, transferID)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir {
+			continue
+		}
+		if object, ok := objects[file.Path]; ok && object.Size == file.Size {
+			continue
+		}
+		if _, err := s.indexStoredFile(ctx, transferID, file.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storedObjectsFor returns the records of the stored files of a transfer by path.
+func (s *Service) storedObjectsFor(ctx context.Context, transferID uuid.UUID) (map[string]models.StoredObject, error) {
+	objects, err := s.repo.FindStoredObjectsByTransferID(ctx, transferID)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]models.StoredObject, len(objects))
+	for _, object := range objects {
+		byPath[object.Path] = object
+	}
+	return byPath, nil
+}
+
+// IndexStoredObjectsService records the checksums of transfers stored before they were
+// taken at assembly. Until then their archives carry the checksums after the content.
+func (s *Service) IndexStoredObjectsService() error {
+	ctx := context.Background()
+	transfers, err := s.repo.FindTransfersWithUnindexedFiles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, trans := range transfers {
+		err := s.indexStoredFiles(ctx, trans.ID, trans.TransferPath)
+		if err != nil {
+			log.Printf("index stored objects service: error indexing %s: %v", trans.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	customerrors "large_fss/internals/customErrors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Lease renewals run in the background and must not hang on a slow database.
+const streamLeaseTimeout = 10 * time.Second
+
+// leasedReader holds a stream lease on the files it reads from until it is closed.
+// The lease is renewed while data flows, so a download that stalls or whose server
+// died stops counting as active once the lease expires.
+type leasedReader struct {
+	io.ReadCloser
+	s       *Service
+	leaseID uuid.UUID
+	fileIDs []uuid.UUID
+	read    atomic.Int64 // Bytes read so far
+	cut     atomic.Bool  // Set once the lease was removed under the download
+	done    chan struct{}
+	once    sync.Once
+}
+
+// leaseStreams marks the files as being streamed through reader, all or none of them.
+// The reader is closed when the lease can't be taken.
+func (s *Service) leaseStreams(c context.Context, reader io.ReadCloser, fileIDs ...uuid.UUID) (*leasedReader, error) {
+	leaseID := uuid.New()
+	err := s.repo.CreateStreamLease(c, leaseID, fileIDs, time.Now().Add(s.cfg.Streams.LeaseTTL()))
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("lease streams: failed to lease files %v: %w", fileIDs, err)
+	}
+	leased := &leasedReader{
+		ReadCloser: reader,
+		s:          s,
+		leaseID:    leaseID,
+		fileIDs:    fileIDs,
+		done:       make(chan struct{}),
+	}
+	go leased.heartbeat()
+	return leased, nil
+}
+
+func (r *leasedReader) Read(p []byte) (int, error) {
+	if r.cut.Load() {
+		return 0, customerrors.ErrStreamCut
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.read.Add(int64(n))
+	return n, err
+}
+
+// heartbeat renews the lease a few times per TTL as long as the download made progress.
+func (r *leasedReader) heartbeat() {
+	ttl := r.s.cfg.Streams.LeaseTTL()
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	var renewedAt int64
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+		read := r.read.Load()
+		if read == renewedAt {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), streamLeaseTimeout)
+		err := r.s.repo.RenewStreamLease(ctx, r.leaseID, time.Now().Add(ttl))
+		if errors.Is(err, sql.ErrNoRows) {
+			// The lease lapsed during a stall and was purged, or purging deleted the files
+			// past the forced-deletion deadline. Only the former can lease them again.
+			err = r.s.repo.CreateStreamLease(ctx, r.leaseID, r.fileIDs, time.Now().Add(ttl))
+			if err != nil {
+				cancel()
+				log.Printf("leased reader: cutting stream of lease %s: %v", r.leaseID, err)
+				r.cut.Store(true)
+				return
+			}
+		}
+		cancel()
+		if err != nil {
+			log.Printf("leased reader: failed to renew stream lease %s: %v", r.leaseID, err)
+			continue
+		}
+		renewedAt = read
+	}
+}
+
+func (r *leasedReader) Close() error {
+	readErr := r.ReadCloser.Close()
+	r.once.Do(func() {
+		close(r.done)
+		ctx, cancel := context.WithTimeout(context.Background(), streamLeaseTimeout)
+		defer cancel()
+		if err := r.s.repo.DeleteStreamLease(ctx, r.leaseID); err != nil {
+			log.Printf("leased reader: failed to release stream lease %s: %v", r.leaseID, err)
+		}
+	})
+	if readErr != nil {
+		return fmt.Errorf("leased reader: close operation failed: %w", readErr)
+	}
+	return nil
+}
+
+// leasedSeekReader is a leasedReader, possibly throttled, over seekable content, as range
+// requests need. Reads go through the wrappers, seeks straight to the content.
+type leasedSeekReader struct {
+	io.ReadCloser
+	seeker io.Seeker
+}
+
+func (r *leasedSeekReader) Seek(offset int64, whence int) (int64, error) {
+	return r.seeker.Seek(offset, whence)
+}
+
+// checkNoActiveStreams returns ErrActiveStreams while any file of the transfer holds an unexpired lease.
+func (s *Service) checkNoActiveStreams(c context.Context, transferID uuid.UUID) error {
+	active, err := s.repo.CountActiveStreamsByTransferID(c, transferID)
+	if err != nil {
+		return err
+	}
+	if active > 0 {
+		return customerrors.ErrActiveStreams
+	}
+	return nil
+}
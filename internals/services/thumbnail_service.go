@@ -0,0 +1,91 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/models"
+	"large_fss/internals/thumbnail"
+	"log"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func thumbnailPath(transferID uuid.UUID, fileID uuid.UUID) string {
+	return filepath.Join(constants.ThumbnailDir, transferID.String(), fileID.String()+".jpg")
+}
+
+// createThumbnail stores a thumbnail of an image file and records it on the file.
+// Files that aren't supported images are left without one.
+func (s *Service) createThumbnail(ctx context.Context, fileData models.File) error {
+	if !thumbnail.Supported(fileData.MimeType) || fileData.ThumbnailPath != "" {
+		return nil
+	}
+	reader, err := s.filestorage.ReadFile(ctx, fileData.FilePath)
+	if err != nil {
+		return fmt.Errorf("thumbnail service:failed to open %s: %w", fileData.FilePath, err)
+	}
+	defer reader.Close()
+	content, err := thumbnail.Generate(reader)
+	if err != nil {
+		return err
+	}
+
+	destPath := thumbnailPath(fileData.TransferID, fileData.ID)
+	err = s.filestorage.CreateFolder(ctx, filepath.Dir(destPath))
+	if err != nil {
+		return fmt.Errorf("thumbnail service:failed to create folder for %s: %w", destPath, err)
+	}
+	writer, err := s.filestorage.WriteFile(ctx, destPath)
+	if err != nil {
+		return fmt.Errorf("thumbnail service:failed to create %s: %w", destPath, err)
+	}
+	_, err = io.Copy(writer, bytes.NewReader(content))
+	closeErr := writer.Close()
+	if err != nil {
+		return fmt.Errorf("thumbnail service:failed to write %s: %w", destPath, err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("thumbnail service:failed to close %s: %w", destPath, closeErr)
+	}
+	return s.repo.UpdateFileThumbnailPathByID(ctx, fileData.ID, destPath)
+}
+
+// createThumbnails makes the thumbnails of the clean image files of a transfer,
+// a file that can't be decoded only goes without a thumbnail.
+func (s *Service) createThumbnails(ctx context.Context, transferID uuid.UUID) {
+	filesData, err := s.repo.FindAllFilesByTransferID(ctx, transferID)
+	if err != nil {
+		log.Printf("thumbnail service: failed to list files of transfer %s: %v", transferID, err)
+		return
+	}
+	for _, file := range filesData {
+		if file.ScanStatus != constants.ScanStatusClean {
+			continue
+		}
+		if err := s.createThumbnail(ctx, file); err != nil {
+			log.Printf("thumbnail service: no thumbnail for %s of transfer %s: %v", file.FileName, transferID, err)
+		}
+	}
+}
+
+// ThumbnailService opens the thumbnail of a shared file, ErrFileNotFound when it has none.
+func (s *Service) ThumbnailService(c *gin.Context, token string, fileID uuid.UUID) (io.ReadCloser, error) {
+	_, _, fileData, err := s.sharedFile(c, token, fileID)
+	if err != nil {
+		return nil, err
+	}
+	err = checkScanStatus(fileData.ScanStatus)
+	if err != nil {
+		return nil, err
+	}
+	if fileData.ThumbnailPath == "" {
+		return nil, customerrors.ErrFileNotFound
+	}
+	return s.filestorage.ReadFile(c, fileData.ThumbnailPath)
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// transferCursor is what a next_cursor holds. The sort it was made for is kept so a
+// cursor can't be replayed against a different order.
+type transferCursor struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d"`
+	Value      string    `json:"v"`
+	ID         uuid.UUID `json:"id"`
+}
+
+// transferFilterFor checks a listing query and turns it into a repository filter.
+func transferFilterFor(query dto.TransferListQueryDTO) (models.TransferFilter, error) {
+	filter := models.TransferFilter{
+		OwnerID:       query.OwnerID,
+		Status:        query.Status,
+		MinSize:       query.MinSize,
+		MaxSize:       query.MaxSize,
+		CreatedAfter:  query.CreatedAfter,
+		CreatedBefore: query.CreatedBefore,
+		Sort:          query.Sort,
+		Limit:         query.Limit,
+	}
+	switch query.Status {
+	case "", constants.TransferStatusActive, constants.TransferStatusExpired, constants.TransferStatusNever,
+		constants.TransferStatusTrashed:
+	default:
+		return models.TransferFilter{}, customerrors.ErrInvalidInput
+	}
+	switch query.Sort {
+	case "":
+		filter.Sort = constants.TransferSortCreatedAt
+	case constants.TransferSortCreatedAt, constants.TransferSortSize, constants.TransferSortExpiry:
+	default:
+		return models.TransferFilter{}, customerrors.ErrInvalidInput
+	}
+	switch query.Order {
+	case "", "desc":
+		filter.Descending = true
+	case "asc":
+	default:
+		return models.TransferFilter{}, customerrors.ErrInvalidInput
+	}
+	if query.Limit < 1 || query.Limit > constants.MaxTransfersLimit {
+		return models.TransferFilter{}, customerrors.ErrInvalidInput
+	}
+	if query.MinSize != nil && *query.MinSize < 0 || query.MaxSize != nil && *query.MaxSize < 0 {
+		return models.TransferFilter{}, customerrors.ErrInvalidInput
+	}
+	if query.MinSize != nil && query.MaxSize != nil && *query.MinSize > *query.MaxSize {
+		return models.TransferFilter{}, customerrors.ErrInvalidInput
+	}
+	if query.CreatedAfter != nil && query.CreatedBefore != nil && !query.CreatedAfter.Before(*query.CreatedBefore) {
+		return models.TransferFilter{}, customerrors.ErrInvalidInput
+	}
+	if query.Search != "" {
+		filter.Search = searchQuery(query.Search)
+		if filter.Search == "" {
+			return models.TransferFilter{}, customerrors.ErrInvalidInput
+		}
+	}
+	if query.Cursor != "" {
+		after, err := decodeTransferCursor(query.Cursor, filter)
+		if err != nil {
+			return models.TransferFilter{}, err
+		}
+		filter.After = after
+	}
+	return filter, nil
+}
+
+// searchQuery turns free text into a tsquery matching every word as a prefix. Only
+// letters and digits are kept, the same way names are split when they are indexed.
+func searchQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = strings.ToLower(word) + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// encodeTransferCursor returns the cursor of the page following the given transfer.
+func encodeTransferCursor(filter models.TransferFilter, last models.Transfer) string {
+	cursor := transferCursor{Sort: filter.Sort, Descending: filter.Descending, ID: last.ID}
+	switch filter.Sort {
+	case constants.TransferSortSize:
+		cursor.Value = strconv.FormatInt(last.Size, 10)
+	case constants.TransferSortExpiry:
+		cursor.Value = "infinity"
+		if last.Expiry != nil {
+			cursor.Value = last.Expiry.Format(time.RFC3339Nano)
+		}
+	default:
+		cursor.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	}
+	payload, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeTransferCursor(encoded string, filter models.TransferFilter) (*models.TransferCursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, customerrors.ErrInvalidInput
+	}
+	var cursor transferCursor
+	err = json.Unmarshal(payload, &cursor)
+	if err != nil || cursor.Sort != filter.Sort || cursor.Descending != filter.Descending {
+		return nil, customerrors.ErrInvalidInput
+	}
+	// The value ends up in the query, it has to parse as what the sort compares
+	switch {
+	case cursor.Sort == constants.TransferSortSize:
+		_, err = strconv.ParseInt(cursor.Value, 10, 64)
+	case cursor.Sort == constants.TransferSortExpiry && cursor.Value == "infinity":
+	default:
+		_, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	}
+	if err != nil {
+		return nil, customerrors.ErrInvalidInput
+	}
+	return &models.TransferCursor{Value: cursor.Value, ID: cursor.ID}, nil
+}
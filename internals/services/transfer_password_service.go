@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/models"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// unlockLimiter counts failed transfer passwords per transfer and client IP.
+type unlockLimiter struct {
+	mu       sync.Mutex
+	failures map[string]*unlockFailures
+}
+
+type unlockFailures struct {
+	count   int
+	resetAt time.Time // End of the window the failures were counted in
+}
+
+// attempt counts an unlock attempt of the transfer from the client up front, returning
+// how long it is still locked out instead when the attempts of the client, or of the
+// transfer from any address, ran out. 0 means it may try. Checking and counting under
+// one lock keeps concurrent guesses from slipping past the limits.
+func (l *unlockLimiter) attempt(transferKey string, client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failures == nil {
+		l.failures = make(map[string]*unlockFailures)
+	}
+	// Forget windows that ended so the map only holds recent failures
+	for k, entry := range l.failures {
+		if !now.Before(entry.resetAt) {
+			delete(l.failures, k)
+		}
+	}
+	// The client's address may be spoofed or rotated, the transfer's count can't be
+	transferEntry := l.entry(transferKey, now)
+	clientEntry := l.entry(transferKey+"|"+client, now)
+	var wait time.Duration
+	if transferEntry.count >= constants.MaxTransferUnlockAttempts {
+		wait = transferEntry.resetAt.Sub(now)
+	}
+	if clientEntry.count >= constants.MaxFailedUnlockAttempts {
+		wait = max(wait, clientEntry.resetAt.Sub(now))
+	}
+	if wait > 0 {
+		return wait
+	}
+	transferEntry.count++
+	clientEntry.count++
+	return 0
+}
+
+// entry returns the failures counted for the key, starting a window when there are none.
+func (l *unlockLimiter) entry(key string, now time.Time) *unlockFailures {
+	entry, ok := l.failures[key]
+	if !ok {
+		entry = &unlockFailures{resetAt: now.Add(constants.UnlockLockoutSeconds * time.Second)}
+		l.failures[key] = entry
+	}
+	return entry
+}
+
+// succeeded clears the client's failures, the attempt that got the password right
+// doesn't count against the transfer either.
+func (l *unlockLimiter) succeeded(transferKey string, client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, transferKey+"|"+client)
+	if entry, ok := l.failures[transferKey]; ok && entry.count > 0 {
+		entry.count--
+	}
+}
+
+// hashTransferPassword returns the bcrypt hash stored for a transfer password.
+func hashTransferPassword(password string) (string, error) {
+	if password == "" || len(password) > constants.MaxTransferPasswordLength {
+		return "", customerrors.ErrInvalidInput
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash transfer password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// passwordPrint identifies the current password of a transfer inside its access tokens.
+// Every hash has its own salt, so setting a password again revokes the old tokens.
+func passwordPrint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// UnlockTransferService exchanges the password of a transfer for a short-lived access token.
+// Failed attempts are limited per transfer and client IP.
+func (s *Service) UnlockTransferService(c *gin.Context, token string, password string) (*dto.TransferAccessDTO, error) {
+	_, transferData, err := s.linkedTransfer(c, token)
+	if err != nil {
+		return nil, err
+	}
+	// Attempts count per transfer, so several links of it don't multiply the tries
+	transferKey := transferData.ID.String()
+	now := time.Now()
+	// Only recipients get to try the password of a private transfer
+	err = s.checkRecipientAccess(c, transferData)
+	if err != nil {
+		return nil, err
+	}
+	if transferData.PasswordHash == "" {
+		return nil, customerrors.ErrInvalidInput
+	}
+	// Every attempt counts before the compare, a correct password clears the count again
+	if wait := s.unlocks.attempt(transferKey, c.ClientIP(), now); wait > 0 {
+		return nil, &customerrors.TooManyAttemptsError{RetryAfter: wait}
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(transferData.PasswordHash), []byte(password))
+	if err != nil {
+		return nil, customerrors.ErrInvalidPassword
+	}
+	s.unlocks.succeeded(transferKey, c.ClientIP())
+
+	expiresAt := now.Add(constants.TransferAccessTokenTTL * time.Second)
+	accessToken, err := s.JwtService.CreateTransferAccessJWT(transferData.ID, passwordPrint(transferData.PasswordHash), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.TransferAccessDTO{TransferID: transferData.ID, Token: accessToken, ExpiresAt: expiresAt}, nil
+}
+
+// checkTransferAccess lets requests through to a password protected transfer only with a
+// valid access token, taken from the transfer's cookie or the Transfer-Token header.
+func (s *Service) checkTransferAccess(c *gin.Context, transferData *models.Transfer) error {
+	if transferData.PasswordHash == "" {
+		return nil
+	}
+	token, err := c.Cookie(constants.TransferAccessCookiePrefix + transferData.ID.String())
+	if err != nil || token == "" {
+		token = c.GetHeader(constants.TransferAccessHeader)
+	}
+	if token == "" {
+		return customerrors.ErrPasswordRequired
+	}
+	if s.JwtService.ValidateTransferAccessJWT(token, transferData.ID, passwordPrint(transferData.PasswordHash)) != nil {
+		return customerrors.ErrPasswordRequired
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"fmt"
+	"large_fss/internals/constants"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUnlockLimiterCountsConcurrentAttempts(t *testing.T) {
+	var limiter unlockLimiter
+	now := time.Now()
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4*constants.MaxFailedUnlockAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.attempt("transfer", "10.0.0.1", now) == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := int(allowed.Load()); got != constants.MaxFailedUnlockAttempts {
+		t.Fatalf("expected %d attempts to be let through, got %d", constants.MaxFailedUnlockAttempts, got)
+	}
+
+	// The window ending or a correct password opens the client again
+	if wait := limiter.attempt("transfer", "10.0.0.1", now.Add(constants.UnlockLockoutSeconds*time.Second)); wait != 0 {
+		t.Fatalf("expected the ended window to be forgotten, locked for %s", wait)
+	}
+	limiter.succeeded("transfer", "10.0.0.1")
+	if wait := limiter.attempt("transfer", "10.0.0.1", now); wait != 0 {
+		t.Fatalf("expected the client to try again after the right password, locked for %s", wait)
+	}
+}
+
+func TestUnlockLimiterCapsTransferAcrossAddresses(t *testing.T) {
+	var limiter unlockLimiter
+	now := time.Now()
+
+	// A new address per guess gets no further than the transfer's own limit
+	allowed := 0
+	for i := 0; i < 4*constants.MaxTransferUnlockAttempts; i++ {
+		if limiter.attempt("transfer", fmt.Sprintf("10.0.%d.%d", i/256, i%256), now) == 0 {
+			allowed++
+		}
+	}
+	if allowed != constants.MaxTransferUnlockAttempts {
+		t.Fatalf("expected %d attempts to be let through, got %d", constants.MaxTransferUnlockAttempts, allowed)
+	}
+	if wait := limiter.attempt("other transfer", "10.0.0.1", now); wait != 0 {
+		t.Fatalf("another transfer must not be locked, locked for %s", wait)
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/models"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// trashTransfer moves a transfer to the trash. Its files stay where they are, so running
+// downloads go on, but links stop working until the owner restores it.
+func (s *Service) trashTransfer(c context.Context, transferID uuid.UUID) (*models.Transfer, error) {
+	transferData, err := s.repo.TrashTransferByID(c, transferID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, customerrors.ErrExpiredLink
+		}
+		return nil, err
+	}
+	// Cached archives only take space while nobody can download them
+	if err := s.invalidateArchiveCache(c, transferID); err != nil {
+		log.Printf("trash transfer: failed to drop cached archives of %s: %v", transferID, err)
+	}
+	return transferData, nil
+}
+
+// purgeAt is when a trashed transfer is deleted for good.
+func (s *Service) purgeAt(transferData *models.Transfer) *time.Time {
+	if transferData.TrashedAt == nil {
+		return nil
+	}
+	at := transferData.TrashedAt.Add(s.cfg.Trash.Retention())
+	return &at
+}
+
+// trashedTransfer returns a transfer of the user that is in the trash and not due for purging.
+func (s *Service) trashedTransfer(c context.Context, transferID uuid.UUID, userID uuid.UUID) (*models.Transfer, error) {
+	transferData, err := s.repo.FindTransferByID(c, transferID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, customerrors.ErrExpiredLink
+		}
+		return nil, err
+	}
+	if transferData.OwnerID != userID {
+		return nil, customerrors.ErrUnauthorized
+	}
+	if transferData.TrashedAt == nil {
+		return nil, customerrors.ErrNotInTrash
+	}
+	if s.purgeAt(transferData).Before(time.Now()) {
+		return nil, customerrors.ErrExpiredLink
+	}
+	return transferData, nil
+}
+
+// RestoreTransferService takes a transfer out of the trash. Its links work again once it
+// has time and downloads left.
+func (s *Service) RestoreTransferService(c context.Context, restoreDTO dto.TransferRestoreDTO) error {
+	transferData, err := s.trashedTransfer(c, restoreDTO.TransferID, restoreDTO.OwnerID)
+	if err != nil {
+		return err
+	}
+	if restoreDTO.Expiry != "" {
+		transferData.Expiry, err = s.transferExpiry(c, transferData.OwnerID, restoreDTO.Expiry)
+		if err != nil {
+			return err
+		}
+	}
+	if restoreDTO.MaxDownloads != nil {
+		switch {
+		case *restoreDTO.MaxDownloads == 0:
+			transferData.MaxDownloads = nil
+		case *restoreDTO.MaxDownloads < 0:
+			return customerrors.ErrInvalidInput
+		default:
+			transferData.MaxDownloads = restoreDTO.MaxDownloads
+		}
+	}
+	// Cleanup would trash it again within the hour
+	if transferData.Expiry != nil && transferData.Expiry.Before(time.Now()) {
+		return customerrors.ErrExpiryNotAllowed
+	}
+	if transferData.MaxDownloads != nil && transferData.DownloadCount >= *transferData.MaxDownloads {
+		return customerrors.ErrDownloadLimitReached
+	}
+	err = s.repo.RestoreTransferByID(c, *transferData)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return customerrors.ErrNotInTrash
+		}
+		return err
+	}
+	return nil
+}
+
+// PurgeTransferService deletes a trashed transfer for good before its retention ends.
+func (s *Service) PurgeTransferService(c context.Context, transferID uuid.UUID, userID uuid.UUID) error {
+	transferData, err := s.trashedTransfer(c, transferID, userID)
+	if err != nil {
+		return err
+	}
+	err = s.checkNoActiveStreams(c, transferData.ID)
+	if err != nil {
+		return err
+	}
+	return s.removeTransfer(c, transferData)
+}
+
+// PurgeTrashService deletes transfers whose trash retention ended once nothing streams
+// from them. Past the forced-deletion deadline they are deleted anyway, which drops the
+// leases of their downloads and cuts them at their next renewal.
+func (s *Service) PurgeTrashService() error {
+	ctx := context.Background()
+	trashed, err := s.repo.FindTrashedTransfersBefore(ctx, time.Now().Add(-s.cfg.Trash.Retention()))
+	if err != nil {
+		return err
+	}
+	for _, trans := range trashed {
+		err := s.checkNoActiveStreams(ctx, trans.ID)
+		if errors.Is(err, customerrors.ErrActiveStreams) {
+			if time.Since(*s.purgeAt(&trans)) < s.cfg.Streams.ForcedDeletionAfter() {
+				continue
+			}
+			log.Printf("purge trash service: forcing deletion of %s with active streams", trans.ID)
+		} else if err != nil {
+			log.Printf("purge trash service: error in checking streams of %s: %v", trans.ID, err)
+			continue
+		}
+		err = s.removeTransfer(ctx, &trans)
+		if err != nil {
+			log.Printf("purge trash service: error in deleting %s: %v", trans.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"large_fss/internals/constants"
+	"large_fss/internals/dto"
+	"large_fss/internals/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GetUploadSessionsService lists the user's uploads that were not assembled yet, so a
+// client that lost its local state can resume or cancel them.
+func (s *Service) GetUploadSessionsService(c context.Context, userID uuid.UUID) ([]dto.UploadSessionDTO, error) {
+	sessions, err := s.repo.FindUploadSessionsByOwnerID(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessionDTOs := make([]dto.UploadSessionDTO, 0, len(sessions))
+	for _, session := range sessions {
+		sessionDTOs = append(sessionDTOs, s.uploadSessionToDTO(session))
+	}
+	return sessionDTOs, nil
+}
+
+func (s *Service) uploadSessionToDTO(session models.UploadSession) dto.UploadSessionDTO {
+	// The cleanup runs hourly and removes sessions idle for longer than this
+	cleanupAt := session.LastUpdated.Add(constants.MaxhoursUploadSessionValid * time.Hour)
+	sessionDTO := dto.UploadSessionDTO{
+		TransferID:       session.ID,
+		Source:           constants.UploadSourceUpload,
+		Message:          session.Message,
+		DeclaredSize:     session.Size,
+		StoreAsIs:        session.StoreAsIs,
+		FileName:         session.FileName,
+		UploadedChunks:   session.UploadedChunks,
+		BytesReceived:    session.ReceivedBytes,
+		CreatedAt:        session.CreatedAt,
+		LastActivityAt:   session.LastUpdated,
+		CleanupAt:        cleanupAt,
+		CleanupInSeconds: max(int64(time.Until(cleanupAt).Seconds()), 0),
+	}
+	if session.Append {
+		sessionDTO.Source = constants.UploadSourceAppend
+	}
+
+	// Imports are downloaded by the server, the client can only follow them. Their row
+	// outlives a restart, when the live progress is gone and the import failed.
+	if session.URLImport {
+		sessionDTO.Source = constants.UploadSourceImport
+		sessionDTO.StatusURL = constants.ImportStatusURLPrefix + session.ID.String()
+		if value, ok := s.imports.Load(session.ID); ok {
+			sessionDTO.BytesReceived = value.(*importProgress).snapshot(session.ID).BytesReceived
+		}
+		return sessionDTO
+	}
+
+	indexes := session.ChunkIndexes
+	nextIndex := 0
+	for _, index := range indexes {
+		if index != nextIndex {
+			break
+		}
+		nextIndex++
+	}
+	sessionDTO.Resume = &dto.UploadResumeDTO{
+		UploadID:        session.ID,
+		UploadURL:       constants.UploadChunkURL,
+		AssembleURL:     constants.AssembleURL,
+		CancelURL:       constants.CancelUploadURL,
+		ChunkSize:       constants.MaxChunkSize,
+		UploadedIndexes: append([]int{}, indexes...),
+		NextIndex:       nextIndex,
+	}
+	return sessionDTO
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/models"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	importBufferSize        = 256 * 1024
+	importTouchInterval     = time.Minute        // Keeps the upload session from being cleaned up as failed
+	importProgressRetention = time.Hour          // How long a finished import keeps its live status in memory
+	importRecordRetention   = 7 * 24 * time.Hour // How long the outcome of an import can be asked for
+	importSaveTimeout       = 10 * time.Second
+	defaultImportFileName   = "download"
+)
+
+// importProgress is the live state of a background url import.
+type importProgress struct {
+	mu            sync.Mutex
+	ownerID       uuid.UUID
+	status        string
+	bytesReceived int64
+	totalBytes    int64
+	errMessage    string
+	finishedAt    time.Time
+	cancel        context.CancelFunc
+}
+
+func (p *importProgress) addReceived(n int64) {
+	p.mu.Lock()
+	p.bytesReceived += n
+	p.mu.Unlock()
+}
+
+func (p *importProgress) setStatus(status string) {
+	p.mu.Lock()
+	p.status = status
+	p.mu.Unlock()
+}
+
+func (p *importProgress) finish(status string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = status
+	p.finishedAt = time.Now()
+	if err != nil {
+		p.errMessage = importErrorMessage(err)
+	}
+}
+
+// record is the state to save of the import of transferID.
+func (p *importProgress) record(transferID uuid.UUID) models.URLImport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	record := models.URLImport{
+		TransferID:    transferID,
+		OwnerID:       p.ownerID,
+		Status:        p.status,
+		BytesReceived: p.bytesReceived,
+		TotalBytes:    p.totalBytes,
+		ErrorMessage:  p.errMessage,
+	}
+	if !p.finishedAt.IsZero() {
+		finishedAt := p.finishedAt
+		record.FinishedAt = &finishedAt
+	}
+	return record
+}
+
+func (p *importProgress) snapshot(transferID uuid.UUID) dto.ImportStatusDTO {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return dto.ImportStatusDTO{
+		TransferID:    transferID,
+		Status:        p.status,
+		BytesReceived: p.bytesReceived,
+		TotalBytes:    p.totalBytes,
+		Error:         p.errMessage,
+	}
+}
+
+// importSlots counts the running imports of each owner. Every import holds a connection,
+// a goroutine and chunks in storage, so an owner may only run a few at once.
+type importSlots struct {
+	mu      sync.Mutex
+	running map[uuid.UUID]int
+}
+
+// acquire takes a slot of the owner, false when they already run max imports. 0 means no limit.
+func (l *importSlots) acquire(ownerID uuid.UUID, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running == nil {
+		l.running = make(map[uuid.UUID]int)
+	}
+	if max > 0 && l.running[ownerID] >= max {
+		return false
+	}
+	l.running[ownerID]++
+	return true
+}
+
+func (l *importSlots) release(ownerID uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running[ownerID]--
+	if l.running[ownerID] <= 0 {
+		delete(l.running, ownerID)
+	}
+}
+
+// importErrorMessage only reveals errors meant for the user.
+func importErrorMessage(err error) string {
+	for _, known := range []error{
+		customerrors.ErrURLNotAllowed,
+		customerrors.ErrRemoteFetchFailed,
+		customerrors.ErrImportInterrupted,
+		customerrors.ErrImportCancelled,
+		customerrors.LimitExceeded,
+		customerrors.ErrUnsupportedArchive,
+		customerrors.ErrArchiveLimitExceeded,
+		customerrors.ErrFileTypeNotAllowed,
+	} {
+		if errors.Is(err, known) {
+			return err.Error()
+		}
+	}
+	return customerrors.ErrInternalServer.Error()
+}
+
+// ImportTransferService opens the remote resource and, once the server answered, streams it
+// into the upload session in the background. The returned ID is the future transfer ID.
+func (s *Service) ImportTransferService(c context.Context, importRequest dto.TransferImportDTO) (uuid.UUID, error) {
+	owner, err := s.repo.FindUserById(c, importRequest.OwnerID)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	quota := s.cfg.QuotaForPlan(owner.Plan)
+	if importRequest.MaxDownloads != nil && *importRequest.MaxDownloads < 1 {
+		return uuid.UUID{}, customerrors.ErrInvalidInput
+	}
+	expiresAt, err := s.expiryForUser(owner, importRequest.Expiry)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	var passwordHash string
+	if importRequest.Password != "" {
+		passwordHash, err = hashTransferPassword(importRequest.Password)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+	}
+
+	var fileName string
+	if importRequest.FileName != "" {
+		fileName, err = storedFileName(importRequest.FileName)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+	}
+
+	if !s.importSlots.acquire(owner.ID, s.cfg.URLImport.MaxConcurrentPerOwner) {
+		return uuid.UUID{}, customerrors.ErrTooManyImports
+	}
+	// The slot is handed to the background import once it started
+	started := false
+	defer func() {
+		if !started {
+			s.importSlots.release(owner.ID)
+		}
+	}()
+
+	// The body outlives the request, so the download gets its own context
+	ctx, cancel := context.WithCancel(context.Background())
+	remote, err := s.fetcher.Open(ctx, importRequest.URL)
+	if err != nil {
+		cancel()
+		return uuid.UUID{}, err
+	}
+	if remote.Size > quota {
+		remote.Body.Close()
+		cancel()
+		return uuid.UUID{}, customerrors.LimitExceeded
+	}
+	if fileName == "" {
+		fileName, err = storedFileName(remote.FileName)
+		if err != nil {
+			fileName = defaultImportFileName
+		}
+	}
+
+	tempTransfer := models.TempTransfer{
+		OwnerID:      importRequest.OwnerID,
+		Message:      importRequest.Message,
+		Expiry:       expiresAt,
+		ExpiryValue:  importRequest.Expiry,
+		Size:         max(remote.Size, 0),
+		StoreAsIs:    !importRequest.Extract,
+		FileName:     fileName,
+		MaxDownloads: importRequest.MaxDownloads,
+		PasswordHash: passwordHash,
+	}
+	transferID, err := s.repo.CreateTempTransfer(c, tempTransfer)
+	if err != nil {
+		remote.Body.Close()
+		cancel()
+		return uuid.UUID{}, err
+	}
+
+	progress := &importProgress{
+		ownerID:    importRequest.OwnerID,
+		status:     constants.ImportStatusDownloading,
+		totalBytes: remote.Size,
+		cancel:     cancel,
+	}
+	err = s.repo.CreateURLImport(c, progress.record(transferID))
+	if err != nil {
+		remote.Body.Close()
+		cancel()
+		if cleanupErr := s.repo.DeleteTempTransferByID(context.Background(), transferID); cleanupErr != nil {
+			log.Printf("url import service: failed to delete upload session %s: %v", transferID, cleanupErr)
+		}
+		return uuid.UUID{}, err
+	}
+	s.imports.Store(transferID, progress)
+	started = true
+	go s.runImport(ctx, transferID, importRequest.OwnerID, remote.Body, quota, progress)
+	return transferID, nil
+}
+
+// runImport downloads the remote body as the upload's only chunk and assembles it
+// like a regular upload. A failed download leaves nothing behind.
+func (s *Service) runImport(ctx context.Context, transferID uuid.UUID, ownerID uuid.UUID, body io.ReadCloser, quota int64, progress *importProgress) {
+	defer s.importSlots.release(ownerID)
+	defer progress.cancel()
+	defer body.Close()
+
+	chunkPath := filepath.Join(constants.ChunkDir, transferID.String())
+	received, err := s.downloadImport(ctx, transferID, body, chunkPath, quota, progress)
+	// A cancel that came in as the download ended must not be assembled anyway
+	if ctx.Err() != nil {
+		err = customerrors.ErrImportCancelled
+	}
+	if err != nil {
+		log.Printf("url import service: download for transfer %s failed: %v", transferID, err)
+		if cleanupErr := s.filestorage.DeleteAll(context.Background(), chunkPath); cleanupErr != nil {
+			log.Printf("url import service: failed to delete %s: %v", chunkPath, cleanupErr)
+		}
+		if cleanupErr := s.repo.DeleteTempTransferByID(context.Background(), transferID); cleanupErr != nil {
+			log.Printf("url import service: failed to delete upload session %s: %v", transferID, cleanupErr)
+		}
+		progress.finish(constants.ImportStatusFailed, err)
+		s.saveImport(transferID, progress)
+		return
+	}
+
+	progress.setStatus(constants.ImportStatusAssembling)
+	s.saveImport(transferID, progress)
+	err = s.repo.UpdateTempTransferSizeByID(context.Background(), transferID, received)
+	if err == nil {
+		_, err = s.AssembleFileService(context.Background(), dto.FileAssembleDTO{ID: transferID, OwnerID: ownerID})
+	}
+	if err != nil {
+		log.Printf("url import service: assembling transfer %s failed: %v", transferID, err)
+		progress.finish(constants.ImportStatusFailed, err)
+		s.saveImport(transferID, progress)
+		return
+	}
+	progress.finish(constants.ImportStatusCompleted, nil)
+	s.saveImport(transferID, progress)
+}
+
+// saveImport writes the progress of an import, so its status outlives the live one.
+func (s *Service) saveImport(transferID uuid.UUID, progress *importProgress) {
+	ctx, cancel := context.WithTimeout(context.Background(), importSaveTimeout)
+	defer cancel()
+	if err := s.repo.UpdateURLImport(ctx, progress.record(transferID)); err != nil {
+		log.Printf("url import service: failed to save progress of %s: %v", transferID, err)
+	}
+}
+
+// downloadImport copies the body into a single chunk file, never storing more than the quota.
+func (s *Service) downloadImport(ctx context.Context, transferID uuid.UUID, body io.Reader, chunkPath string, quota int64, progress *importProgress) (int64, error) {
+	err := s.filestorage.CreateFolder(ctx, chunkPath)
+	if err != nil {
+		return 0, fmt.Errorf("url import service:failed to create chunk folder for tranferID-%s: %w", transferID, err)
+	}
+	writer, err := s.filestorage.WriteFile(ctx, filepath.Join(chunkPath, "0"))
+	if err != nil {
+		return 0, fmt.Errorf("url import service:failed to open chunk file for tranferID-%s: %w", transferID, err)
+	}
+
+	buf := make([]byte, importBufferSize)
+	limited := io.LimitReader(body, quota+1)
+	lastTouch := time.Now()
+	var received int64
+	for {
+		n, readErr := limited.Read(buf)
+		if n > 0 {
+			received += int64(n)
+			if received > quota {
+				writer.Close()
+				return received, customerrors.LimitExceeded
+			}
+			if _, err := writer.Write(buf[:n]); err != nil {
+				writer.Close()
+				return received, fmt.Errorf("url import service:failed to write chunk for tranferID-%s: %w", transferID, err)
+			}
+			progress.addReceived(int64(n))
+			if time.Since(lastTouch) > importTouchInterval {
+				if err := s.repo.UpdateTempTransferLastUpdatedTimeByID(ctx, transferID); err != nil {
+					log.Printf("url import service: failed to touch upload session %s: %v", transferID, err)
+				}
+				s.saveImport(transferID, progress)
+				lastTouch = time.Now()
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			writer.Close()
+			return received, fmt.Errorf("%w: %v", customerrors.ErrRemoteFetchFailed, readErr)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return received, fmt.Errorf("url import service:failed to close chunk file for tranferID-%s: %w", transferID, err)
+	}
+	return received, nil
+}
+
+// ImportStatusService reports the progress of an import to its owner, live while it runs
+// and from its saved record afterwards.
+func (s *Service) ImportStatusService(c context.Context, transferID uuid.UUID, ownerID uuid.UUID) (*dto.ImportStatusDTO, error) {
+	if value, ok := s.imports.Load(transferID); ok {
+		progress := value.(*importProgress)
+		if progress.ownerID != ownerID {
+			return nil, customerrors.ErrUnauthorized
+		}
+		status := progress.snapshot(transferID)
+		return &status, nil
+	}
+	record, err := s.repo.FindURLImportByID(c, transferID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, customerrors.ErrUploadRequestNotFound
+		}
+		return nil, err
+	}
+	if record.OwnerID != ownerID {
+		return nil, customerrors.ErrUnauthorized
+	}
+	return &dto.ImportStatusDTO{
+		TransferID:    transferID,
+		Status:        record.Status,
+		BytesReceived: record.BytesReceived,
+		TotalBytes:    record.TotalBytes,
+		Error:         record.ErrorMessage,
+	}, nil
+}
+
+// cancelImport stops a running import, its download then cleans up after itself.
+func (s *Service) cancelImport(transferID uuid.UUID) {
+	if value, ok := s.imports.Load(transferID); ok {
+		value.(*importProgress).cancel()
+	}
+}
+
+// FailInterruptedImportsService marks the imports that were running when the server
+// stopped as failed, nothing downloads them anymore.
+func (s *Service) FailInterruptedImportsService() error {
+	failed, err := s.repo.FailInterruptedURLImports(context.Background(), customerrors.ErrImportInterrupted.Error())
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		log.Printf("url import service: marked %d interrupted imports as failed", failed)
+	}
+	return nil
+}
+
+// PruneImportProgressService forgets imports that finished a while ago, their live status
+// sooner than their record.
+func (s *Service) PruneImportProgressService() {
+	deleted, err := s.repo.DeleteURLImportsFinishedBefore(context.Background(), time.Now().Add(-importRecordRetention))
+	if err != nil {
+		log.Printf("url import service: failed to delete old imports: %v", err)
+	} else if deleted > 0 {
+		log.Printf("url import service: deleted %d old imports", deleted)
+	}
+	s.imports.Range(func(key, value any) bool {
+		progress := value.(*importProgress)
+		progress.mu.Lock()
+		finishedAt := progress.finishedAt
+		progress.mu.Unlock()
+		if !finishedAt.IsZero() && time.Since(finishedAt) > importProgressRetention {
+			s.imports.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"large_fss/internals/config"
+	"large_fss/internals/constants"
+	customerrors "large_fss/internals/customErrors"
+	"large_fss/internals/dto"
+	"large_fss/internals/models"
+	"large_fss/internals/repository"
+	"large_fss/internals/storage"
+	"large_fss/internals/urlimport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// importRepo keeps what an import stores in memory. Calls outside of it panic on the
+// nil DbRepository, so a test notices when the import does more than expected.
+type importRepo struct {
+	repository.DbRepository
+	mu       sync.Mutex
+	owner    models.User
+	sessions map[uuid.UUID]models.TempTransfer
+	imports  map[uuid.UUID]models.URLImport
+}
+
+func newImportRepo(plan string) *importRepo {
+	return &importRepo{
+		owner:    models.User{ID: uuid.New(), Plan: plan},
+		sessions: map[uuid.UUID]models.TempTransfer{},
+		imports:  map[uuid.UUID]models.URLImport{},
+	}
+}
+
+func (r *importRepo) FindUserById(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	owner := r.owner
+	return &owner, nil
+}
+
+func (r *importRepo) CreateTempTransfer(ctx context.Context, tempTransfer models.TempTransfer) (uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := uuid.New()
+	r.sessions[id] = tempTransfer
+	return id, nil
+}
+
+func (r *importRepo) DeleteTempTransferByID(ctx context.Context, transferID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, transferID)
+	return nil
+}
+
+func (r *importRepo) UpdateTempTransferLastUpdatedTimeByID(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (r *importRepo) CreateURLImport(ctx context.Context, urlImport models.URLImport) error {
+	return r.UpdateURLImport(ctx, urlImport)
+}
+
+func (r *importRepo) UpdateURLImport(ctx context.Context, urlImport models.URLImport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.imports[urlImport.TransferID] = urlImport
+	return nil
+}
+
+func (r *importRepo) FindURLImportByID(ctx context.Context, transferID uuid.UUID) (*models.URLImport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	urlImport, ok := r.imports[transferID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &urlImport, nil
+}
+
+const testImportQuota = 1024
+
+func newImportService(t *testing.T, repo *importRepo) *Service {
+	t.Helper()
+	fetcher, err := urlimport.NewFetcher(urlimport.Options{AllowedCIDRs: []string{"127.0.0.0/8"}, MaxRedirects: 3})
+	if err != nil {
+		t.Fatalf("new fetcher: %v", err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.PlanQuotas[repo.owner.Plan] = testImportQuota
+	return &Service{repo: repo, filestorage: storage.NewLocalStorage(t.TempDir()), fetcher: fetcher, cfg: cfg}
+}
+
+// waitForImport polls the import status until it is finished.
+func waitForImport(t *testing.T, s *Service, transferID uuid.UUID, ownerID uuid.UUID) *dto.ImportStatusDTO {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := s.ImportStatusService(context.Background(), transferID, ownerID)
+		if err != nil {
+			t.Fatalf("import status: %v", err)
+		}
+		if status.Status == constants.ImportStatusFailed || status.Status == constants.ImportStatusCompleted {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("import did not finish")
+	return nil
+}
+
+func TestImportRefusesDeclaredSizeOverQuota(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", testImportQuota+1))
+	}))
+	defer server.Close()
+	repo := newImportRepo("free")
+	s := newImportService(t, repo)
+
+	_, err := s.ImportTransferService(context.Background(), dto.TransferImportDTO{OwnerID: repo.owner.ID, Expiry: "P1D", URL: server.URL})
+	if !errors.Is(err, customerrors.LimitExceeded) {
+		t.Fatalf("expected LimitExceeded, got %v", err)
+	}
+	if len(repo.sessions) != 0 {
+		t.Fatal("an upload session was left behind")
+	}
+}
+
+func TestImportStopsUndeclaredSizeOverQuota(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Flushing first sends the body chunked, without a Content-Length
+		w.(http.Flusher).Flush()
+		for range 4 {
+			io.WriteString(w, strings.Repeat("x", testImportQuota/2))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+	repo := newImportRepo("free")
+	s := newImportService(t, repo)
+
+	transferID, err := s.ImportTransferService(context.Background(), dto.TransferImportDTO{OwnerID: repo.owner.ID, Expiry: "P1D", URL: server.URL})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	status := waitForImport(t, s, transferID, repo.owner.ID)
+	if status.Status != constants.ImportStatusFailed || status.Error != customerrors.LimitExceeded.Error() {
+		t.Fatalf("expected a failed import over the quota, got %+v", status)
+	}
+	repo.mu.Lock()
+	_, sessionLeft := repo.sessions[transferID]
+	record := repo.imports[transferID]
+	repo.mu.Unlock()
+	if sessionLeft {
+		t.Fatal("the upload session of the failed import was left behind")
+	}
+	if record.Status != constants.ImportStatusFailed || record.FinishedAt == nil {
+		t.Fatalf("the failure was not saved, got %+v", record)
+	}
+}
+
+func TestImportRejectsBlockedAndFailingURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer server.Close()
+	repo := newImportRepo("free")
+	s := newImportService(t, repo)
+
+	_, err := s.ImportTransferService(context.Background(), dto.TransferImportDTO{OwnerID: repo.owner.ID, Expiry: "P1D", URL: server.URL})
+	if !errors.Is(err, customerrors.ErrRemoteFetchFailed) {
+		t.Fatalf("expected ErrRemoteFetchFailed, got %v", err)
+	}
+	_, err = s.ImportTransferService(context.Background(), dto.TransferImportDTO{OwnerID: repo.owner.ID, Expiry: "P1D", URL: "http://10.0.0.1/file"})
+	if !errors.Is(err, customerrors.ErrURLNotAllowed) {
+		t.Fatalf("expected ErrURLNotAllowed, got %v", err)
+	}
+	if len(repo.sessions) != 0 || len(repo.imports) != 0 {
+		t.Fatal("a refused import was recorded")
+	}
+}
+
+func TestImportStatusComesFromTheImportRecord(t *testing.T) {
+	repo := newImportRepo("free")
+	s := newImportService(t, repo)
+	transferID := uuid.New()
+	finishedAt := time.Now()
+	repo.imports[transferID] = models.URLImport{
+		TransferID:   transferID,
+		OwnerID:      repo.owner.ID,
+		Status:       constants.ImportStatusFailed,
+		TotalBytes:   -1,
+		ErrorMessage: customerrors.ErrImportInterrupted.Error(),
+		FinishedAt:   &finishedAt,
+	}
+
+	status, err := s.ImportStatusService(context.Background(), transferID, repo.owner.ID)
+	if err != nil {
+		t.Fatalf("import status: %v", err)
+	}
+	if status.Status != constants.ImportStatusFailed || status.Error != customerrors.ErrImportInterrupted.Error() {
+		t.Fatalf("expected the saved failure, got %+v", status)
+	}
+	_, err = s.ImportStatusService(context.Background(), transferID, uuid.New())
+	if !errors.Is(err, customerrors.ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized for another user, got %v", err)
+	}
+}
+
+func TestImportLimitsRunningImportsPerOwner(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	repo := newImportRepo("free")
+	s := newImportService(t, repo)
+	s.cfg.URLImport.MaxConcurrentPerOwner = 1
+	importRequest := dto.TransferImportDTO{OwnerID: repo.owner.ID, Expiry: "P1D", URL: server.URL}
+
+	transferID, err := s.ImportTransferService(context.Background(), importRequest)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	_, err = s.ImportTransferService(context.Background(), importRequest)
+	if !errors.Is(err, customerrors.ErrTooManyImports) {
+		t.Fatalf("expected ErrTooManyImports, got %v", err)
+	}
+
+	// A cancelled import is never assembled and frees its slot
+	s.cancelImport(transferID)
+	status := waitForImport(t, s, transferID, repo.owner.ID)
+	if status.Status != constants.ImportStatusFailed || status.Error != customerrors.ErrImportCancelled.Error() {
+		t.Fatalf("expected a cancelled import, got %+v", status)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		transferID, err = s.ImportTransferService(context.Background(), importRequest)
+		if !errors.Is(err, customerrors.ErrTooManyImports) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("expected the slot to be free again, got %v", err)
+	}
+	s.cancelImport(transferID)
+	waitForImport(t, s, transferID, repo.owner.ID)
+}
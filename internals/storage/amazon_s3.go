@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/url"
 	"path"
 	"strings"
 
@@ -48,6 +50,21 @@ func (s *S3Storage) ReadFile(ctx context.Context, filePath string) (io.ReadClose
 	return resp.Body, nil
 }
 
+func (s *S3Storage) ReadFileRange(ctx context.Context, filePath string, offset int64, length int64) (io.ReadCloser, error) {
+	if length <= 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	resp, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.BucketName),
+		Key:    aws.String(filePath),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
 func (s *S3Storage) WriteFile(ctx context.Context, filePath string) (io.WriteCloser, error) {
 	pr, pw := io.Pipe()
 
@@ -204,6 +221,19 @@ func (s *S3Storage) DeleteFolder(ctx context.Context, folderPath string) error {
 	return s.DeleteAll(ctx, folderPath)
 }
 
+// Rename copies the object to its new key and removes the old one, S3 has no native move.
+func (s *S3Storage) Rename(ctx context.Context, srcPath string, destPath string) error {
+	_, err := s.Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.BucketName),
+		CopySource: aws.String((&url.URL{Path: s.BucketName + "/" + srcPath}).EscapedPath()),
+		Key:        aws.String(destPath),
+	})
+	if err != nil {
+		return err
+	}
+	return s.DeleteFile(ctx, srcPath)
+}
+
 func (s *S3Storage) Exists(ctx context.Context, path string) (bool, error) {
 	_, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.BucketName),
@@ -39,6 +39,22 @@ func (l *LocalStorage) ReadFile(ctx context.Context, filePath string) (io.ReadCl
 	return os.Open(l.resolve(filePath))
 }
 
+// ReadFileRange opens a file for reading length bytes starting at offset.
+func (l *LocalStorage) ReadFileRange(ctx context.Context, filePath string, offset int64, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(l.resolve(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
 // WriteFile opens a file for writing.
 func (l *LocalStorage) WriteFile(ctx context.Context, filePath string) (io.WriteCloser, error) {
 	fmt.Println("reading-", filePath)
@@ -132,6 +148,15 @@ func (l *LocalStorage) DeleteFolder(ctx context.Context, folderPath string) erro
 	return os.RemoveAll(l.resolve(folderPath))
 }
 
+// Rename moves a file to a new path, creating missing parent directories.
+func (l *LocalStorage) Rename(ctx context.Context, srcPath string, destPath string) error {
+	dest := l.resolve(destPath)
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(l.resolve(srcPath), dest)
+}
+
 // Exists checks whether a file or folder exists.
 func (l *LocalStorage) Exists(ctx context.Context, path string) (bool, error) {
 	_, err := os.Stat(l.resolve(path))
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// RangeReader reads a stored file of known size as an io.ReadSeeker. Seeking is
+// free, the content is requested from the offset on the first read after it.
+type RangeReader struct {
+	ctx    context.Context
+	fs     Storage
+	path   string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func NewRangeReader(ctx context.Context, fs Storage, filePath string, size int64) *RangeReader {
+	return &RangeReader{ctx: ctx, fs: fs, path: filePath, size: size}
+}
+
+func (r *RangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.fs.ReadFileRange(r.ctx, r.path, r.offset, r.size-r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *RangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("range reader: negative position")
+	}
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *RangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
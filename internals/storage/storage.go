@@ -10,6 +10,7 @@ import (
 type Storage interface {
 	CreateFile(ctx context.Context, filePath string) error
 	ReadFile(ctx context.Context, filePath string) (io.ReadCloser, error)
+	ReadFileRange(ctx context.Context, filePath string, offset int64, length int64) (io.ReadCloser, error)
 	WriteFile(ctx context.Context, filePath string) (io.WriteCloser, error)
 
 	CreateFolder(ctx context.Context, folderPath string) error
@@ -21,6 +22,8 @@ type Storage interface {
 	DeleteFile(ctx context.Context, filePath string) error     // Optional
 	DeleteFolder(ctx context.Context, folderPath string) error // Optional
 
+	Rename(ctx context.Context, srcPath string, destPath string) error
+
 	Exists(ctx context.Context, path string) (bool, error)      // Optional
 	Stat(ctx context.Context, path string) (models.SysFileInfo, error) // Optional
 
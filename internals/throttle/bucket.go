@@ -0,0 +1,81 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// minBurst keeps slow buckets from splitting every read into tiny pieces.
+const minBurst = 32 * 1024
+
+// Bucket is a token bucket refilled with rate bytes per second, holding at most
+// one second of tokens. Waiters take tokens on credit, so a bucket shared by
+// several downloads hands out bandwidth in the order they asked.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full bucket for rate bytes per second, which must be positive.
+func NewBucket(rate int64) *Bucket {
+	b := &Bucket{last: time.Now()}
+	b.setRate(rate)
+	b.tokens = b.burst
+	return b
+}
+
+// SetRate changes the rate, keeping the tokens collected so far.
+func (b *Bucket) SetRate(rate int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	b.setRate(rate)
+}
+
+func (b *Bucket) setRate(rate int64) {
+	b.rate = float64(rate)
+	b.burst = max(float64(rate), minBurst)
+	b.tokens = min(b.tokens, b.burst)
+}
+
+// Burst is the most a single read should take from the bucket.
+func (b *Bucket) Burst() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(b.burst)
+}
+
+func (b *Bucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Wait takes n tokens and blocks until the bucket has paid them off, or the
+// context ends. It returns how long it waited.
+func (b *Bucket) Wait(ctx context.Context, n int) (time.Duration, error) {
+	b.mu.Lock()
+	now := time.Now()
+	b.refill(now)
+	b.tokens -= float64(n)
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return time.Since(now), ctx.Err()
+	}
+}
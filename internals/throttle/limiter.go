@@ -0,0 +1,157 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"sync"
+)
+
+// ErrBusy is returned by Start when the concurrent download cap is reached.
+var ErrBusy = errors.New("throttle: too many concurrent downloads")
+
+// Metrics are published with the other expvar variables under "downloads".
+var Metrics = expvar.NewMap("downloads")
+
+const (
+	metricActive           = "active"            // Downloads streaming right now
+	metricStarted          = "started"           // Downloads admitted since start-up
+	metricRejected         = "rejected"          // Downloads turned away by the concurrent cap
+	metricBytesSent        = "bytes_sent"        // Bytes read from throttled downloads
+	metricThrottledSeconds = "throttled_seconds" // Time downloads spent waiting for bandwidth
+)
+
+// Limit throttles every download sharing its key to BytesPerSecond together.
+// A rate of 0 or less leaves the key unlimited.
+type Limit struct {
+	Key            string
+	BytesPerSecond int64
+}
+
+// Limiter caps the number of concurrent downloads and their bandwidth, overall
+// and per key, such as a user or a share link.
+type Limiter struct {
+	global        *Bucket // nil without a global rate
+	maxConcurrent int     // 0 for no cap
+
+	mu      sync.Mutex
+	active  int
+	buckets map[string]*sharedBucket
+}
+
+// sharedBucket is dropped once no download uses its key anymore.
+type sharedBucket struct {
+	*Bucket
+	users int
+}
+
+// NewLimiter returns a limiter with a global rate in bytes per second and a cap on
+// concurrent downloads. Zero disables either.
+func NewLimiter(globalBytesPerSecond int64, maxConcurrent int) *Limiter {
+	l := &Limiter{
+		maxConcurrent: maxConcurrent,
+		buckets:       make(map[string]*sharedBucket),
+	}
+	if globalBytesPerSecond > 0 {
+		l.global = NewBucket(globalBytesPerSecond)
+	}
+	return l
+}
+
+// Start admits a download and returns its content throttled by the global rate and
+// the given limits. Closing the returned reader ends the download.
+func (l *Limiter) Start(ctx context.Context, reader io.ReadCloser, limits ...Limit) (io.ReadCloser, error) {
+	l.mu.Lock()
+	if l.maxConcurrent > 0 && l.active >= l.maxConcurrent {
+		l.mu.Unlock()
+		Metrics.Add(metricRejected, 1)
+		return nil, ErrBusy
+	}
+	l.active++
+
+	throttled := &Reader{ReadCloser: reader, ctx: ctx, limiter: l}
+	if l.global != nil {
+		throttled.buckets = append(throttled.buckets, l.global)
+	}
+	for _, limit := range limits {
+		if limit.BytesPerSecond <= 0 {
+			continue
+		}
+		shared, ok := l.buckets[limit.Key]
+		if !ok {
+			shared = &sharedBucket{Bucket: NewBucket(limit.BytesPerSecond)}
+			l.buckets[limit.Key] = shared
+		} else {
+			// Picks up limits changed while other downloads were running
+			shared.SetRate(limit.BytesPerSecond)
+		}
+		shared.users++
+		throttled.keys = append(throttled.keys, limit.Key)
+		throttled.buckets = append(throttled.buckets, shared.Bucket)
+	}
+	l.mu.Unlock()
+
+	Metrics.Add(metricActive, 1)
+	Metrics.Add(metricStarted, 1)
+	throttled.chunk = chunkSize(throttled.buckets)
+	return throttled, nil
+}
+
+func (l *Limiter) finish(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	for _, key := range keys {
+		shared := l.buckets[key]
+		shared.users--
+		if shared.users == 0 {
+			delete(l.buckets, key)
+		}
+	}
+	Metrics.Add(metricActive, -1)
+}
+
+// chunkSize keeps single reads within the smallest burst, so one read never
+// runs a bucket far into debt.
+func chunkSize(buckets []*Bucket) int {
+	size := 0
+	for _, bucket := range buckets {
+		if burst := bucket.Burst(); size == 0 || burst < size {
+			size = burst
+		}
+	}
+	return size
+}
+
+// Reader is the content of an admitted download, read no faster than its buckets allow.
+type Reader struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *Limiter
+	keys    []string
+	buckets []*Bucket
+	chunk   int // Largest read, 0 when unthrottled
+	once    sync.Once
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.chunk > 0 && len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+	n, err := r.ReadCloser.Read(p)
+	Metrics.Add(metricBytesSent, int64(n))
+	for _, bucket := range r.buckets {
+		waited, waitErr := bucket.Wait(r.ctx, n)
+		Metrics.AddFloat(metricThrottledSeconds, waited.Seconds())
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *Reader) Close() error {
+	r.once.Do(func() { r.limiter.finish(r.keys) })
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,125 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestBucketAllowsBurstThenWaits(t *testing.T) {
+	bucket := NewBucket(minBurst)
+
+	waited, err := bucket.Wait(context.Background(), minBurst)
+	if err != nil || waited != 0 {
+		t.Fatalf("a full bucket should pay its burst at once, waited %s: %v", waited, err)
+	}
+	// Half the rate on credit takes about half a second
+	waited, err = bucket.Wait(context.Background(), minBurst/2)
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if waited < 400*time.Millisecond || waited > 700*time.Millisecond {
+		t.Fatalf("expected about 500ms, waited %s", waited)
+	}
+}
+
+func TestBucketWaitStopsWithContext(t *testing.T) {
+	bucket := NewBucket(minBurst)
+	bucket.Wait(context.Background(), minBurst)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// Ten seconds worth of tokens
+	_, err := bucket.Wait(ctx, 10*minBurst)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline, got %v", err)
+	}
+}
+
+func TestBucketSetRateCapsTokens(t *testing.T) {
+	bucket := NewBucket(4 * minBurst)
+	bucket.SetRate(minBurst)
+	if burst := bucket.Burst(); burst != minBurst {
+		t.Fatalf("expected the burst to follow the rate, got %d", burst)
+	}
+	// Tokens collected at the old rate are capped to the new burst
+	bucket.Wait(context.Background(), minBurst)
+	waited, _ := bucket.Wait(context.Background(), minBurst/4)
+	if waited == 0 {
+		t.Fatal("expected the lowered rate to make the read wait")
+	}
+}
+
+func TestLimiterCapsConcurrentDownloads(t *testing.T) {
+	limiter := NewLimiter(0, 2)
+	first, err := limiter.Start(context.Background(), io.NopCloser(bytes.NewReader(nil)))
+	if err != nil {
+		t.Fatalf("first download: %v", err)
+	}
+	second, err := limiter.Start(context.Background(), io.NopCloser(bytes.NewReader(nil)))
+	if err != nil {
+		t.Fatalf("second download: %v", err)
+	}
+	if _, err := limiter.Start(context.Background(), io.NopCloser(bytes.NewReader(nil))); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected ErrBusy over the cap, got %v", err)
+	}
+
+	first.Close()
+	// Closing twice must not free a second slot
+	first.Close()
+	third, err := limiter.Start(context.Background(), io.NopCloser(bytes.NewReader(nil)))
+	if err != nil {
+		t.Fatalf("a closed download should free its slot: %v", err)
+	}
+	if _, err := limiter.Start(context.Background(), io.NopCloser(bytes.NewReader(nil))); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected ErrBusy after a double close, got %v", err)
+	}
+	second.Close()
+	third.Close()
+}
+
+func TestLimiterSharesKeyedBuckets(t *testing.T) {
+	limiter := NewLimiter(0, 0)
+	limit := Limit{Key: "owner:1", BytesPerSecond: minBurst}
+	content := make([]byte, minBurst)
+
+	first, _ := limiter.Start(context.Background(), io.NopCloser(bytes.NewReader(content)), limit)
+	second, _ := limiter.Start(context.Background(), io.NopCloser(bytes.NewReader(content)), limit)
+	if len(limiter.buckets) != 1 || limiter.buckets["owner:1"].users != 2 {
+		t.Fatalf("expected one bucket shared by both downloads, got %+v", limiter.buckets)
+	}
+
+	start := time.Now()
+	io.Copy(io.Discard, first)
+	// The first download emptied the shared bucket, so the second one waits a second
+	io.Copy(io.Discard, second)
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Fatalf("two bursts through one bucket took only %s", elapsed)
+	}
+
+	first.Close()
+	second.Close()
+	if len(limiter.buckets) != 0 {
+		t.Fatal("the bucket outlived its downloads")
+	}
+}
+
+func TestLimiterLeavesUnlimitedKeysAlone(t *testing.T) {
+	limiter := NewLimiter(0, 0)
+	reader, err := limiter.Start(context.Background(), io.NopCloser(bytes.NewReader(make([]byte, 4*minBurst))), Limit{Key: "link:1"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer reader.Close()
+	start := time.Now()
+	n, _ := io.Copy(io.Discard, reader)
+	if n != 4*minBurst || time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("read %d bytes in %s without a limit", n, time.Since(start))
+	}
+	if len(limiter.buckets) != 0 {
+		t.Fatal("a rate of 0 should not create a bucket")
+	}
+}
@@ -0,0 +1,78 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxSide is the longest edge of a thumbnail in pixels.
+	MaxSide = 256
+	// Larger images are not decoded, a small file can declare huge dimensions.
+	maxSourcePixels = 50_000_000
+	jpegQuality     = 80
+)
+
+var ErrImageTooLarge = errors.New("thumbnail: image dimensions exceed the decoding limit")
+
+var supportedMimeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Supported reports whether a thumbnail can be made from content of the sniffed type.
+func Supported(mimeType string) bool {
+	return supportedMimeTypes[mimeType]
+}
+
+// Generate decodes an image and returns a JPEG scaled to fit MaxSide, transparent
+// areas become white. The header is checked before the pixels are decoded.
+func Generate(r io.Reader) ([]byte, error) {
+	var header bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, fmt.Errorf("thumbnail: failed to read image header: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxSourcePixels {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, fmt.Errorf("thumbnail: failed to decode image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("thumbnail: failed to encode: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// fit scales the dimensions down to MaxSide keeping the aspect ratio, small images keep their size.
+func fit(width, height int) (int, int) {
+	if width <= MaxSide && height <= MaxSide {
+		return width, height
+	}
+	if width >= height {
+		return MaxSide, max(1, height*MaxSide/width)
+	}
+	return max(1, width*MaxSide/height), MaxSide
+}
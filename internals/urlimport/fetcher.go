@@ -0,0 +1,199 @@
+package urlimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	customerrors "large_fss/internals/customErrors"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	dialTimeout           = 10 * time.Second
+	responseHeaderTimeout = 30 * time.Second
+)
+
+// Options configures which remote servers a Fetcher may contact.
+type Options struct {
+	AllowedHosts []string      // Host names that may resolve to blocked addresses
+	AllowedCIDRs []string      // Blocked ranges that are reachable anyway, e.g. an internal network
+	Timeout      time.Duration // Whole request including the body, zero for none
+	MaxRedirects int
+}
+
+// Fetcher downloads remote resources while refusing to reach loopback, private,
+// link-local and other internal addresses unless they are explicitly allowed.
+// Addresses are checked at dial time, so redirects and DNS rebinding are covered.
+type Fetcher struct {
+	client       *http.Client
+	allowedHosts map[string]bool
+	allowedNets  []*net.IPNet
+	maxRedirects int
+}
+
+// Response is an opened remote resource.
+type Response struct {
+	Body     io.ReadCloser
+	Size     int64  // Content-Length, -1 when the server did not send it
+	FileName string // Name from Content-Disposition or the URL path, may be empty
+}
+
+func NewFetcher(opts Options) (*Fetcher, error) {
+	f := &Fetcher{
+		allowedHosts: make(map[string]bool),
+		maxRedirects: opts.MaxRedirects,
+	}
+	for _, host := range opts.AllowedHosts {
+		f.allowedHosts[strings.ToLower(host)] = true
+	}
+	for _, cidr := range opts.AllowedCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("url import: invalid allowed cidr %q: %w", cidr, err)
+		}
+		f.allowedNets = append(f.allowedNets, ipNet)
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	transport := &http.Transport{
+		// A proxy would make the address check meaningless
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return f.dialContext(ctx, dialer, network, addr)
+		},
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		ForceAttemptHTTP2:     true,
+	}
+	f.client = &http.Client{
+		Transport:     transport,
+		Timeout:       opts.Timeout,
+		CheckRedirect: f.checkRedirect,
+	}
+	return f, nil
+}
+
+// CheckURL validates the URL and that its host resolves to allowed addresses only.
+func (f *Fetcher) CheckURL(ctx context.Context, rawURL string) (*url.URL, error) {
+	u, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot resolve %s", customerrors.ErrURLNotAllowed, u.Hostname())
+	}
+	for _, ip := range ips {
+		if !f.allowed(u.Hostname(), ip.IP) {
+			return nil, fmt.Errorf("%w: %s resolves to a blocked address", customerrors.ErrURLNotAllowed, u.Hostname())
+		}
+	}
+	return u, nil
+}
+
+// Open requests the resource and returns its body once the server answered with 2xx.
+func (f *Fetcher) Open(ctx context.Context, rawURL string) (*Response, error) {
+	u, err := f.CheckURL(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", customerrors.ErrURLNotAllowed, err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// A redirect into a blocked range is refused like the original URL would be
+		if errors.Is(err, customerrors.ErrURLNotAllowed) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", customerrors.ErrRemoteFetchFailed, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: remote server answered %s", customerrors.ErrRemoteFetchFailed, resp.Status)
+	}
+	return &Response{
+		Body:     resp.Body,
+		Size:     resp.ContentLength,
+		FileName: responseFileName(resp),
+	}, nil
+}
+
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > f.maxRedirects {
+		return fmt.Errorf("%w: too many redirects", customerrors.ErrRemoteFetchFailed)
+	}
+	_, err := parseURL(req.URL.String())
+	return err
+}
+
+// dialContext resolves the host itself and only connects to allowed addresses.
+func (f *Fetcher) dialContext(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error = fmt.Errorf("%w: %s resolves to a blocked address", customerrors.ErrURLNotAllowed, host)
+	for _, ip := range ips {
+		if !f.allowed(host, ip.IP) {
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (f *Fetcher) allowed(host string, ip net.IP) bool {
+	if f.allowedHosts[strings.ToLower(host)] {
+		return true
+	}
+	for _, ipNet := range f.allowedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return !isBlockedIP(ip)
+}
+
+func parseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", customerrors.ErrURLNotAllowed, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: only http and https are supported", customerrors.ErrURLNotAllowed)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: missing host", customerrors.ErrURLNotAllowed)
+	}
+	return u, nil
+}
+
+func responseFileName(resp *http.Response) string {
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != "" {
+		if _, params, err := mime.ParseMediaType(disposition); err == nil && params["filename"] != "" {
+			return params["filename"]
+		}
+	}
+	name := path.Base(resp.Request.URL.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
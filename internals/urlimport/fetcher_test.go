@@ -0,0 +1,153 @@
+package urlimport
+
+import (
+	"context"
+	"errors"
+	"io"
+	customerrors "large_fss/internals/customErrors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// loopbackFetcher may reach the test servers, which listen on loopback.
+func loopbackFetcher(t *testing.T, maxRedirects int) *Fetcher {
+	t.Helper()
+	fetcher, err := NewFetcher(Options{AllowedCIDRs: []string{"127.0.0.0/8"}, MaxRedirects: maxRedirects})
+	if err != nil {
+		t.Fatalf("new fetcher: %v", err)
+	}
+	return fetcher
+}
+
+func TestOpenReturnsBodySizeAndName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="report.pdf"`)
+		io.WriteString(w, "hello")
+	}))
+	defer server.Close()
+
+	resp, err := loopbackFetcher(t, 3).Open(context.Background(), server.URL+"/files/ignored.bin")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello" || resp.Size != 5 || resp.FileName != "report.pdf" {
+		t.Fatalf("got body %q, size %d, name %q", body, resp.Size, resp.FileName)
+	}
+}
+
+func TestOpenRefusesBlockedAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a blocked server was contacted")
+	}))
+	defer server.Close()
+
+	fetcher, err := NewFetcher(Options{MaxRedirects: 3})
+	if err != nil {
+		t.Fatalf("new fetcher: %v", err)
+	}
+	for _, rawURL := range []string{server.URL, "ftp://example.com/file", "http:///nohost"} {
+		_, err := fetcher.Open(context.Background(), rawURL)
+		if !errors.Is(err, customerrors.ErrURLNotAllowed) {
+			t.Errorf("%s: expected ErrURLNotAllowed, got %v", rawURL, err)
+		}
+	}
+}
+
+func TestOpenAllowsListedHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+	host := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")[0]
+
+	fetcher, err := NewFetcher(Options{AllowedHosts: []string{host}})
+	if err != nil {
+		t.Fatalf("new fetcher: %v", err)
+	}
+	resp, err := fetcher.Open(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestOpenRejectsNon2xx(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusInternalServerError, http.StatusNotModified} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		_, err := loopbackFetcher(t, 3).Open(context.Background(), server.URL)
+		server.Close()
+		if !errors.Is(err, customerrors.ErrRemoteFetchFailed) {
+			t.Errorf("status %d: expected ErrRemoteFetchFailed, got %v", status, err)
+		}
+	}
+}
+
+func TestOpenFollowsRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/middle", http.StatusFound)
+	})
+	mux.HandleFunc("/middle", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/data.csv", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/data.csv", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "a,b")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := loopbackFetcher(t, 2).Open(context.Background(), server.URL+"/start")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.FileName != "data.csv" {
+		t.Fatalf("expected the name of the final URL, got %q", resp.FileName)
+	}
+
+	_, err = loopbackFetcher(t, 1).Open(context.Background(), server.URL+"/start")
+	if !errors.Is(err, customerrors.ErrRemoteFetchFailed) {
+		t.Fatalf("expected too many redirects to fail, got %v", err)
+	}
+}
+
+func TestOpenRefusesRedirectsToBlockedHosts(t *testing.T) {
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the redirect target was contacted")
+	}))
+	defer blocked.Close()
+	blockedURL, _ := url.Parse(blocked.URL)
+	// Same loopback server under a name that is not allowed
+	target := "http://localhost:" + blockedURL.Port() + "/secret"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target, http.StatusFound)
+	}))
+	defer server.Close()
+	host := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")[0]
+
+	fetcher, err := NewFetcher(Options{AllowedHosts: []string{host}, MaxRedirects: 3})
+	if err != nil {
+		t.Fatalf("new fetcher: %v", err)
+	}
+	_, err = fetcher.Open(context.Background(), server.URL)
+	if !errors.Is(err, customerrors.ErrURLNotAllowed) {
+		t.Fatalf("expected ErrURLNotAllowed, got %v", err)
+	}
+
+	scheme := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	}))
+	defer scheme.Close()
+	_, err = loopbackFetcher(t, 3).Open(context.Background(), scheme.URL)
+	if !errors.Is(err, customerrors.ErrURLNotAllowed) {
+		t.Fatalf("expected ErrURLNotAllowed for a file redirect, got %v", err)
+	}
+}
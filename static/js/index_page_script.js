@@ -5,6 +5,8 @@ const ENDPOINTS = {
     UPLOAD_CHUNK: `${BACKEND_BASE}/auth/transfer/upload`,
     ASSEMBLE: `${BACKEND_BASE}/auth/transfer/assemble`,
     CANCEL: `${BACKEND_BASE}/auth/transfer/cancel`,
+    LINKS: `${BACKEND_BASE}/auth/transfer/links`,
+    EXPIRY_POLICY: `${BACKEND_BASE}/auth/transfer/expiry-policy`,
     LOGIN: `${BACKEND_BASE}/login`,
     SIGNUP: `${BACKEND_BASE}/signup`,
 };
@@ -164,8 +166,37 @@ function showUploadCard() {
     document.getElementById('auth-card').classList.add('hidden');
     document.getElementById('loginbutton').classList.add('hidden');
 
+    loadExpiryOptions();
+}
 
+// Fill the expiry select with the presets the user's plan allows
+async function loadExpiryOptions() {
+    try {
+        const response = await fetch(ENDPOINTS.EXPIRY_POLICY, {
+            headers: { 'Authorization': `Bearer ${authToken}` }
+        });
+        if (!response.ok) return;
+        const policy = (await response.json()).data;
+        const select = document.getElementById('expiry');
+        const previous = select.value;
+        select.innerHTML = '';
+        policy.presets.forEach(preset => select.add(new Option(formatExpirySeconds(preset.seconds), preset.name)));
+        if (policy.never_allowed) select.add(new Option('Never', 'never'));
+        if ([...select.options].some(option => option.value === previous)) select.value = previous;
+    } catch (error) {
+        // The built-in options stay
+    }
+}
 
+function formatExpirySeconds(seconds) {
+    const units = [['week', 604800], ['day', 86400], ['hour', 3600], ['minute', 60]];
+    for (const [unit, size] of units) {
+        if (seconds >= size && seconds % size === 0) {
+            const count = seconds / size;
+            return `${count} ${unit}${count === 1 ? '' : 's'}`;
+        }
+    }
+    return `${seconds} seconds`;
 }
 
 // Show toast notification
@@ -305,6 +336,9 @@ async function startTransfer() {
     try {
         const expiry = document.getElementById('expiry').value;
         const message = document.getElementById('message').value;
+        const maxDownloadsValue = document.getElementById('max-downloads').value;
+        const max_downloads = maxDownloadsValue ? parseInt(maxDownloadsValue, 10) : null;
+        const password = document.getElementById('transfer-password').value;
 
         // Initialize transfer
         const initResponse = await fetch(ENDPOINTS.NEW_TRANSFER, {
@@ -313,7 +347,7 @@ async function startTransfer() {
                 'Content-Type': 'application/json',
                 'Authorization': `Bearer ${authToken}`
             },
-            body: JSON.stringify({ expiry, message, size: totalSize })
+            body: JSON.stringify({ expiry, message, size: totalSize, max_downloads, password })
         });
 
         const initData = await initResponse.json();
@@ -488,12 +522,25 @@ function showUploadProgress() {
     document.getElementById('upload-success').classList.add('hidden');
 }
 
-function showUploadSuccess() {
+async function showUploadSuccess() {
     document.getElementById('file-selection').classList.add('hidden');
     document.getElementById('upload-progress').classList.add('hidden');
     document.getElementById('upload-success').classList.remove('hidden');
-    const shareUrl = `${window.location.origin}/share/${transferId}`;
-    document.getElementById('share-url').textContent = shareUrl;
+    document.getElementById('share-url').textContent = 'Loading share link...';
+    try {
+        // Every new transfer starts with one default link
+        const response = await fetch(`${ENDPOINTS.LINKS}/${transferId}`, {
+            headers: { 'Authorization': `Bearer ${authToken}` }
+        });
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error?.message);
+        const link = (data.data || []).find(l => l.enabled);
+        if (!link) throw new Error('no share link');
+        document.getElementById('share-url').textContent = `${window.location.origin}${link.url}`;
+    } catch (error) {
+        document.getElementById('share-url').textContent = '';
+        showToast('error', 'Failed to load share link: ' + error.message);
+    }
 }
 
 function setProgress(percent) {
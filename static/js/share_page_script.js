@@ -4,12 +4,26 @@ const BACKEND_BASE = 'http://localhost:8081/api';
 const SHARE_BACKEND_URL=BACKEND_BASE+"/transfer/share"
 const FILE_DOWNLOAD_BACKEND_URL=BACKEND_BASE+"/transfer/download/file"
 const TRANSFER_DOWNLOAD_BACKEND_URL=BACKEND_BASE+"/transfer/download/transfer"
+const SELECTION_DOWNLOAD_BACKEND_URL=BACKEND_BASE+"/transfer/download/selection"
+const FILE_PREVIEW_BACKEND_URL=BACKEND_BASE+"/transfer/preview/file"
+const PASSWORD_REQUIRED_MESSAGE='transfer is password protected'
+const RECIPIENT_REQUIRED_MESSAGE='transfer is private, sign in or verify your email'
 
 
 // DOM elements
 const loadingState = document.getElementById('loading-state');
 const errorState = document.getElementById('error-state');
 const contentState = document.getElementById('content-state');
+const passwordState = document.getElementById('password-state');
+const passwordForm = document.getElementById('password-form');
+const passwordInput = document.getElementById('transfer-password');
+const passwordError = document.getElementById('password-error');
+const recipientState = document.getElementById('recipient-state');
+const recipientEmailForm = document.getElementById('recipient-email-form');
+const recipientCodeForm = document.getElementById('recipient-code-form');
+const recipientEmailInput = document.getElementById('recipient-email');
+const recipientCodeInput = document.getElementById('recipient-code');
+const recipientError = document.getElementById('recipient-error');
 const statusBadge = document.getElementById('status-badge');
 const transferIdEl = document.getElementById('transfer-id');
 const totalSizeEl = document.getElementById('total-size');
@@ -19,6 +33,7 @@ const messageContent = document.getElementById('message-content');
 const filesContainer = document.getElementById('files-container');
 const filesCount = document.getElementById('files-count');
 const downloadAllBtn = document.getElementById('download-all-btn');
+const downloadSelectedBtn = document.getElementById('download-selected-btn');
 
 // Utility functions
 function formatFileSize(bytes) {
@@ -55,17 +70,29 @@ function getFileIcon(extension) {
     return iconMap[extension] || '📄';
 }
 
+function scanStatusLabel(status) {
+    const labelMap = {
+        'pending': 'Scanning for malware...',
+        'error': 'Scan failed, retrying...',
+        'infected': 'Quarantined'
+    };
+    return labelMap[status] || 'Unavailable';
+}
+
 // API functions
 async function fetchTransferInfo() {
     try {
         console.log("sending request")
-        const response = await fetch(`${SHARE_BACKEND_URL}/${transferId}`);
+        const response = await fetch(`${SHARE_BACKEND_URL}/${linkToken}`);
         const data = await response.json();
         console.log(data,"-data received")
         console.log(response.ok)
         
         if (!response.ok) {
-            throw new Error(data.error?.message || 'Failed to fetch transfer');
+            const error = new Error(data.error?.message || 'Failed to fetch transfer');
+            error.passwordRequired = response.status === 401 && data.error?.message === PASSWORD_REQUIRED_MESSAGE;
+            error.recipientRequired = response.status === 401 && data.error?.message === RECIPIENT_REQUIRED_MESSAGE;
+            throw error;
         }
         
         return data.data;
@@ -75,8 +102,40 @@ async function fetchTransferInfo() {
     }
 }
 
+async function postShare(action, body, fallbackMessage) {
+    const response = await fetch(`${SHARE_BACKEND_URL}/${linkToken}/${action}`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        credentials: 'same-origin',
+        body: JSON.stringify(body)
+    });
+    const data = await response.json();
+    if (!response.ok) {
+        throw new Error(data.error?.message || fallbackMessage);
+    }
+}
+
+// The server answers with an access cookie for this transfer's download links
+function unlockTransfer(password) {
+    return postShare('unlock', { password }, 'Failed to unlock transfer');
+}
+
+// Guests of a private transfer get a one-time code by email
+function requestRecipientCode(email) {
+    return postShare('code', { email }, 'Failed to send code');
+}
+
+// Like unlocking, a verified code sets an access cookie for this transfer
+function verifyRecipientCode(email, code) {
+    return postShare('verify', { email, code }, 'Failed to verify code');
+}
+
+function previewFile(fileId) {
+    window.open(`${FILE_PREVIEW_BACKEND_URL}/${linkToken}/${fileId}`, '_blank', 'noopener');
+}
+
 function downloadFile(fileId, filename) {
-    const downloadUrl = `${FILE_DOWNLOAD_BACKEND_URL}/${fileId}`;
+    const downloadUrl = `${FILE_DOWNLOAD_BACKEND_URL}/${linkToken}/${fileId}`;
     const link = document.createElement('a');
     link.href = downloadUrl;
     link.download = filename;
@@ -87,7 +146,7 @@ function downloadFile(fileId, filename) {
 }
 
 function downloadAllFiles() {
-    const downloadUrl = `${TRANSFER_DOWNLOAD_BACKEND_URL}/${transferId}`;
+    const downloadUrl = `${TRANSFER_DOWNLOAD_BACKEND_URL}/${linkToken}`;
     const link = document.createElement('a');
     link.href = downloadUrl;
     link.target = '_blank';
@@ -96,23 +155,73 @@ function downloadAllFiles() {
     document.body.removeChild(link);
 }
 
+function selectedFileIds() {
+    return Array.from(filesContainer.querySelectorAll('.file-select:checked')).map(box => box.value);
+}
+
+function downloadSelectedFiles() {
+    const fileIds = selectedFileIds();
+    if (fileIds.length === 0) {
+        return;
+    }
+    const query = fileIds.map(id => `file_id=${encodeURIComponent(id)}`).join('&');
+    const link = document.createElement('a');
+    link.href = `${SELECTION_DOWNLOAD_BACKEND_URL}/${linkToken}?${query}`;
+    link.target = '_blank';
+    document.body.appendChild(link);
+    link.click();
+    document.body.removeChild(link);
+}
+
+function updateSelectedButton() {
+    const count = selectedFileIds().length;
+    downloadSelectedBtn.disabled = count === 0;
+    downloadSelectedBtn.textContent = count === 0 ? 'Download Selected' : `Download Selected (${count})`;
+}
+
 // UI functions
+function showRecipientPrompt() {
+    loadingState.style.display = 'none';
+    errorState.style.display = 'none';
+    contentState.style.display = 'none';
+    passwordState.style.display = 'none';
+    recipientState.style.display = 'block';
+    recipientEmailInput.focus();
+}
+
+function showPasswordPrompt() {
+    recipientState.style.display = 'none';
+    loadingState.style.display = 'none';
+    errorState.style.display = 'none';
+    contentState.style.display = 'none';
+    passwordState.style.display = 'block';
+    passwordInput.focus();
+}
+
 function showError(message = 'Transfer not found or expired') {
+    recipientState.style.display = 'none';
     loadingState.style.display = 'none';
     contentState.style.display = 'none';
+    passwordState.style.display = 'none';
     errorState.style.display = 'block';
     errorState.querySelector('.error-message').textContent = message;
 }
 
 function showContent(transferData) {
+    recipientState.style.display = 'none';
     loadingState.style.display = 'none';
     errorState.style.display = 'none';
+    passwordState.style.display = 'none';
     contentState.style.display = 'block';
 
     // Update transfer info
     transferIdEl.textContent = transferData.id;
     totalSizeEl.textContent = formatFileSize(transferData.size);
     expiresAtEl.textContent = formatDate(transferData.expiry);
+    if (transferData.downloads_left !== undefined) {
+        document.getElementById('downloads-left-item').style.display = '';
+        document.getElementById('downloads-left').textContent = transferData.downloads_left;
+    }
 
     // Check if expired
     const now = new Date();
@@ -126,6 +235,14 @@ function showContent(transferData) {
         downloadAllBtn.style.cursor = 'not-allowed';
     }
 
+    // Downloads stay blocked until the malware scan has passed
+    if (transferData.scan_status && transferData.scan_status !== 'clean') {
+        downloadAllBtn.disabled = true;
+        downloadAllBtn.textContent = scanStatusLabel(transferData.scan_status);
+        downloadAllBtn.style.opacity = '0.5';
+        downloadAllBtn.style.cursor = 'not-allowed';
+    }
+
     // Show message if exists
     if (transferData.message && transferData.message.trim()) {
         messageSection.style.display = 'block';
@@ -154,13 +271,17 @@ function renderFiles(files) {
         
         const extension = getFileExtension(file.file_name);
         const icon = getFileIcon(extension);
+        const scanned = !file.scan_status || file.scan_status === 'clean';
         
         fileItem.innerHTML = `
+            <input type="checkbox" class="file-select" value="${file.id}" ${scanned ? '' : 'disabled'} aria-label="Select ${file.file_name}">
+            ${file.thumbnail_url ? `<img class="file-thumbnail" src="${file.thumbnail_url}" alt="" loading="lazy">` : ''}
             <div class="file-info">
-                <div class="file-name">${icon} ${file.file_name}</div>
-                <div class="file-meta">${formatFileSize(file.file_size)} • ${extension.toUpperCase()}</div>
+                <div class="file-name">${file.thumbnail_url ? '' : icon} ${file.file_name}</div>
+                <div class="file-meta">${formatFileSize(file.file_size)} • ${extension.toUpperCase()}${scanned ? '' : ' • ' + scanStatusLabel(file.scan_status)}</div>
             </div>
-            <button class="download-btn" onclick="downloadFile('${file.id}', '${file.file_name}')">
+            ${file.previewable ? `<button class="download-btn preview-btn" ${scanned ? '' : 'disabled'} onclick="previewFile('${file.id}')">Preview</button>` : ''}
+            <button class="download-btn" ${scanned ? '' : 'disabled'} onclick="downloadFile('${file.id}', '${file.file_name}')">
                 <svg class="icon" viewBox="0 0 20 20">
                     <path d="M3 17a1 1 0 011-1h12a1 1 0 110 2H4a1 1 0 01-1-1zm3.293-7.707a1 1 0 011.414 0L9 10.586V3a1 1 0 112 0v7.586l1.293-1.293a1 1 0 111.414 1.414l-3 3a1 1 0 01-1.414 0l-3-3a1 1 0 010-1.414z"/>
                 </svg>
@@ -170,29 +291,85 @@ function renderFiles(files) {
         
         filesContainer.appendChild(fileItem);
     });
+    updateSelectedButton();
 }
 
 // Event listeners
 downloadAllBtn.addEventListener('click', downloadAllFiles);
+downloadSelectedBtn.addEventListener('click', downloadSelectedFiles);
+filesContainer.addEventListener('change', updateSelectedButton);
+passwordForm.addEventListener('submit', async (event) => {
+    event.preventDefault();
+    passwordError.textContent = '';
+    try {
+        await unlockTransfer(passwordInput.value);
+        passwordInput.value = '';
+        showContent(await fetchTransferInfo());
+    } catch (error) {
+        passwordError.textContent = error.message;
+    }
+});
+
+recipientEmailForm.addEventListener('submit', async (event) => {
+    event.preventDefault();
+    recipientError.textContent = '';
+    try {
+        await requestRecipientCode(recipientEmailInput.value);
+        recipientEmailForm.style.display = 'none';
+        recipientCodeForm.style.display = '';
+        recipientError.textContent = 'If this email may open the transfer, a code is on its way.';
+        recipientCodeInput.focus();
+    } catch (error) {
+        recipientError.textContent = error.message;
+    }
+});
+recipientCodeForm.addEventListener('submit', async (event) => {
+    event.preventDefault();
+    recipientError.textContent = '';
+    try {
+        await verifyRecipientCode(recipientEmailInput.value, recipientCodeInput.value);
+        recipientCodeInput.value = '';
+        await loadTransfer();
+    } catch (error) {
+        recipientError.textContent = error.message;
+    }
+});
 
 // Make functions globally available
 window.downloadFile = downloadFile;
+window.previewFile = previewFile;
 
 // Initialize
 async function init() {
-    if (!transferId) {
-        showError('No transfer ID provided');
+    if (!linkToken) {
+        showError('No share link provided');
         return;
     }
 
     try {
-        console.log("fetching data-",transferId)
-        const transferData = await fetchTransferInfo();
-        showContent(transferData);
+        console.log("fetching data-",linkToken)
+        await loadTransfer();
     } catch (error) {
         showError(error.message);
     }
 }
 
+// A private transfer asks who is visiting before a protected one asks for its password
+async function loadTransfer() {
+    try {
+        showContent(await fetchTransferInfo());
+    } catch (error) {
+        if (error.recipientRequired) {
+            showRecipientPrompt();
+            return;
+        }
+        if (error.passwordRequired) {
+            showPasswordPrompt();
+            return;
+        }
+        throw error;
+    }
+}
+
 // Start the app
 init();
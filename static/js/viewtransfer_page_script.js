@@ -48,29 +48,58 @@ function getTransferStatus(createdAt, expiry) {
     return now > expiresAt ? 'expired' : 'active';
 }
 
-// Load transfers from backend
-async function loadTransfers() {
+// Query string for the current filters, the server filters, sorts and pages
+function transferQuery(cursor) {
+    const params = new URLSearchParams();
+    const searchTerm = document.getElementById('searchInput').value.trim();
+    const statusFilter = document.getElementById('statusFilter').value;
+    const dateFilter = document.getElementById('dateFilter').value;
+    const [sort, order] = document.getElementById('sortFilter').value.split(':');
+
+    if (searchTerm) params.set('q', searchTerm);
+    if (statusFilter) params.set('status', statusFilter);
+    if (dateFilter) {
+        const since = new Date();
+        switch (dateFilter) {
+            case 'today':
+                since.setHours(0, 0, 0, 0);
+                break;
+            case 'week':
+                since.setTime(since.getTime() - 7 * 24 * 60 * 60 * 1000);
+                break;
+            case 'month':
+                since.setTime(since.getTime() - 30 * 24 * 60 * 60 * 1000);
+                break;
+        }
+        params.set('created_after', since.toISOString());
+    }
+    params.set('sort', sort);
+    params.set('order', order);
+    if (cursor) params.set('cursor', cursor);
+    return params.toString();
+}
+
+let nextCursor = '';
+
+// Load transfers from backend, the next page is appended when more is true
+async function loadTransfers(more = false) {
     const token = checkAuth();
     if (!token) return;
 
     try {
-        const response = await fetch(`${BACKEND_BASE}/auth/transfer/all`, {
+        const response = await fetch(`${BACKEND_BASE}/auth/transfer/all?${transferQuery(more ? nextCursor : '')}`, {
             headers: {
                 'Authorization': `Bearer ${token}`
             }
         });
-        console.log(response,"-response")
 
         if (response.ok) {
             const data = await response.json();
-            transfers = data.data || [];
-            console.log("transfers-",transfers)
-            
-            // Add mock data for demonstration
-            if (transfers.length === 0) {
-                transfers =[];
-            }
-            
+            const page = data.data || {};
+            transfers = more ? transfers.concat(page.transfers || []) : (page.transfers || []);
+            nextCursor = page.next_cursor || '';
+            document.getElementById('loadMoreButton').style.display = nextCursor ? 'inline-block' : 'none';
+
             filteredTransfers = [...transfers];
             displayTransfers();
         } else {
@@ -85,7 +114,13 @@ async function loadTransfers() {
     document.getElementById('loadingState').style.display = 'none';
 }
 
+function loadMoreTransfers() {
+    loadTransfers(true);
+}
+
 function FindExpiry(expiryTimeStr) {
+    // Transfers without an expiry come with the zero time
+    if (!expiryTimeStr || expiryTimeStr.startsWith('0001-')) return 'Never';
     // Ensure expiryTime is in milliseconds
     const expiryTime = new Date(expiryTimeStr).getTime(); 
     if (expiryTime < 1e12) expiryTime *= 1000;
@@ -126,9 +161,10 @@ function displayTransfers() {
     grid.style.display = 'grid';
 
     grid.innerHTML = filteredTransfers.map(transfer => {
-        const status = getTransferStatus(transfer.created_at, transfer.expiry);
-        // const shareUrl = `/share/${transferId}`;
-        const shareLink = `${window.location.origin}/share/${transfer.id}`;
+        const status = transfer.trashed_at ? 'trashed' : getTransferStatus(transfer.created_at, transfer.expiry);
+        const links = transfer.links || [];
+        const activeLink = links.find(link => link.enabled);
+        const shareLink = activeLink ? `${window.location.origin}${activeLink.url}` : '';
         
         return `
             <div class="transfer-card">
@@ -157,7 +193,7 @@ function displayTransfers() {
                     </div>
                     <div class="info-item">
                         <div class="info-label">Downloads</div>
-                        <div class="info-value">${transfer.download_count} times</div>
+                        <div class="info-value" title="${transfer.last_download_at ? 'Last download ' + formatDate(transfer.last_download_at) : 'Never downloaded'}">${transfer.download_count} times (${transfer.completed_downloads} completed)</div>
                     </div>
                     <div class="info-item">
                         <div class="info-label">Expires</div>
@@ -165,13 +201,60 @@ function displayTransfers() {
                     </div>
                 </div>
 
+                <div class="transfer-links">
+                    ${links.map(link => `
+                        <div class="info-item">
+                            <div class="info-label">${link.label || 'Link'}${link.enabled ? '' : ' (disabled)'}</div>
+                            <div class="info-value">
+                                ${link.download_count} downloads${link.downloads_left !== undefined ? `, ${link.downloads_left} left` : ''}${link.expires_at ? `, expires ${formatDate(link.expires_at)}` : ''}
+                                <button class="btn btn-outline btn-sm" onclick="copyShareLink('${window.location.origin}${link.url}')">Copy</button>
+                                <button class="btn btn-danger btn-sm" onclick="revokeLink('${link.id}')">Revoke</button>
+                            </div>
+                        </div>
+                    `).join('')}
+                    <button class="btn btn-outline btn-sm" onclick="createLink('${transfer.id}')">
+                        ➕ New Link
+                    </button>
+                </div>
+
+                ${transfer.private ? `
+                    <div class="transfer-links">
+                        ${(transfer.recipients || []).map(recipient => `
+                            <div class="info-item">
+                                <div class="info-label">${recipient.email}${recipient.registered ? ' (registered)' : ''}</div>
+                                <div class="info-value">
+                                    ${recipient.status}${recipient.last_access_at ? `, last opened ${formatDate(recipient.last_access_at)}` : ''}, ${recipient.completed} downloads
+                                    <button class="btn btn-danger btn-sm" onclick="removeRecipient('${transfer.id}', '${recipient.id}')">Remove</button>
+                                </div>
+                            </div>
+                        `).join('')}
+                        <button class="btn btn-outline btn-sm" onclick="addRecipients('${transfer.id}')">
+                            ➕ Add Recipients
+                        </button>
+                    </div>
+                ` : ''}
+
+                ${transfer.trashed_at ? `
+                <div class="transfer-actions">
+                    <div class="info-value">Deleted for good on ${formatDate(transfer.purge_at)}</div>
+                    <button class="btn btn-primary btn-sm" onclick="restoreTransfer('${transfer.id}')">
+                        ♻️ Restore
+                    </button>
+                    <button class="btn btn-danger btn-sm" onclick="purgeTransfer('${transfer.id}')">
+                        🗑️ Delete Forever
+                    </button>
+                </div>
+                ` : `
                 <div class="transfer-actions">
-                    <button class="btn btn-primary btn-sm" onclick="copyShareLink('${shareLink}')">
+                    <button class="btn btn-primary btn-sm" ${shareLink ? '' : 'disabled'} onclick="copyShareLink('${shareLink}')">
                         🔗 Copy Link
                     </button>
-                    <button class="btn btn-outline btn-sm" onclick="downloadTransfer('${transfer.id}')">
+                    <button class="btn btn-outline btn-sm" ${activeLink ? '' : 'disabled'} onclick="downloadTransfer('${activeLink ? activeLink.token : ''}')">
                         ⬇️ Download
                     </button>
+                    <button class="btn btn-outline btn-sm" onclick="exportDownloadLog('${transfer.id}')">
+                        📊 Download Log
+                    </button>
                     <button class="btn btn-outline btn-sm" onclick="editTransfer('${transfer.id}')">
                         ✏️ Edit
                     </button>
@@ -179,52 +262,18 @@ function displayTransfers() {
                         🗑️ Delete
                     </button>
                 </div>
+                `}
             </div>
         `;
     }).join('');
 }
 
 // Filter transfers
+let filterTimer = null;
 function filterTransfers() {
-    const searchTerm = document.getElementById('searchInput').value.toLowerCase();
-    const statusFilter = document.getElementById('statusFilter').value;
-    const dateFilter = document.getElementById('dateFilter').value;
-
-    filteredTransfers = transfers.filter(transfer => {
-        // Search filter
-        const matchesSearch = !searchTerm || 
-            transfer.message.toLowerCase().includes(searchTerm) ||
-            transfer.id.toLowerCase().includes(searchTerm);
-
-        // Status filter
-        const transferStatus = getTransferStatus(transfer.created_at, transfer.expiry);
-        const matchesStatus = !statusFilter || transferStatus === statusFilter;
-
-        // Date filter
-        let matchesDate = true;
-        if (dateFilter) {
-            const transferDate = new Date(transfer.created_at);
-            const now = new Date();
-            
-            switch (dateFilter) {
-                case 'today':
-                    matchesDate = transferDate.toDateString() === now.toDateString();
-                    break;
-                case 'week':
-                    const weekAgo = new Date(now.getTime() - 7 * 24 * 60 * 60 * 1000);
-                    matchesDate = transferDate >= weekAgo;
-                    break;
-                case 'month':
-                    const monthAgo = new Date(now.getTime() - 30 * 24 * 60 * 60 * 1000);
-                    matchesDate = transferDate >= monthAgo;
-                    break;
-            }
-        }
-
-        return matchesSearch && matchesStatus && matchesDate;
-    });
-
-    displayTransfers();
+    // Wait for the user to stop typing before asking the server
+    clearTimeout(filterTimer);
+    filterTimer = setTimeout(() => loadTransfers(), 300);
 }
 
 // Copy share link
@@ -234,22 +283,162 @@ function copyShareLink(link) {
     });
 }
 
-// Download transfer
-async function downloadTransfer(transferId) {
+// Download transfer through one of its share links
+async function downloadTransfer(linkToken) {
     const token = checkAuth();
     if (!token) return;
 
     try {
-        // In a real implementation, this would download the actual files
-        showToast('Download started for transfer #' + transferId);
-        
-        // Simulate download
-        window.open(`${BACKEND_BASE}/transfer/download/transfer/${transferId}`, '_blank');
+        showToast('Download started');
+        window.open(`${BACKEND_BASE}/transfer/download/transfer/${linkToken}`, '_blank');
     } catch (error) {
         showToast('Download failed: ' + error.message, 'error');
     }
 }
 
+// Add another share link, with its own label, to a transfer
+async function createLink(transferId) {
+    const label = prompt('Label for the new link (e.g. the recipient):', '');
+    if (label === null) return;
+
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/transfer/links/${transferId}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': `Bearer ${token}`
+            },
+            body: JSON.stringify({ label })
+        });
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error?.message || 'Failed to create link');
+
+        const transfer = transfers.find(t => t.id === transferId);
+        if (transfer) {
+            transfer.links = [...(transfer.links || []), data.data];
+            filterTransfers();
+        }
+        copyShareLink(`${window.location.origin}${data.data.url}`);
+    } catch (error) {
+        showToast('Creating link failed: ' + error.message, 'error');
+    }
+}
+
+// Revoke a share link, the transfer's other links keep working
+async function revokeLink(linkId) {
+    if (!confirm('Revoke this link? Anyone using it will lose access.')) {
+        return;
+    }
+
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/transfer/link/${linkId}`, {
+            method: 'DELETE',
+            headers: { 'Authorization': `Bearer ${token}` }
+        });
+        if (!response.ok) throw new Error('Failed to revoke link');
+
+        transfers.forEach(t => {
+            t.links = (t.links || []).filter(link => link.id !== linkId);
+        });
+        filterTransfers();
+        showToast('Link revoked');
+    } catch (error) {
+        showToast('Revoke failed: ' + error.message, 'error');
+    }
+}
+
+// Add recipients to a private transfer, the list is replaced with the server's
+async function addRecipients(transferId) {
+    const input = prompt('Emails of the recipients, separated by commas:', '');
+    if (!input) return;
+    const emails = input.split(',').map(email => email.trim()).filter(Boolean);
+
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/transfer/recipients/${transferId}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': `Bearer ${token}`
+            },
+            body: JSON.stringify({ emails })
+        });
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error?.message || 'Failed to add recipients');
+
+        const transfer = transfers.find(t => t.id === transferId);
+        if (transfer) {
+            transfer.recipients = data.data;
+            filterTransfers();
+        }
+        showToast('Recipients added');
+    } catch (error) {
+        showToast('Adding recipients failed: ' + error.message, 'error');
+    }
+}
+
+async function removeRecipient(transferId, recipientId) {
+    if (!confirm('Remove this recipient? They will lose access to the transfer.')) {
+        return;
+    }
+
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/transfer/recipient/${recipientId}`, {
+            method: 'DELETE',
+            headers: { 'Authorization': `Bearer ${token}` }
+        });
+        if (!response.ok) throw new Error('Failed to remove recipient');
+
+        const transfer = transfers.find(t => t.id === transferId);
+        if (transfer) {
+            transfer.recipients = (transfer.recipients || []).filter(r => r.id !== recipientId);
+            filterTransfers();
+        }
+        showToast('Recipient removed');
+    } catch (error) {
+        showToast('Remove failed: ' + error.message, 'error');
+    }
+}
+
+// Export the download log of a transfer as CSV
+async function exportDownloadLog(transferId) {
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/transfer/analytics/${transferId}/export`, {
+            headers: {
+                'Authorization': `Bearer ${token}`
+            }
+        });
+        if (!response.ok) {
+            throw new Error('Failed to export download log');
+        }
+        const blob = await response.blob();
+        const url = URL.createObjectURL(blob);
+        const link = document.createElement('a');
+        link.href = url;
+        link.download = `${transferId}-downloads.csv`;
+        document.body.appendChild(link);
+        link.click();
+        document.body.removeChild(link);
+        URL.revokeObjectURL(url);
+    } catch (error) {
+        showToast('Export failed: ' + error.message, 'error');
+    }
+}
+
 // Edit transfer
 function editTransfer(transferId) {
     const transfer = transfers.find(t => t.id === transferId);
@@ -257,10 +446,46 @@ function editTransfer(transferId) {
 
     currentEditingId = transferId;
     document.getElementById('editMessage').value = transfer.message || '';
-    document.getElementById('editExpiry').value = transfer.expiry;
+    // Left on keep, the expiry is not sent
+    document.getElementById('editExpiry').value = '';
+    document.getElementById('editPassword').value = '';
+    document.getElementById('editRemovePassword').checked = false;
+    document.getElementById('removePasswordLabel').style.display = transfer.password_protected ? '' : 'none';
+    document.getElementById('editPrivate').checked = !!transfer.private;
     document.getElementById('editModal').classList.add('active');
 }
 
+// Fill the edit expiry select with the presets the user's plan allows
+async function loadExpiryOptions() {
+    const token = checkAuth();
+    if (!token) return;
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/transfer/expiry-policy`, {
+            headers: { 'Authorization': `Bearer ${token}` }
+        });
+        if (!response.ok) return;
+        const policy = (await response.json()).data;
+        const select = document.getElementById('editExpiry');
+        select.innerHTML = '';
+        select.add(new Option('Keep current', ''));
+        policy.presets.forEach(preset => select.add(new Option(formatExpirySeconds(preset.seconds) + ' from now', preset.name)));
+        if (policy.never_allowed) select.add(new Option('Never', 'never'));
+    } catch (error) {
+        // The built-in options stay
+    }
+}
+
+function formatExpirySeconds(seconds) {
+    const units = [['week', 604800], ['day', 86400], ['hour', 3600], ['minute', 60]];
+    for (const [unit, size] of units) {
+        if (seconds >= size && seconds % size === 0) {
+            const count = seconds / size;
+            return `${count} ${unit}${count === 1 ? '' : 's'}`;
+        }
+    }
+    return `${seconds} seconds`;
+}
+
 // Close edit modal
 function closeEditModal() {
     document.getElementById('editModal').classList.remove('active');
@@ -278,9 +503,17 @@ document.getElementById('editForm').addEventListener('submit', async (e) => {
     const formData = {
         "transfer_id":currentEditingId,
         message: document.getElementById('editMessage').value,
-        expiry: document.getElementById('editExpiry').value
+        expiry: document.getElementById('editExpiry').value,
+        private: document.getElementById('editPrivate').checked
     };
-    console.log(formData)
+    // Left out keeps the current password, an empty one removes it
+    const newPassword = document.getElementById('editPassword').value;
+    const passwordChange = {};
+    if (document.getElementById('editRemovePassword').checked) {
+        passwordChange.password = '';
+    } else if (newPassword) {
+        passwordChange.password = newPassword;
+    }
 
     try {
         const response = await fetch(`${BACKEND_BASE}/auth/transfer/update`, {
@@ -289,7 +522,7 @@ document.getElementById('editForm').addEventListener('submit', async (e) => {
                 'Content-Type': 'application/json',
                 'Authorization': `Bearer ${token}`
             },
-            body: JSON.stringify(formData)
+            body: JSON.stringify({ ...formData, ...passwordChange })
         });
 
         if (response.ok) {
@@ -297,6 +530,9 @@ document.getElementById('editForm').addEventListener('submit', async (e) => {
             const transferIndex = transfers.findIndex(t => t.id === currentEditingId);
             if (transferIndex !== -1) {
                 transfers[transferIndex] = { ...transfers[transferIndex], ...formData };
+                if (passwordChange.password !== undefined) {
+                    transfers[transferIndex].password_protected = passwordChange.password !== '';
+                }
                 filterTransfers();
             }
             
@@ -312,7 +548,7 @@ document.getElementById('editForm').addEventListener('submit', async (e) => {
 
 // Delete transfer
 async function deleteTransfer(transferId) {
-    if (!confirm('Are you sure you want to delete this transfer? This action cannot be undone.')) {
+    if (!confirm('Move this transfer to the trash? You can restore it until it is deleted for good.')) {
         return;
     }
 
@@ -331,7 +567,7 @@ async function deleteTransfer(transferId) {
             // Remove from local data
             transfers = transfers.filter(t => t.id !== transferId);
             filterTransfers();
-            showToast('Transfer deleted successfully!');
+            showToast('Transfer moved to the trash');
         } else {
             throw new Error('Failed to delete transfer');
         }
@@ -340,6 +576,218 @@ async function deleteTransfer(transferId) {
     }
 }
 
+// Take a transfer out of the trash, expired ones need a new expiry
+async function restoreTransfer(transferId, expiry) {
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/transfer/restore/${transferId}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': `Bearer ${token}`
+            },
+            body: JSON.stringify(expiry ? { expiry } : {})
+        });
+        const result = await response.json();
+        if (response.ok) {
+            transfers = transfers.filter(t => t.id !== transferId);
+            filterTransfers();
+            showToast('Transfer restored');
+            return;
+        }
+        if (response.status === 400 && !expiry) {
+            const newExpiry = prompt('This transfer has expired. New expiry (for example 3d, P7D or an RFC 3339 date):');
+            if (newExpiry) restoreTransfer(transferId, newExpiry.trim());
+            return;
+        }
+        throw new Error(result.error?.message || 'Failed to restore transfer');
+    } catch (error) {
+        showToast('Restore failed: ' + error.message, 'error');
+    }
+}
+
+// Delete a trashed transfer for good
+async function purgeTransfer(transferId) {
+    if (!confirm('Delete this transfer for good? This action cannot be undone.')) {
+        return;
+    }
+
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/transfer/trash/${transferId}`, {
+            method: 'DELETE',
+            headers: {
+                'Authorization': `Bearer ${token}`
+            }
+        });
+        if (response.ok) {
+            transfers = transfers.filter(t => t.id !== transferId);
+            filterTransfers();
+            showToast('Transfer deleted for good');
+        } else {
+            const result = await response.json();
+            throw new Error(result.error?.message || 'Failed to delete transfer');
+        }
+    } catch (error) {
+        showToast('Delete failed: ' + error.message, 'error');
+    }
+}
+
+const NOTIFICATION_LABELS = {
+    first_download: 'First download of a transfer',
+    all_downloaded: 'All files of a transfer downloaded',
+    expired_unused: 'Transfer expired without downloads'
+};
+
+// Load the unread count shown on the notifications button
+async function loadUnreadCount() {
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/notifications?unread=true&limit=1`, {
+            headers: { 'Authorization': `Bearer ${token}` }
+        });
+        if (!response.ok) throw new Error('Failed to load notifications');
+        const data = await response.json();
+        const unread = data.data.unread;
+        document.getElementById('unreadCount').textContent = unread > 0 ? `(${unread})` : '';
+    } catch (error) {
+        console.error('Error loading notifications:', error);
+    }
+}
+
+async function openNotifications() {
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const [listResponse, preferencesResponse] = await Promise.all([
+            fetch(`${BACKEND_BASE}/auth/notifications`, { headers: { 'Authorization': `Bearer ${token}` } }),
+            fetch(`${BACKEND_BASE}/auth/notifications/preferences`, { headers: { 'Authorization': `Bearer ${token}` } })
+        ]);
+        if (!listResponse.ok || !preferencesResponse.ok) throw new Error('Failed to load notifications');
+        const list = (await listResponse.json()).data;
+        const preferences = (await preferencesResponse.json()).data;
+
+        const listEl = document.getElementById('notificationsList');
+        listEl.replaceChildren();
+        if (list.notifications.length === 0) {
+            const empty = document.createElement('li');
+            empty.textContent = 'No notifications yet';
+            listEl.appendChild(empty);
+        }
+        list.notifications.forEach(notification => {
+            const item = document.createElement('li');
+            if (!notification.read) item.classList.add('unread');
+            const subject = document.createElement('div');
+            subject.className = 'notification-subject';
+            subject.textContent = notification.subject;
+            const message = document.createElement('div');
+            message.textContent = notification.message;
+            const meta = document.createElement('div');
+            meta.className = 'notification-meta';
+            meta.textContent = formatDate(notification.created_at);
+            item.append(subject, message, meta);
+            item.addEventListener('click', () => markNotificationRead(notification.id, item));
+            listEl.appendChild(item);
+        });
+
+        const body = document.getElementById('preferencesBody');
+        body.replaceChildren();
+        preferences.forEach(preference => {
+            const row = document.createElement('tr');
+            row.dataset.kind = preference.kind;
+            const label = document.createElement('td');
+            label.textContent = NOTIFICATION_LABELS[preference.kind] || preference.kind;
+            row.appendChild(label);
+            ['email', 'in_app'].forEach(channel => {
+                const cell = document.createElement('td');
+                const checkbox = document.createElement('input');
+                checkbox.type = 'checkbox';
+                checkbox.name = channel;
+                checkbox.checked = preference[channel];
+                cell.appendChild(checkbox);
+                row.appendChild(cell);
+            });
+            body.appendChild(row);
+        });
+
+        document.getElementById('notificationsModal').classList.add('active');
+    } catch (error) {
+        showToast(error.message, 'error');
+    }
+}
+
+function closeNotifications() {
+    document.getElementById('notificationsModal').classList.remove('active');
+}
+
+async function markNotificationRead(notificationId, item) {
+    if (!item.classList.contains('unread')) return;
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/notifications/${notificationId}/read`, {
+            method: 'POST',
+            headers: { 'Authorization': `Bearer ${token}` }
+        });
+        if (!response.ok) throw new Error('Failed to mark notification read');
+        item.classList.remove('unread');
+        loadUnreadCount();
+    } catch (error) {
+        showToast(error.message, 'error');
+    }
+}
+
+async function markAllNotificationsRead() {
+    const token = checkAuth();
+    if (!token) return;
+
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/notifications/read`, {
+            method: 'POST',
+            headers: { 'Authorization': `Bearer ${token}` }
+        });
+        if (!response.ok) throw new Error('Failed to mark notifications read');
+        document.querySelectorAll('#notificationsList li.unread').forEach(item => item.classList.remove('unread'));
+        loadUnreadCount();
+    } catch (error) {
+        showToast(error.message, 'error');
+    }
+}
+
+document.getElementById('preferencesForm').addEventListener('submit', async (e) => {
+    e.preventDefault();
+    const token = checkAuth();
+    if (!token) return;
+
+    const preferences = [...document.querySelectorAll('#preferencesBody tr')].map(row => ({
+        kind: row.dataset.kind,
+        email: row.querySelector('input[name="email"]').checked,
+        in_app: row.querySelector('input[name="in_app"]').checked
+    }));
+    try {
+        const response = await fetch(`${BACKEND_BASE}/auth/notifications/preferences`, {
+            method: 'PUT',
+            headers: {
+                'Authorization': `Bearer ${token}`,
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ preferences })
+        });
+        if (!response.ok) throw new Error('Failed to save preferences');
+        showToast('Preferences saved');
+    } catch (error) {
+        showToast(error.message, 'error');
+    }
+});
+
 // Show toast notification
 function showToast(message, type = 'success') {
     // Simple toast implementation
@@ -367,6 +815,7 @@ function showToast(message, type = 'success') {
 document.getElementById('searchInput').addEventListener('input', filterTransfers);
 document.getElementById('statusFilter').addEventListener('change', filterTransfers);
 document.getElementById('dateFilter').addEventListener('change', filterTransfers);
+document.getElementById('sortFilter').addEventListener('change', filterTransfers);
 
 // Close modal when clicking outside
 document.getElementById('editModal').addEventListener('click', (e) => {
@@ -375,7 +824,15 @@ document.getElementById('editModal').addEventListener('click', (e) => {
     }
 });
 
+document.getElementById('notificationsModal').addEventListener('click', (e) => {
+    if (e.target === e.currentTarget) {
+        closeNotifications();
+    }
+});
+
 // Initialize
 document.addEventListener('DOMContentLoaded', () => {
     loadTransfers();
+    loadExpiryOptions();
+    loadUnreadCount();
 });
@@ -1,185 +1,124 @@
 package utils
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
+	"large_fss/internals/archive"
 	"large_fss/internals/storage"
-	"net/http"
-	"path"
+	"mime"
 	"path/filepath"
-	"time"
-)
-
-func ParseExpiry(expiryStr *string) (*time.Time, error) {
-	if *expiryStr == "never" {
-		// Represents "never expires"
-		return nil, nil
-	}
+	"sort"
+	"strings"
 
-	now := time.Now().UTC()
-	var expiry time.Time
-
-	switch *expiryStr {
-	case "5m":
-		expiry = now.Add(5 * time.Minute)
-	case "3h":
-		expiry = now.Add(3 * time.Hour)
-	case "12h":
-		expiry = now.Add(12 * time.Hour)
-	case "1d":
-		expiry = now.Add(24 * time.Hour)
-	case "3d":
-		expiry = now.Add(72 * time.Hour)
-	case "1w":
-		expiry = now.Add(7 * 24 * time.Hour)
-	default:
-		return nil, errors.New("parse expiry:invalid expiry value")
-	}
+	"github.com/gabriel-vasile/mimetype"
+)
 
-	return &expiry, nil
+// CreateZip compresses a folder into a zip file at outputZipPath.
+func CreateZip(ctx context.Context, storage storage.Storage, folderPath string, outputZipPath string) error {
+	return CreateArchive(ctx, storage, folderPath, outputZipPath, archive.FormatZip)
 }
 
-func Unzip(ctx context.Context, storage storage.Storage, srcPath string, destPath string) error {
-	// Open the zip file using the storage interface
-	srcReader, err := storage.ReadFile(ctx, srcPath)
-	if err != nil {
-		return fmt.Errorf("unzip util:failed to open zip file from storage: %w", err)
-	}
-	defer srcReader.Close()
-
-	// Read all bytes of the zip file
-	zipBytes, err := io.ReadAll(srcReader)
-	if err != nil {
-		return fmt.Errorf("unzip util:failed to read zip file: %w", err)
-	}
-
-	// Create a zip reader from the bytes
-	zipReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+// CreateArchive packs a folder into an archive of the given format at outputPath.
+func CreateArchive(ctx context.Context, storage storage.Storage, folderPath string, outputPath string, format archive.Format) error {
+	// Get list of all files and directories inside the folder
+	files, err := storage.ListFilesRecursive(ctx, folderPath)
 	if err != nil {
-		return fmt.Errorf("unzip util:failed to create zip reader: %w", err)
+		return fmt.Errorf("create archive util:failed to list folder contents: %w", err)
 	}
 
-	// Iterate over files in zip
-	for _, f := range zipReader.File {
-		fPath := path.Join(destPath, f.Name)
-		
-
-		if f.FileInfo().IsDir() {
-			err := storage.CreateFolder(ctx, fPath)
-			fmt.Println("unzip creating folder -",f)
-			if err != nil {
-				return fmt.Errorf("unzip util:failed to create folder %s: %w", fPath, err)
-			}
-			continue
-		}
-
-		// Open the file inside the zip
-		fileInZip, err := f.Open()
-		if err != nil {
-			return fmt.Errorf("unzip util:failed to open file %s in zip: %w", f.Name, err)
-		}
-
-		// Create destination file in storage
-		writer, err := storage.WriteFile(ctx, fPath)
+	entries := make([]archive.Entry, 0, len(files))
+	for _, file := range files {
+		relPath, err := filepath.Rel(folderPath, file.Path)
 		if err != nil {
-			fileInZip.Close()
-			return fmt.Errorf("unzip util:failed to create file %s in storage: %w", fPath, err)
+			return fmt.Errorf("create archive util:failed to compute relative path: %w", err)
 		}
-
-		// Copy the content
-		_, err = io.Copy(writer, fileInZip)
-		fileInZip.Close()
-		writer.Close()
-
-		if err != nil {
-			return fmt.Errorf("unzip util:failed to copy contents to %s: %w", fPath, err)
+		name := filepath.ToSlash(relPath)
+		if file.IsDir {
+			entries = append(entries, archive.Entry{Name: name + "/", Modified: file.ModTime})
+			continue
 		}
+		// Checksums are taken while the content is written
+		entries = append(entries, archive.Entry{
+			Name:     name,
+			Path:     file.Path,
+			Size:     file.Size,
+			Modified: file.ModTime,
+			NoCRC32:  true,
+		})
 	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
 
-	return nil
-}
-
-// CreateZipFromFolder takes a folder path, compresses it into a zip, and returns the zip file path.
-func CreateZip(ctx context.Context, storage storage.Storage, folderPath string, outputZipPath string) error {
-	// Ensure output zip file is created
-	err := storage.CreateFile(ctx, outputZipPath)
+	archiveWriter, err := archive.NewWriter(format, entries)
 	if err != nil {
-		return fmt.Errorf("create zip util:failed to create zip file: %w", err)
+		return fmt.Errorf("create archive util: %w", err)
 	}
 
-	// Open the zip file for writing
-	zipWriterCloser, err := storage.WriteFile(ctx, outputZipPath)
+	// Ensure output file is created
+	err = storage.CreateFile(ctx, outputPath)
 	if err != nil {
-		return fmt.Errorf("create zip util:failed to open zip file for writing: %w", err)
+		return fmt.Errorf("create archive util:failed to create archive file: %w", err)
 	}
-	defer zipWriterCloser.Close()
-
-	zipWriter := zip.NewWriter(zipWriterCloser)
-	defer zipWriter.Close()
-
-	// Get list of all files and directories inside the folder
-	files, err := storage.ListFilesRecursive(ctx, folderPath)
+	writer, err := storage.WriteFile(ctx, outputPath)
 	if err != nil {
-		return fmt.Errorf("create zip util:failed to list folder contents: %w", err)
+		return fmt.Errorf("create archive util:failed to open archive file for writing: %w", err)
 	}
+	err = archiveWriter.WriteTo(ctx, storage, writer)
+	closeErr := writer.Close()
+	if err != nil {
+		return fmt.Errorf("create archive util:failed to write archive: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("create archive util:failed to close archive file: %w", closeErr)
+	}
+	return nil
+}
 
-	for _, file := range files {
-		fmt.Println(folderPath,"-",file.Path)
-		relPath, err := filepath.Rel(folderPath, file.Path)
-		fmt.Println("rel path-",relPath)
-		if err != nil {
-			return fmt.Errorf("create zip util:failed to compute relative path: %w", err)
-		}
-
-		if file.IsDir {
-			// Add directory with trailing slash
-			_, err := zipWriter.Create(relPath + "/")
-			if err != nil {
-				return fmt.Errorf("create zip util:failed to add directory to zip: %w", err)
-			}
-			continue
-		}
-
-		// Read file from storage
-		reader, err := storage.ReadFile(ctx, file.Path)
-		if err != nil {
-			return fmt.Errorf("create zip util:failed to read file %s: %w", file.Path, err)
-		}
-
-		writer, err := zipWriter.Create(relPath)
-		if err != nil {
-			reader.Close()
-			return fmt.Errorf("create zip util:failed to create zip entry for %s: %w", relPath, err)
+// ContentDisposition builds a Content-Disposition header per RFC 6266. The plain
+// filename is an ASCII fallback for old clients, filename* carries the real name
+// percent-encoded as UTF-8 per RFC 5987.
+func ContentDisposition(dispositionType string, filename string) string {
+	var fallback, encoded strings.Builder
+	for _, r := range filename {
+		switch {
+		case r < 0x20 || r == 0x7f || r == '"' || r == '\\' || r > 0x7e:
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
 		}
-
-		_, err = io.Copy(writer, reader)
-		reader.Close()
-		if err != nil {
-			return fmt.Errorf("create zip util:failed to write file %s to zip: %w", relPath, err)
+	}
+	for _, b := range []byte(filename) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
 		}
 	}
-
-	return nil
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", dispositionType, fallback.String(), encoded.String())
 }
 
-func DetectContentTypeFromReader(r io.ReadCloser) (string, error) {
-
-	buffer := &bytes.Buffer{}
-	tee := io.TeeReader(io.LimitReader(r, 512), buffer)
-
-	// Read 512 bytes
-	buf := make([]byte, 512)
-	_, err := io.ReadFull(tee, buf)
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-		return "",fmt.Errorf("detect content type util:error in reading content %w", err)
+// isAttrChar reports whether b may appear unencoded in an RFC 5987 value.
+func isAttrChar(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
 	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
 
-	contentType := http.DetectContentType(buf)
+// DetectContentTypeFromReader sniffs the MIME type from the leading bytes of the
+// content, the file name is never consulted. Parameters such as charset are dropped.
+func DetectContentTypeFromReader(r io.Reader) (string, error) {
+	detected, err := mimetype.DetectReader(r)
+	if err != nil {
+		return "", fmt.Errorf("detect content type util:error in reading content %w", err)
+	}
 
-	// Optionally return a new reader with full contents if needed
+	contentType, _, err := mime.ParseMediaType(detected.String())
+	if err != nil {
+		return detected.String(), nil
+	}
 	return contentType, nil
 }